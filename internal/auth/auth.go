@@ -4,14 +4,18 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/photocore/photocore/internal/config"
+	"github.com/photocore/photocore/internal/logger"
 	"github.com/photocore/photocore/internal/storage"
 )
 
@@ -93,8 +97,9 @@ func IsAdmin(role string) bool {
 
 // Auth управляет аутентификацией пользователей
 type Auth struct {
-	cfg   *config.Config
-	store *storage.Store
+	cfg     *config.Config
+	store   *storage.Store
+	limiter *LoginLimiter
 }
 
 // NewAuth создает новый сервис аутентификации
@@ -102,6 +107,23 @@ func NewAuth(cfg *config.Config, store *storage.Store) *Auth {
 	return &Auth{
 		cfg:   cfg,
 		store: store,
+		limiter: NewLoginLimiter(
+			cfg.Auth.LoginMaxAttempts,
+			time.Duration(cfg.Auth.LoginWindow)*time.Second,
+			time.Duration(cfg.Auth.LoginLockout)*time.Second,
+		),
+	}
+}
+
+// CanViewGeo проверяет право на просмотр карты и GPS координат (задается Server.GeoVisibility)
+func (a *Auth) CanViewGeo(role string) bool {
+	switch a.cfg.Server.GeoVisibility {
+	case storage.RoleAdmin:
+		return role == storage.RoleAdmin
+	case storage.RoleEditor:
+		return role == storage.RoleAdmin || role == storage.RoleEditor
+	default:
+		return true
 	}
 }
 
@@ -114,6 +136,48 @@ func (a *Auth) HashPassword(password string) (string, error) {
 	return string(hash), nil
 }
 
+// ValidatePassword проверяет пароль на соответствие требованиям из конфигурации
+func (a *Auth) ValidatePassword(password string) error {
+	policy := a.cfg.Auth
+	if utf8.RuneCountInString(password) < policy.PasswordMinLength {
+		return fmt.Errorf("password must be at least %d characters long", policy.PasswordMinLength)
+	}
+
+	var hasDigit, hasLetter, hasUpper, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsLetter(r):
+			hasLetter = true
+			if unicode.IsUpper(r) {
+				hasUpper = true
+			}
+		default:
+			hasSpecial = true
+		}
+	}
+
+	if policy.PasswordRequireDigit && !hasDigit {
+		return fmt.Errorf("password must contain at least one digit")
+	}
+	if policy.PasswordRequireLetter && !hasLetter {
+		return fmt.Errorf("password must contain at least one letter")
+	}
+	if policy.PasswordRequireUpper && !hasUpper {
+		return fmt.Errorf("password must contain at least one uppercase letter")
+	}
+	if policy.PasswordRequireSpecial && !hasSpecial {
+		return fmt.Errorf("password must contain at least one special character")
+	}
+	return nil
+}
+
+// CheckPassword сверяет пароль с bcrypt хешем
+func (a *Auth) CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
 // EnsureAdminUser создает администратора если его нет
 func (a *Auth) EnsureAdminUser() error {
 	// Проверяем, существует ли админ
@@ -126,6 +190,11 @@ func (a *Auth) EnsureAdminUser() error {
 		return nil // Админ уже существует
 	}
 
+	// Пароль начального админа задается в конфиге: не блокируем запуск, только предупреждаем
+	if err := a.ValidatePassword(a.cfg.Auth.AdminPassword); err != nil {
+		logger.InfoLog.Printf("Warning: admin password does not meet password policy (%v), change it after first login", err)
+	}
+
 	// Создаем нового админа
 	hash, err := bcrypt.GenerateFromPassword([]byte(a.cfg.Auth.AdminPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -148,18 +217,23 @@ func (a *Auth) EnsureAdminUser() error {
 }
 
 // Login выполняет аутентификацию пользователя
-func (a *Auth) Login(username, password string) (*storage.Session, error) {
+func (a *Auth) Login(username, password, ip string) (*storage.Session, error) {
+	// Блокировка проверяется до поиска пользователя и не зависит от его существования
+	if wait := a.limiter.Check(username, ip); wait > 0 {
+		return nil, &LockoutError{RetryAfter: wait}
+	}
+
 	user, err := a.store.GetUser(username)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
-	if user == nil {
-		return nil, fmt.Errorf("invalid credentials")
-	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+	if user == nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		if wait := a.limiter.Fail(username, ip); wait > 0 {
+			return nil, &LockoutError{RetryAfter: wait}
+		}
 		return nil, fmt.Errorf("invalid credentials")
 	}
+	a.limiter.Reset(username, ip)
 
 	// Обновляем время последнего входа
 	user.LastLogin = time.Now()
@@ -214,11 +288,16 @@ func (a *Auth) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Сначала проверяем Authorization header (для API и PWA)
 		authHeader := r.Header.Get("Authorization")
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			token := strings.TrimPrefix(authHeader, "Bearer ")
+		if len(authHeader) > 7 && strings.EqualFold(authHeader[:7], "Bearer ") {
+			token := strings.TrimSpace(authHeader[7:])
 
 			apiToken, err := a.ValidateAPIToken(token)
 			if err == nil && apiToken != nil {
+				if !apiToken.HasScope(RequiredScope(r)) {
+					forbiddenJSON(w, "token scope does not allow this request")
+					return
+				}
+
 				// Создаем псевдо-сессию из токена
 				session := &storage.Session{
 					ID:       apiToken.Token,
@@ -233,20 +312,21 @@ func (a *Auth) Middleware(next http.Handler) http.Handler {
 			}
 
 			// Bearer токен невалидный
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="photocore", error="invalid_token"`)
+			unauthorizedJSON(w)
 			return
 		}
 
 		// Fallback на cookie-based аутентификацию
 		cookie, err := r.Cookie("session")
 		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusFound)
+			unauthorized(w, r)
 			return
 		}
 
 		session, err := a.ValidateSession(cookie.Value)
 		if err != nil || session == nil {
-			http.Redirect(w, r, "/login", http.StatusFound)
+			unauthorized(w, r)
 			return
 		}
 
@@ -256,13 +336,49 @@ func (a *Auth) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// unauthorized отвечает неаутентифицированному запросу: API-клиентам и HTMX — 401 JSON,
+// браузеру — редирект на страницу входа
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	isHTMX := r.Header.Get("HX-Request") == "true"
+	if isHTMX || isAPIRequest(r) {
+		if isHTMX {
+			w.Header().Set("HX-Redirect", "/login") // HTMX перейдет на страницу входа
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="photocore"`)
+		unauthorizedJSON(w)
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+// isAPIRequest запрос от скрипта (API, WebSocket, сборщик метрик), а не переход
+// по странице: HTML входа ему бесполезен
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/ws/") ||
+		r.URL.Path == "/metrics"
+}
+
+// unauthorizedJSON пишет 401 в формате ошибок API
+func unauthorizedJSON(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`{"error":"unauthorized","code":"unauthorized"}`))
+}
+
+// forbiddenJSON пишет 403 в формате ошибок API
+func forbiddenJSON(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": message, "code": "forbidden"})
+}
+
 // RequireRole создает middleware для проверки роли
 func (a *Auth) RequireRole(roles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			session := GetSession(r)
 			if session == nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				unauthorizedJSON(w)
 				return
 			}
 
@@ -275,7 +391,7 @@ func (a *Auth) RequireRole(roles ...string) func(http.Handler) http.Handler {
 			}
 
 			if !allowed {
-				http.Error(w, "Forbidden", http.StatusForbidden)
+				forbiddenJSON(w, "role "+session.Role+" is not allowed")
 				return
 			}
 
@@ -292,8 +408,30 @@ func generateID() string {
 
 // === API Token Authentication ===
 
-// GenerateAPIToken создает токен для мобильного клиента
-func (a *Auth) GenerateAPIToken(userID, username, role, deviceName string) (*storage.APIToken, error) {
+// DefaultAPITokenTTL срок действия API токена, если не задан при создании
+const DefaultAPITokenTTL = 180 * 24 * time.Hour
+
+// RequiredScope возвращает область доступа, нужную API токену для запроса:
+// чтение — read, загрузка файлов — upload, остальные изменения — admin.
+// Область зависит от метода, поэтому GET маршруты не должны ничего менять.
+func RequiredScope(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return storage.ScopeRead
+	}
+	if r.URL.Path == "/api/upload" {
+		return storage.ScopeUpload
+	}
+	return storage.ScopeAdmin
+}
+
+// GenerateAPIToken создает токен для мобильного клиента.
+// ttl 0 — срок по умолчанию (DefaultAPITokenTTL); пустой scopes — все права роли.
+func (a *Auth) GenerateAPIToken(userID, username, role, deviceName string, ttl time.Duration, scopes []string) (*storage.APIToken, error) {
+	if ttl <= 0 {
+		ttl = DefaultAPITokenTTL
+	}
+
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
 		return nil, err
@@ -306,7 +444,8 @@ func (a *Auth) GenerateAPIToken(userID, username, role, deviceName string) (*sto
 		Role:       role,
 		DeviceName: deviceName,
 		CreatedAt:  time.Now(),
-		ExpiresAt:  time.Now().AddDate(0, 6, 0), // 6 месяцев
+		ExpiresAt:  time.Now().Add(ttl),
+		Scopes:     scopes,
 	}
 
 	if err := a.store.SaveAPIToken(token); err != nil {
@@ -326,7 +465,7 @@ func (a *Auth) ValidateAPIToken(token string) (*storage.APIToken, error) {
 		return nil, nil
 	}
 
-	if time.Now().After(apiToken.ExpiresAt) {
+	if apiToken.Expired() {
 		a.store.DeleteAPIToken(token)
 		return nil, nil
 	}
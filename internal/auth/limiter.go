@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LockoutError возвращается Login, пока вход для пары логин+IP заблокирован
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// loginAttempts неудачные попытки входа для одной пары логин+IP
+type loginAttempts struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// LoginLimiter считает неудачные попытки входа в памяти и блокирует вход
+// после maxAttempts неудач в пределах window на время lockout.
+// Ключ не зависит от существования пользователя, поэтому блокировка его не раскрывает.
+type LoginLimiter struct {
+	maxAttempts int
+	window      time.Duration
+	lockout     time.Duration
+
+	mu       sync.Mutex
+	attempts map[string]*loginAttempts
+	now      func() time.Time
+}
+
+// NewLoginLimiter создает счетчик попыток входа
+func NewLoginLimiter(maxAttempts int, window, lockout time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		maxAttempts: maxAttempts,
+		window:      window,
+		lockout:     lockout,
+		attempts:    make(map[string]*loginAttempts),
+		now:         time.Now,
+	}
+}
+
+// limiterKey ключ счетчика попыток
+func limiterKey(username, ip string) string {
+	return username + "|" + ip
+}
+
+// Check возвращает время до снятия блокировки (0 — вход разрешен)
+func (l *LoginLimiter) Check(username, ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Check вызывается при каждом входе: старые записи чистятся, даже если неудач больше нет
+	now := l.now()
+	l.expire(now)
+
+	a, ok := l.attempts[limiterKey(username, ip)]
+	if !ok {
+		return 0
+	}
+	if wait := a.lockedUntil.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Fail учитывает неудачную попытку и возвращает время блокировки, если она наступила
+func (l *LoginLimiter) Fail(username, ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.expire(now)
+
+	key := limiterKey(username, ip)
+	a, ok := l.attempts[key]
+	if !ok || now.Sub(a.windowStart) > l.window {
+		a = &loginAttempts{windowStart: now}
+		l.attempts[key] = a
+	}
+
+	a.failures++
+	if a.failures >= l.maxAttempts {
+		a.lockedUntil = now.Add(l.lockout)
+		a.failures = 0
+		a.windowStart = now
+		return l.lockout
+	}
+	return 0
+}
+
+// Reset сбрасывает счетчик после успешного входа
+func (l *LoginLimiter) Reset(username, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, limiterKey(username, ip))
+}
+
+// expire забывает записи с истекшим окном и без активной блокировки.
+// В карте только пары с недавними неудачами, поэтому полный проход дешев. Вызывается под l.mu.
+func (l *LoginLimiter) expire(now time.Time) {
+	for key, a := range l.attempts {
+		if now.Sub(a.windowStart) > l.window && now.After(a.lockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeClock управляемое время для LoginLimiter
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(maxAttempts int, window, lockout time.Duration) (*LoginLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLoginLimiter(maxAttempts, window, lockout)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestLoginLimiterLocksAfterMaxFailures(t *testing.T) {
+	l, clock := newTestLimiter(3, 15*time.Minute, 5*time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if wait := l.Fail("admin", "10.0.0.1"); wait != 0 {
+			t.Fatalf("failure %d locked for %v, want no lock yet", i+1, wait)
+		}
+	}
+	if wait := l.Fail("admin", "10.0.0.1"); wait != 5*time.Minute {
+		t.Fatalf("third failure lock = %v, want 5m", wait)
+	}
+	if wait := l.Check("admin", "10.0.0.1"); wait != 5*time.Minute {
+		t.Errorf("check = %v, want 5m", wait)
+	}
+
+	// Другая пара логин+IP не заблокирована
+	if wait := l.Check("admin", "10.0.0.2"); wait != 0 {
+		t.Errorf("other IP locked for %v", wait)
+	}
+
+	clock.advance(5*time.Minute + time.Second)
+	if wait := l.Check("admin", "10.0.0.1"); wait != 0 {
+		t.Errorf("lock still active after lockout: %v", wait)
+	}
+}
+
+func TestLoginLimiterWindowResets(t *testing.T) {
+	l, clock := newTestLimiter(3, 15*time.Minute, 5*time.Minute)
+
+	l.Fail("admin", "10.0.0.1")
+	l.Fail("admin", "10.0.0.1")
+	clock.advance(16 * time.Minute) // Окно истекло — счет начинается заново
+
+	if wait := l.Fail("admin", "10.0.0.1"); wait != 0 {
+		t.Errorf("failure after window locked for %v, want counter reset", wait)
+	}
+
+	l.Fail("admin", "10.0.0.1")
+	l.Reset("admin", "10.0.0.1") // Успешный вход сбрасывает счетчик
+	if wait := l.Fail("admin", "10.0.0.1"); wait != 0 {
+		t.Errorf("failure after reset locked for %v", wait)
+	}
+}
+
+func TestLoginLimiterEvictsExpiredEntries(t *testing.T) {
+	l, clock := newTestLimiter(3, 15*time.Minute, 5*time.Minute)
+
+	for i := 0; i < 100; i++ {
+		l.Fail("user", fmt.Sprintf("10.0.1.%d", i))
+	}
+	if len(l.attempts) != 100 {
+		t.Fatalf("entries = %d, want 100", len(l.attempts))
+	}
+
+	clock.advance(time.Hour)
+	l.Check("someone", "10.0.0.1")
+	if len(l.attempts) != 0 {
+		t.Errorf("entries after expiry = %d, want 0", len(l.attempts))
+	}
+}
+
+func TestLoginLimiterEvictsOnEveryCheck(t *testing.T) {
+	l, clock := newTestLimiter(2, 30*time.Second, 45*time.Second)
+
+	l.Fail("alice", "10.0.0.1")
+	l.Fail("bob", "10.0.0.2")
+	l.Fail("bob", "10.0.0.2") // bob заблокирован на 45s
+
+	// Окно короче минуты: запись alice забывается на первой же проверке после него
+	clock.advance(31 * time.Second)
+	l.Check("someone", "10.0.0.9")
+	if _, ok := l.attempts[limiterKey("alice", "10.0.0.1")]; ok {
+		t.Error("expired alice entry survived the check")
+	}
+	// Активная блокировка не снимается вместе с окном
+	if wait := l.Check("bob", "10.0.0.2"); wait != 14*time.Second {
+		t.Errorf("bob lock = %v, want 14s", wait)
+	}
+
+	clock.advance(15 * time.Second)
+	l.Fail("carol", "10.0.0.3")
+	if _, ok := l.attempts[limiterKey("bob", "10.0.0.2")]; ok {
+		t.Error("bob entry survived the failure after lock expiry")
+	}
+	if len(l.attempts) != 1 {
+		t.Errorf("entries = %d, want only carol", len(l.attempts))
+	}
+}
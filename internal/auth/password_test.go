@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePasswordPolicy(t *testing.T) {
+	a, _ := newTestAuth(t)
+	a.cfg.Auth.PasswordMinLength = 8
+	a.cfg.Auth.PasswordRequireDigit = true
+	a.cfg.Auth.PasswordRequireLetter = true
+	a.cfg.Auth.PasswordRequireUpper = true
+	a.cfg.Auth.PasswordRequireSpecial = true
+
+	tests := []struct {
+		password string
+		reject   string // Часть текста ошибки, "" — пароль подходит
+	}{
+		{"Ab1!", "at least 8 characters"},
+		{"Пар0ль!", "at least 8 characters"}, // 7 символов, хотя байт больше
+		{"Abcdefg!", "digit"},
+		{"12345678!", "letter"},
+		{"abcdefg1!", "uppercase"},
+		{"Abcdefg12", "special"},
+		{"Abcdefg1!", ""},
+		{"Пароль-2024", ""},
+	}
+	for _, tt := range tests {
+		err := a.ValidatePassword(tt.password)
+		switch {
+		case tt.reject == "" && err != nil:
+			t.Errorf("%q rejected: %v", tt.password, err)
+		case tt.reject != "" && (err == nil || !strings.Contains(err.Error(), tt.reject)):
+			t.Errorf("%q: err = %v, want rejection for %q", tt.password, err, tt.reject)
+		}
+	}
+
+	// Без дополнительных требований проверяется только длина
+	a.cfg.Auth.PasswordRequireDigit = false
+	a.cfg.Auth.PasswordRequireLetter = false
+	a.cfg.Auth.PasswordRequireUpper = false
+	a.cfg.Auth.PasswordRequireSpecial = false
+	if err := a.ValidatePassword("abcdefgh"); err != nil {
+		t.Errorf("length-only policy rejected abcdefgh: %v", err)
+	}
+}
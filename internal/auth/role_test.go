@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func TestRequireRoleJSONErrors(t *testing.T) {
+	a, _ := newTestAuth(t)
+	h := a.RequireRole(storage.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		name    string
+		session *storage.Session
+		status  int
+		code    string
+	}{
+		{"no session", nil, http.StatusUnauthorized, "unauthorized"},
+		{"wrong role", &storage.Session{ID: "s1", Role: storage.RoleViewer}, http.StatusForbidden, "forbidden"},
+		{"allowed", &storage.Session{ID: "s2", Role: storage.RoleAdmin}, http.StatusOK, ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		if c.session != nil {
+			req = req.WithContext(context.WithValue(req.Context(), SessionKey, c.session))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s: status = %d, want %d", c.name, rec.Code, c.status)
+			continue
+		}
+		if c.code == "" {
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Errorf("%s: content type = %q, want JSON", c.name, ct)
+		}
+		var body struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != c.code || body.Error == "" {
+			t.Errorf("%s: body = %s (%v), want code %s", c.name, rec.Body, err, c.code)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "/api/scan/progress", storage.ScopeRead},
+		{http.MethodHead, "/media/abc", storage.ScopeRead},
+		{http.MethodPost, "/api/upload", storage.ScopeUpload},
+		{http.MethodPost, "/api/scan", storage.ScopeAdmin},
+		{http.MethodPost, "/api/media/abc/colors", storage.ScopeAdmin},
+		{http.MethodDelete, "/api/media/abc", storage.ScopeAdmin},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := RequiredScope(r); got != tt.want {
+			t.Errorf("RequiredScope(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
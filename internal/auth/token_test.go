@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/config"
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// newTestAuth создает Auth над пустой БД во временной директории
+func newTestAuth(tb testing.TB) (*Auth, *storage.Store) {
+	tb.Helper()
+	dir := tb.TempDir()
+	if err := logger.Init(filepath.Join(dir, "logs")); err != nil {
+		tb.Fatal(err)
+	}
+	store, err := storage.NewStore(filepath.Join(dir, "test.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { store.Close() })
+	return NewAuth(&config.Config{}, store), store
+}
+
+// serveWithToken выполняет запрос через Middleware с Bearer токеном
+func serveWithToken(a *Auth, method, path, token string) *httptest.ResponseRecorder {
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestExpiredAPITokenIsRejected(t *testing.T) {
+	a, store := newTestAuth(t)
+	expired := &storage.APIToken{
+		Token:     "expired-token",
+		UserID:    "u1",
+		Username:  "admin",
+		Role:      storage.RoleAdmin,
+		CreatedAt: time.Now().Add(-2 * time.Hour),
+		ExpiresAt: time.Now().Add(-time.Hour),
+	}
+	if err := store.SaveAPIToken(expired); err != nil {
+		t.Fatal(err)
+	}
+
+	if tok, _ := a.ValidateAPIToken(expired.Token); tok != nil {
+		t.Error("expired token validated")
+	}
+	if rec := serveWithToken(a, http.MethodGet, "/api/stats", expired.Token); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expired token status = %d, want 401", rec.Code)
+	}
+	// Просроченный токен считается несуществующим и удаляется
+	if tok, _ := store.GetAPIToken(expired.Token); tok != nil {
+		t.Error("expired token was not deleted")
+	}
+
+	fresh, err := a.GenerateAPIToken("u1", "admin", storage.RoleAdmin, "phone", time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := serveWithToken(a, http.MethodGet, "/api/stats", fresh.Token); rec.Code != http.StatusOK {
+		t.Errorf("valid token status = %d, want 200", rec.Code)
+	}
+}
+
+func TestAPITokenScopeDenied(t *testing.T) {
+	a, _ := newTestAuth(t)
+	token, err := a.GenerateAPIToken("u1", "admin", storage.RoleAdmin, "viewer app", 0, []string{storage.ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := serveWithToken(a, http.MethodGet, "/api/stats", token.Token); rec.Code != http.StatusOK {
+		t.Errorf("read request status = %d, want 200", rec.Code)
+	}
+	rec := serveWithToken(a, http.MethodPost, "/api/scan", token.Token)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("POST /api/scan with read scope = %d, want 403", rec.Code)
+	}
+	if rec = serveWithToken(a, http.MethodPost, "/api/upload", token.Token); rec.Code != http.StatusForbidden {
+		t.Errorf("upload with read scope = %d, want 403", rec.Code)
+	}
+}
+
+func TestUnauthenticatedRequests(t *testing.T) {
+	a, _ := newTestAuth(t)
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(path string, header http.Header) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// API отвечает 401 вместо редиректа на HTML страницу входа
+	rec := serve("/api/stats", nil)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("API without auth = %d, WWW-Authenticate %q; want 401 with challenge", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+	if rec := serve("/api/stats", http.Header{"Hx-Request": {"true"}}); rec.Code != http.StatusUnauthorized || rec.Header().Get("HX-Redirect") != "/login" {
+		t.Errorf("HTMX without auth = %d, HX-Redirect %q; want 401 redirecting to /login", rec.Code, rec.Header().Get("HX-Redirect"))
+	}
+	if rec := serve("/timeline", nil); rec.Code != http.StatusFound || rec.Header().Get("Location") != "/login" {
+		t.Errorf("page without auth = %d to %q, want 302 to /login", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// Схема Bearer принимается в любом регистре
+	token, err := a.GenerateAPIToken("u1", "admin", storage.RoleAdmin, "script", time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scheme := range []string{"Bearer ", "bearer ", "BEARER  "} {
+		if rec := serve("/api/stats", http.Header{"Authorization": {scheme + token.Token}}); rec.Code != http.StatusOK {
+			t.Errorf("%q scheme = %d, want 200", scheme, rec.Code)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package cache
 
 import (
+	"container/list"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -9,6 +11,7 @@ import (
 type Item struct {
 	Value      interface{}
 	Expiration int64
+	key        string // Ключ нужен при вытеснении с конца LRU списка
 }
 
 // IsExpired проверяет, истек ли срок жизни элемента
@@ -19,15 +22,19 @@ func (i *Item) IsExpired() bool {
 	return time.Now().UnixNano() > i.Expiration
 }
 
-// Cache представляет in-memory кэш с TTL
+// Cache представляет in-memory кэш с TTL и вытеснением по LRU
 type Cache struct {
-	items             map[string]*Item
+	items             map[string]*list.Element // Значения элементов — *Item
+	lru               *list.List               // Спереди недавно использованные, сзади — кандидаты на вытеснение
 	mu                sync.RWMutex
 	defaultExpiration time.Duration
 	cleanupInterval   time.Duration
 	stopCleanup       chan struct{}
 	maxItems          int
 	onEvicted         func(key string, value interface{})
+
+	hits   int64
+	misses int64
 }
 
 // Config конфигурация кэша
@@ -51,7 +58,8 @@ func New(config Config) *Cache {
 	}
 
 	c := &Cache{
-		items:             make(map[string]*Item),
+		items:             make(map[string]*list.Element),
+		lru:               list.New(),
 		defaultExpiration: config.DefaultExpiration,
 		cleanupInterval:   config.CleanupInterval,
 		stopCleanup:       make(chan struct{}),
@@ -79,32 +87,47 @@ func (c *Cache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Проверяем лимит и удаляем старые элементы если нужно
+	// Обновление существующего ключа не требует вытеснения
+	if elem, found := c.items[key]; found {
+		item := elem.Value.(*Item)
+		item.Value = value
+		item.Expiration = expiration
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	// Проверяем лимит и удаляем давно не использованный элемент если нужно
 	if len(c.items) >= c.maxItems {
 		c.evictOldest()
 	}
 
-	c.items[key] = &Item{
+	c.items[key] = c.lru.PushFront(&Item{
 		Value:      value,
 		Expiration: expiration,
-	}
+		key:        key,
+	})
 }
 
-// Get получает элемент из кэша
+// Get получает элемент из кэша и отмечает его как недавно использованный
 func (c *Cache) Get(key string) (interface{}, bool) {
-	c.mu.RLock()
-	item, found := c.items[key]
-	c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
+	elem, found := c.items[key]
 	if !found {
+		atomic.AddInt64(&c.misses, 1)
 		return nil, false
 	}
 
+	item := elem.Value.(*Item)
 	if item.IsExpired() {
-		c.Delete(key)
+		c.removeElement(elem)
+		atomic.AddInt64(&c.misses, 1)
 		return nil, false
 	}
 
+	c.lru.MoveToFront(elem)
+	atomic.AddInt64(&c.hits, 1)
 	return item.Value, true
 }
 
@@ -128,11 +151,8 @@ func (c *Cache) Delete(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if item, found := c.items[key]; found {
-		if c.onEvicted != nil {
-			c.onEvicted(key, item.Value)
-		}
-		delete(c.items, key)
+	if elem, found := c.items[key]; found {
+		c.removeElement(elem)
 	}
 }
 
@@ -142,12 +162,13 @@ func (c *Cache) Clear() {
 	defer c.mu.Unlock()
 
 	if c.onEvicted != nil {
-		for key, item := range c.items {
-			c.onEvicted(key, item.Value)
+		for key, elem := range c.items {
+			c.onEvicted(key, elem.Value.(*Item).Value)
 		}
 	}
 
-	c.items = make(map[string]*Item)
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
 }
 
 // Count возвращает количество элементов в кэше
@@ -180,8 +201,8 @@ func (c *Cache) Stats() CacheStats {
 	defer c.mu.RUnlock()
 
 	expired := 0
-	for _, item := range c.items {
-		if item.IsExpired() {
+	for _, elem := range c.items {
+		if elem.Value.(*Item).IsExpired() {
 			expired++
 		}
 	}
@@ -190,14 +211,18 @@ func (c *Cache) Stats() CacheStats {
 		Items:        len(c.items),
 		MaxItems:     c.maxItems,
 		ExpiredItems: expired,
+		Hits:         atomic.LoadInt64(&c.hits),
+		Misses:       atomic.LoadInt64(&c.misses),
 	}
 }
 
 // CacheStats статистика кэша
 type CacheStats struct {
-	Items        int `json:"items"`
-	MaxItems     int `json:"max_items"`
-	ExpiredItems int `json:"expired_items"`
+	Items        int   `json:"items"`
+	MaxItems     int   `json:"max_items"`
+	ExpiredItems int   `json:"expired_items"`
+	Hits         int64 `json:"hits"`   // Успешные Get
+	Misses       int64 `json:"misses"` // Get без результата (нет или истек)
 }
 
 func (c *Cache) cleanupLoop() {
@@ -218,35 +243,25 @@ func (c *Cache) deleteExpired() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	for key, item := range c.items {
-		if item.IsExpired() {
-			if c.onEvicted != nil {
-				c.onEvicted(key, item.Value)
-			}
-			delete(c.items, key)
+	for _, elem := range c.items {
+		if elem.Value.(*Item).IsExpired() {
+			c.removeElement(elem)
 		}
 	}
 }
 
+// evictOldest удаляет давно не использованный элемент (конец LRU списка)
 func (c *Cache) evictOldest() {
-	// Простая стратегия: удаляем первый найденный просроченный
-	// или любой элемент если просроченных нет
-	var keyToDelete string
-
-	for key, item := range c.items {
-		if item.IsExpired() {
-			keyToDelete = key
-			break
-		}
-		if keyToDelete == "" {
-			keyToDelete = key
-		}
+	if elem := c.lru.Back(); elem != nil {
+		c.removeElement(elem)
 	}
+}
 
-	if keyToDelete != "" {
-		if c.onEvicted != nil {
-			c.onEvicted(keyToDelete, c.items[keyToDelete].Value)
-		}
-		delete(c.items, keyToDelete)
+// removeElement удаляет элемент из map и LRU списка (вызывается под c.mu)
+func (c *Cache) removeElement(elem *list.Element) {
+	item := c.lru.Remove(elem).(*Item)
+	delete(c.items, item.key)
+	if c.onEvicted != nil {
+		c.onEvicted(item.key, item.Value)
 	}
 }
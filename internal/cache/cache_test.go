@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	var evicted []string
+	c := New(Config{
+		DefaultExpiration: time.Hour,
+		MaxItems:          3,
+		OnEvicted:         func(key string, _ interface{}) { evicted = append(evicted, key) },
+	})
+	defer c.Stop()
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	// a и b становятся недавно использованными, c — самый старый
+	c.Get("a")
+	c.Get("b")
+	c.Set("d", 4)
+
+	if _, ok := c.Get("c"); ok {
+		t.Error("untouched key c should have been evicted first")
+	}
+	for _, key := range []string{"a", "b", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("key %s was evicted", key)
+		}
+	}
+
+	// Теперь порядок a, b, d (d использован последним) — вытесняется a
+	c.Set("e", 5)
+	if _, ok := c.Get("a"); ok {
+		t.Error("least recently used key a should have been evicted")
+	}
+	if fmt.Sprint(evicted) != "[c a]" {
+		t.Errorf("evicted = %v, want [c a]", evicted)
+	}
+	if c.Count() != 3 {
+		t.Errorf("count = %d, want 3", c.Count())
+	}
+}
+
+func TestCacheHitMissCounters(t *testing.T) {
+	c := New(Config{DefaultExpiration: time.Hour})
+	defer c.Stop()
+
+	c.Set("key", "value")
+	c.Get("key")
+	c.Get("key")
+	c.Get("missing")
+	c.SetWithTTL("short", "value", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	c.Get("short") // Истекший элемент — промах
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("hits = %d, misses = %d; want 2, 2", stats.Hits, stats.Misses)
+	}
+}
@@ -16,6 +16,15 @@ type MediaCache struct {
 
 	// Кэш статистики
 	statsCache *Cache
+
+	// Кэш навигационного индекса
+	navCache *Cache
+}
+
+// navEntry навигационный индекс и версия данных, для которой он построен
+type navEntry struct {
+	version uint64
+	index   *storage.NavIndex
 }
 
 // NewMediaCache создает новый медиа-кэш
@@ -36,6 +45,11 @@ func NewMediaCache() *MediaCache {
 			CleanupInterval:   1 * time.Minute,
 			MaxItems:          10,
 		}),
+		navCache: New(Config{
+			DefaultExpiration: 10 * time.Minute,
+			CleanupInterval:   5 * time.Minute,
+			MaxItems:          1,
+		}),
 	}
 }
 
@@ -105,11 +119,29 @@ func (mc *MediaCache) InvalidateStats() {
 	mc.statsCache.Delete("stats")
 }
 
+// GetNavIndex получает навигационный индекс, если он построен для этой версии данных
+func (mc *MediaCache) GetNavIndex(version uint64) (*storage.NavIndex, bool) {
+	val, found := mc.navCache.Get("nav")
+	if !found {
+		return nil, false
+	}
+	if entry, ok := val.(*navEntry); ok && entry.version == version {
+		return entry.index, true
+	}
+	return nil, false
+}
+
+// SetNavIndex сохраняет навигационный индекс для версии данных
+func (mc *MediaCache) SetNavIndex(version uint64, index *storage.NavIndex) {
+	mc.navCache.Set("nav", &navEntry{version: version, index: index})
+}
+
 // Clear очищает все кэши
 func (mc *MediaCache) Clear() {
 	mc.mediaCache.Clear()
 	mc.dirCache.Clear()
 	mc.statsCache.Clear()
+	mc.navCache.Clear()
 }
 
 // Stop останавливает все кэши
@@ -117,6 +149,7 @@ func (mc *MediaCache) Stop() {
 	mc.mediaCache.Stop()
 	mc.dirCache.Stop()
 	mc.statsCache.Stop()
+	mc.navCache.Stop()
 }
 
 // Stats возвращает общую статистику кэшей
@@ -125,5 +158,6 @@ func (mc *MediaCache) Stats() map[string]CacheStats {
 		"media": mc.mediaCache.Stats(),
 		"dir":   mc.dirCache.Stats(),
 		"stats": mc.statsCache.Stats(),
+		"nav":   mc.navCache.Stats(),
 	}
 }
@@ -1,9 +1,15 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/photocore/photocore/internal/logger"
 )
 
 type Config struct {
@@ -13,11 +19,27 @@ type Config struct {
 	Auth       AuthConfig       `yaml:"auth"`
 	Scan       ScanConfig       `yaml:"scan"`
 	Tools      ToolsConfig      `yaml:"tools"`
+	Geo        GeoConfig        `yaml:"geo"`
+	Trash      TrashConfig      `yaml:"trash"`
+	Users      UsersConfig      `yaml:"users"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	Tasks      TasksConfig      `yaml:"tasks"`
+
+	path string       // Файл, из которого загружена конфигурация
+	mu   sync.RWMutex // Защищает поля, которые меняет Reload (reloadableFields)
 }
 
 type ServerConfig struct {
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Host              string `yaml:"host"`
+	Port              int    `yaml:"port"`
+	PreloadThumbnails int    `yaml:"preload_thumbnails"` // Сколько превью первого экрана отдавать в Link: preload (<0 = выключено)
+	GeoVisibility     string `yaml:"geo_visibility"`     // Кто видит карту и GPS: all, editor, admin
+	MinifyHTML        bool   `yaml:"minify_html"`        // Удалять комментарии и лишние пробелы из HTML страниц
+	Metrics           string `yaml:"metrics"`            // Метрики Prometheus на /metrics: auth (с входом), public, off
+	// Сколько тяжелых запросов (архив, контактный лист) одновременно с одного IP (<0 = без ограничения)
+	MaxHeavyPerIP int `yaml:"max_heavy_requests_per_ip"`
+	// Прокси, которым доверяем X-Forwarded-For / X-Real-IP (IP или CIDR)
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 type StorageConfig struct {
@@ -28,10 +50,23 @@ type StorageConfig struct {
 }
 
 type ThumbnailsConfig struct {
-	Small   int `yaml:"small"`
-	Medium  int `yaml:"medium"`
-	Large   int `yaml:"large"`
-	Quality int `yaml:"quality"` // JPEG quality (0-100)
+	Small   int    `yaml:"small"`
+	Medium  int    `yaml:"medium"`
+	Large   int    `yaml:"large"`
+	Quality int    `yaml:"quality"` // Качество JPEG/WebP (0-100)
+	Format  string `yaml:"format"`  // Формат превью: jpeg, webp или auto (оба, выбор по Accept); webp через ffmpeg
+	// Размеры, которые попадают в srcset карточек и в thumbnails ответов API (по умолчанию все три)
+	SrcsetSizes []string `yaml:"srcset_sizes"`
+	// Сколько секунд ждать синхронной генерации для ?wait=1 (<0 = не ждать, сразу 503)
+	WaitTimeout int `yaml:"wait_timeout"`
+	// Сколько ?wait=1 одновременно ждут генерации с одного IP (<0 = без ограничения).
+	// Отдельно от max_heavy_requests_per_ip: страница запрашивает много превью сразу
+	WaitPerIP int `yaml:"wait_per_ip"`
+	// Всегда поворачивать по EXIF Orientation. false — не поворачивать, если пиксели
+	// уже повернуты (пропорции кадра совпадают с уже примененной ориентацией)
+	TrustOrientation bool `yaml:"trust_orientation"`
+	// Порядок фоновой генерации превью: newest_first, favorites_first, by_album
+	PregenerateOrder string `yaml:"pregenerate_order"`
 }
 
 type AuthConfig struct {
@@ -39,10 +74,56 @@ type AuthConfig struct {
 	SessionMaxAge int    `yaml:"session_max_age"`
 	AdminUsername string `yaml:"admin_username"`
 	AdminPassword string `yaml:"admin_password"`
+
+	// Требования к паролям пользователей (пароль начального админа только проверяется с предупреждением)
+	PasswordMinLength      int  `yaml:"password_min_length"`      // Минимальная длина (по умолчанию 8)
+	PasswordRequireDigit   bool `yaml:"password_require_digit"`   // Хотя бы одна цифра
+	PasswordRequireLetter  bool `yaml:"password_require_letter"`  // Хотя бы одна буква
+	PasswordRequireUpper   bool `yaml:"password_require_upper"`   // Хотя бы одна заглавная буква
+	PasswordRequireSpecial bool `yaml:"password_require_special"` // Хотя бы один символ, кроме букв и цифр
+
+	// Защита от подбора пароля: после login_max_attempts неудач за login_window секунд
+	// вход для пары логин+IP блокируется на login_lockout секунд
+	LoginMaxAttempts int `yaml:"login_max_attempts"` // По умолчанию 5
+	LoginWindow      int `yaml:"login_window"`       // По умолчанию 900 (15 минут)
+	LoginLockout     int `yaml:"login_lockout"`      // По умолчанию 900 (15 минут)
 }
 
 type ScanConfig struct {
-	Extensions ExtensionsConfig `yaml:"extensions"`
+	Extensions     ExtensionsConfig     `yaml:"extensions"`
+	DuplicateScope DuplicateScopeConfig `yaml:"duplicate_scope"`
+	MimeTypes      map[string]string    `yaml:"mime_types"`     // Переопределения MIME по расширению (".ext": "type/subtype")
+	RemoveMissing  bool                 `yaml:"remove_missing"` // Перемещать в корзину записи, файлы которых удалены с диска
+	DuplicateKeep  string               `yaml:"duplicate_keep"` // Какую копию оставлять при дубликате: existing, larger, higher_res
+	Watch          bool                 `yaml:"watch"`          // Следить за изменениями файлов и обновлять БД без полного сканирования
+	// Не искать визуальные дубликаты (pHash) среди изображений меньше N px по короткой стороне (0 = все)
+	MinDuplicateDimension int `yaml:"min_duplicate_dimension"`
+	// Сколько групп дубликатов показывать не больше и сколько секунд искать похожие (<0 = без ограничения)
+	DuplicateMaxGroups int `yaml:"duplicate_max_groups"`
+	DuplicateTimeout   int `yaml:"duplicate_timeout"`
+	// Теги из имен папок для новых файлов: 2023/Italy/Rome -> italy, rome
+	AutoTagFromPath bool     `yaml:"auto_tag_from_path"`
+	AutoTagDepth    int      `yaml:"auto_tag_depth"` // Сколько ближайших к файлу папок брать (0 = все)
+	AutoTagSkip     []string `yaml:"auto_tag_skip"`  // Имена папок, не дающие тегов (без учета регистра)
+	// Ключевые слова XMP (dc:subject) и IPTC как теги новых файлов
+	ImportKeywords bool `yaml:"import_keywords"`
+	// Часовой пояс съемки (IANA, "Europe/Moscow") для EXIF без OffsetTimeOriginal; "" — UTC
+	Timezone string `yaml:"timezone"`
+	// Шаблоны даты (формат Go: "2006-01-02", "2006-01") в именах папок для файлов без даты съемки
+	// в метаданных; без совпадений остается дата изменения файла. Пусто — не выводить дату из папок
+	FolderDatePatterns []string `yaml:"folder_date_patterns"`
+	// Серии (burst): кадры одной камеры с интервалом не больше burst_gap секунд, от burst_min_size кадров
+	BurstGap       int  `yaml:"burst_gap"`
+	BurstMinSize   int  `yaml:"burst_min_size"`
+	BurstAutoStack bool `yaml:"burst_auto_stack"` // Собирать найденные серии в стопки после сканирования
+
+	location *time.Location // Разобранный Timezone
+}
+
+// DuplicateScopeConfig ограничивает поиск визуально похожих дубликатов
+type DuplicateScopeConfig struct {
+	SameCamera bool `yaml:"same_camera"` // Сравнивать только снимки с одной камеры
+	MaxDays    int  `yaml:"max_days"`    // Сравнивать только снимки в пределах N дней (0 = без ограничения)
 }
 
 type ExtensionsConfig struct {
@@ -52,8 +133,49 @@ type ExtensionsConfig struct {
 }
 
 type ToolsConfig struct {
-	Dcraw  string `yaml:"dcraw"`
-	Ffmpeg string `yaml:"ffmpeg"`
+	Dcraw       string   `yaml:"dcraw"`
+	Ffmpeg      string   `yaml:"ffmpeg"`
+	Ffprobe     string   `yaml:"ffprobe"`
+	Exiftool    string   `yaml:"exiftool"` // Запасной способ достать превью из RAW (CR3)
+	HeifConvert string   `yaml:"heif_convert"`
+	HeicChain   []string `yaml:"heic_chain"` // Порядок декодеров HEIC/HEIF: native, heif-convert, ffmpeg
+}
+
+// GeoConfig настройки обратного геокодирования (GPS -> город/страна)
+type GeoConfig struct {
+	Enabled       bool    `yaml:"enabled"`         // Выключено по умолчанию: нужна база городов
+	CitiesPath    string  `yaml:"cities_path"`     // Файл GeoNames (cities15000.txt) или CSV name,country,lat,lon
+	MaxDistanceKm float64 `yaml:"max_distance_km"` // Дальше этого расстояния до города место не подписывается
+}
+
+// TrashConfig настройки корзины
+type TrashConfig struct {
+	MoveFiles bool   `yaml:"move_files"` // Перемещать файлы удалённых медиа в Dir внутри медиа-корня
+	Dir       string `yaml:"dir"`        // Директория корзины относительно медиа-корня (не сканируется)
+	// Через сколько дней медиа удаляются из корзины окончательно (0 = не удалять автоматически)
+	RetentionDays int `yaml:"retention_days"`
+}
+
+// LoggingConfig настройки логов (файлы в storage.logs_path)
+type LoggingConfig struct {
+	// Формат записей: text — строки с датой, json — объект на строку для Loki/ELK (logger.Options)
+	Format string `yaml:"format"`
+	// Ротация: файл больше max_size_mb переименовывается в .1, хранится max_backups копий
+	MaxSizeMB  int `yaml:"max_size_mb"` // По умолчанию 100 (<0 = без ротации)
+	MaxBackups int `yaml:"max_backups"` // По умолчанию 5 (<0 = не хранить копии)
+}
+
+// TasksConfig повторы фоновых задач пула (превью, метаданные, сканирование)
+type TasksConfig struct {
+	MaxAttempts int `yaml:"max_attempts"` // Попыток на задачу, по умолчанию 3 (1 = без повторов)
+	RetryDelay  int `yaml:"retry_delay"`  // Пауза перед первым повтором в секундах, дальше в 4 раза дольше
+}
+
+// UsersConfig настройки учетных записей
+type UsersConfig struct {
+	// Что делать с загрузками и альбомами удаленного пользователя:
+	// keep — оставить как есть, reassign-to-admin — передать admin_username, orphan — убрать владельца
+	OnDelete string `yaml:"on_delete"`
 }
 
 // Load читает конфигурацию из YAML-файла
@@ -68,9 +190,27 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	// Переменные окружения PHOTOCORE_* важнее значений из файла
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
 	// Установка значений по умолчанию
 	cfg.setDefaults()
 
+	if cfg.Scan.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Scan.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scan.timezone: %w", err)
+		}
+		cfg.Scan.location = loc
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	cfg.path = path
 	return &cfg, nil
 }
 
@@ -81,6 +221,19 @@ func (c *Config) setDefaults() {
 	if c.Server.Port == 0 {
 		c.Server.Port = 8080
 	}
+	if c.Server.PreloadThumbnails == 0 {
+		c.Server.PreloadThumbnails = 24
+	}
+	if c.Server.MaxHeavyPerIP == 0 {
+		c.Server.MaxHeavyPerIP = 1
+	}
+	if c.Server.GeoVisibility == "" {
+		c.Server.GeoVisibility = "all"
+	}
+	c.Server.Metrics = strings.ToLower(c.Server.Metrics)
+	if c.Server.Metrics != "public" && c.Server.Metrics != "off" {
+		c.Server.Metrics = "auth"
+	}
 	if c.Storage.CachePath == "" {
 		c.Storage.CachePath = "./cache"
 	}
@@ -102,29 +255,149 @@ func (c *Config) setDefaults() {
 	if c.Thumbnails.Quality == 0 {
 		c.Thumbnails.Quality = 85
 	}
+	if len(c.Thumbnails.SrcsetSizes) == 0 {
+		c.Thumbnails.SrcsetSizes = []string{"small", "medium", "large"}
+	}
+	for i, size := range c.Thumbnails.SrcsetSizes {
+		c.Thumbnails.SrcsetSizes[i] = strings.ToLower(strings.TrimSpace(size))
+	}
+	if c.Thumbnails.WaitTimeout == 0 {
+		c.Thumbnails.WaitTimeout = 10
+	}
+	if c.Thumbnails.WaitPerIP == 0 {
+		c.Thumbnails.WaitPerIP = 6
+	}
+	if c.Scan.DuplicateMaxGroups == 0 {
+		c.Scan.DuplicateMaxGroups = 1000
+	}
+	if c.Scan.DuplicateTimeout == 0 {
+		c.Scan.DuplicateTimeout = 10
+	}
+	if c.Scan.BurstGap <= 0 {
+		c.Scan.BurstGap = 2
+	}
+	if c.Scan.BurstMinSize < 2 {
+		c.Scan.BurstMinSize = 3
+	}
+	c.Scan.DuplicateKeep = strings.ToLower(c.Scan.DuplicateKeep)
+	if c.Scan.DuplicateKeep != "larger" && c.Scan.DuplicateKeep != "higher_res" {
+		c.Scan.DuplicateKeep = "existing"
+	}
+	c.Thumbnails.Format = strings.ToLower(c.Thumbnails.Format)
+	if c.Thumbnails.Format != "webp" && c.Thumbnails.Format != "auto" {
+		c.Thumbnails.Format = "jpeg"
+	}
+	c.Thumbnails.PregenerateOrder = strings.ToLower(c.Thumbnails.PregenerateOrder)
+	if c.Thumbnails.PregenerateOrder != "favorites_first" && c.Thumbnails.PregenerateOrder != "by_album" {
+		c.Thumbnails.PregenerateOrder = "newest_first"
+	}
+	c.Users.OnDelete = strings.ToLower(c.Users.OnDelete)
+	if c.Users.OnDelete != "reassign-to-admin" && c.Users.OnDelete != "orphan" {
+		c.Users.OnDelete = "keep"
+	}
+	c.Logging.Format = strings.ToLower(c.Logging.Format)
+	if c.Logging.Format != "json" {
+		c.Logging.Format = "text"
+	}
+	if c.Logging.MaxSizeMB == 0 {
+		c.Logging.MaxSizeMB = 100
+	}
+	if c.Logging.MaxBackups == 0 {
+		c.Logging.MaxBackups = 5
+	}
+	if c.Tasks.MaxAttempts <= 0 {
+		c.Tasks.MaxAttempts = 3
+	}
+	if c.Tasks.RetryDelay <= 0 {
+		c.Tasks.RetryDelay = 1
+	}
 	if c.Auth.SessionMaxAge == 0 {
 		c.Auth.SessionMaxAge = 86400
 	}
+	if c.Auth.PasswordMinLength <= 0 {
+		c.Auth.PasswordMinLength = 8
+	}
+	if c.Auth.LoginMaxAttempts <= 0 {
+		c.Auth.LoginMaxAttempts = 5
+	}
+	if c.Auth.LoginWindow <= 0 {
+		c.Auth.LoginWindow = 900
+	}
+	if c.Auth.LoginLockout <= 0 {
+		c.Auth.LoginLockout = 900
+	}
 	if c.Tools.Dcraw == "" {
 		c.Tools.Dcraw = "dcraw"
 	}
 	if c.Tools.Ffmpeg == "" {
 		c.Tools.Ffmpeg = "ffmpeg"
 	}
+	if c.Tools.Ffprobe == "" {
+		c.Tools.Ffprobe = "ffprobe"
+	}
+	if c.Tools.Exiftool == "" {
+		c.Tools.Exiftool = "exiftool"
+	}
+	if c.Tools.HeifConvert == "" {
+		c.Tools.HeifConvert = "heif-convert"
+	}
+	if len(c.Tools.HeicChain) == 0 {
+		c.Tools.HeicChain = []string{"native", "heif-convert", "ffmpeg"}
+	}
+	if c.Geo.MaxDistanceKm == 0 {
+		c.Geo.MaxDistanceKm = 50
+	}
+	if c.Trash.Dir == "" {
+		c.Trash.Dir = ".trash"
+	}
+	if c.Trash.RetentionDays < 0 {
+		c.Trash.RetentionDays = 0
+	}
+
+	// Нормализуем ключи переопределений MIME (".EXT" -> ".ext")
+	if len(c.Scan.MimeTypes) > 0 {
+		normalized := make(map[string]string, len(c.Scan.MimeTypes))
+		for ext, mime := range c.Scan.MimeTypes {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			normalized[ext] = mime
+		}
+		c.Scan.MimeTypes = normalized
+	}
+}
+
+// CaptureLocation часовой пояс для дат съемки без явного смещения в EXIF
+func (c *Config) CaptureLocation() *time.Location {
+	if c.Scan.location == nil {
+		return time.UTC
+	}
+	return c.Scan.location
+}
+
+// LoggerOptions формат и ротация из раздела logging: logger.InitWithOptions(cfg.Storage.LogsPath, cfg.LoggerOptions())
+func (c *Config) LoggerOptions() logger.Options {
+	return logger.Options{
+		Format:     c.Logging.Format,
+		MaxSizeMB:  max(c.Logging.MaxSizeMB, 0),
+		MaxBackups: max(c.Logging.MaxBackups, 0),
+	}
 }
 
 // AllExtensions возвращает все поддерживаемые расширения
 func (c *Config) AllExtensions() []string {
+	exts := c.Extensions()
 	var all []string
-	all = append(all, c.Scan.Extensions.Images...)
-	all = append(all, c.Scan.Extensions.Videos...)
-	all = append(all, c.Scan.Extensions.Raw...)
+	all = append(all, exts.Images...)
+	all = append(all, exts.Videos...)
+	all = append(all, exts.Raw...)
 	return all
 }
 
 // IsImage проверяет, является ли расширение изображением
 func (c *Config) IsImage(ext string) bool {
-	for _, e := range c.Scan.Extensions.Images {
+	for _, e := range c.Extensions().Images {
 		if e == ext {
 			return true
 		}
@@ -134,7 +407,7 @@ func (c *Config) IsImage(ext string) bool {
 
 // IsVideo проверяет, является ли расширение видео
 func (c *Config) IsVideo(ext string) bool {
-	for _, e := range c.Scan.Extensions.Videos {
+	for _, e := range c.Extensions().Videos {
 		if e == ext {
 			return true
 		}
@@ -144,10 +417,47 @@ func (c *Config) IsVideo(ext string) bool {
 
 // IsRaw проверяет, является ли расширение RAW-файлом
 func (c *Config) IsRaw(ext string) bool {
-	for _, e := range c.Scan.Extensions.Raw {
+	for _, e := range c.Extensions().Raw {
 		if e == ext {
 			return true
 		}
 	}
 	return false
 }
+
+// defaultMimeTypes соответствие расширений MIME-типам по умолчанию
+var defaultMimeTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".heic": "image/heic",
+	".mp4":  "video/mp4",
+	".mov":  "video/quicktime",
+	".avi":  "video/x-msvideo",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+	".raw":  "image/x-raw",
+	".cr2":  "image/x-canon-cr2",
+	".cr3":  "image/x-canon-cr3",
+	".nef":  "image/x-nikon-nef",
+	".arw":  "image/x-sony-arw",
+	".dng":  "image/x-adobe-dng",
+	".orf":  "image/x-olympus-orf",
+	".raf":  "image/x-fuji-raf",
+	".rw2":  "image/x-panasonic-rw2",
+}
+
+// MimeType возвращает MIME-тип для расширения.
+// Единый источник для сканера и загрузки: сначала scan.mime_types из конфига, затем встроенная таблица.
+func (c *Config) MimeType(ext string) string {
+	ext = strings.ToLower(ext)
+	if mime, ok := c.Scan.MimeTypes[ext]; ok && mime != "" {
+		return mime
+	}
+	if mime, ok := defaultMimeTypes[ext]; ok {
+		return mime
+	}
+	return "application/octet-stream"
+}
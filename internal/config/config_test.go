@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/photocore/photocore/internal/logger"
+)
+
+func TestLoggerOptions(t *testing.T) {
+	cfg, err := Load(writeConfig(t, t.TempDir(), "logging:\n  format: JSON\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := logger.Options{Format: logger.FormatJSON, MaxSizeMB: 100, MaxBackups: 5}
+	if got := cfg.LoggerOptions(); got != want {
+		t.Errorf("options = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoggerOptionsDisableRotation(t *testing.T) {
+	cfg, err := Load(writeConfig(t, t.TempDir(), "logging:\n  max_size_mb: -1\n  max_backups: -1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Отрицательные значения конфигурации — выключено: logger понимает это как 0
+	if got := cfg.LoggerOptions(); got.MaxSizeMB != 0 || got.MaxBackups != 0 {
+		t.Errorf("options = %+v, want no rotation and no backups", got)
+	}
+}
+
+func TestMimeTypeOverrides(t *testing.T) {
+	cfg, err := Load(writeConfig(t, t.TempDir(), "scan:\n  mime_types:\n    JXL: image/jxl\n    \".MOV\": video/mp4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ ext, want string }{
+		{".jpg", "image/jpeg"},
+		{".JPG", "image/jpeg"},
+		{".jxl", "image/jxl"}, // Ключ без точки и в верхнем регистре нормализуется
+		{".MOV", "video/mp4"}, // Переопределение побеждает встроенную таблицу
+		{".xyz", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := cfg.MimeType(tt.ext); got != tt.want {
+			t.Errorf("MimeType(%q) = %q, want %q", tt.ext, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix префикс переменных окружения, переопределяющих поля конфигурации
+const EnvPrefix = "PHOTOCORE_"
+
+// EnvName имя переменной окружения для поля (путь в нотации Diff):
+// "auth.admin_password" -> PHOTOCORE_AUTH_ADMIN_PASSWORD
+func EnvName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+}
+
+// applyEnv переносит в c заданные переменные окружения PHOTOCORE_*.
+// Списки — через запятую (PHOTOCORE_STORAGE_MEDIA_PATHS=/photos,/videos), словари не поддерживаются.
+// Пустое значение тоже применяется; незаданная переменная оставляет значение из YAML.
+func (c *Config) applyEnv() error {
+	return applyEnvFields("", reflect.ValueOf(c).Elem())
+}
+
+// applyEnvFields рекурсивно обходит экспортируемые поля структур, как diffFields
+func applyEnvFields(prefix string, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnvFields(name, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		env := EnvName(name)
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		if err := setFromString(v.Field(i), value); err != nil {
+			return fmt.Errorf("invalid %s: %w", env, err)
+		}
+	}
+	return nil
+}
+
+// setFromString разбирает value по типу поля
+func setFromString(f reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		if f.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", f.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvOverridesYAML(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `server:
+  host: 127.0.0.1
+  port: 9000
+  minify_html: true
+auth:
+  admin_password: from-yaml
+thumbnails:
+  quality: 70
+`)
+	other := filepath.Join(dir, "other")
+	if err := os.MkdirAll(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PHOTOCORE_SERVER_PORT", "7000")
+	t.Setenv("PHOTOCORE_SERVER_MINIFY_HTML", "false")
+	t.Setenv("PHOTOCORE_AUTH_ADMIN_PASSWORD", "from-env")
+	t.Setenv("PHOTOCORE_STORAGE_MEDIA_PATHS", filepath.Join(dir, "media")+", "+other)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 7000 || cfg.Server.MinifyHTML || cfg.Auth.AdminPassword != "from-env" {
+		t.Errorf("env did not win: port %d, minify %v, password %q", cfg.Server.Port, cfg.Server.MinifyHTML, cfg.Auth.AdminPassword)
+	}
+	if want := []string{filepath.Join(dir, "media"), other}; !reflect.DeepEqual(cfg.Storage.MediaPaths, want) {
+		t.Errorf("media paths = %v, want %v", cfg.Storage.MediaPaths, want)
+	}
+
+	// Незаданные переменные оставляют значения из файла
+	if cfg.Server.Host != "127.0.0.1" || cfg.Thumbnails.Quality != 70 {
+		t.Errorf("yaml values lost: host %q, quality %d", cfg.Server.Host, cfg.Thumbnails.Quality)
+	}
+}
+
+func TestEnvInvalidValue(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "")
+	t.Setenv("PHOTOCORE_SERVER_PORT", "eighty")
+
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "PHOTOCORE_SERVER_PORT") {
+		t.Errorf("err = %v, want invalid PHOTOCORE_SERVER_PORT", err)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	if got := EnvName("auth.admin_password"); got != "PHOTOCORE_AUTH_ADMIN_PASSWORD" {
+		t.Errorf("EnvName = %q", got)
+	}
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// reloadableFields поля (пути в нотации Diff), которые применяются без перезапуска.
+// Остальные изменения вступают в силу только после рестарта.
+var reloadableFields = []string{
+	"thumbnails.small",
+	"thumbnails.medium",
+	"thumbnails.large",
+	"thumbnails.srcset_sizes",
+	"scan.extensions",
+	"trash.retention_days",
+}
+
+// Diff возвращает поля, отличающиеся от old, путями ключей YAML ("server.port", "scan.extensions.images")
+func (c *Config) Diff(old *Config) []string {
+	var changed []string
+	diffFields("", reflect.ValueOf(old).Elem(), reflect.ValueOf(c).Elem(), &changed)
+	return changed
+}
+
+// diffFields рекурсивно сравнивает экспортируемые поля структур
+func diffFields(prefix string, old, cur reflect.Value, changed *[]string) {
+	t := cur.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			diffFields(name, old.Field(i), cur.Field(i), changed)
+			continue
+		}
+		if !reflect.DeepEqual(old.Field(i).Interface(), cur.Field(i).Interface()) {
+			*changed = append(*changed, name)
+		}
+	}
+}
+
+// IsReloadable применяется ли поле (путь из Diff) без перезапуска
+func IsReloadable(path string) bool {
+	for _, field := range reloadableFields {
+		if path == field || strings.HasPrefix(path, field+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload перечитывает path и переносит в c поля, которые можно менять на лету.
+// Если файл не читается или не проходит Validate, c не меняется.
+// Возвращает примененные изменения и те, что требуют перезапуска.
+func (c *Config) Reload(path string) (applied, restart []string, err error) {
+	next, err := Load(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, field := range next.Diff(c) {
+		if IsReloadable(field) {
+			applied = append(applied, field)
+		} else {
+			restart = append(restart, field)
+		}
+	}
+
+	// Компоненты держат указатель на общий Config и читают эти поля через
+	// ThumbnailSizes, SrcsetSizes, Extensions и TrashRetentionDays под c.mu
+	c.Thumbnails.Small = next.Thumbnails.Small
+	c.Thumbnails.Medium = next.Thumbnails.Medium
+	c.Thumbnails.Large = next.Thumbnails.Large
+	c.Thumbnails.SrcsetSizes = next.Thumbnails.SrcsetSizes
+	c.Scan.Extensions = next.Scan.Extensions
+	c.Trash.RetentionDays = next.Trash.RetentionDays
+	return applied, restart, nil
+}
+
+// Path файл, из которого загружена конфигурация (пусто, если Config создан не через Load)
+func (c *Config) Path() string {
+	return c.path
+}
+
+// ThumbnailSizes размеры превью small, medium и large в пикселях
+func (c *Config) ThumbnailSizes() (small, medium, large int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Thumbnails.Small, c.Thumbnails.Medium, c.Thumbnails.Large
+}
+
+// SrcsetSizes размеры превью для srcset и списков URL (thumbnails.srcset_sizes)
+func (c *Config) SrcsetSizes() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.Thumbnails.SrcsetSizes...)
+}
+
+// Extensions расширения файлов, которые сканируются и принимаются при загрузке
+func (c *Config) Extensions() ExtensionsConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Scan.Extensions
+}
+
+// TrashRetentionDays срок хранения медиа в корзине в днях (0 — не удалять автоматически)
+func (c *Config) TrashRetentionDays() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Trash.RetentionDays
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// writeConfig пишет config.yaml с хранилищем во временной директории dir; extra
+// дописывается в конец (разделы кроме storage). Возвращает путь к файлу.
+func writeConfig(tb testing.TB, dir, extra string) string {
+	tb.Helper()
+	for _, sub := range []string{"media", "cache", "data", "logs"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	yaml := fmt.Sprintf(`storage:
+  media_paths: [%q]
+  cache_path: %q
+  db_path: %q
+  logs_path: %q
+%s`, filepath.Join(dir, "media"), filepath.Join(dir, "cache"), filepath.Join(dir, "data", "test.db"), filepath.Join(dir, "logs"), extra)
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	old, err := Load(writeConfig(t, dir, "server:\n  port: 8080\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := Load(writeConfig(t, dir, `server:
+  port: 9090
+thumbnails:
+  small: 200
+scan:
+  extensions:
+    images: [".jpg", ".heic"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed := old.Diff(old); len(changed) != 0 {
+		t.Errorf("diff with itself = %v, want none", changed)
+	}
+	want := []string{"server.port", "thumbnails.small", "scan.extensions.images"}
+	if got := cur.Diff(old); !reflect.DeepEqual(got, want) {
+		t.Errorf("diff = %v, want %v", got, want)
+	}
+
+	if !IsReloadable("thumbnails.small") || !IsReloadable("scan.extensions.images") {
+		t.Error("thumbnail sizes and extensions must be reloadable")
+	}
+	if IsReloadable("server.port") || IsReloadable("thumbnails.quality") {
+		t.Error("server.port and thumbnails.quality must require a restart")
+	}
+}
+
+func TestReloadAppliesSafeFields(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "server:\n  port: 8080\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Path() != path {
+		t.Errorf("path = %q, want %q", cfg.Path(), path)
+	}
+
+	writeConfig(t, dir, "server:\n  port: 9090\nthumbnails:\n  large: 2000\ntrash:\n  retention_days: 14\n")
+	applied, restart, err := cfg.Reload(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"thumbnails.large", "trash.retention_days"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	if want := []string{"server.port"}; !reflect.DeepEqual(restart, want) {
+		t.Errorf("restart = %v, want %v", restart, want)
+	}
+	if _, _, large := cfg.ThumbnailSizes(); large != 2000 {
+		t.Errorf("large = %d, want 2000", large)
+	}
+	if cfg.TrashRetentionDays() != 14 {
+		t.Errorf("retention = %d, want 14", cfg.TrashRetentionDays())
+	}
+	if cfg.Server.Port != 8080 {
+		t.Errorf("port = %d, want 8080 until restart", cfg.Server.Port)
+	}
+}
+
+func TestReloadRejectsInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "thumbnails:\n  small: 250\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, extra := range map[string]string{
+		"invalid value": "thumbnails:\n  small: 5000\n", // Больше medium
+		"bad yaml":      "thumbnails: [\n",
+	} {
+		writeConfig(t, dir, extra)
+		if _, _, err := cfg.Reload(path); err == nil {
+			t.Errorf("%s: reload accepted", name)
+		}
+		if small, _, _ := cfg.ThumbnailSizes(); small != 250 {
+			t.Errorf("%s: small = %d after rejected reload, want 250", name, small)
+		}
+	}
+}
+
+func TestReloadConcurrentReads(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Под -race проверяет, что чтение на лету не пересекается с Reload
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					cfg.ThumbnailSizes()
+					cfg.IsImage(".jpg")
+					cfg.TrashRetentionDays()
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		writeConfig(t, dir, fmt.Sprintf("thumbnails:\n  small: %d\n", 100+i))
+		if _, _, err := cfg.Reload(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
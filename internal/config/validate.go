@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Validate проверяет конфигурацию после установки умолчаний: медиа-пути доступны
+// для чтения, директории кэша, базы и логов — для записи, размеры превью и качество
+// в допустимых пределах. Возвращает все найденные проблемы одной ошибкой.
+func (c *Config) Validate() error {
+	var problems []error
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		problems = append(problems, fmt.Errorf("server.port: %d is out of range 1-65535", c.Server.Port))
+	}
+
+	if len(c.Storage.MediaPaths) == 0 {
+		problems = append(problems, errors.New("storage.media_paths: no media paths configured"))
+	}
+	for _, path := range c.Storage.MediaPaths {
+		if err := checkReadableDir(path); err != nil {
+			problems = append(problems, fmt.Errorf("storage.media_paths: %w", err))
+		}
+	}
+	if err := checkWritableDir(c.Storage.CachePath); err != nil {
+		problems = append(problems, fmt.Errorf("storage.cache_path: %w", err))
+	}
+	if err := checkWritableDir(filepath.Dir(c.Storage.DBPath)); err != nil {
+		problems = append(problems, fmt.Errorf("storage.db_path: %w", err))
+	}
+	if err := checkWritableDir(c.Storage.LogsPath); err != nil {
+		problems = append(problems, fmt.Errorf("storage.logs_path: %w", err))
+	}
+
+	t := c.Thumbnails
+	if t.Small <= 0 || t.Medium <= 0 || t.Large <= 0 {
+		problems = append(problems, fmt.Errorf("thumbnails: sizes must be positive (small %d, medium %d, large %d)", t.Small, t.Medium, t.Large))
+	} else if t.Small >= t.Medium || t.Medium >= t.Large {
+		problems = append(problems, fmt.Errorf("thumbnails: sizes must ascend small < medium < large (got %d, %d, %d)", t.Small, t.Medium, t.Large))
+	}
+	for _, size := range t.SrcsetSizes {
+		if size != "small" && size != "medium" && size != "large" {
+			problems = append(problems, fmt.Errorf("thumbnails.srcset_sizes: unknown size %q (small, medium or large)", size))
+		}
+	}
+	if t.Quality < 1 || t.Quality > 100 {
+		problems = append(problems, fmt.Errorf("thumbnails.quality: %d is out of range 1-100", t.Quality))
+	}
+
+	for _, ext := range c.AllExtensions() {
+		if !strings.HasPrefix(ext, ".") {
+			problems = append(problems, fmt.Errorf("scan.extensions: %q must start with a dot", ext))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config:\n%w", errors.Join(problems...))
+}
+
+// checkReadableDir проверяет, что path — существующая директория, которую можно прочитать
+func checkReadableDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, unwrapPathError(err))
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: not a directory", path)
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, unwrapPathError(err))
+	}
+	defer dir.Close()
+	if _, err := dir.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, unwrapPathError(err))
+	}
+	return nil
+}
+
+// checkWritableDir проверяет, что в path можно создавать файлы. Отсутствующая
+// директория допустима, если ее можно создать: проверяется ближайший существующий родитель.
+func checkWritableDir(path string) error {
+	dir := path
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s: not a directory", dir)
+			}
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%s: %w", dir, unwrapPathError(err))
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("%s: %w", path, unwrapPathError(err))
+		}
+		dir = parent
+	}
+
+	probe, err := os.CreateTemp(dir, ".photocore-write-check-*")
+	if err != nil {
+		if dir != path {
+			return fmt.Errorf("%s: cannot be created in %s: %w", path, dir, unwrapPathError(err))
+		}
+		return fmt.Errorf("%s: not writable: %w", path, unwrapPathError(err))
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// unwrapPathError убирает из ошибки повтор пути (*os.PathError), путь уже в сообщении
+func unwrapPathError(err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
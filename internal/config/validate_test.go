@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// validConfig загружает корректную конфигурацию во временной директории
+func validConfig(tb testing.TB) (*Config, string) {
+	tb.Helper()
+	dir := tb.TempDir()
+	cfg, err := Load(writeConfig(tb, dir, ""))
+	if err != nil {
+		tb.Fatalf("valid config rejected: %v", err)
+	}
+	return cfg, dir
+}
+
+func TestValidateAcceptsValidConfig(t *testing.T) {
+	cfg, dir := validConfig(t)
+	// Отсутствующие директории кэша и логов допустимы, если их можно создать
+	cfg.Storage.CachePath = filepath.Join(dir, "new", "cache")
+	cfg.Storage.LogsPath = filepath.Join(dir, "new", "logs")
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestValidateReportsEachField(t *testing.T) {
+	cases := []struct {
+		field string
+		edit  func(c *Config, dir string)
+	}{
+		{"server.port", func(c *Config, _ string) { c.Server.Port = 70000 }},
+		{"storage.media_paths", func(c *Config, _ string) { c.Storage.MediaPaths = nil }},
+		{"storage.media_paths", func(c *Config, dir string) { c.Storage.MediaPaths = []string{filepath.Join(dir, "missing")} }},
+		{"storage.media_paths", func(c *Config, dir string) { c.Storage.MediaPaths = []string{filepath.Join(dir, "config.yaml")} }},
+		{"storage.cache_path", func(c *Config, dir string) { c.Storage.CachePath = filepath.Join(dir, "config.yaml") }},
+		{"storage.db_path", func(c *Config, dir string) { c.Storage.DBPath = filepath.Join(dir, "config.yaml", "test.db") }},
+		{"storage.logs_path", func(c *Config, dir string) { c.Storage.LogsPath = filepath.Join(dir, "config.yaml", "logs") }},
+		{"thumbnails: sizes must be positive", func(c *Config, _ string) { c.Thumbnails.Small = 0 }},
+		{"thumbnails: sizes must ascend", func(c *Config, _ string) { c.Thumbnails.Medium = c.Thumbnails.Large }},
+		{"thumbnails.srcset_sizes", func(c *Config, _ string) { c.Thumbnails.SrcsetSizes = []string{"small", "huge"} }},
+		{"thumbnails.quality", func(c *Config, _ string) { c.Thumbnails.Quality = 0 }},
+		{"thumbnails.quality", func(c *Config, _ string) { c.Thumbnails.Quality = 101 }},
+		{"scan.extensions", func(c *Config, _ string) { c.Scan.Extensions.Images = []string{"jpg"} }},
+	}
+	for _, c := range cases {
+		cfg, dir := validConfig(t)
+		c.edit(cfg, dir)
+		err := cfg.Validate()
+		if err == nil {
+			t.Errorf("%s: invalid value accepted", c.field)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.field) {
+			t.Errorf("%s: error does not name the field: %v", c.field, err)
+		}
+	}
+}
+
+func TestValidateUnwritableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root writes to directories regardless of permissions")
+	}
+	cfg, dir := validConfig(t)
+	locked := filepath.Join(dir, "cache")
+	if err := os.Chmod(locked, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "storage.cache_path") {
+		t.Errorf("read-only cache dir: err = %v", err)
+	}
+}
+
+func TestValidateListsAllProblems(t *testing.T) {
+	cfg, dir := validConfig(t)
+	cfg.Storage.MediaPaths = []string{filepath.Join(dir, "missing")}
+	cfg.Thumbnails.Quality = 0
+	cfg.Server.Port = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid config accepted")
+	}
+	for _, field := range []string{"server.port", "storage.media_paths", "thumbnails.quality"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("combined error misses %s: %v", field, err)
+		}
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "thumbnails:\n  quality: 150\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "thumbnails.quality") {
+		t.Errorf("Load err = %v, want thumbnails.quality problem", err)
+	}
+}
@@ -0,0 +1,28 @@
+package geo
+
+import "math"
+
+// Place результат обратного геокодирования
+type Place struct {
+	City       string  `json:"city"`
+	Country    string  `json:"country"`     // Код страны (ISO 3166-1 alpha-2)
+	DistanceKm float64 `json:"distance_km"` // Расстояние до центра найденного города
+}
+
+// Geocoder превращает координаты в название места
+type Geocoder interface {
+	// Reverse возвращает ближайшее место или nil, если ничего не найдено
+	Reverse(lat, lon float64) *Place
+}
+
+const earthRadiusKm = 6371.0
+
+// DistanceKm расстояние между точками по формуле гаверсинусов
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
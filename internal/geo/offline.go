@@ -0,0 +1,161 @@
+package geo
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// city запись из базы городов
+type city struct {
+	name    string
+	country string
+	lat     float64
+	lon     float64
+}
+
+// cellKey ячейка сетки 1°x1° для быстрого поиска ближайшего города
+type cellKey struct {
+	lat int
+	lon int
+}
+
+// OfflineGeocoder ищет ближайший город по локальной базе (без сетевых запросов)
+type OfflineGeocoder struct {
+	cells         map[cellKey][]city
+	maxDistanceKm float64
+}
+
+// NewOfflineGeocoder загружает базу городов из файла.
+// Поддерживаются формат GeoNames (cities15000.txt и т.п., разделитель TAB)
+// и простой CSV: name,country,lat,lon
+func NewOfflineGeocoder(path string, maxDistanceKm float64) (*OfflineGeocoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cities database: %w", err)
+	}
+	defer file.Close()
+
+	g := &OfflineGeocoder{
+		cells:         make(map[cellKey][]city),
+		maxDistanceKm: maxDistanceKm,
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // alternatenames в GeoNames бывают длинными
+	count := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		c, ok := parseCityLine(line)
+		if !ok {
+			continue
+		}
+		key := cellFor(c.lat, c.lon)
+		g.cells[key] = append(g.cells[key], c)
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cities database: %w", err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("cities database %s is empty or has unknown format", path)
+	}
+
+	return g, nil
+}
+
+// parseCityLine разбирает строку GeoNames или CSV
+func parseCityLine(line string) (city, bool) {
+	var name, country, latStr, lonStr string
+	if fields := strings.Split(line, "\t"); len(fields) >= 9 {
+		// GeoNames: geonameid, name, asciiname, alternatenames, latitude, longitude, class, code, country code, ...
+		name, latStr, lonStr, country = fields[1], fields[4], fields[5], fields[8]
+	} else if fields := strings.Split(line, ","); len(fields) >= 4 {
+		name, country, latStr, lonStr = fields[0], fields[1], fields[2], fields[3]
+	} else {
+		return city{}, false
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil {
+		return city{}, false
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil {
+		return city{}, false
+	}
+	return city{
+		name:    strings.TrimSpace(name),
+		country: strings.ToUpper(strings.TrimSpace(country)),
+		lat:     lat,
+		lon:     lon,
+	}, true
+}
+
+func cellFor(lat, lon float64) cellKey {
+	return cellKey{lat: int(math.Floor(lat)), lon: int(math.Floor(lon))}
+}
+
+// Reverse возвращает ближайший город не дальше maxDistanceKm
+func (g *OfflineGeocoder) Reverse(lat, lon float64) *Place {
+	center := cellFor(lat, lon)
+
+	var best *city
+	bestDist := math.MaxFloat64
+
+	// Расширяем поиск кольцами ячеек, пока найденный город может быть не ближайшим.
+	// Кольцо r гарантированно покрывает r*111 км по широте и r*111*cos(lat) км по долготе.
+	cellKm := 111 * math.Cos(lat*math.Pi/180)
+	maxRing := int(g.maxDistanceKm/math.Max(cellKm, 1)) + 1
+	if maxRing > 180 {
+		maxRing = 180
+	}
+	for ring := 0; ring <= maxRing; ring++ {
+		for dLat := -ring; dLat <= ring; dLat++ {
+			for dLon := -ring; dLon <= ring; dLon++ {
+				if abs(dLat) != ring && abs(dLon) != ring {
+					continue // Внутренние ячейки уже просмотрены
+				}
+				key := cellKey{lat: center.lat + dLat, lon: wrapLon(center.lon + dLon)}
+				for i := range g.cells[key] {
+					c := &g.cells[key][i]
+					if d := DistanceKm(lat, lon, c.lat, c.lon); d < bestDist {
+						best, bestDist = c, d
+					}
+				}
+			}
+		}
+		if best != nil && bestDist <= float64(ring)*cellKm {
+			break
+		}
+	}
+
+	if best == nil || bestDist > g.maxDistanceKm {
+		return nil
+	}
+	return &Place{City: best.name, Country: best.country, DistanceKm: bestDist}
+}
+
+// wrapLon нормализует индекс ячейки долготы в диапазон [-180, 179]
+func wrapLon(lon int) int {
+	for lon < -180 {
+		lon += 360
+	}
+	for lon >= 180 {
+		lon -= 360
+	}
+	return lon
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
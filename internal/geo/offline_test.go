@@ -0,0 +1,77 @@
+package geo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCities пишет базу городов во временный файл
+func writeCities(tb testing.TB, content string) string {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "cities.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+func TestOfflineGeocoderReverse(t *testing.T) {
+	// CSV и строка GeoNames (TAB) в одном файле, комментарии и мусор пропускаются
+	path := writeCities(t, "# name,country,lat,lon\n"+
+		"Moscow,ru,55.7558,37.6173\n"+
+		"Khimki,RU,55.8970,37.4297\n"+
+		"2988507\tParis\tParis\tParis,Lutetia\t48.85341\t2.3488\tP\tPPLC\tFR\n"+
+		"Suva,FJ,-18.1416,178.4415\n"+
+		"broken line\n")
+	g, err := NewOfflineGeocoder(path, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		lat, lon      float64
+		city, country string
+	}{
+		{"center", 55.75, 37.62, "Moscow", "RU"},
+		{"nearest of two", 55.88, 37.44, "Khimki", "RU"},
+		{"geonames line", 48.86, 2.35, "Paris", "FR"},
+		{"nearest in neighbouring cell", 48.99, 2.01, "Paris", "FR"},
+		{"open sea", 45.0, -30.0, "", ""},
+	}
+	for _, tt := range tests {
+		p := g.Reverse(tt.lat, tt.lon)
+		if tt.city == "" {
+			if p != nil {
+				t.Errorf("%s: Reverse = %+v, want nothing within 50 km", tt.name, p)
+			}
+			continue
+		}
+		if p == nil || p.City != tt.city || p.Country != tt.country {
+			t.Errorf("%s: Reverse = %+v, want %s, %s", tt.name, p, tt.city, tt.country)
+		} else if p.DistanceKm > 50 {
+			t.Errorf("%s: distance %.1f km beyond the limit", tt.name, p.DistanceKm)
+		}
+	}
+}
+
+func TestOfflineGeocoderWrapsLongitude(t *testing.T) {
+	g, err := NewOfflineGeocoder(writeCities(t, "Suva,FJ,-18.1416,178.4415\n"), 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Точка по другую сторону 180-го меридиана ближе 300 км
+	if p := g.Reverse(-18.0, -179.5); p == nil || p.City != "Suva" {
+		t.Errorf("Reverse across the antimeridian = %+v, want Suva", p)
+	}
+}
+
+func TestOfflineGeocoderRejectsEmptyDatabase(t *testing.T) {
+	if _, err := NewOfflineGeocoder(writeCities(t, "# nothing here\nnot a city\n"), 50); err == nil {
+		t.Error("empty database accepted")
+	}
+	if _, err := NewOfflineGeocoder(filepath.Join(t.TempDir(), "missing.txt"), 50); err == nil {
+		t.Error("missing database accepted")
+	}
+}
@@ -7,15 +7,33 @@ import (
 	"path/filepath"
 )
 
+// Форматы записи логов
+const (
+	FormatText = "text" // Строки log.LstdFlags с файлом и строкой вызова
+	FormatJSON = "json" // Один JSON-объект на строку: time, level, msg, caller и поля
+)
+
 var (
 	InfoLog   *log.Logger
 	ErrorLog  *log.Logger
-	infoFile  *os.File
-	errorFile *os.File
+	infoFile  *rotatingFile
+	errorFile *rotatingFile
 )
 
-// Init инициализирует логгеры для записи только в файлы
+// Options формат и ротация логов
+type Options struct {
+	Format     string // FormatText или FormatJSON (другие значения — текст)
+	MaxSizeMB  int    // Размер файла, после которого он ротируется (<= 0 — без ротации)
+	MaxBackups int    // Сколько копий info.log.1, info.log.2... хранить (0 — только обрезать)
+}
+
+// Init инициализирует логгеры для записи только в файлы (текстовый формат, без ротации)
 func Init(logsPath string) error {
+	return InitWithOptions(logsPath, Options{Format: FormatText})
+}
+
+// InitWithOptions инициализирует логгеры info.log и error.log в logsPath
+func InitWithOptions(logsPath string, opts Options) error {
 	// Создать директорию для логов
 	if err := os.MkdirAll(logsPath, 0755); err != nil {
 		return fmt.Errorf("failed to create logs directory: %w", err)
@@ -23,23 +41,30 @@ func Init(logsPath string) error {
 
 	// Открыть info.log (append mode)
 	infoPath := filepath.Join(logsPath, "info.log")
+	maxSize := int64(opts.MaxSizeMB) * 1024 * 1024
 	var err error
-	infoFile, err = os.OpenFile(infoPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	infoFile, err = openRotatingFile(infoPath, maxSize, opts.MaxBackups)
 	if err != nil {
 		return fmt.Errorf("failed to create info.log: %w", err)
 	}
 
 	// Открыть error.log (append mode)
 	errorPath := filepath.Join(logsPath, "error.log")
-	errorFile, err = os.OpenFile(errorPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	errorFile, err = openRotatingFile(errorPath, maxSize, opts.MaxBackups)
 	if err != nil {
 		infoFile.Close()
 		return fmt.Errorf("failed to create error.log: %w", err)
 	}
 
 	// Настроить логгеры (ТОЛЬКО запись в файлы, БЕЗ stdout)
-	InfoLog = log.New(infoFile, "", log.LstdFlags|log.Lshortfile)
-	ErrorLog = log.New(errorFile, "", log.LstdFlags|log.Lshortfile)
+	if opts.Format == FormatJSON {
+		// Время добавляет jsonWriter, файл и строку он переносит в поле caller
+		InfoLog = log.New(&jsonWriter{out: infoFile, level: levelInfo}, "", log.Lshortfile)
+		ErrorLog = log.New(&jsonWriter{out: errorFile, level: levelError}, "", log.Lshortfile)
+	} else {
+		InfoLog = log.New(infoFile, "", log.LstdFlags|log.Lshortfile)
+		ErrorLog = log.New(errorFile, "", log.LstdFlags|log.Lshortfile)
+	}
 
 	// Первая запись в лог для подтверждения что логирование работает
 	InfoLog.Printf("Logger initialized successfully. Logs directory: %s", logsPath)
@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSONFormatLinesParse(t *testing.T) {
+	dir := t.TempDir()
+	if err := InitWithOptions(dir, Options{Format: FormatJSON}); err != nil {
+		t.Fatal(err)
+	}
+	InfoLog.Printf("plain message with \"quotes\"")
+	Infof("Scan finished", "files", 3, "err", errors.New("disk full"), "odd")
+	Errorf("Thumbnail failed", "id", "abc")
+	if err := Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readJSONLines(t, filepath.Join(dir, "info.log"))
+	last := entries[len(entries)-1]
+	if last["msg"] != "Scan finished" || last["level"] != "info" {
+		t.Errorf("entry = %v, want info Scan finished", last)
+	}
+	if last["files"] != float64(3) || last["err"] != "disk full" || last["!BADKEY"] != "odd" {
+		t.Errorf("fields = %v", last)
+	}
+	if caller, _ := last["caller"].(string); !strings.HasPrefix(caller, "logger_test.go:") {
+		t.Errorf("caller = %q, want logger_test.go:N", caller)
+	}
+	if _, ok := last["time"]; !ok {
+		t.Error("entry has no time")
+	}
+
+	errEntries := readJSONLines(t, filepath.Join(dir, "error.log"))
+	if len(errEntries) != 1 || errEntries[0]["level"] != "error" || errEntries[0]["id"] != "abc" {
+		t.Errorf("error.log = %v", errEntries)
+	}
+}
+
+// readJSONLines разбирает каждую строку файла как JSON-объект
+func readJSONLines(tb testing.TB, path string) []map[string]interface{} {
+	tb.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			tb.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		tb.Fatalf("%s is empty", path)
+	}
+	return entries
+}
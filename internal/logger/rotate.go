@@ -0,0 +1,120 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile файл лога, который при превышении maxSize переименовывается
+// в path.1 (старые копии сдвигаются до path.N) и открывается заново.
+// Проверка размера идет под тем же мьютексом, что и запись, поэтому гонок с ротацией нет.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64 // <= 0 — без ротации
+	maxBackups int   // Сколько копий хранить; 0 — только обрезать файл
+	file       *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open открывает path в режиме дописывания и запоминает текущий размер
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Пустой файл не ротируем: запись больше лимита все равно надо куда-то писать
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			// Не теряем записи: пишем в старый файл, если он еще открыт
+			fmt.Fprintf(os.Stderr, "log rotation failed for %s: %v\n", f.path, err)
+		}
+	}
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate сдвигает копии path.1..path.N-1 на одну, переименовывает path в path.1 и открывает новый path
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if f.maxBackups > 0 {
+		os.Remove(backupPath(f.path, f.maxBackups))
+		for n := f.maxBackups - 1; n >= 1; n-- {
+			if err := os.Rename(backupPath(f.path, n), backupPath(f.path, n+1)); err != nil && !os.IsNotExist(err) {
+				return f.reopen(err)
+			}
+		}
+		if err := os.Rename(f.path, backupPath(f.path, 1)); err != nil {
+			return f.reopen(err)
+		}
+	} else if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+		return f.reopen(err)
+	}
+
+	return f.open()
+}
+
+// reopen снова открывает текущий файл после неудачной ротации и возвращает исходную ошибку
+func (f *rotatingFile) reopen(err error) error {
+	if openErr := f.open(); openErr != nil {
+		return fmt.Errorf("%w; reopen: %v", err, openErr)
+	}
+	return err
+}
+
+// backupPath имя n-й копии: info.log.1, info.log.2...
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+func (f *rotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
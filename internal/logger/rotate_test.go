@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFileKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	f, err := openRotatingFile(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first", "second", "third"} {
+		if _, err := f.Write([]byte(strings.Repeat(line[:1], 59) + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Третья запись сдвинула копии: .2 — самая старая, активный файл только с последней
+	for name, want := range map[string]string{"": "t", ".1": "s", ".2": "f"} {
+		data, err := os.ReadFile(path + name)
+		if err != nil {
+			t.Fatalf("info.log%s: %v", name, err)
+		}
+		if len(data) != 60 || string(data[:1]) != want {
+			t.Errorf("info.log%s = %d bytes starting %q, want 60 starting %q", name, len(data), data[:1], want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("more backups than max_backups")
+	}
+}
+
+func TestRotatingFileWithoutBackupsTruncates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "error.log")
+	f, err := openRotatingFile(path, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte(strings.Repeat("a", 80)))
+	f.Write([]byte(strings.Repeat("b", 40)))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != strings.Repeat("b", 40) {
+		t.Errorf("active file = %q, want only the last write", data)
+	}
+	if _, err := os.Stat(path + ".1"); err == nil {
+		t.Error("backup created with max_backups 0")
+	}
+}
@@ -0,0 +1,138 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Уровни записей в JSON
+const (
+	levelInfo  = "info"
+	levelError = "error"
+)
+
+// jsonWriter превращает строки log.Logger (с флагом Lshortfile) в JSON-объекты
+type jsonWriter struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level string
+}
+
+// Write разбирает "file.go:12: сообщение" из log.Logger
+func (w *jsonWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+	caller := ""
+	if i := strings.Index(line, ": "); i > 0 {
+		caller, line = line[:i], line[i+2:]
+	}
+	if err := w.writeEntry(caller, line, nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeEntry пишет одну запись; ключи идут в порядке time, level, msg, caller, затем поля
+func (w *jsonWriter) writeEntry(caller, msg string, keysAndValues []interface{}) error {
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJSONValue(&buf, time.Now().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSONValue(&buf, w.level)
+	buf.WriteString(`,"msg":`)
+	writeJSONValue(&buf, msg)
+	if caller != "" {
+		buf.WriteString(`,"caller":`)
+		writeJSONValue(&buf, caller)
+	}
+	for _, field := range pairs(keysAndValues) {
+		buf.WriteByte(',')
+		writeJSONValue(&buf, field.key)
+		buf.WriteByte(':')
+		writeJSONValue(&buf, field.value)
+	}
+	buf.WriteString("}\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.out.Write(buf.Bytes())
+	return err
+}
+
+// writeJSONValue кодирует значение; ошибки и значения, которые не кодируются, — строкой
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(data)
+}
+
+// field пара ключ-значение контекста записи
+type field struct {
+	key   string
+	value interface{}
+}
+
+// pairs разбирает список ключ, значение, ключ, значение...
+// Значение без ключа попадает под "!BADKEY", как в log/slog.
+func pairs(keysAndValues []interface{}) []field {
+	var fields []field
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 == len(keysAndValues) {
+			fields = append(fields, field{key: "!BADKEY", value: keysAndValues[i]})
+			break
+		}
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		fields = append(fields, field{key: key, value: keysAndValues[i+1]})
+	}
+	return fields
+}
+
+// Infof пишет в info.log сообщение с контекстом: Infof("Scan finished", "files", 120, "took", d).
+// В текстовом формате поля дописываются как key=value.
+func Infof(msg string, keysAndValues ...interface{}) {
+	logEntry(InfoLog, msg, keysAndValues)
+}
+
+// Errorf пишет в error.log сообщение с контекстом, как Infof
+func Errorf(msg string, keysAndValues ...interface{}) {
+	logEntry(ErrorLog, msg, keysAndValues)
+}
+
+// logEntry общая часть Infof и Errorf; вызывающий код — на два кадра выше
+func logEntry(l *log.Logger, msg string, keysAndValues []interface{}) {
+	if w, ok := l.Writer().(*jsonWriter); ok {
+		caller := ""
+		if _, file, line, ok := runtime.Caller(2); ok {
+			caller = filepath.Base(file) + ":" + strconv.Itoa(line)
+		}
+		w.writeEntry(caller, msg, keysAndValues)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(msg)
+	for _, field := range pairs(keysAndValues) {
+		value := fmt.Sprint(field.value)
+		if value == "" || strings.ContainsAny(value, " =\"") {
+			value = strconv.Quote(value)
+		}
+		text.WriteString(" " + field.key + "=" + value)
+	}
+	l.Output(3, text.String())
+}
@@ -0,0 +1,126 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Параметры BlurHash: число компонент по горизонтали и вертикали
+const (
+	blurHashComponentsX = 4
+	blurHashComponentsY = 3
+	blurHashSampleSize  = 32 // Изображение уменьшается до этого размера перед кодированием
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash кодирует изображение в строку BlurHash (https://blurha.sh)
+func BlurHash(img image.Image) (string, error) {
+	if img.Bounds().Dx() == 0 || img.Bounds().Dy() == 0 {
+		return "", fmt.Errorf("empty image")
+	}
+
+	// Для BlurHash достаточно крошечной копии — так кодирование почти бесплатно
+	small := imaging.Fit(img, blurHashSampleSize, blurHashSampleSize, imaging.Box)
+	width, height := small.Bounds().Dx(), small.Bounds().Dy()
+
+	// Переводим пиксели в линейное пространство один раз
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := small.NRGBAAt(x, y)
+			linear[y*width+x] = [3]float64{sRGBToLinear(c.R), sRGBToLinear(c.G), sRGBToLinear(c.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, blurHashComponentsX*blurHashComponentsY)
+	for j := 0; j < blurHashComponentsY; j++ {
+		for i := 0; i < blurHashComponentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1.0
+			}
+			var r, g, b float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					p := linear[y*width+x]
+					r += basis * p[0]
+					g += basis * p[1]
+					b += basis * p[2]
+				}
+			}
+			scale := 1.0 / float64(width*height)
+			factors = append(factors, [3]float64{r * scale, g * scale, b * scale})
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(encodeBase83((blurHashComponentsX-1)+(blurHashComponentsY-1)*9, 1))
+
+	// Максимум AC компонент задает масштаб квантования
+	maxValue := 1.0
+	ac := factors[1:]
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		sb.WriteString(encodeBase83(quantisedMax, 1))
+	} else {
+		sb.WriteString(encodeBase83(0, 1))
+	}
+
+	dc := factors[0]
+	sb.WriteString(encodeBase83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	for _, f := range ac {
+		sb.WriteString(encodeBase83(encodeAC(f, maxValue), 2))
+	}
+
+	return sb.String(), nil
+}
+
+func encodeAC(f [3]float64, maxValue float64) int {
+	quant := func(v float64) int {
+		return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+	}
+	return quant(f[0])*19*19 + quant(f[1])*19 + quant(f[2])
+}
+
+func encodeBase83(value, length int) string {
+	buf := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		buf[i-1] = base83Chars[digit]
+	}
+	return string(buf)
+}
+
+func sRGBToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
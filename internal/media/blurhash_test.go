@@ -0,0 +1,53 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestBlurHashSolidColor(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.RGBA{A: 255})
+		}
+	}
+	// 4x3 компоненты ("L"), нулевой максимум AC, черный DC и 11 нулевых AC
+	want := "L00000" + strings.Repeat("fQ", 11)
+	if got, err := BlurHash(img); err != nil || got != want {
+		t.Errorf("BlurHash(black) = %q, %v; want %q", got, err, want)
+	}
+
+	if _, err := BlurHash(image.NewRGBA(image.Rect(0, 0, 0, 10))); err == nil {
+		t.Error("BlurHash of an empty image succeeded")
+	}
+}
+
+func TestSmallThumbnailComputesBlurHash(t *testing.T) {
+	g, m := thumbnailFixture(t, "jpeg", false)
+
+	if _, err := g.GenerateThumbnail(m, "medium"); err != nil {
+		t.Fatal(err)
+	}
+	if m.BlurHash != "" {
+		t.Errorf("medium thumbnail set BlurHash %q, want only small", m.BlurHash)
+	}
+
+	if _, err := g.GenerateThumbnail(m, "small"); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.BlurHash) != 28 || m.BlurHash[0] != 'L' {
+		t.Errorf("BlurHash = %q, want a 4x3 hash", m.BlurHash)
+	}
+
+	// Готовое превью не пересоздается, но BlurHash старой записи досчитывается по нему
+	m.BlurHash = ""
+	if _, err := g.GenerateThumbnail(m, "small"); err != nil {
+		t.Fatal(err)
+	}
+	if m.BlurHash == "" {
+		t.Error("BlurHash not filled from the existing small thumbnail")
+	}
+}
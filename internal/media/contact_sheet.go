@@ -0,0 +1,100 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// Ограничения контактного листа
+const (
+	ContactSheetMaxItems    = 500
+	ContactSheetMaxColumns  = 20
+	ContactSheetMaxCellSize = 600
+	ContactSheetMaxPadding  = 100
+	ContactSheetMaxPixels   = 40_000_000 // ~160 МБ в RGBA
+)
+
+// ErrContactSheetTooLarge лист с такими параметрами превышает ContactSheetMaxPixels
+var ErrContactSheetTooLarge = errors.New("contact sheet is too large")
+
+// ContactSheetOptions параметры контактного листа
+type ContactSheetOptions struct {
+	Columns  int // Количество колонок
+	CellSize int // Размер ячейки в пикселях (квадрат)
+	Padding  int // Отступ между ячейками
+}
+
+// ContactSheet собирает превью медиа в одно изображение-сетку.
+// Использует маленькие превью (генерирует недостающие), медиа без превью пропускаются.
+func (t *ThumbnailGenerator) ContactSheet(items []*storage.Media, opts ContactSheetOptions) (image.Image, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no media for contact sheet")
+	}
+	if len(items) > ContactSheetMaxItems {
+		items = items[:ContactSheetMaxItems]
+	}
+	if opts.Columns <= 0 {
+		opts.Columns = 5
+	}
+	if opts.Columns > ContactSheetMaxColumns {
+		opts.Columns = ContactSheetMaxColumns
+	}
+	if opts.CellSize <= 0 {
+		opts.CellSize = 200
+	}
+	if opts.CellSize > ContactSheetMaxCellSize {
+		opts.CellSize = ContactSheetMaxCellSize
+	}
+	if opts.Padding < 0 {
+		opts.Padding = 0
+	}
+	if opts.Padding > ContactSheetMaxPadding {
+		opts.Padding = ContactSheetMaxPadding
+	}
+
+	columns := opts.Columns
+	if len(items) < columns {
+		columns = len(items)
+	}
+	rows := (len(items) + columns - 1) / columns
+
+	step := opts.CellSize + opts.Padding
+	width := columns*step + opts.Padding
+	height := rows*step + opts.Padding
+	if width*height > ContactSheetMaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d, limit %d pixels", ErrContactSheetTooLarge, width, height, ContactSheetMaxPixels)
+	}
+
+	sheet := imaging.New(width, height, color.White)
+
+	for i, m := range items {
+		thumbPath, err := t.GenerateThumbnail(m, "small")
+		if err != nil {
+			logger.InfoLog.Printf("Contact sheet: skipping %s: %v", m.ID, err)
+			continue
+		}
+
+		thumb, err := imaging.Open(thumbPath)
+		if err != nil {
+			logger.InfoLog.Printf("Contact sheet: failed to open thumbnail %s: %v", thumbPath, err)
+			continue
+		}
+
+		// Вписываем превью в ячейку с сохранением пропорций и центрируем
+		cell := imaging.Fit(thumb, opts.CellSize, opts.CellSize, imaging.Lanczos)
+		col := i % columns
+		row := i / columns
+		x := opts.Padding + col*step + (opts.CellSize-cell.Bounds().Dx())/2
+		y := opts.Padding + row*step + (opts.CellSize-cell.Bounds().Dy())/2
+		sheet = imaging.Paste(sheet, cell, image.Pt(x, y))
+	}
+
+	return sheet, nil
+}
@@ -0,0 +1,60 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// contactSheetItems медиа с готовыми маленькими превью 16x8
+func contactSheetItems(tb testing.TB, g *ThumbnailGenerator, n int) []*storage.Media {
+	tb.Helper()
+	items := make([]*storage.Media, n)
+	for i := range items {
+		items[i] = &storage.Media{ID: fmt.Sprintf("media-%d", i)}
+		writeTestImage(tb, g.GetThumbnailPath(items[i].ID, "small"))
+	}
+	return items
+}
+
+func TestContactSheetDimensions(t *testing.T) {
+	g := newTestGenerator(t)
+	for _, tc := range []struct {
+		name          string
+		items         int
+		opts          ContactSheetOptions
+		width, height int
+	}{
+		{"grid", 7, ContactSheetOptions{Columns: 3, CellSize: 100, Padding: 10}, 340, 340},
+		{"fewer items than columns", 2, ContactSheetOptions{Columns: 5, CellSize: 50, Padding: 4}, 112, 58},
+		{"defaults", 6, ContactSheetOptions{}, 1000, 400},
+		{"negative padding", 4, ContactSheetOptions{Columns: 2, CellSize: 30, Padding: -5}, 60, 60},
+		{"clamped columns", 25, ContactSheetOptions{Columns: 50, CellSize: 10}, 200, 20},
+		{"clamped cell size and padding", 3, ContactSheetOptions{CellSize: 5000, Padding: 1 << 30}, 2200, 800},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sheet, err := g.ContactSheet(contactSheetItems(t, g, tc.items), tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := sheet.Bounds(); b.Dx() != tc.width || b.Dy() != tc.height {
+				t.Errorf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tc.width, tc.height)
+			}
+		})
+	}
+}
+
+func TestContactSheetPixelBudget(t *testing.T) {
+	g := newTestGenerator(t)
+	// Превью не нужны: размер проверяется до сборки листа
+	items := make([]*storage.Media, ContactSheetMaxItems+1)
+	for i := range items {
+		items[i] = &storage.Media{ID: fmt.Sprintf("media-%d", i)}
+	}
+	_, err := g.ContactSheet(items, ContactSheetOptions{Columns: ContactSheetMaxColumns, CellSize: ContactSheetMaxCellSize, Padding: ContactSheetMaxPadding})
+	if !errors.Is(err, ErrContactSheetTooLarge) {
+		t.Fatalf("err = %v, want ErrContactSheetTooLarge", err)
+	}
+}
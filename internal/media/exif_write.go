@@ -0,0 +1,175 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	exif "github.com/dsoprea/go-exif/v3"
+	exifcommon "github.com/dsoprea/go-exif/v3/common"
+)
+
+// ErrExifUnsupported формат файла не хранит EXIF (PNG, GIF, видео) — записать некуда
+var ErrExifUnsupported = errors.New("file format does not support EXIF writing")
+
+// exifHeader начало payload сегмента APP1 с EXIF
+var exifHeader = []byte("Exif\x00\x00")
+
+const (
+	jpegMarkerSOI  = 0xD8
+	jpegMarkerSOS  = 0xDA
+	jpegMarkerAPP0 = 0xE0
+	jpegMarkerAPP1 = 0xE1
+
+	maxSegmentPayload = 0xFFFF - 2 // Длина сегмента JPEG включает сами 2 байта длины
+)
+
+// WriteOrientation записывает EXIF Orientation (1-8) в JPEG
+func WriteOrientation(path string, orientation int) error {
+	if orientation < 1 || orientation > 8 {
+		return fmt.Errorf("invalid orientation %d", orientation)
+	}
+	return updateExif(path, func(rootIb *exif.IfdBuilder) error {
+		return setStandardTag(rootIb, "Orientation", []uint16{uint16(orientation)})
+	})
+}
+
+// WriteDateTaken записывает дату съемки (DateTimeOriginal и DateTimeDigitized) в JPEG
+func WriteDateTaken(path string, t time.Time) error {
+	value := t.Format("2006:01:02 15:04:05")
+	return updateExif(path, func(rootIb *exif.IfdBuilder) error {
+		exifIb, err := exif.GetOrCreateIbFromRootIb(rootIb, "IFD/Exif")
+		if err != nil {
+			return fmt.Errorf("failed to get EXIF IFD: %w", err)
+		}
+		for _, name := range []string{"DateTimeOriginal", "DateTimeDigitized"} {
+			if err := setStandardTag(exifIb, name, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// setStandardTag заменяет тег или добавляет его, если в IFD его еще нет
+func setStandardTag(ib *exif.IfdBuilder, name string, value interface{}) error {
+	if _, err := ib.FindTagWithName(name); err == nil {
+		return ib.SetStandardWithName(name, value)
+	}
+	return ib.AddStandardWithName(name, value)
+}
+
+// updateExif читает EXIF из JPEG (или создает пустой), применяет edit и перезаписывает файл.
+// Файл заменяется через временный в той же папке, чтобы сбой не оставил обрезанный снимок.
+func updateExif(path string, edit func(rootIb *exif.IfdBuilder) error) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".jpg" && ext != ".jpeg" {
+		return fmt.Errorf("%w: %s", ErrExifUnsupported, ext)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	start, end, err := findExifSegment(data)
+	if err != nil {
+		return err
+	}
+
+	rootIb, err := exifBuilder(data[start:end])
+	if err != nil {
+		return err
+	}
+	if err := edit(rootIb); err != nil {
+		return err
+	}
+
+	encoded, err := exif.NewIfdByteEncoder().EncodeToExif(rootIb)
+	if err != nil {
+		return fmt.Errorf("failed to encode EXIF: %w", err)
+	}
+	payload := append(append([]byte{}, exifHeader...), encoded...)
+	if len(payload) > maxSegmentPayload {
+		return fmt.Errorf("EXIF too large: %d bytes", len(payload))
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data) + len(payload) + 4)
+	out.Write(data[:start])
+	out.Write([]byte{0xFF, jpegMarkerAPP1})
+	binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+	out.Write(data[end:])
+
+	// Права файла сохраняются, временный .tmp watcher не примет за новое фото
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, info.Mode().Perm(), func(f *os.File) error {
+		_, err := f.Write(out.Bytes())
+		return err
+	})
+}
+
+// findExifSegment возвращает границы сегмента APP1 с EXIF (вместе с маркером).
+// Если EXIF нет, start == end — место для вставки после SOI и JFIF (APP0).
+func findExifSegment(data []byte) (start, end int, err error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegMarkerSOI {
+		return 0, 0, fmt.Errorf("%w: not a JPEG file", ErrExifUnsupported)
+	}
+
+	insertAt := 2
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return 0, 0, fmt.Errorf("corrupt JPEG: no marker at offset %d", pos)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF { // Заполняющие байты перед маркером
+			pos++
+			continue
+		}
+		if marker == jpegMarkerSOS {
+			break // Дальше сжатые данные, EXIF там не бывает
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		next := pos + 2 + length
+		if length < 2 || next > len(data) {
+			return 0, 0, fmt.Errorf("corrupt JPEG: bad segment length at offset %d", pos)
+		}
+		if marker == jpegMarkerAPP1 && bytes.HasPrefix(data[pos+4:next], exifHeader) {
+			return pos, next, nil
+		}
+		if marker == jpegMarkerAPP0 && insertAt == pos {
+			insertAt = next
+		}
+		pos = next
+	}
+	return insertAt, insertAt, nil
+}
+
+// exifBuilder строит IfdBuilder из сегмента APP1 или пустой IFD0, если сегмента нет
+func exifBuilder(segment []byte) (*exif.IfdBuilder, error) {
+	im, err := exifcommon.NewIfdMappingWithStandard()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IFD mapping: %w", err)
+	}
+	ti := exif.NewTagIndex()
+
+	if len(segment) == 0 {
+		return exif.NewIfdBuilder(im, ti, exifcommon.IfdStandardIfdIdentity, exifcommon.EncodeDefaultByteOrder), nil
+	}
+
+	rawExif := segment[4+len(exifHeader):]
+	_, index, err := exif.Collect(im, ti, rawExif)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse EXIF: %w", err)
+	}
+	return exif.NewIfdBuilderFromExistingChain(index.RootIfd), nil
+}
@@ -0,0 +1,187 @@
+package media
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	exif "github.com/dsoprea/go-exif/v3"
+
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/scanner"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// writeTestImage пишет картинку 16x8 в JPEG или PNG по расширению path
+func writeTestImage(tb testing.TB, path string) {
+	tb.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 32), B: 128, A: 255})
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	if filepath.Ext(path) == ".png" {
+		err = png.Encode(f, img)
+	} else {
+		err = jpeg.Encode(f, img, nil)
+	}
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// readMetadata извлекает метаданные файла так же, как сканер
+func readMetadata(tb testing.TB, path string) *storage.Media {
+	tb.Helper()
+	if err := logger.Init(filepath.Join(tb.TempDir(), "logs")); err != nil {
+		tb.Fatal(err)
+	}
+	m := &storage.Media{Path: path}
+	if err := scanner.ExtractMetadata(path, m, time.UTC); err != nil {
+		tb.Fatalf("ExtractMetadata: %v", err)
+	}
+	return m
+}
+
+func TestWriteOrientationRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	writeTestImage(t, path)
+
+	// Файл без EXIF: сегмент создается
+	if err := WriteOrientation(path, 6); err != nil {
+		t.Fatal(err)
+	}
+	if got := readMetadata(t, path).Metadata.Orientation; got != 6 {
+		t.Fatalf("orientation = %d, want 6", got)
+	}
+
+	// Повторная запись заменяет тег, а не добавляет второй
+	if err := WriteOrientation(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	if got := readMetadata(t, path).Metadata.Orientation; got != 3 {
+		t.Errorf("orientation after rewrite = %d, want 3", got)
+	}
+
+	// Пиксели не тронуты: JPEG по-прежнему декодируется с прежним размером
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, err := jpeg.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("rewritten JPEG does not decode: %v", err)
+	}
+	if cfg.Width != 16 || cfg.Height != 8 {
+		t.Errorf("size = %dx%d, want 16x8", cfg.Width, cfg.Height)
+	}
+}
+
+func TestWriteDateTakenRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	writeTestImage(t, path)
+	if err := WriteOrientation(path, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	taken := time.Date(2019, 7, 14, 18, 30, 5, 0, time.UTC)
+	if err := WriteDateTaken(path, taken); err != nil {
+		t.Fatal(err)
+	}
+	m := readMetadata(t, path)
+	if !m.TakenAt.Equal(taken) {
+		t.Errorf("taken at = %v, want %v", m.TakenAt, taken)
+	}
+	if m.Metadata.Orientation != 1 {
+		t.Errorf("orientation lost after date write: %d", m.Metadata.Orientation)
+	}
+}
+
+func TestWriteOrientationRejectsPNG(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.png")
+	writeTestImage(t, path)
+
+	if err := WriteOrientation(path, 6); !errors.Is(err, ErrExifUnsupported) {
+		t.Errorf("PNG error = %v, want ErrExifUnsupported", err)
+	}
+	if err := WriteOrientation(filepath.Join(t.TempDir(), "x.jpg"), 9); err == nil {
+		t.Error("orientation 9 accepted")
+	}
+}
+
+func TestExtractMetadataReadsOffsetTimeOriginal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	writeTestImage(t, path)
+	if err := WriteDateTaken(path, time.Date(2023, 7, 14, 18, 30, 5, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	err := updateExif(path, func(rootIb *exif.IfdBuilder) error {
+		exifIb, err := exif.GetOrCreateIbFromRootIb(rootIb, "IFD/Exif")
+		if err != nil {
+			return err
+		}
+		return setStandardTag(exifIb, "OffsetTimeOriginal", "+02:00")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &storage.Media{Path: path}
+	if err := logger.Init(filepath.Join(t.TempDir(), "logs")); err != nil {
+		t.Fatal(err)
+	}
+	// Пояс по умолчанию не должен влиять на дату со смещением
+	if err := scanner.ExtractMetadata(path, m, time.FixedZone("MSK", 3*3600)); err != nil {
+		t.Fatal(err)
+	}
+	if m.Metadata.TZOffset != "+02:00" {
+		t.Errorf("tz offset = %q, want +02:00", m.Metadata.TZOffset)
+	}
+	if want := time.Date(2023, 7, 14, 16, 30, 5, 0, time.UTC); !m.TakenAt.Equal(want) {
+		t.Errorf("taken at = %v, want %v", m.TakenAt.UTC(), want)
+	}
+}
+
+func TestExtractMetadataReadsAttribution(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	writeTestImage(t, path)
+	err := updateExif(path, func(rootIb *exif.IfdBuilder) error {
+		for name, value := range map[string]string{
+			"Software":  "Darktable 4.6",
+			"Artist":    "  Anna Petrova ",
+			"Copyright": "(c) 2024 Anna Petrova",
+		} {
+			if err := setStandardTag(rootIb, name, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := readMetadata(t, path).Metadata
+	if meta.Software != "Darktable 4.6" {
+		t.Errorf("software = %q", meta.Software)
+	}
+	if meta.Artist != "Anna Petrova" {
+		t.Errorf("artist = %q, want trimmed %q", meta.Artist, "Anna Petrova")
+	}
+	if meta.Copyright != "(c) 2024 Anna Petrova" {
+		t.Errorf("copyright = %q", meta.Copyright)
+	}
+}
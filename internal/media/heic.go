@@ -0,0 +1,108 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+
+	"github.com/photocore/photocore/internal/logger"
+)
+
+// heicDecoder декодирует HEIC/HEIF одним из способов цепочки Tools.HeicChain
+type heicDecoder func(path string) (image.Image, error)
+
+// defaultHEICDecoders декодеры HEIC по именам из конфигурации
+func (t *ThumbnailGenerator) defaultHEICDecoders() map[string]heicDecoder {
+	return map[string]heicDecoder{
+		"native":       t.decodeHEICNative,
+		"heif-convert": t.decodeHEICHeifConvert,
+		"ffmpeg":       t.decodeHEICFfmpeg,
+	}
+}
+
+// heicOrientingDecoders декодеры, которые сами применяют поворот и отражение
+// из контейнера HEIF (irot/imir). По спецификации HEIF они главнее EXIF Orientation,
+// поэтому повторно поворачивать результат по EXIF нельзя — iPhone пишет оба.
+var heicOrientingDecoders = map[string]bool{
+	"heif-convert": true,
+	"ffmpeg":       true,
+}
+
+// isHEIC проверяет расширение HEIC/HEIF
+func isHEIC(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".heic" || ext == ".heif"
+}
+
+// loadHEIC пробует декодеры по порядку Tools.HeicChain до первого успешного.
+// oriented — пиксели уже повернуты декодером и EXIF Orientation применять не нужно.
+func (t *ThumbnailGenerator) loadHEIC(path string) (img image.Image, oriented bool, err error) {
+	var errs []string
+	for _, name := range t.cfg.Tools.HeicChain {
+		decode, ok := t.heicDecoders[name]
+		if !ok {
+			errs = append(errs, name+": unknown decoder")
+			continue
+		}
+		img, err := decode(path)
+		if err != nil {
+			errs = append(errs, name+": "+err.Error())
+			continue
+		}
+		logger.InfoLog.Printf("HEIC %s decoded via %s", filepath.Base(path), name)
+		return img, heicOrientingDecoders[name], nil
+	}
+	// Формат "unsupported format:" — постоянная ошибка, превью не будет повторяться
+	return nil, false, fmt.Errorf("unsupported format: no HEIC decoder succeeded (%s)", strings.Join(errs, "; "))
+}
+
+// decodeHEICNative декодирует через зарегистрированные в сборке декодеры image
+func (t *ThumbnailGenerator) decodeHEICNative(path string) (image.Image, error) {
+	return imaging.Open(path)
+}
+
+// decodeHEICHeifConvert конвертирует через heif-convert (libheif) во временный JPEG
+func (t *ThumbnailGenerator) decodeHEICHeifConvert(path string) (image.Image, error) {
+	tmp, err := os.CreateTemp("", "photocore-heic-*.jpg")
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	// heif-convert -q 90 photo.heic out.jpg
+	cmd := exec.Command(t.cfg.Tools.HeifConvert, "-q", "90", path, tmpPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("heif-convert failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return imaging.Open(tmpPath)
+}
+
+// decodeHEICFfmpeg декодирует первый кадр через ffmpeg
+func (t *ThumbnailGenerator) decodeHEICFfmpeg(path string) (image.Image, error) {
+	// ffmpeg -i photo.heic -frames:v 1 -f image2pipe -vcodec mjpeg -
+	cmd := exec.Command(t.cfg.Tools.Ffmpeg,
+		"-i", path,
+		"-frames:v", "1",
+		"-f", "image2pipe",
+		"-vcodec", "mjpeg",
+		"-",
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w", err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(output))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ffmpeg output: %w", err)
+	}
+	return img, nil
+}
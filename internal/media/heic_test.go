@@ -0,0 +1,100 @@
+package media
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func TestHEICDecoderChainFallback(t *testing.T) {
+	g, _ := thumbnailFixture(t, "jpeg", false)
+	var calls []string
+	decoder := func(name string, fail bool) heicDecoder {
+		return func(path string) (image.Image, error) {
+			calls = append(calls, name)
+			if fail {
+				return nil, errors.New("cannot decode")
+			}
+			return image.NewRGBA(image.Rect(0, 0, 4, 4)), nil
+		}
+	}
+	g.heicDecoders = map[string]heicDecoder{
+		"native":       decoder("native", true),
+		"heif-convert": decoder("heif-convert", false),
+		"ffmpeg":       decoder("ffmpeg", false),
+	}
+
+	// Первый успешный декодер останавливает цепочку, неизвестные имена пропускаются
+	g.cfg.Tools.HeicChain = []string{"libde265", "native", "heif-convert", "ffmpeg"}
+	img, _, err := g.loadImage("/photos/IMG_0001.HEIC")
+	if err != nil || img == nil {
+		t.Fatalf("loadImage = %v, %v; want the heif-convert result", img, err)
+	}
+	if !slices.Equal(calls, []string{"native", "heif-convert"}) {
+		t.Errorf("decoders called = %v, want native then heif-convert", calls)
+	}
+
+	// Все способы не справились: постоянная ошибка с причинами каждого
+	calls = nil
+	g.cfg.Tools.HeicChain = []string{"native", "libde265"}
+	_, _, err = g.loadImage("/photos/IMG_0002.heif")
+	if err == nil || !strings.HasPrefix(err.Error(), "unsupported format:") {
+		t.Fatalf("error = %v, want an unsupported format error", err)
+	}
+	for _, part := range []string{"native: cannot decode", "libde265: unknown decoder"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("error %q does not mention %q", err, part)
+		}
+	}
+}
+
+func TestHEICOrientationAppliedOnce(t *testing.T) {
+	g, _ := thumbnailFixture(t, "jpeg", false)
+	g.cfg.Thumbnails.TrustOrientation = true
+	landscape := func(path string) (image.Image, error) {
+		return image.NewRGBA(image.Rect(0, 0, 16, 8)), nil
+	}
+	g.heicDecoders = map[string]heicDecoder{"native": landscape, "heif-convert": landscape}
+
+	tests := []struct {
+		decoder string
+		rotated bool
+	}{
+		{"native", true},        // Декодер отдает пиксели как есть — поворачиваем по EXIF
+		{"heif-convert", false}, // irot уже применен декодером, повторный поворот положит кадр на бок
+	}
+	// Заголовок ftyp, по которому файл распознается как HEIC; пиксели отдают заглушки декодеров
+	ftyp := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+	for _, tt := range tests {
+		g.cfg.Tools.HeicChain = []string{tt.decoder}
+		path := filepath.Join(t.TempDir(), tt.decoder+".HEIC")
+		if err := os.WriteFile(path, ftyp, 0644); err != nil {
+			t.Fatal(err)
+		}
+		m := &storage.Media{ID: storage.GenerateID(path), Path: path, Type: storage.MediaTypeImage}
+		m.Metadata.Orientation = 6
+		thumb, err := g.GenerateThumbnail(m, "small")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(thumb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := jpeg.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rotated := c.Height > c.Width; rotated != tt.rotated {
+			t.Errorf("%s: thumbnail %dx%d, rotated = %v, want %v", tt.decoder, c.Width, c.Height, rotated, tt.rotated)
+		}
+	}
+}
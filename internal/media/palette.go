@@ -0,0 +1,89 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// Параметры вычисления палитры
+const (
+	PaletteSize       = 5  // Сколько доминирующих цветов сохраняется в Media.Colors
+	paletteSampleSize = 64 // Изображение уменьшается до этого размера перед подсчетом
+	paletteBits       = 3  // Бит на канал при квантовании (8 уровней, 512 корзин)
+	paletteMinDist    = 48 // Минимальное расстояние между цветами палитры (евклидово RGB)
+)
+
+// DominantColors возвращает до n доминирующих цветов изображения (#rrggbb),
+// отсортированных по доле пикселей. Используется гистограмма по квантованным цветам.
+func DominantColors(img image.Image, n int) []string {
+	if img.Bounds().Dx() == 0 || img.Bounds().Dy() == 0 || n <= 0 {
+		return nil
+	}
+
+	small := imaging.Fit(img, paletteSampleSize, paletteSampleSize, imaging.Box)
+
+	type bucket struct {
+		count   int
+		r, g, b int // Суммы для среднего цвета корзины
+	}
+	shift := 8 - paletteBits
+	buckets := make(map[int]*bucket)
+
+	bounds := small.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := small.NRGBAAt(x, y)
+			if c.A < 128 {
+				continue // Прозрачные пиксели не учитываем
+			}
+			key := int(c.R>>shift)<<(2*paletteBits) | int(c.G>>shift)<<paletteBits | int(c.B>>shift)
+			bk := buckets[key]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.r += int(c.R)
+			bk.g += int(c.G)
+			bk.b += int(c.B)
+		}
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].count > sorted[j].count
+	})
+
+	var chosen [][3]int
+	for _, bk := range sorted {
+		if len(chosen) >= n {
+			break
+		}
+		c := [3]int{bk.r / bk.count, bk.g / bk.count, bk.b / bk.count}
+
+		// Пропускаем оттенки, почти совпадающие с уже выбранными
+		distinct := true
+		for _, prev := range chosen {
+			dr, dg, db := c[0]-prev[0], c[1]-prev[1], c[2]-prev[2]
+			if dr*dr+dg*dg+db*db < paletteMinDist*paletteMinDist {
+				distinct = false
+				break
+			}
+		}
+		if distinct {
+			chosen = append(chosen, c)
+		}
+	}
+
+	colors := make([]string, len(chosen))
+	for i, c := range chosen {
+		colors[i] = fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+	}
+	return colors
+}
@@ -0,0 +1,47 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"strconv"
+	"testing"
+)
+
+func TestDominantColorsMostlyRed(t *testing.T) {
+	// 80% красного, полоса синего снизу
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			c := color.RGBA{R: 210, G: 30, B: 25, A: 255}
+			if y >= 80 {
+				c = color.RGBA{R: 20, G: 40, B: 200, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	colors := DominantColors(img, PaletteSize)
+	if len(colors) < 2 {
+		t.Fatalf("colors = %v, want red and blue", colors)
+	}
+
+	r, g, b := hexRGB(t, colors[0])
+	if r < 150 || g > 80 || b > 80 {
+		t.Errorf("dominant color = %s, want red-ish", colors[0])
+	}
+}
+
+func hexRGB(t *testing.T, hex string) (r, g, b int64) {
+	t.Helper()
+	if len(hex) != 7 || hex[0] != '#' {
+		t.Fatalf("color %q is not #rrggbb", hex)
+	}
+	parse := func(s string) int64 {
+		v, err := strconv.ParseInt(s, 16, 64)
+		if err != nil {
+			t.Fatalf("color %q: %v", hex, err)
+		}
+		return v
+	}
+	return parse(hex[1:3]), parse(hex[3:5]), parse(hex[5:7])
+}
@@ -0,0 +1,100 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/photocore/photocore/internal/logger"
+)
+
+// rawDecoder один из способов получить изображение из RAW
+type rawDecoder struct {
+	name   string
+	decode func(path string) (image.Image, error)
+}
+
+// exiftoolPreviewTags теги со встроенным JPEG, от большего к меньшему
+var exiftoolPreviewTags = []string{"JpgFromRaw", "PreviewImage"}
+
+// defaultRAWDecoders цепочка декодеров RAW: встроенное превью через dcraw,
+// превью через exiftool (CR3 и другие форматы, которых не знают старые сборки dcraw),
+// затем полное декодирование dcraw в половинном размере
+func (t *ThumbnailGenerator) defaultRAWDecoders() []rawDecoder {
+	return []rawDecoder{
+		{name: "dcraw embedded", decode: t.decodeRAWEmbedded},
+		{name: "exiftool preview", decode: t.decodeRAWExiftool},
+		{name: "dcraw half-size", decode: t.decodeRAWHalfSize},
+	}
+}
+
+// loadRawImage загружает RAW-изображение первым успешным декодером цепочки
+func (t *ThumbnailGenerator) loadRawImage(path string) (image.Image, error) {
+	var errs []string
+	for _, decoder := range t.rawDecoders {
+		img, err := decoder.decode(path)
+		if err != nil {
+			errs = append(errs, decoder.name+": "+err.Error())
+			continue
+		}
+		logger.InfoLog.Printf("RAW %s decoded via %s", filepath.Base(path), decoder.name)
+		return img, nil
+	}
+	return nil, fmt.Errorf("no RAW decoder succeeded (%s)", strings.Join(errs, "; "))
+}
+
+// decodeRAWEmbedded извлекает встроенное JPEG превью
+func (t *ThumbnailGenerator) decodeRAWEmbedded(path string) (image.Image, error) {
+	// dcraw -e -c выдает встроенное превью на stdout
+	cmd := exec.Command(t.cfg.Tools.Dcraw, "-e", "-c", path)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("dcraw failed: %w", err)
+	}
+	return decodeToolOutput(output)
+}
+
+// decodeRAWExiftool извлекает встроенное превью через exiftool
+func (t *ThumbnailGenerator) decodeRAWExiftool(path string) (image.Image, error) {
+	var lastErr error
+	for _, tag := range exiftoolPreviewTags {
+		// exiftool -b -PreviewImage photo.cr3 выдает бинарное значение тега на stdout
+		cmd := exec.Command(t.cfg.Tools.Exiftool, "-b", "-"+tag, path)
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("exiftool failed: %w", err)
+		}
+		img, err := decodeToolOutput(output)
+		if err == nil {
+			return img, nil
+		}
+		lastErr = fmt.Errorf("%s: %w", tag, err)
+	}
+	return nil, lastErr
+}
+
+// decodeRAWHalfSize декодирует RAW целиком
+func (t *ThumbnailGenerator) decodeRAWHalfSize(path string) (image.Image, error) {
+	// dcraw -c -w -W -h выдает half-size PPM на stdout (быстрее)
+	cmd := exec.Command(t.cfg.Tools.Dcraw, "-c", "-w", "-W", "-h", path)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("dcraw failed: %w", err)
+	}
+	return decodeToolOutput(output)
+}
+
+// decodeToolOutput декодирует изображение из stdout внешней утилиты
+func decodeToolOutput(output []byte) (image.Image, error) {
+	if len(output) == 0 {
+		return nil, fmt.Errorf("empty output")
+	}
+	img, _, err := image.Decode(bytes.NewReader(output))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode output: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,131 @@
+package media
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/photocore/photocore/internal/logger"
+)
+
+// stubTool пишет в dir скрипт name, который записывает вызов в общий журнал и
+// по ключевому аргументу (-e, -c, -JpgFromRaw, -PreviewImage) выдает fixture ("ok"),
+// пустой вывод ("empty") или падает ("fail")
+func stubTool(tb testing.TB, dir, name, fixture string, actions map[string]string) string {
+	tb.Helper()
+	var cases strings.Builder
+	for key, action := range actions {
+		switch action {
+		case "ok":
+			fmt.Fprintf(&cases, "  %s) cat %q ;;\n", key, fixture)
+		case "empty":
+			fmt.Fprintf(&cases, "  %s) exit 0 ;;\n", key)
+		default:
+			fmt.Fprintf(&cases, "  %s) exit 1 ;;\n", key)
+		}
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+key=""
+for arg in "$@"; do
+  case "$arg" in
+    -e|-JpgFromRaw|-PreviewImage) key="$arg"; break ;;
+    -c) key="$arg" ;;
+  esac
+done
+echo "%s $key" >> %q
+case "$key" in
+%s  *) exit 1 ;;
+esac
+`, name, filepath.Join(dir, "calls.log"), cases.String())
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+// rawCalls вызовы заглушек по порядку
+func rawCalls(tb testing.TB, dir string) []string {
+	tb.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "calls.log"))
+	if err != nil && !os.IsNotExist(err) {
+		tb.Fatal(err)
+	}
+	return strings.Fields(strings.ReplaceAll(string(data), " ", "_"))
+}
+
+func TestLoadRawImageFallbackOrder(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("tool stubs need /bin/sh")
+	}
+
+	for _, tc := range []struct {
+		name     string
+		dcraw    map[string]string
+		exiftool map[string]string
+		calls    []string
+		wantErr  bool
+	}{
+		{
+			name:  "dcraw embedded preview",
+			dcraw: map[string]string{"-e": "ok"},
+			calls: []string{"dcraw_-e"},
+		},
+		{
+			name:     "exiftool JpgFromRaw",
+			dcraw:    map[string]string{"-e": "fail", "-c": "ok"},
+			exiftool: map[string]string{"-JpgFromRaw": "ok"},
+			calls:    []string{"dcraw_-e", "exiftool_-JpgFromRaw"},
+		},
+		{
+			name:     "exiftool PreviewImage after empty JpgFromRaw",
+			dcraw:    map[string]string{"-e": "empty", "-c": "ok"},
+			exiftool: map[string]string{"-JpgFromRaw": "empty", "-PreviewImage": "ok"},
+			calls:    []string{"dcraw_-e", "exiftool_-JpgFromRaw", "exiftool_-PreviewImage"},
+		},
+		{
+			name:     "dcraw half-size last",
+			dcraw:    map[string]string{"-e": "fail", "-c": "ok"},
+			exiftool: map[string]string{"-JpgFromRaw": "empty", "-PreviewImage": "empty"},
+			calls:    []string{"dcraw_-e", "exiftool_-JpgFromRaw", "exiftool_-PreviewImage", "dcraw_-c"},
+		},
+		{
+			name:    "all decoders fail",
+			calls:   []string{"dcraw_-e", "exiftool_-JpgFromRaw", "dcraw_-c"},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := logger.Init(filepath.Join(dir, "logs")); err != nil {
+				t.Fatal(err)
+			}
+			fixture := filepath.Join(dir, "preview.jpg")
+			writeTestImage(t, fixture)
+
+			g := newTestGenerator(t)
+			g.cfg.Tools.Dcraw = stubTool(t, dir, "dcraw", fixture, tc.dcraw)
+			g.cfg.Tools.Exiftool = stubTool(t, dir, "exiftool", fixture, tc.exiftool)
+
+			img, err := g.loadRawImage(filepath.Join(dir, "photo.cr3"))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error when every decoder fails")
+				}
+				for _, name := range []string{"dcraw embedded", "exiftool preview", "dcraw half-size"} {
+					if !strings.Contains(err.Error(), name) {
+						t.Errorf("error %q does not mention %s", err, name)
+					}
+				}
+			} else if err != nil || img.Bounds().Dx() != 16 {
+				t.Fatalf("loadRawImage = %v, %v; want the 16px fixture", img, err)
+			}
+
+			if got := rawCalls(t, dir); strings.Join(got, " ") != strings.Join(tc.calls, " ") {
+				t.Errorf("calls = %v, want %v", got, tc.calls)
+			}
+		})
+	}
+}
@@ -6,13 +6,14 @@ import (
 	"image"
 	_ "image/gif"
 	"image/jpeg"
-	_ "image/png"
+	"image/png"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp"
 
 	"github.com/photocore/photocore/internal/config"
 	"github.com/photocore/photocore/internal/logger"
@@ -22,16 +23,21 @@ import (
 
 // ThumbnailGenerator генерирует превью для медиа-файлов
 type ThumbnailGenerator struct {
-	cfg       *config.Config
-	cachePath string
+	cfg          *config.Config
+	cachePath    string
+	heicDecoders map[string]heicDecoder // Декодеры HEIC по именам из Tools.HeicChain
+	rawDecoders  []rawDecoder           // Цепочка декодеров RAW по порядку
 }
 
 // NewThumbnailGenerator создает новый генератор превью
 func NewThumbnailGenerator(cfg *config.Config) *ThumbnailGenerator {
-	return &ThumbnailGenerator{
+	t := &ThumbnailGenerator{
 		cfg:       cfg,
 		cachePath: cfg.Storage.CachePath,
 	}
+	t.heicDecoders = t.defaultHEICDecoders()
+	t.rawDecoders = t.defaultRAWDecoders()
+	return t
 }
 
 // EnsureCacheDir создает директорию кэша если не существует
@@ -40,9 +46,81 @@ func (t *ThumbnailGenerator) EnsureCacheDir() error {
 	return os.MkdirAll(thumbDir, 0755)
 }
 
-// GetThumbnailPath возвращает путь к превью
+// SizeWidth возвращает максимальную сторону превью в пикселях (thumbnails.small/medium/large)
+func (t *ThumbnailGenerator) SizeWidth(size string) int {
+	small, medium, large := t.cfg.ThumbnailSizes()
+	switch size {
+	case "medium":
+		return medium
+	case "large":
+		return large
+	default:
+		return small
+	}
+}
+
+// Srcset возвращает значение srcset с настроенными размерами превью медиа ("url 300w, url 600w, ...")
+func (t *ThumbnailGenerator) Srcset(media *storage.Media) string {
+	sizes := t.cfg.SrcsetSizes()
+	parts := make([]string, 0, len(sizes))
+	for _, size := range sizes {
+		parts = append(parts, fmt.Sprintf("%s %dw", media.ThumbnailURL(size), t.SizeWidth(size)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// GetThumbnailPath возвращает путь к превью в текущем формате (thumbnails.format)
 func (t *ThumbnailGenerator) GetThumbnailPath(mediaID string, size string) string {
-	return filepath.Join(t.cachePath, "thumbs", fmt.Sprintf("%s_%s.jpg", mediaID, size))
+	return t.thumbnailPath(mediaID, size, t.thumbnailExt())
+}
+
+// LegacyThumbnailPath возвращает путь к JPEG превью, оставшемуся от прежнего формата
+// ("" если формат jpeg или такого файла нет) — его можно отдавать, пока генерируется новое
+func (t *ThumbnailGenerator) LegacyThumbnailPath(mediaID string, size string) string {
+	if t.cfg.Thumbnails.Format != "webp" {
+		return ""
+	}
+	path := t.thumbnailPath(mediaID, size, ".jpg")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// NegotiateThumbnail выбирает вариант превью по заголовку Accept.
+// В режиме auto хранятся JPEG и WebP: WebP отдается браузерам, которые его принимают.
+// Возвращает путь, MIME тип и признак, что WebP вариант запрошен, но еще не создан.
+func (t *ThumbnailGenerator) NegotiateThumbnail(mediaID, size, accept string) (path, contentType string, webpMissing bool) {
+	path = t.GetThumbnailPath(mediaID, size)
+	contentType = t.ThumbnailContentType()
+	if t.cfg.Thumbnails.Format != "auto" || !strings.Contains(accept, "image/webp") {
+		return path, contentType, false
+	}
+
+	webpPath := t.thumbnailPath(mediaID, size, ".webp")
+	if _, err := os.Stat(webpPath); err != nil {
+		return path, contentType, true
+	}
+	return webpPath, "image/webp", false
+}
+
+// ThumbnailContentType возвращает MIME тип основного варианта превью
+func (t *ThumbnailGenerator) ThumbnailContentType() string {
+	if t.cfg.Thumbnails.Format == "webp" {
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+func (t *ThumbnailGenerator) thumbnailExt() string {
+	if t.cfg.Thumbnails.Format == "webp" {
+		return ".webp"
+	}
+	return ".jpg"
+}
+
+func (t *ThumbnailGenerator) thumbnailPath(mediaID, size, ext string) string {
+	return filepath.Join(t.cachePath, "thumbs", fmt.Sprintf("%s_%s%s", mediaID, size, ext))
 }
 
 // ThumbnailExists проверяет существование превью
@@ -56,11 +134,38 @@ func (t *ThumbnailGenerator) ThumbnailExists(mediaID string, size string) bool {
 func (t *ThumbnailGenerator) DeleteThumbnails(mediaID string) {
 	sizes := []string{"small", "medium", "large"}
 	for _, size := range sizes {
-		path := t.GetThumbnailPath(mediaID, size)
-		os.Remove(path) // игнорируем ошибки - файла может не быть
+		for _, ext := range []string{".jpg", ".webp"} {
+			os.Remove(t.thumbnailPath(mediaID, size, ext)) // игнорируем ошибки - файла может не быть
+		}
 	}
 }
 
+// MoveThumbnails переименовывает превью медиа, получившего новый ID (файл перемещен).
+// Если переименовать не удалось, превью удаляется и будет создано заново.
+func (t *ThumbnailGenerator) MoveThumbnails(oldID, newID string) {
+	for _, size := range []string{"small", "medium", "large"} {
+		for _, ext := range []string{".jpg", ".webp"} {
+			from := t.thumbnailPath(oldID, size, ext)
+			if _, err := os.Stat(from); err != nil {
+				continue
+			}
+			if err := os.Rename(from, t.thumbnailPath(newID, size, ext)); err != nil {
+				os.Remove(from)
+			}
+		}
+	}
+}
+
+// PurgeFiles удаляет с диска файл медиа и его превью перед окончательным удалением записи.
+// Если файл удалить не удалось, превью остаются и возвращается ошибка.
+func (t *ThumbnailGenerator) PurgeFiles(media *storage.Media) error {
+	if err := os.Remove(media.Path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file %s: %w", media.Path, err)
+	}
+	t.DeleteThumbnails(media.ID)
+	return nil
+}
+
 // GenerateThumbnail генерирует превью для медиа-файла
 func (t *ThumbnailGenerator) GenerateThumbnail(media *storage.Media, size string) (string, error) {
 	if err := t.EnsureCacheDir(); err != nil {
@@ -71,6 +176,19 @@ func (t *ThumbnailGenerator) GenerateThumbnail(media *storage.Media, size string
 
 	// Если превью уже существует, возвращаем путь
 	if _, err := os.Stat(thumbPath); err == nil {
+		// BlurHash, палитру и WebP вариант (режим auto) для старых записей досчитываем по готовому превью
+		needsData := size == "small" && needsPreviewData(media)
+		needsWebP := t.needsWebPVariant(media.ID, size)
+		if needsData || needsWebP {
+			if img, err := imaging.Open(thumbPath); err == nil {
+				if needsData {
+					setPreviewData(media, img)
+				}
+				if needsWebP {
+					t.writeWebPVariant(img, media.ID, size)
+				}
+			}
+		}
 		return thumbPath, nil
 	}
 
@@ -92,23 +210,14 @@ func (t *ThumbnailGenerator) GenerateThumbnail(media *storage.Media, size string
 	}
 
 	// Определяем размер
-	var maxSize int
-	switch size {
-	case "small":
-		maxSize = t.cfg.Thumbnails.Small
-	case "medium":
-		maxSize = t.cfg.Thumbnails.Medium
-	case "large":
-		maxSize = t.cfg.Thumbnails.Large
-	default:
-		maxSize = t.cfg.Thumbnails.Small
-	}
+	maxSize := t.SizeWidth(size)
 
 	var img image.Image
+	var oriented bool // Поворот уже применен декодером (HEIC irot/imir)
 
 	switch media.Type {
 	case storage.MediaTypeImage:
-		img, err = t.loadImage(media.Path)
+		img, oriented, err = t.loadImage(media.Path)
 	case storage.MediaTypeRaw:
 		img, err = t.loadRawImage(media.Path)
 	case storage.MediaTypeVideo:
@@ -121,60 +230,141 @@ func (t *ThumbnailGenerator) GenerateThumbnail(media *storage.Media, size string
 		return "", fmt.Errorf("failed to load image: %w", err)
 	}
 
-	// Применяем ориентацию из EXIF
-	if media.Metadata.Orientation > 1 {
+	// Применяем ориентацию из EXIF (если пиксели еще не повернуты)
+	if media.Metadata.Orientation > 1 && !oriented && (t.cfg.Thumbnails.TrustOrientation || !alreadyOriented(img, media)) {
 		img = applyOrientation(img, media.Metadata.Orientation)
 	}
 
 	// Ресайзим с сохранением пропорций
 	thumb := imaging.Fit(img, maxSize, maxSize, imaging.Lanczos)
 
+	if size == "small" && needsPreviewData(media) {
+		setPreviewData(media, thumb)
+	}
+
+	if t.cfg.Thumbnails.Format == "webp" {
+		if err := t.encodeWebP(thumb, thumbPath); err != nil {
+			return "", err
+		}
+		// JPEG от прежнего формата больше не нужен
+		os.Remove(t.thumbnailPath(media.ID, size, ".jpg"))
+		return thumbPath, nil
+	}
+
 	// Сохраняем как JPEG
-	out, err := os.Create(thumbPath)
+	err = writeFileAtomic(thumbPath, 0644, func(out *os.File) error {
+		return jpeg.Encode(out, thumb, &jpeg.Options{Quality: t.cfg.Thumbnails.Quality})
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to create thumbnail file: %w", err)
+		return "", fmt.Errorf("failed to write thumbnail: %w", err)
 	}
-	defer out.Close()
 
-	if err := jpeg.Encode(out, thumb, &jpeg.Options{Quality: t.cfg.Thumbnails.Quality}); err != nil {
-		return "", fmt.Errorf("failed to encode thumbnail: %w", err)
+	if t.cfg.Thumbnails.Format == "auto" {
+		t.writeWebPVariant(thumb, media.ID, size)
 	}
 
 	return thumbPath, nil
 }
 
-// loadImage загружает обычное изображение
-func (t *ThumbnailGenerator) loadImage(path string) (image.Image, error) {
-	return imaging.Open(path)
+// needsWebPVariant проверяет, что в режиме auto для превью еще нет WebP варианта
+func (t *ThumbnailGenerator) needsWebPVariant(mediaID, size string) bool {
+	if t.cfg.Thumbnails.Format != "auto" {
+		return false
+	}
+	_, err := os.Stat(t.thumbnailPath(mediaID, size, ".webp"))
+	return err != nil
 }
 
-// loadRawImage загружает RAW-изображение через dcraw
-func (t *ThumbnailGenerator) loadRawImage(path string) (image.Image, error) {
-	// Пробуем извлечь встроенный JPEG превью
-	// dcraw -e -c выдает встроенное превью на stdout
-	cmd := exec.Command(t.cfg.Tools.Dcraw, "-e", "-c", path)
-	output, err := cmd.Output()
-	if err == nil && len(output) > 0 {
-		img, _, err := image.Decode(bytes.NewReader(output))
-		if err == nil {
-			return img, nil
+// writeWebPVariant сохраняет дополнительный WebP вариант; при ошибке остается только JPEG
+func (t *ThumbnailGenerator) writeWebPVariant(img image.Image, mediaID, size string) {
+	if err := t.encodeWebP(img, t.thumbnailPath(mediaID, size, ".webp")); err != nil {
+		logger.InfoLog.Printf("WARNING: failed to create WebP variant for %s/%s: %v", mediaID[:16], size, err)
+	}
+}
+
+// needsPreviewData проверяет, не хватает ли BlurHash или палитры
+func needsPreviewData(media *storage.Media) bool {
+	return media.BlurHash == "" || len(media.Colors) == 0
+}
+
+// setPreviewData вычисляет недостающие BlurHash и палитру по превью;
+// сохранить media должен вызывающий (SaveMedia)
+func setPreviewData(media *storage.Media, img image.Image) {
+	if media.BlurHash == "" {
+		hash, err := BlurHash(img)
+		if err != nil {
+			logger.InfoLog.Printf("Failed to compute BlurHash for %s: %v", media.Filename, err)
+		} else {
+			media.BlurHash = hash
 		}
 	}
+	if len(media.Colors) == 0 {
+		media.Colors = DominantColors(img, PaletteSize)
+	}
+}
 
-	// Если встроенного превью нет, конвертируем RAW в PPM
-	// dcraw -c -w -W -h выдает half-size PPM на stdout (быстрее)
-	cmd = exec.Command(t.cfg.Tools.Dcraw, "-c", "-w", "-W", "-h", path)
-	output, err = cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("dcraw failed: %w", err)
+// encodeWebP сохраняет превью в WebP через ffmpeg (в стандартной библиотеке нет WebP энкодера)
+func (t *ThumbnailGenerator) encodeWebP(img image.Image, path string) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return fmt.Errorf("failed to encode thumbnail: %w", err)
 	}
 
-	img, _, err := image.Decode(bytes.NewReader(output))
+	// ffmpeg пишет во временный файл рядом с превью (формат задан -f, расширение не важно)
+	return writeFileAtomic(path, 0644, func(out *os.File) error {
+		// ffmpeg -f png_pipe -i - -c:v libwebp -quality 85 -f webp -y thumb.webp
+		cmd := exec.Command(t.cfg.Tools.Ffmpeg,
+			"-loglevel", "error",
+			"-f", "png_pipe",
+			"-i", "-",
+			"-c:v", "libwebp",
+			"-quality", fmt.Sprintf("%d", t.cfg.Thumbnails.Quality),
+			"-f", "webp",
+			"-y", out.Name(),
+		)
+		cmd.Stdin = &buf
+
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("ffmpeg webp encode failed: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	})
+}
+
+// writeFileAtomic создает или заменяет path целиком с правами perm: write пишет во
+// временный файл в той же директории, затем он переименовывается. Временный файл не в
+// os.TempDir, так как rename между файловыми системами не атомарен и завершается ошибкой.
+// Параллельные читатели не увидят недописанный файл.
+func writeFileAtomic(path string, perm os.FileMode, write func(out *os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode dcraw output: %w", err)
+		return err
 	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // После успешного Rename файла уже нет
 
-	return img, nil
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp создает файл с правами 0600
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// loadImage загружает обычное изображение (HEIC — через цепочку декодеров).
+// oriented — декодер уже повернул пиксели сам.
+func (t *ThumbnailGenerator) loadImage(path string) (img image.Image, oriented bool, err error) {
+	if isHEIC(path) {
+		return t.loadHEIC(path)
+	}
+	img, err = imaging.Open(path)
+	return img, false, err
 }
 
 // extractVideoFrame извлекает кадр из видео через ffmpeg
@@ -235,6 +425,24 @@ func applyOrientation(img image.Image, orientation int) image.Image {
 	}
 }
 
+// alreadyOriented проверяет, повернуты ли пиксели заранее при флаге поворота на 90° (5-8):
+// размеры из EXIF записаны до поворота, и если декодированный кадр уже имеет
+// другую ориентацию (портрет вместо пейзажа или наоборот), повторный поворот положит его на бок.
+// Для квадратных кадров и без размеров в EXIF определить нельзя — считаем, что не повернуты.
+func alreadyOriented(img image.Image, media *storage.Media) bool {
+	if media.Metadata.Orientation < 5 || media.Metadata.Orientation > 8 {
+		return false
+	}
+	if media.Width == 0 || media.Height == 0 || media.Width == media.Height {
+		return false
+	}
+	b := img.Bounds()
+	if b.Dx() == b.Dy() {
+		return false
+	}
+	return (b.Dx() > b.Dy()) != (media.Width > media.Height)
+}
+
 // GetImageDimensions получает размеры изображения
 func GetImageDimensions(path string, mediaType storage.MediaType, dcrawPath string) (width, height int, err error) {
 	if mediaType == storage.MediaTypeRaw {
@@ -0,0 +1,318 @@
+package media
+
+import (
+	"errors"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/photocore/photocore/internal/config"
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// newTestGenerator генератор превью с кэшем во временной директории
+func newTestGenerator(tb testing.TB) *ThumbnailGenerator {
+	tb.Helper()
+	cfg := &config.Config{}
+	cfg.Storage.CachePath = tb.TempDir()
+	t := NewThumbnailGenerator(cfg)
+	if err := t.EnsureCacheDir(); err != nil {
+		tb.Fatal(err)
+	}
+	return t
+}
+
+func TestMoveThumbnails(t *testing.T) {
+	g := newTestGenerator(t)
+	for _, path := range []string{g.thumbnailPath("old", "small", ".jpg"), g.thumbnailPath("old", "large", ".webp")} {
+		if err := os.WriteFile(path, []byte("thumb"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g.MoveThumbnails("old", "new")
+
+	for _, c := range []struct{ size, ext string }{{"small", ".jpg"}, {"large", ".webp"}} {
+		if _, err := os.Stat(g.thumbnailPath("new", c.size, c.ext)); err != nil {
+			t.Errorf("%s%s thumbnail was not moved: %v", c.size, c.ext, err)
+		}
+		if _, err := os.Stat(g.thumbnailPath("old", c.size, c.ext)); err == nil {
+			t.Errorf("%s%s thumbnail under the old ID remains", c.size, c.ext)
+		}
+	}
+}
+
+func TestWriteFileAtomicStaysInTargetDir(t *testing.T) {
+	// Временный каталог ОС недоступен (как на другой файловой системе): запись его не использует
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	dir := t.TempDir()
+	path := filepath.Join(dir, "thumb.jpg")
+
+	err := writeFileAtomic(path, 0640, func(out *os.File) error {
+		if filepath.Dir(out.Name()) != dir {
+			t.Errorf("temp file %s is outside %s", out.Name(), dir)
+		}
+		_, err := out.WriteString("new")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+
+	// Неудачная запись не трогает прежний файл и не оставляет временных
+	err = writeFileAtomic(path, 0640, func(out *os.File) error {
+		out.WriteString("partial")
+		return errors.New("encode failed")
+	})
+	if err == nil {
+		t.Fatal("write error was not returned")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("content = %q after failed write, want %q", data, "new")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only thumb.jpg", len(entries))
+	}
+}
+
+func TestSrcsetUsesConfiguredSizes(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Thumbnails.Small, cfg.Thumbnails.Medium, cfg.Thumbnails.Large = 200, 500, 1000
+	cfg.Thumbnails.SrcsetSizes = []string{"small", "large"}
+	g := NewThumbnailGenerator(cfg)
+	m := &storage.Media{ID: "abc"}
+
+	if got, want := g.Srcset(m), "/media/abc/thumb/small 200w, /media/abc/thumb/large 1000w"; got != want {
+		t.Errorf("srcset = %q, want %q", got, want)
+	}
+	urls := m.ThumbnailURLs(cfg.SrcsetSizes())
+	if len(urls) != 2 || urls["small"] != "/media/abc/thumb/small" || urls["large"] != "/media/abc/thumb/large" {
+		t.Errorf("thumbnail URLs = %v, want small and large only", urls)
+	}
+}
+
+// thumbnailFixture генератор превью формата format с заглушкой ffmpeg (WebP): она пишет вход
+// в выходной файл (последний аргумент) или падает, если fail. Возвращает генератор и медиа
+func thumbnailFixture(tb testing.TB, format string, fail bool) (*ThumbnailGenerator, *storage.Media) {
+	tb.Helper()
+	dir := tb.TempDir()
+	if err := logger.Init(filepath.Join(dir, "logs")); err != nil {
+		tb.Fatal(err)
+	}
+	script := "#!/bin/sh\nfor arg in \"$@\"; do out=\"$arg\"; done\ncat > \"$out\"\n"
+	if fail {
+		script = "#!/bin/sh\necho 'Unknown encoder libwebp' >&2\nexit 1\n"
+	}
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	if err := os.WriteFile(ffmpeg, []byte(script), 0755); err != nil {
+		tb.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Storage.CachePath = filepath.Join(dir, "cache")
+	cfg.Thumbnails.Small, cfg.Thumbnails.Quality, cfg.Thumbnails.Format = 8, 80, format
+	cfg.Tools.Ffmpeg = ffmpeg
+	g := NewThumbnailGenerator(cfg)
+	if err := g.EnsureCacheDir(); err != nil {
+		tb.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "a.jpg")
+	writeTestImage(tb, path)
+	return g, &storage.Media{ID: storage.GenerateID(path), Path: path, Filename: "a.jpg", Ext: ".jpg", Type: storage.MediaTypeImage}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestWebPFormatReplacesLegacyJPEG(t *testing.T) {
+	g, m := thumbnailFixture(t, "webp", false)
+	legacy := g.thumbnailPath(m.ID, "small", ".jpg")
+	if err := os.WriteFile(legacy, []byte("old jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Пока WebP нет, можно отдавать JPEG прежнего формата
+	if got := g.LegacyThumbnailPath(m.ID, "small"); got != legacy {
+		t.Errorf("legacy path = %q, want %q", got, legacy)
+	}
+	if got := g.ThumbnailContentType(); got != "image/webp" {
+		t.Errorf("content type = %q, want image/webp", got)
+	}
+
+	path, err := g.GenerateThumbnail(m, "small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(path) != ".webp" || !exists(path) {
+		t.Errorf("thumbnail = %q, want an existing .webp file", path)
+	}
+	if exists(legacy) || g.LegacyThumbnailPath(m.ID, "small") != "" {
+		t.Error("legacy JPEG was kept after the WebP thumbnail was written")
+	}
+}
+
+func TestWebPFormatEncoderFailure(t *testing.T) {
+	g, m := thumbnailFixture(t, "webp", true)
+	if _, err := g.GenerateThumbnail(m, "small"); err == nil {
+		t.Fatal("GenerateThumbnail succeeded with a failing encoder")
+	}
+	if g.ThumbnailExists(m.ID, "small") {
+		t.Error("a partial WebP thumbnail was left behind")
+	}
+}
+
+func TestAutoFormatNegotiatesByAccept(t *testing.T) {
+	g, m := thumbnailFixture(t, "auto", false)
+	jpegPath, webpPath := g.thumbnailPath(m.ID, "small", ".jpg"), g.thumbnailPath(m.ID, "small", ".webp")
+	const browser = "image/avif,image/webp,image/*,*/*;q=0.8"
+
+	// JPEG прежней версии без WebP варианта: отдается JPEG, вариант помечается недостающим
+	if err := os.WriteFile(jpegPath, []byte("old jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if path, contentType, missing := g.NegotiateThumbnail(m.ID, "small", browser); path != jpegPath || contentType != "image/jpeg" || !missing {
+		t.Errorf("before WebP = %q %q missing=%v, want JPEG and missing", path, contentType, missing)
+	}
+	os.Remove(jpegPath)
+
+	if _, err := g.GenerateThumbnail(m, "small"); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(jpegPath) || !exists(webpPath) {
+		t.Fatalf("auto format wrote jpeg=%v webp=%v, want both", exists(jpegPath), exists(webpPath))
+	}
+
+	tests := []struct {
+		accept, path, contentType string
+	}{
+		{browser, webpPath, "image/webp"},
+		{"image/jpeg,image/*", jpegPath, "image/jpeg"},
+		{"", jpegPath, "image/jpeg"},
+	}
+	for _, tt := range tests {
+		path, contentType, missing := g.NegotiateThumbnail(m.ID, "small", tt.accept)
+		if path != tt.path || contentType != tt.contentType || missing {
+			t.Errorf("Accept %q = %q %q missing=%v, want %q %q", tt.accept, path, contentType, missing, tt.path, tt.contentType)
+		}
+	}
+}
+
+func TestAutoFormatBackfillsWebPVariant(t *testing.T) {
+	g, m := thumbnailFixture(t, "jpeg", false)
+	if _, err := g.GenerateThumbnail(m, "small"); err != nil {
+		t.Fatal(err)
+	}
+	webpPath := g.thumbnailPath(m.ID, "small", ".webp")
+	if exists(webpPath) {
+		t.Fatal("jpeg format wrote a WebP variant")
+	}
+	// В режиме jpeg выбор по Accept не делается
+	if _, contentType, missing := g.NegotiateThumbnail(m.ID, "small", "image/webp"); contentType != "image/jpeg" || missing {
+		t.Errorf("jpeg format = %q missing=%v, want image/jpeg", contentType, missing)
+	}
+
+	// После переключения на auto вариант досоздается по готовому JPEG
+	g.cfg.Thumbnails.Format = "auto"
+	if _, err := g.GenerateThumbnail(m, "small"); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(webpPath) {
+		t.Error("WebP variant was not created for the existing JPEG thumbnail")
+	}
+}
+
+func TestPurgeFilesRemovesFileAndThumbnails(t *testing.T) {
+	g := newTestGenerator(t)
+	dir := t.TempDir()
+	write := func(path string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &storage.Media{ID: storage.GenerateID("a.jpg"), Path: filepath.Join(dir, "a.jpg")}
+	thumb := g.thumbnailPath(m.ID, "small", ".jpg")
+	write(m.Path)
+	write(thumb)
+
+	if err := g.PurgeFiles(m); err != nil {
+		t.Fatal(err)
+	}
+	if exists(m.Path) || exists(thumb) {
+		t.Errorf("after purge file=%v thumbnail=%v, want both removed", exists(m.Path), exists(thumb))
+	}
+	// Файла уже нет — не ошибка
+	if err := g.PurgeFiles(m); err != nil {
+		t.Errorf("purge of a missing file = %v, want nil", err)
+	}
+
+	// Файл не удалился (непустой каталог на его месте): превью остаются
+	stuck := &storage.Media{ID: storage.GenerateID("stuck.jpg"), Path: filepath.Join(dir, "stuck.jpg")}
+	write(filepath.Join(stuck.Path, "inner"))
+	stuckThumb := g.thumbnailPath(stuck.ID, "small", ".jpg")
+	write(stuckThumb)
+	if err := g.PurgeFiles(stuck); err == nil {
+		t.Error("purge of an undeletable file returned nil")
+	}
+	if !exists(stuckThumb) {
+		t.Error("thumbnail was removed although the file stayed")
+	}
+}
+
+func TestOrientationSkippedForRotatedPixels(t *testing.T) {
+	// thumbnailOrientation ориентация превью снимка 16x8 с EXIF-размерами width x height и флагом 6 (90°)
+	thumbnailOrientation := func(trust bool, width, height int) string {
+		t.Helper()
+		g, m := thumbnailFixture(t, "jpeg", false)
+		g.cfg.Thumbnails.TrustOrientation = trust
+		m.Width, m.Height, m.Metadata.Orientation = width, height, 6
+		path, err := g.GenerateThumbnail(m, "small")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		c, err := jpeg.DecodeConfig(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Width > c.Height {
+			return "landscape"
+		}
+		return "portrait"
+	}
+
+	tests := []struct {
+		trust         bool
+		width, height int
+		want          string
+	}{
+		{false, 16, 8, "portrait"},  // Пиксели совпадают с EXIF — поворачиваем
+		{false, 8, 16, "landscape"}, // Пиксели уже повернуты
+		{false, 0, 0, "portrait"},   // Без размеров в EXIF проверить нельзя
+		{true, 8, 16, "portrait"},   // trust_orientation поворачивает всегда
+	}
+	for _, tt := range tests {
+		if got := thumbnailOrientation(tt.trust, tt.width, tt.height); got != tt.want {
+			t.Errorf("trust=%v exif %dx%d: thumbnail is %s, want %s", tt.trust, tt.width, tt.height, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/photocore/photocore/internal/config"
+)
+
+// FolderDate выводит дату съемки из имен папок относительного пути (Scan.FolderDatePatterns):
+// "Архив/2005-08 Summer/scan01.jpg" с шаблоном "2006-01" -> 1 августа 2005.
+// Папки проверяются от ближайшей к файлу, шаблоны — по порядку; дата ищется в любом месте имени,
+// но не внутри более длинного числа. Годы раньше 1900 и позже следующего не принимаются.
+func FolderDate(relPath string, cfg *config.Config) (time.Time, bool) {
+	if len(cfg.Scan.FolderDatePatterns) == 0 {
+		return time.Time{}, false
+	}
+	dir := filepath.Dir(filepath.ToSlash(relPath))
+	if dir == "." || dir == "/" {
+		return time.Time{}, false
+	}
+
+	parts := strings.Split(dir, "/")
+	maxYear := time.Now().Year() + 1
+	for i := len(parts) - 1; i >= 0; i-- {
+		for _, layout := range cfg.Scan.FolderDatePatterns {
+			if t, ok := findDate(parts[i], layout, cfg.CaptureLocation()); ok && t.Year() >= 1900 && t.Year() <= maxYear {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// findDate ищет в name подстроку длины layout, которая разбирается по layout.
+// Подходят шаблоны фиксированной длины из цифр и разделителей ("2006-01-02", "2006_01", "2006").
+func findDate(name, layout string, loc *time.Location) (time.Time, bool) {
+	for start := 0; start+len(layout) <= len(name); start++ {
+		end := start + len(layout)
+		if !utf8.RuneStart(name[start]) || (end < len(name) && !utf8.RuneStart(name[end])) {
+			continue
+		}
+		// Не берем дату из середины числа: "IMG_120051" не 2005 год
+		if start > 0 && isDigit(name[start-1]) || end < len(name) && isDigit(name[end]) {
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, name[start:end], loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/config"
+)
+
+func TestFolderDate(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Scan.FolderDatePatterns = []string{"2006-01-02", "2006-01", "2006_01", "2006"}
+
+	tests := []struct {
+		path string
+		want time.Time // Нулевое — дата не выводится
+	}{
+		{"Архив/2005-08 Summer/scan01.jpg", time.Date(2005, 8, 1, 0, 0, 0, 0, time.UTC)},
+		{"Trips/2019-07-14 Sochi/IMG_1.jpg", time.Date(2019, 7, 14, 0, 0, 0, 0, time.UTC)},
+		{"2010/2012_03 party/a.jpg", time.Date(2012, 3, 1, 0, 0, 0, 0, time.UTC)}, // Ближайшая к файлу папка
+		{"Family 1998/a.jpg", time.Date(1998, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"IMG_120051/a.jpg", time.Time{}},   // Год внутри числа
+		{"1850 archive/a.jpg", time.Time{}}, // Слишком ранний год
+		{"9999/a.jpg", time.Time{}},         // Будущее
+		{"a.jpg", time.Time{}},              // Файл в корне
+	}
+	for _, tt := range tests {
+		got, ok := FolderDate(tt.path, cfg)
+		if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+			t.Errorf("FolderDate(%q) = %v, %v; want %v", tt.path, got, ok, tt.want)
+		}
+	}
+
+	cfg.Scan.FolderDatePatterns = nil
+	if _, ok := FolderDate("2005-08/a.jpg", cfg); ok {
+		t.Error("date inferred with no patterns configured")
+	}
+}
+
+func TestScanInfersDateFromFolder(t *testing.T) {
+	s, store, root := newTestScanner(t, "  folder_date_patterns: [\"2006-01\"]\n")
+	dated := filepath.Join(root, "2005-08 Summer", "scan01.jpg")
+	plain := filepath.Join(root, "misc", "scan02.jpg")
+	writeJPEG(t, dated, 1) // Без EXIF: даты съемки в файле нет
+	writeJPEG(t, plain, 2)
+
+	runScan(t, s)
+
+	m, err := store.GetMediaByPath(dated)
+	if err != nil || m == nil {
+		t.Fatalf("media not indexed: %v", err)
+	}
+	if want := time.Date(2005, 8, 1, 0, 0, 0, 0, time.UTC); !m.TakenAt.Equal(want) {
+		t.Errorf("taken at = %v, want %v from folder name", m.TakenAt, want)
+	}
+	if m, _ := store.GetMediaByPath(plain); m == nil || m.TakenAt.Year() == 2005 {
+		t.Errorf("folder without a date got inferred date: %v", m)
+	}
+}
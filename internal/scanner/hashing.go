@@ -13,6 +13,10 @@ import (
 
 	"github.com/corona10/goimagehash"
 	"github.com/photocore/photocore/internal/logger"
+	// Декодеры остальных индексируемых форматов, чтобы у них тоже был perceptual hash
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
 )
 
 // HashResult содержит результаты хеширования файла
@@ -62,7 +66,14 @@ func calculateSHA256(path string) (string, error) {
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-// calculateImageHash вычисляет perceptual hash изображения (dHash)
+// hashableExts расширения, для которых зарегистрирован декодер perceptual hash
+var hashableExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".webp": true, ".bmp": true, ".tif": true, ".tiff": true,
+}
+
+// calculateImageHash вычисляет perceptual hash изображения (dHash).
+// Поддерживаются JPEG, PNG, GIF, WebP, BMP и TIFF; для остальных форматов — ошибка и hash 0
 func calculateImageHash(path string) (uint64, error) {
 	f, err := os.Open(path)
 	if err != nil {
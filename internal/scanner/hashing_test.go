@@ -0,0 +1,86 @@
+package scanner
+
+import (
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testWebP фрагмент видеокадра в WebP (из testdata golang.org/x/image)
+const testWebP = "testdata/video-001.webp"
+
+// copyFile копирует fixture src в dst
+func copyFile(tb testing.TB, src, dst string) {
+	tb.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestWebPImageHashMatchesJPEG(t *testing.T) {
+	f, err := os.Open(testWebP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := image.Decode(f)
+	f.Close()
+	if err != nil || format != "webp" {
+		t.Fatalf("decode %s: format %q, %v", testWebP, format, err)
+	}
+
+	// То же содержимое, пересохраненное в JPEG
+	jpegPath := filepath.Join(t.TempDir(), "copy.jpg")
+	out, err := os.Create(jpegPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(out, img, &jpeg.Options{Quality: 85}); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	webpHash, err := calculateImageHash(testWebP)
+	if err != nil || webpHash == 0 {
+		t.Fatalf("webp hash = %x, %v; want non-zero", webpHash, err)
+	}
+	jpegHash, err := calculateImageHash(jpegPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Порог по умолчанию поиска похожих (FindDuplicates)
+	if d := CompareImageHashes(webpHash, jpegHash); d >= 10 {
+		t.Errorf("distance between webp and jpeg = %d, want < 10", d)
+	}
+}
+
+func TestScanFillsMissingImageHash(t *testing.T) {
+	s, store, root := newTestScanner(t, "")
+	path := filepath.Join(root, "frame.webp")
+	copyFile(t, testWebP, path)
+
+	runScan(t, s)
+	m, err := store.GetMediaByPath(path)
+	if err != nil || m == nil {
+		t.Fatalf("media not indexed: %v", err)
+	}
+	want := m.ImageHash
+	if want == 0 {
+		t.Fatal("new webp media has no image hash")
+	}
+
+	// Запись из прежней версии без декодера WebP: файл не менялся, hash досчитывается
+	m.ImageHash = 0
+	if err := store.SaveMedia(m); err != nil {
+		t.Fatal(err)
+	}
+	runScan(t, s)
+	if m, _ := store.GetMediaByPath(path); m.ImageHash != want {
+		t.Errorf("image hash after rescan = %x, want %x", m.ImageHash, want)
+	}
+}
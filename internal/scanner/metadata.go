@@ -2,6 +2,8 @@ package scanner
 
 import (
 	"fmt"
+	"image"
+	"os"
 	"strings"
 	"time"
 
@@ -12,8 +14,9 @@ import (
 	"github.com/photocore/photocore/internal/storage"
 )
 
-// ExtractMetadata извлекает EXIF метаданные из изображения
-func ExtractMetadata(path string, media *storage.Media) error {
+// ExtractMetadata извлекает EXIF метаданные из изображения.
+// Дата съемки без смещения в EXIF (OffsetTimeOriginal) считается временем в loc.
+func ExtractMetadata(path string, media *storage.Media, loc *time.Location) error {
 	// Используем универсальный метод который работает с любыми файлами
 	rawExif, err := exif.SearchFileAndExtractExif(path)
 	if err != nil {
@@ -43,20 +46,35 @@ func ExtractMetadata(path string, media *storage.Media) error {
 	logger.InfoLog.Printf("EXIF: found EXIF in %s", path)
 
 	// Извлекаем данные из IFD0 и EXIF IFD
-	extractFromIndex(index, media)
+	extractFromIndex(index, media, loc)
 
 	return nil
 }
 
-func extractFromIndex(index exif.IfdIndex, media *storage.Media) {
+// fillImageDimensions берет размеры из заголовка изображения, если в EXIF их нет
+// (PNG, GIF, скриншоты и иконки обычно без EXIF)
+func fillImageDimensions(path string, media *storage.Media) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	if cfg, _, err := image.DecodeConfig(f); err == nil {
+		media.Width = cfg.Width
+		media.Height = cfg.Height
+	}
+}
+
+func extractFromIndex(index exif.IfdIndex, media *storage.Media, loc *time.Location) {
 	// Пробуем получить ExifIfd
 	exifIfd, err := index.RootIfd.ChildWithIfdPath(exifcommon.IfdExifStandardIfdIdentity)
 	if err == nil {
-		extractExifTags(exifIfd, media)
+		extractExifTags(exifIfd, media, loc)
 	}
 
 	// Также извлекаем из корневого IFD (IFD0)
-	extractIfd0Tags(index.RootIfd, media)
+	extractIfd0Tags(index.RootIfd, exifIfd, media, loc)
 
 	// GPS данные
 	gpsIfd, err := index.RootIfd.ChildWithIfdPath(exifcommon.IfdGpsInfoStandardIfdIdentity)
@@ -65,29 +83,13 @@ func extractFromIndex(index exif.IfdIndex, media *storage.Media) {
 	}
 }
 
-func extractExifTags(ifd *exif.Ifd, media *storage.Media) {
+func extractExifTags(ifd *exif.Ifd, media *storage.Media, loc *time.Location) {
 	// DateTimeOriginal - дата съёмки
-	if entries, err := ifd.FindTagWithName("DateTimeOriginal"); err == nil && len(entries) > 0 {
-		if val, err := entries[0].Value(); err == nil {
-			if str, ok := val.(string); ok {
-				if t, err := parseExifDateTime(str); err == nil {
-					media.TakenAt = t
-				}
-			}
-		}
-	}
+	setTakenAt(media, ifd, "DateTimeOriginal", ifd, "OffsetTimeOriginal", loc)
 
 	// Если DateTimeOriginal нет, пробуем DateTimeDigitized
 	if media.TakenAt.IsZero() {
-		if entries, err := ifd.FindTagWithName("DateTimeDigitized"); err == nil && len(entries) > 0 {
-			if val, err := entries[0].Value(); err == nil {
-				if str, ok := val.(string); ok {
-					if t, err := parseExifDateTime(str); err == nil {
-						media.TakenAt = t
-					}
-				}
-			}
-		}
+		setTakenAt(media, ifd, "DateTimeDigitized", ifd, "OffsetTimeDigitized", loc)
 	}
 
 	// PixelXDimension, PixelYDimension
@@ -106,8 +108,10 @@ func extractExifTags(ifd *exif.Ifd, media *storage.Media) {
 	if entries, err := ifd.FindTagWithName("FocalLength"); err == nil && len(entries) > 0 {
 		if val, err := entries[0].Value(); err == nil {
 			if rat, ok := val.([]exifcommon.Rational); ok && len(rat) > 0 {
-				focal := float64(rat[0].Numerator) / float64(rat[0].Denominator)
-				media.Metadata.FocalLength = fmt.Sprintf("%.0fmm", focal)
+				if focal, ok := ratio(rat[0]); ok {
+					media.Metadata.FocalLength = fmt.Sprintf("%.0fmm", focal)
+					media.Metadata.FocalMM = focal
+				}
 			}
 		}
 	}
@@ -116,8 +120,10 @@ func extractExifTags(ifd *exif.Ifd, media *storage.Media) {
 	if entries, err := ifd.FindTagWithName("FNumber"); err == nil && len(entries) > 0 {
 		if val, err := entries[0].Value(); err == nil {
 			if rat, ok := val.([]exifcommon.Rational); ok && len(rat) > 0 {
-				aperture := float64(rat[0].Numerator) / float64(rat[0].Denominator)
-				media.Metadata.Aperture = fmt.Sprintf("f/%.1f", aperture)
+				if aperture, ok := ratio(rat[0]); ok {
+					media.Metadata.Aperture = fmt.Sprintf("f/%.1f", aperture)
+					media.Metadata.ApertureF = aperture
+				}
 			}
 		}
 	}
@@ -125,7 +131,8 @@ func extractExifTags(ifd *exif.Ifd, media *storage.Media) {
 	// ExposureTime (shutter speed)
 	if entries, err := ifd.FindTagWithName("ExposureTime"); err == nil && len(entries) > 0 {
 		if val, err := entries[0].Value(); err == nil {
-			if rat, ok := val.([]exifcommon.Rational); ok && len(rat) > 0 {
+			// Нулевая выдержка бессмысленна, а 1/denom с нулевым числителем делит на ноль
+			if rat, ok := val.([]exifcommon.Rational); ok && len(rat) > 0 && rat[0].Numerator != 0 && rat[0].Denominator != 0 {
 				num := rat[0].Numerator
 				denom := rat[0].Denominator
 				if num < denom {
@@ -133,6 +140,7 @@ func extractExifTags(ifd *exif.Ifd, media *storage.Media) {
 				} else {
 					media.Metadata.ShutterSpeed = fmt.Sprintf("%.1fs", float64(num)/float64(denom))
 				}
+				media.Metadata.ShutterSec = float64(num) / float64(denom)
 			}
 		}
 	}
@@ -154,7 +162,7 @@ func extractExifTags(ifd *exif.Ifd, media *storage.Media) {
 	}
 }
 
-func extractIfd0Tags(ifd *exif.Ifd, media *storage.Media) {
+func extractIfd0Tags(ifd, exifIfd *exif.Ifd, media *storage.Media, loc *time.Location) {
 	// Make (производитель)
 	var make string
 	if entries, err := ifd.FindTagWithName("Make"); err == nil && len(entries) > 0 {
@@ -195,17 +203,20 @@ func extractIfd0Tags(ifd *exif.Ifd, media *storage.Media) {
 		}
 	}
 
-	// DateTime (fallback если нет DateTimeOriginal)
+	// Software, Artist, Copyright (программа обработки, автор и правообладатель)
+	if str, ok := exifString(ifd, "Software"); ok {
+		media.Metadata.Software = strings.TrimSpace(str)
+	}
+	if str, ok := exifString(ifd, "Artist"); ok {
+		media.Metadata.Artist = strings.TrimSpace(str)
+	}
+	if str, ok := exifString(ifd, "Copyright"); ok {
+		media.Metadata.Copyright = strings.TrimSpace(str)
+	}
+
+	// DateTime (fallback если нет DateTimeOriginal); его смещение OffsetTime лежит в EXIF IFD
 	if media.TakenAt.IsZero() {
-		if entries, err := ifd.FindTagWithName("DateTime"); err == nil && len(entries) > 0 {
-			if val, err := entries[0].Value(); err == nil {
-				if str, ok := val.(string); ok {
-					if t, err := parseExifDateTime(str); err == nil {
-						media.TakenAt = t
-					}
-				}
-			}
-		}
+		setTakenAt(media, ifd, "DateTime", exifIfd, "OffsetTime", loc)
 	}
 
 	// ImageWidth, ImageLength (fallback)
@@ -277,9 +288,12 @@ func dmsToDecimal(dms []exifcommon.Rational, ref string) float64 {
 		return 0
 	}
 
-	degrees := float64(dms[0].Numerator) / float64(dms[0].Denominator)
-	minutes := float64(dms[1].Numerator) / float64(dms[1].Denominator)
-	seconds := float64(dms[2].Numerator) / float64(dms[2].Denominator)
+	degrees, okD := ratio(dms[0])
+	minutes, okM := ratio(dms[1])
+	seconds, okS := ratio(dms[2])
+	if !okD || !okM || !okS {
+		return 0
+	}
 
 	decimal := degrees + minutes/60 + seconds/3600
 
@@ -290,13 +304,73 @@ func dmsToDecimal(dms []exifcommon.Rational, ref string) float64 {
 	return decimal
 }
 
-func parseExifDateTime(s string) (time.Time, error) {
-	// EXIF формат: "2006:01:02 15:04:05"
+// setTakenAt записывает дату съемки из тега dateTag. Смещение от UTC берется
+// из offsetTag (EXIF 2.31) и сохраняется в Metadata.TZOffset, чтобы местное время
+// съемки не зависело от часового пояса сервера; без него дата считается в loc.
+// ratio значение рационального числа EXIF; false при нулевом знаменателе
+// (битый EXIF дал бы NaN/Inf, которые не сериализуются в JSON)
+func ratio(r exifcommon.Rational) (float64, bool) {
+	if r.Denominator == 0 {
+		return 0, false
+	}
+	return float64(r.Numerator) / float64(r.Denominator), true
+}
+
+func setTakenAt(media *storage.Media, ifd *exif.Ifd, dateTag string, offsetIfd *exif.Ifd, offsetTag string, loc *time.Location) {
+	str, ok := exifString(ifd, dateTag)
+	if !ok {
+		return
+	}
+	offset := ""
+	if offsetIfd != nil {
+		offset, _ = exifString(offsetIfd, offsetTag)
+	}
+
+	t, tzOffset, err := parseExifDateTime(str, offset, loc)
+	if err != nil {
+		return
+	}
+	media.TakenAt = t
+	media.Metadata.TZOffset = tzOffset
+}
+
+// exifString значение строкового тега
+func exifString(ifd *exif.Ifd, name string) (string, bool) {
+	entries, err := ifd.FindTagWithName(name)
+	if err != nil || len(entries) == 0 {
+		return "", false
+	}
+	val, err := entries[0].Value()
+	if err != nil {
+		return "", false
+	}
+	str, ok := val.(string)
+	return str, ok
+}
+
+// parseExifDateTime разбирает дату EXIF ("2006:01:02 15:04:05") со смещением
+// OffsetTime* ("+03:00"). Пустое или некорректное смещение — время в loc,
+// tzOffset тогда пустой.
+func parseExifDateTime(s, offset string, loc *time.Location) (t time.Time, tzOffset string, err error) {
 	s = strings.TrimSpace(s)
 	if s == "" || s == "0000:00:00 00:00:00" {
-		return time.Time{}, fmt.Errorf("empty or zero datetime")
+		return time.Time{}, "", fmt.Errorf("empty or zero datetime")
+	}
+
+	if zone, err := time.Parse("-07:00", strings.TrimSpace(offset)); err == nil {
+		_, seconds := zone.Zone()
+		loc = time.FixedZone("", seconds)
+		tzOffset = zone.Format("-07:00")
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	t, err = time.ParseInLocation("2006:01:02 15:04:05", s, loc)
+	if err != nil {
+		return time.Time{}, "", err
 	}
-	return time.Parse("2006:01:02 15:04:05", s)
+	return t, tzOffset, nil
 }
 
 func toInt(val interface{}) int {
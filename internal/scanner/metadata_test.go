@@ -0,0 +1,137 @@
+package scanner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	exif "github.com/dsoprea/go-exif/v3"
+	exifcommon "github.com/dsoprea/go-exif/v3/common"
+
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func TestParseExifDateTimeOffset(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*3600)
+	for _, tc := range []struct {
+		name      string
+		value     string
+		offset    string
+		loc       *time.Location
+		wantUTC   string
+		wantShift string
+	}{
+		{"offset wins over default zone", "2023:07:14 18:30:05", "+02:00", moscow, "2023-07-14T16:30:05Z", "+02:00"},
+		{"negative half-hour offset", "2023:07:14 18:30:05", "-03:30", time.UTC, "2023-07-14T22:00:05Z", "-03:30"},
+		{"no offset uses default zone", "2023:07:14 18:30:05", "", moscow, "2023-07-14T15:30:05Z", ""},
+		{"no offset and no zone is UTC", "2023:07:14 18:30:05", "", nil, "2023-07-14T18:30:05Z", ""},
+		{"malformed offset ignored", "2023:07:14 18:30:05", "   :  ", moscow, "2023-07-14T15:30:05Z", ""},
+		{"padded value", " 2023:07:14 18:30:05 ", " +02:00", nil, "2023-07-14T16:30:05Z", "+02:00"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, shift, err := parseExifDateTime(tc.value, tc.offset, tc.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if utc := got.UTC().Format(time.RFC3339); utc != tc.wantUTC {
+				t.Errorf("time = %s, want %s", utc, tc.wantUTC)
+			}
+			if shift != tc.wantShift {
+				t.Errorf("tz offset = %q, want %q", shift, tc.wantShift)
+			}
+			// Местное время съемки сохраняется как в EXIF
+			if local := got.Format("2006:01:02 15:04:05"); local != "2023:07:14 18:30:05" {
+				t.Errorf("local time = %s, want the EXIF wall clock", local)
+			}
+		})
+	}
+
+	for _, bad := range []string{"", "0000:00:00 00:00:00", "2023-07-14 18:30:05"} {
+		if _, _, err := parseExifDateTime(bad, "+02:00", nil); err == nil {
+			t.Errorf("parseExifDateTime(%q) accepted", bad)
+		}
+	}
+}
+
+// writeExposureExif пишет файл только с EXIF IFD: FNumber, ExposureTime и FocalLength
+// (SearchFileAndExtractExif находит заголовок TIFF и без JPEG вокруг)
+func writeExposureExif(tb testing.TB, fnumber, exposure, focal exifcommon.Rational) string {
+	tb.Helper()
+	im, err := exifcommon.NewIfdMappingWithStandard()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	rootIb := exif.NewIfdBuilder(im, exif.NewTagIndex(), exifcommon.IfdStandardIfdIdentity, exifcommon.EncodeDefaultByteOrder)
+	exifIb, err := exif.GetOrCreateIbFromRootIb(rootIb, "IFD/Exif")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for name, value := range map[string]exifcommon.Rational{"FNumber": fnumber, "ExposureTime": exposure, "FocalLength": focal} {
+		if err := exifIb.SetStandardWithName(name, []exifcommon.Rational{value}); err != nil {
+			tb.Fatalf("set %s: %v", name, err)
+		}
+	}
+	data, err := exif.NewIfdByteEncoder().EncodeToExif(rootIb)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	path := filepath.Join(tb.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractMetadataExposureNumbers(t *testing.T) {
+	if err := logger.Init(filepath.Join(t.TempDir(), "logs")); err != nil {
+		t.Fatal(err)
+	}
+	r := func(num, den uint32) exifcommon.Rational {
+		return exifcommon.Rational{Numerator: num, Denominator: den}
+	}
+	for _, tc := range []struct {
+		name                      string
+		fnumber, exposure, focal  exifcommon.Rational
+		aperture, shutter, length string
+		apertureF, shutterSec     float64
+		focalMM                   float64
+	}{
+		{"typical", r(28, 10), r(1, 250), r(50, 1), "f/2.8", "1/250", "50mm", 2.8, 0.004, 50},
+		{"long exposure", r(8, 1), r(3, 2), r(24, 1), "f/8.0", "1.5s", "24mm", 8, 1.5, 24},
+		{"zero denominators", r(28, 0), r(1, 0), r(50, 0), "", "", "", 0, 0, 0},
+		{"zero shutter", r(4, 1), r(0, 1), r(35, 1), "f/4.0", "", "35mm", 4, 0, 35},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeExposureExif(t, tc.fnumber, tc.exposure, tc.focal)
+			m := &storage.Media{Path: path}
+			if err := ExtractMetadata(path, m, time.UTC); err != nil {
+				t.Fatal(err)
+			}
+			md := m.Metadata
+			if md.Aperture != tc.aperture || md.ShutterSpeed != tc.shutter || md.FocalLength != tc.length {
+				t.Errorf("strings = %q %q %q, want %q %q %q", md.Aperture, md.ShutterSpeed, md.FocalLength, tc.aperture, tc.shutter, tc.length)
+			}
+			if md.ApertureF != tc.apertureF || md.ShutterSec != tc.shutterSec || md.FocalMM != tc.focalMM {
+				t.Errorf("numbers = %v %v %v, want %v %v %v", md.ApertureF, md.ShutterSec, md.FocalMM, tc.apertureF, tc.shutterSec, tc.focalMM)
+			}
+			// Битый EXIF не должен ломать ответы API
+			if _, err := json.Marshal(m); err != nil {
+				t.Errorf("media does not marshal: %v", err)
+			}
+		})
+	}
+}
+
+func TestDMSToDecimalZeroDenominator(t *testing.T) {
+	dms := []exifcommon.Rational{{Numerator: 55, Denominator: 1}, {Numerator: 45, Denominator: 0}, {Numerator: 0, Denominator: 1}}
+	if got := dmsToDecimal(dms, "N"); got != 0 {
+		t.Errorf("dmsToDecimal with zero denominator = %v, want 0", got)
+	}
+	dms[1].Denominator = 1
+	if got := dmsToDecimal(dms, "S"); got != -55.75 {
+		t.Errorf("dmsToDecimal = %v, want -55.75", got)
+	}
+}
@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/photocore/photocore/internal/config"
+)
+
+// PathTags выводит теги из папок относительного пути файла (Scan.AutoTagFromPath):
+// "2023/Italy/Rome_Trip/img.jpg" -> italy, rome, trip.
+// Берутся только AutoTagDepth ближайших к файлу папок, числовые и перечисленные в AutoTagSkip пропускаются.
+func PathTags(relPath string, cfg *config.Config) []string {
+	dir := filepath.Dir(filepath.ToSlash(relPath))
+	if dir == "." || dir == "/" {
+		return nil
+	}
+	parts := strings.Split(filepath.ToSlash(dir), "/")
+	if depth := cfg.Scan.AutoTagDepth; depth > 0 && len(parts) > depth {
+		parts = parts[len(parts)-depth:]
+	}
+
+	skip := make(map[string]bool, len(cfg.Scan.AutoTagSkip))
+	for _, s := range cfg.Scan.AutoTagSkip {
+		skip[strings.ToLower(strings.TrimSpace(s))] = true
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, part := range parts {
+		if skip[strings.ToLower(strings.TrimSpace(part))] {
+			continue
+		}
+		for _, word := range strings.FieldsFunc(part, isTagSeparator) {
+			tag := strings.ToLower(word)
+			if tag == "" || seen[tag] || skip[tag] || isNumeric(tag) {
+				continue
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// isTagSeparator разделители слов в имени папки ("Rome_Trip", "Italy, Rome", "Paris 2019")
+func isTagSeparator(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("_,;+&.()[]", r)
+}
+
+// isNumeric папки-годы и даты ("2023", "2023-05-01") тегов не дают: дата есть в метаданных
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) && r != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/photocore/photocore/internal/config"
+)
+
+func TestPathTags(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Scan.AutoTagSkip = []string{"Camera Roll", "misc"}
+
+	tests := []struct {
+		path  string
+		depth int
+		want  []string
+	}{
+		{"2023/Italy/Rome_Trip/img.jpg", 0, []string{"italy", "rome", "trip"}},
+		{"2023/Italy/Rome_Trip/img.jpg", 1, []string{"rome", "trip"}}, // Только ближайшая к файлу папка
+		{"Paris 2019/2019-05-01/a.jpg", 0, []string{"paris"}},         // Годы и даты тегов не дают
+		{"Italy/Rome, Italy/a.jpg", 0, []string{"italy", "rome"}},     // Без повторов
+		{"Camera Roll/Misc/Sea (old)/a.jpg", 0, []string{"sea", "old"}},
+		{"a.jpg", 0, nil}, // Файл в корне
+	}
+	for _, tt := range tests {
+		cfg.Scan.AutoTagDepth = tt.depth
+		if got := PathTags(tt.path, cfg); !slices.Equal(got, tt.want) {
+			t.Errorf("PathTags(%q, depth %d) = %v, want %v", tt.path, tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestScanAddsPathTagsToNewFiles(t *testing.T) {
+	s, store, root := newTestScanner(t, "  auto_tag_from_path: true\n")
+	path := filepath.Join(root, "Italy", "Rome", "a.jpg")
+	writeJPEG(t, path, 1)
+	runScan(t, s)
+
+	m, err := store.GetMediaByPath(path)
+	if err != nil || m == nil {
+		t.Fatalf("scanned media: %v, %v", m, err)
+	}
+	if !slices.Equal(m.Tags, []string{"italy", "rome"}) {
+		t.Fatalf("tags = %v, want italy, rome", m.Tags)
+	}
+
+	// Снятый вручную тег не возвращается при повторном сканировании измененного файла
+	if err := store.RemoveTagsFromMedia(m.ID, []string{"rome"}); err != nil {
+		t.Fatal(err)
+	}
+	touchFile(t, path)
+	runScan(t, s)
+	if m, _ := store.GetMediaByPath(path); !slices.Equal(m.Tags, []string{"italy"}) {
+		t.Errorf("tags after rescan = %v, want only italy", m.Tags)
+	}
+}
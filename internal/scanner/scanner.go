@@ -1,49 +1,131 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/photocore/photocore/internal/config"
+	"github.com/photocore/photocore/internal/geo"
 	"github.com/photocore/photocore/internal/logger"
 	"github.com/photocore/photocore/internal/storage"
 )
 
 // Scanner сканирует файловую систему для поиска медиа-файлов
 type Scanner struct {
-	cfg   *config.Config
-	store *storage.Store
+	cfg      *config.Config
+	store    *storage.Store
+	geocoder geo.Geocoder // nil, если геокодирование выключено
+
+	queue FileQueue // nil — файлы обрабатываются последовательно при обходе
+
+	mu       sync.RWMutex
+	scanning bool
+	progress ScanProgress // Running, Counting, StartedAt и CurrentPath; счётчики в counters
+	counters scanCounters
+	stopChan chan struct{}
+	run      *scanRun   // Текущее сканирование (nil, если не идёт)
+	saveMu   sync.Mutex // Проверка дубликатов и сохранение по одному файлу
+
+	// Начало и конец обработки файлов (после подсчета) — для FilesPerSecond
+	processingSince time.Time
+	finishedAt      time.Time
+}
+
+// scanCounters счётчики прогресса, обновляемые воркерами параллельно
+type scanCounters struct {
+	totalFiles        atomic.Int64
+	scanned           atomic.Int64
+	newFiles          atomic.Int64
+	updatedFiles      atomic.Int64
+	skippedDuplicates atomic.Int64
+	removedMissing    atomic.Int64
+	errors            atomic.Int64
+}
 
-	mu        sync.RWMutex
-	scanning  bool
-	progress  ScanProgress
-	stopChan  chan struct{}
+// reset обнуляет счётчики перед новым сканированием
+func (c *scanCounters) reset() {
+	for _, v := range []*atomic.Int64{
+		&c.totalFiles, &c.scanned, &c.newFiles, &c.updatedFiles,
+		&c.skippedDuplicates, &c.removedMissing, &c.errors,
+	} {
+		v.Store(0)
+	}
+}
+
+// scanRun состояние текущего сканирования, общее для обхода и воркеров
+type scanRun struct {
+	stop       chan struct{}
+	extensions map[string]storage.MediaType
+	wg         sync.WaitGroup // Файлы, отданные в пул и ещё не обработанные
+}
+
+// FileQueue очередь параллельной обработки файлов (реализуется worker.ScanService).
+// Для каждого принятого пути очередь должна вызвать Scanner.ProcessQueuedFile.
+type FileQueue interface {
+	SubmitScanFile(path string) bool
 }
 
 // ScanProgress содержит информацию о прогрессе сканирования
 type ScanProgress struct {
 	Running           bool      `json:"running"`
+	Counting          bool      `json:"counting"` // Идет подсчет файлов, TotalFiles еще растет
 	StartedAt         time.Time `json:"started_at"`
 	TotalFiles        int       `json:"total_files"`
 	Scanned           int       `json:"scanned"`
 	NewFiles          int       `json:"new_files"`
 	UpdatedFiles      int       `json:"updated_files"`
 	SkippedDuplicates int       `json:"skipped_duplicates"`
+	RemovedMissing    int       `json:"removed_missing"`
 	Errors            int       `json:"errors"`
 	CurrentPath       string    `json:"current_path"`
+	FilesPerSecond    float64   `json:"files_per_second"` // Средняя скорость обработки
+	ETASeconds        int       `json:"eta_seconds"`      // Оценка оставшегося времени (0 — неизвестно или готово)
 }
 
 // NewScanner создает новый сканер
 func NewScanner(cfg *config.Config, store *storage.Store) *Scanner {
-	return &Scanner{
+	s := &Scanner{
 		cfg:      cfg,
 		store:    store,
 		stopChan: make(chan struct{}),
 	}
+
+	if cfg.Geo.Enabled {
+		geocoder, err := geo.NewOfflineGeocoder(cfg.Geo.CitiesPath, cfg.Geo.MaxDistanceKm)
+		if err != nil {
+			logger.ErrorLog.Printf("Reverse geocoding disabled: %v", err)
+		} else {
+			s.geocoder = geocoder
+		}
+	}
+
+	return s
+}
+
+// SetFileQueue включает параллельную обработку файлов через очередь
+func (s *Scanner) SetFileQueue(q FileQueue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = q
+}
+
+// Geocode заполняет Metadata.Place и Metadata.Country по GPS координатам
+func (s *Scanner) Geocode(media *storage.Media) {
+	if s.geocoder == nil || (media.Metadata.GPSLat == 0 && media.Metadata.GPSLon == 0) {
+		return
+	}
+	if place := s.geocoder.Reverse(media.Metadata.GPSLat, media.Metadata.GPSLon); place != nil {
+		media.Metadata.Place = place.City
+		media.Metadata.Country = place.Country
+	}
 }
 
 // Start запускает сканирование всех медиа-путей
@@ -56,8 +138,12 @@ func (s *Scanner) Start() error {
 	s.scanning = true
 	s.progress = ScanProgress{
 		Running:   true,
+		Counting:  true,
 		StartedAt: time.Now(),
 	}
+	s.processingSince = time.Time{}
+	s.finishedAt = time.Time{}
+	s.counters.reset()
 	s.mu.Unlock()
 
 	go s.scan()
@@ -77,8 +163,30 @@ func (s *Scanner) Stop() {
 // Progress возвращает текущий прогресс сканирования
 func (s *Scanner) Progress() ScanProgress {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.progress
+	progress := s.progress
+	s.mu.RUnlock()
+
+	progress.TotalFiles = int(s.counters.totalFiles.Load())
+	progress.Scanned = int(s.counters.scanned.Load())
+	progress.NewFiles = int(s.counters.newFiles.Load())
+	progress.UpdatedFiles = int(s.counters.updatedFiles.Load())
+	progress.SkippedDuplicates = int(s.counters.skippedDuplicates.Load())
+	progress.RemovedMissing = int(s.counters.removedMissing.Load())
+	progress.Errors = int(s.counters.errors.Load())
+
+	s.mu.RLock()
+	since, until := s.processingSince, s.finishedAt
+	s.mu.RUnlock()
+	if until.IsZero() {
+		until = time.Now()
+	}
+	if elapsed := until.Sub(since).Seconds(); !since.IsZero() && elapsed > 0 && progress.Scanned > 0 {
+		progress.FilesPerSecond = float64(progress.Scanned) / elapsed
+		if progress.Running && !progress.Counting && progress.TotalFiles > progress.Scanned {
+			progress.ETASeconds = int(math.Ceil(float64(progress.TotalFiles-progress.Scanned) / progress.FilesPerSecond))
+		}
+	}
+	return progress
 }
 
 // IsScanning возвращает true, если сканирование в процессе
@@ -93,23 +201,49 @@ func (s *Scanner) scan() {
 		s.mu.Lock()
 		s.scanning = false
 		s.progress.Running = false
+		s.progress.Counting = false
+		s.finishedAt = time.Now()
+		s.run = nil
 		s.mu.Unlock()
 	}()
 
-	extensions := make(map[string]storage.MediaType)
-	for _, ext := range s.cfg.Scan.Extensions.Images {
-		extensions[strings.ToLower(ext)] = storage.MediaTypeImage
+	run := &scanRun{
+		extensions: make(map[string]storage.MediaType),
 	}
-	for _, ext := range s.cfg.Scan.Extensions.Videos {
-		extensions[strings.ToLower(ext)] = storage.MediaTypeVideo
+	exts := s.cfg.Extensions()
+	for _, ext := range exts.Images {
+		run.extensions[strings.ToLower(ext)] = storage.MediaTypeImage
 	}
-	for _, ext := range s.cfg.Scan.Extensions.Raw {
-		extensions[strings.ToLower(ext)] = storage.MediaTypeRaw
+	for _, ext := range exts.Videos {
+		run.extensions[strings.ToLower(ext)] = storage.MediaTypeVideo
 	}
+	for _, ext := range exts.Raw {
+		run.extensions[strings.ToLower(ext)] = storage.MediaTypeRaw
+	}
+
+	s.mu.Lock()
+	run.stop = s.stopChan
+	s.run = run
+	queue := s.queue
+	s.mu.Unlock()
+
+	// Быстрый подсчет файлов, чтобы прогресс и оценка времени шли от настоящего итога
+	s.countFiles(run)
+	s.mu.Lock()
+	s.progress.Counting = false
+	s.processingSince = time.Now()
+	s.mu.Unlock()
+
+	// ID всех встреченных медиа-файлов, успешно обойдённые корни и пути,
+	// которые не удалось прочитать (для RemoveMissing)
+	seen := make(map[string]bool)
+	var walkedRoots, failedPaths []string
+	var discovered int64
 
 	for _, mediaPath := range s.cfg.Storage.MediaPaths {
 		select {
-		case <-s.stopChan:
+		case <-run.stop:
+			run.wg.Wait()
 			return
 		default:
 		}
@@ -120,193 +254,506 @@ func (s *Scanner) scan() {
 			continue
 		}
 
+		// Недоступный корень (например, отмонтированный диск) не участвует в сверке,
+		// иначе все его записи ушли бы в корзину
+		if _, err := os.Stat(absPath); err != nil {
+			logger.InfoLog.Printf("Error accessing path %s: %v", absPath, err)
+			continue
+		}
+
 		err = filepath.Walk(absPath, func(path string, info os.FileInfo, err error) error {
 			select {
-			case <-s.stopChan:
+			case <-run.stop:
 				return fmt.Errorf("scan stopped")
 			default:
 			}
 
 			if err != nil {
-				s.mu.Lock()
-				s.progress.Errors++
-				s.mu.Unlock()
+				// Файлы нечитаемой папки не попадут в seen — не сверяем их, как и недоступные корни
+				s.counters.errors.Add(1)
+				failedPaths = append(failedPaths, path)
 				return nil // Продолжаем сканирование
 			}
 
 			if info.IsDir() {
+				// Файлы в корзине на диске уже учтены своими записями
+				if s.cfg.Trash.Dir != "" && path == filepath.Join(absPath, s.cfg.Trash.Dir) {
+					return filepath.SkipDir
+				}
 				return nil
 			}
 
 			ext := strings.ToLower(filepath.Ext(path))
-			mediaType, ok := extensions[ext]
-			if !ok {
+			if _, ok := run.extensions[ext]; !ok {
 				return nil // Не медиа-файл
 			}
 
-			s.mu.Lock()
-			s.progress.TotalFiles++
-			s.progress.Scanned++
-			s.progress.CurrentPath = path
-			s.mu.Unlock()
-
-			// Проверяем, есть ли файл в БД
-			existing, err := s.store.GetMediaByPath(path)
-			if err != nil {
-				logger.InfoLog.Printf("Error checking media %s: %v", path, err)
-				s.mu.Lock()
-				s.progress.Errors++
-				s.mu.Unlock()
-				return nil
+			seen[storage.GenerateID(path)] = true
+			// Файлы, появившиеся после подсчета, увеличивают итог
+			if discovered++; discovered > s.counters.totalFiles.Load() {
+				s.counters.totalFiles.Store(discovered)
 			}
 
-			// Если файл в корзине (soft-deleted), пропускаем
-			if existing != nil && existing.DeletedAt != nil {
+			// Хеширование и метаданные выполняются воркерами пула параллельно
+			if queue == nil {
+				s.processFile(run, absPath, path, info)
 				return nil
 			}
-
-			// Если файл существует и не изменился, пропускаем
-			if existing != nil && existing.ModifiedAt.Equal(info.ModTime()) && existing.Size == info.Size() {
-				return nil
+			run.wg.Add(1)
+			if !queue.SubmitScanFile(path) {
+				run.wg.Done()
+				return fmt.Errorf("worker pool stopped")
 			}
+			return nil
+		})
 
-			// Создаем или обновляем запись
-			relPath, _ := filepath.Rel(absPath, path)
-			media := &storage.Media{
-				ID:         storage.GenerateID(path),
-				Path:       path,
-				RelPath:    relPath,
-				Dir:        filepath.Dir(relPath),
-				Filename:   info.Name(),
-				Ext:        ext,
-				Type:       mediaType,
-				MimeType:   getMimeType(ext),
-				Size:       info.Size(),
-				ModifiedAt: info.ModTime(),
-				CreatedAt:  time.Now(),
-			}
+		if err != nil {
+			logger.InfoLog.Printf("Error walking path %s: %v", mediaPath, err)
+			// Прерванный обход даёт неполный список - не сверяем
+			walkedRoots = nil
+			break
+		}
+		walkedRoots = append(walkedRoots, absPath)
+	}
+	if len(walkedRoots) > 0 {
+		s.counters.totalFiles.Store(discovered) // Без файлов, удаленных после подсчета
+	}
 
-			// Сохраняем важные поля из существующей записи
-			if existing != nil {
-				media.CreatedAt = existing.CreatedAt
-				media.IsFavorite = existing.IsFavorite
-				media.Tags = existing.Tags
-				media.ThumbSmall = existing.ThumbSmall
-				media.ThumbLarge = existing.ThumbLarge
-				media.Checksum = existing.Checksum
-				media.ImageHash = existing.ImageHash
-				// Не перезаписываем метаданные, если они уже есть
-				if existing.TakenAt.Year() > 1900 {
-					media.TakenAt = existing.TakenAt
-					media.Metadata = existing.Metadata
-				}
-			}
+	// Дожидаемся файлов, ещё обрабатываемых воркерами
+	run.wg.Wait()
 
-			// Извлекаем метаданные для изображений (только для новых файлов)
-			if existing == nil && (mediaType == storage.MediaTypeImage || mediaType == storage.MediaTypeRaw) {
-				if err := ExtractMetadata(path, media); err != nil {
-					logger.InfoLog.Printf("Error extracting metadata from %s: %v", path, err)
-				}
-			}
+	if s.cfg.Scan.RemoveMissing && len(walkedRoots) > 0 {
+		s.removeMissing(seen, walkedRoots, failedPaths)
+	}
+
+	if s.cfg.Scan.BurstAutoStack {
+		if stacks, err := s.store.StackBursts(BurstOptions(s.cfg)); err != nil {
+			logger.ErrorLog.Printf("Burst stacking failed: %v", err)
+		} else if stacks > 0 {
+			logger.InfoLog.Printf("Stacked %d bursts", stacks)
+		}
+	}
 
-			// Вычисляем хеши для новых файлов или если они отсутствуют
-			if media.Checksum == "" {
-				isImage := mediaType == storage.MediaTypeImage || mediaType == storage.MediaTypeRaw
-				hashes, err := CalculateHashes(path, isImage)
-				if err != nil {
-					logger.InfoLog.Printf("Error calculating hashes for %s: %v", path, err)
-				} else {
-					media.Checksum = hashes.Checksum
-					media.ImageHash = hashes.ImageHash
+	progress := s.Progress()
+	logger.InfoLog.Printf("Scan completed: %d files, %d new, %d updated, %d duplicates skipped, %d removed missing, %d errors",
+		progress.TotalFiles, progress.NewFiles, progress.UpdatedFiles, progress.SkippedDuplicates, progress.RemovedMissing, progress.Errors)
+}
+
+// countFiles считает медиа-файлы во всех корнях по тем же правилам, что и обход в scan,
+// без stat записей и обработки — только имена
+func (s *Scanner) countFiles(run *scanRun) {
+	for _, mediaPath := range s.cfg.Storage.MediaPaths {
+		absPath, err := filepath.Abs(mediaPath)
+		if err != nil {
+			continue
+		}
+		trashDir := ""
+		if s.cfg.Trash.Dir != "" {
+			trashDir = filepath.Join(absPath, s.cfg.Trash.Dir)
+		}
+		err = filepath.WalkDir(absPath, func(path string, d fs.DirEntry, err error) error {
+			select {
+			case <-run.stop:
+				return fmt.Errorf("scan stopped")
+			default:
+			}
+			if err != nil {
+				return nil // Ошибки учтет основной обход
+			}
+			if d.IsDir() {
+				if path == trashDir {
+					return filepath.SkipDir
 				}
+				return nil
+			}
+			if _, ok := run.extensions[strings.ToLower(filepath.Ext(path))]; ok {
+				s.counters.totalFiles.Add(1)
 			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+}
 
-			// Проверяем на дубликаты (только для новых файлов)
-			// Гибридный подход: 1) размер ±10%, 2) SHA256, 3) pHash
-			if existing == nil {
-				isImage := mediaType == storage.MediaTypeImage || mediaType == storage.MediaTypeRaw
-				dupResult, err := s.store.CheckDuplicate(media.Size, media.Checksum, media.ImageHash, isImage, 10)
-				if err != nil {
-					logger.InfoLog.Printf("Error checking duplicates for %s: %v", path, err)
-				} else if dupResult.IsDuplicate {
-					// Это дубликат - сохраняем с пометкой и перемещаем в корзину
-					media.DuplicateOf = dupResult.ExistingID
-
-					if err := s.store.SaveMedia(media); err != nil {
-						logger.InfoLog.Printf("Error saving duplicate %s: %v", path, err)
-						return nil
-					}
-
-					// Перемещаем в корзину
-					s.store.SoftDeleteMedia(media.ID)
-
-					if dupResult.Type == "exact" {
-						logger.InfoLog.Printf("Duplicate moved to trash: %s (exact copy of %s)", path, dupResult.ExistingID)
-					} else {
-						logger.InfoLog.Printf("Duplicate moved to trash: %s (similar to %s, distance=%d)", path, dupResult.ExistingID, dupResult.Distance)
-					}
-
-					s.mu.Lock()
-					s.progress.SkippedDuplicates++
-					s.mu.Unlock()
-					return nil
-				}
+// ProcessQueuedFile обрабатывает файл, отданный в FileQueue текущим сканированием.
+// Ошибки учитываются в прогрессе сканирования.
+func (s *Scanner) ProcessQueuedFile(ctx context.Context, path string) {
+	s.mu.RLock()
+	run := s.run
+	s.mu.RUnlock()
+	if run == nil {
+		return // Сканирование уже завершено
+	}
+	defer run.wg.Done()
+
+	select {
+	case <-run.stop:
+		return
+	case <-ctx.Done():
+		return
+	default:
+	}
+
+	info, err := os.Stat(path)
+	root, ok := s.rootOf(path)
+	if err != nil || !ok {
+		s.counters.errors.Add(1)
+		return
+	}
+	s.processFile(run, root, path, info)
+}
+
+// DiscardQueuedFile снимает ожидание файла, отданного в FileQueue, который не будет обработан
+// (пул остановлен): иначе сканирование ждало бы его бесконечно
+func (s *Scanner) DiscardQueuedFile(path string) {
+	s.mu.RLock()
+	run := s.run
+	s.mu.RUnlock()
+	if run == nil {
+		return
+	}
+	s.counters.errors.Add(1)
+	run.wg.Done()
+}
+
+// needsImageHash у изображения нет perceptual hash, хотя его формат декодируется
+func needsImageHash(m *storage.Media) bool {
+	return m.ImageHash == 0 && m.Type == storage.MediaTypeImage && hashableExts[strings.ToLower(m.Ext)]
+}
+
+// fillImageHash вычисляет perceptual hash неизмененного файла и сохраняет запись
+func (s *Scanner) fillImageHash(m *storage.Media) {
+	hash, err := calculateImageHash(m.Path)
+	if err != nil {
+		logger.InfoLog.Printf("Warning: failed to calculate image hash for %s: %v", m.Path, err)
+		return
+	}
+	m.ImageHash = hash
+	if err := s.store.SaveMedia(m); err != nil {
+		logger.InfoLog.Printf("Error saving image hash for %s: %v", m.Path, err)
+	}
+}
+
+// processFile создает или обновляет запись медиа для файла path из корня absPath
+func (s *Scanner) processFile(run *scanRun, absPath, path string, info os.FileInfo) {
+	ext := strings.ToLower(filepath.Ext(path))
+	mediaType := run.extensions[ext]
+
+	s.counters.scanned.Add(1)
+	s.mu.Lock()
+	s.progress.CurrentPath = path
+	s.mu.Unlock()
+
+	// Проверяем, есть ли файл в БД
+	existing, err := s.store.GetMediaByPath(path)
+	if err != nil {
+		logger.InfoLog.Printf("Error checking media %s: %v", path, err)
+		s.counters.errors.Add(1)
+		return
+	}
+
+	// Если файл в корзине (soft-deleted), пропускаем
+	if existing != nil && existing.DeletedAt != nil {
+		return
+	}
+
+	// Если файл существует и не изменился, пропускаем
+	if existing != nil && existing.ModifiedAt.Equal(info.ModTime()) && existing.Size == info.Size() {
+		// Записи, проиндексированные до появления декодера формата, досчитывают perceptual hash
+		if needsImageHash(existing) {
+			s.fillImageHash(existing)
+		}
+		return
+	}
+
+	// Создаем или обновляем запись
+	relPath, _ := filepath.Rel(absPath, path)
+	media := &storage.Media{
+		ID:         storage.GenerateID(path),
+		Path:       path,
+		RelPath:    relPath,
+		Dir:        filepath.Dir(relPath),
+		Filename:   info.Name(),
+		Ext:        ext,
+		Type:       mediaType,
+		MimeType:   s.cfg.MimeType(ext),
+		Size:       info.Size(),
+		ModifiedAt: info.ModTime(),
+		CreatedAt:  time.Now(),
+	}
+
+	// Сохраняем важные поля из существующей записи
+	if existing != nil {
+		media.CreatedAt = existing.CreatedAt
+		media.Slug = existing.Slug
+		media.IsFavorite = existing.IsFavorite
+		media.Tags = existing.Tags
+		media.Flagged = existing.Flagged
+		media.FlagReason = existing.FlagReason
+		media.FlaggedBy = existing.FlaggedBy
+		media.FlaggedAt = existing.FlaggedAt
+		media.UploadedBy = existing.UploadedBy
+		media.StackID = existing.StackID
+		media.DuplicateOf = existing.DuplicateOf
+		media.ThumbSmall = existing.ThumbSmall
+		media.ThumbLarge = existing.ThumbLarge
+		media.BlurHash = existing.BlurHash
+		media.Colors = existing.Colors
+		media.Checksum = existing.Checksum
+		media.ImageHash = existing.ImageHash
+		// Не перезаписываем метаданные, если они уже есть
+		if existing.TakenAt.Year() > 1900 {
+			media.TakenAt = existing.TakenAt
+			media.Metadata = existing.Metadata
+		}
+		if mediaType == storage.MediaTypeVideo {
+			media.Width = existing.Width
+			media.Height = existing.Height
+			media.Duration = existing.Duration
+			media.Metadata.Codec = existing.Metadata.Codec
+		}
+	}
+
+	// Извлекаем метаданные для изображений (только для новых файлов)
+	var keywords []string
+	if existing == nil && (mediaType == storage.MediaTypeImage || mediaType == storage.MediaTypeRaw) {
+		if err := ExtractMetadata(path, media, s.cfg.CaptureLocation()); err != nil {
+			logger.InfoLog.Printf("Error extracting metadata from %s: %v", path, err)
+		}
+		if keywords, err = ExtractXMP(path, media); err != nil {
+			logger.InfoLog.Printf("Error extracting XMP from %s: %v", path, err)
+		}
+		if mediaType == storage.MediaTypeImage && (media.Width == 0 || media.Height == 0) {
+			fillImageDimensions(path, media)
+		}
+	}
+
+	// Место съемки по GPS (и для старых записей без подписи)
+	if media.Metadata.Place == "" {
+		s.Geocode(media)
+	}
+
+	// Для видео — ffprobe (и для старых записей, где длительность еще не известна)
+	if mediaType == storage.MediaTypeVideo && (existing == nil || existing.Duration == 0) {
+		if err := s.ExtractVideoMetadata(path, media); err != nil {
+			logger.InfoLog.Printf("Error extracting video metadata from %s: %v", path, err)
+		}
+	}
+
+	// Нет даты съемки в метаданных — берем из имени папки (иначе дата изменения файла)
+	if media.TakenAt.Year() <= 1900 {
+		if t, ok := FolderDate(relPath, s.cfg); ok {
+			media.TakenAt = t
+		}
+	}
+
+	// Вычисляем хеши для новых файлов или если они отсутствуют
+	if media.Checksum == "" {
+		isImage := mediaType == storage.MediaTypeImage || mediaType == storage.MediaTypeRaw
+		hashes, err := CalculateHashes(path, isImage)
+		if err != nil {
+			logger.InfoLog.Printf("Error calculating hashes for %s: %v", path, err)
+		} else {
+			media.Checksum = hashes.Checksum
+			media.ImageHash = hashes.ImageHash
+		}
+	} else if needsImageHash(media) {
+		if hash, err := calculateImageHash(path); err == nil {
+			media.ImageHash = hash
+		}
+	}
+
+	// Проверка дубликатов и сохранение новых файлов идут по одному,
+	// иначе две одинаковые копии, обрабатываемые параллельно, не увидят друг друга.
+	// Обновления существующих записей дубликаты не проверяют и не ждут.
+	if existing == nil {
+		s.saveMu.Lock()
+	}
+	saved := s.saveScannedMedia(media, existing == nil)
+	if existing == nil {
+		s.saveMu.Unlock()
+	}
+	if !saved {
+		return
+	}
+
+	// Короткий ID для ссылок /view/{slug}
+	if media.Slug == "" {
+		if _, err := s.store.EnsureSlug(media.ID); err != nil {
+			logger.InfoLog.Printf("Error creating slug for %s: %v", path, err)
+		}
+	}
+
+	// Теги из имен папок и ключевых слов — только для новых файлов, чтобы не возвращать снятые вручную
+	if existing == nil {
+		var tags []string
+		if s.cfg.Scan.AutoTagFromPath {
+			tags = PathTags(relPath, s.cfg)
+		}
+		if s.cfg.Scan.ImportKeywords {
+			tags = append(tags, keywords...)
+		}
+		if len(tags) > 0 {
+			if err := s.store.AddTagsToMedia(media.ID, tags); err != nil {
+				logger.InfoLog.Printf("Error adding tags to %s: %v", path, err)
 			}
+		}
+	}
+
+	if existing == nil {
+		s.counters.newFiles.Add(1)
+	} else {
+		s.counters.updatedFiles.Add(1)
+	}
+}
+
+// saveScannedMedia проверяет новый файл на дубликаты и сохраняет запись.
+// Возвращает false, если файл ушёл в корзину как дубликат или не сохранился.
+func (s *Scanner) saveScannedMedia(media *storage.Media, isNew bool) bool {
+	// Проверяем на дубликаты (только для новых файлов)
+	// Гибридный подход: 1) размер ±10%, 2) SHA256, 3) pHash
+	if isNew {
+		isImage := media.Type == storage.MediaTypeImage || media.Type == storage.MediaTypeRaw
+		dupResult, err := s.store.CheckDuplicate(media, isImage, 10, DuplicateScope(s.cfg))
+		if err != nil {
+			logger.InfoLog.Printf("Error checking duplicates for %s: %v", media.Path, err)
+		} else if dupResult.IsDuplicate && s.replaceWithBetterCopy(media, dupResult.ExistingID) {
+			// Новая копия лучше — существующая уже в корзине, новый файл сохраняется как обычно
+			s.counters.skippedDuplicates.Add(1)
+		} else if dupResult.IsDuplicate {
+			// Это дубликат - сохраняем с пометкой и перемещаем в корзину
+			media.DuplicateOf = dupResult.ExistingID
 
-			// Сохраняем в БД
 			if err := s.store.SaveMedia(media); err != nil {
-				logger.InfoLog.Printf("Error saving media %s: %v", path, err)
-				s.mu.Lock()
-				s.progress.Errors++
-				s.mu.Unlock()
-				return nil
+				logger.InfoLog.Printf("Error saving duplicate %s: %v", media.Path, err)
+				return false
 			}
 
-			s.mu.Lock()
-			if existing == nil {
-				s.progress.NewFiles++
+			// Перемещаем в корзину
+			s.store.SoftDeleteMedia(media.ID)
+
+			if dupResult.Type == "exact" {
+				logger.InfoLog.Printf("Duplicate moved to trash: %s (exact copy of %s)", media.Path, dupResult.ExistingID)
 			} else {
-				s.progress.UpdatedFiles++
+				logger.InfoLog.Printf("Duplicate moved to trash: %s (similar to %s, distance=%d)", media.Path, dupResult.ExistingID, dupResult.Distance)
 			}
-			s.mu.Unlock()
 
-			return nil
-		})
+			s.counters.skippedDuplicates.Add(1)
+			return false
+		}
+	}
 
+	// Сохраняем в БД
+	if err := s.store.SaveMedia(media); err != nil {
+		logger.InfoLog.Printf("Error saving media %s: %v", media.Path, err)
+		s.counters.errors.Add(1)
+		return false
+	}
+	return true
+}
+
+// rootOf возвращает медиа-корень, которому принадлежит путь (первый по порядку в конфигурации,
+// как при обходе)
+func (s *Scanner) rootOf(path string) (string, bool) {
+	for _, mediaPath := range s.cfg.Storage.MediaPaths {
+		root, err := filepath.Abs(mediaPath)
 		if err != nil {
-			logger.InfoLog.Printf("Error walking path %s: %v", mediaPath, err)
+			continue
+		}
+		if underAnyRoot(path, []string{root}) {
+			return root, true
 		}
 	}
+	return "", false
+}
+
+// removeMissing перемещает в корзину записи, файлы которых не были найдены при обходе.
+// Учитываются только записи внутри успешно обойдённых корней и вне путей failed,
+// на которых обход получил ошибку (нечитаемые папки и файлы).
+func (s *Scanner) removeMissing(seen map[string]bool, roots, failed []string) {
+	allMedia, err := s.store.ListAllMedia()
+	if err != nil {
+		logger.InfoLog.Printf("Error listing media for reconciliation: %v", err)
+		return
+	}
+
+	for _, m := range allMedia {
+		if seen[m.ID] || !underAnyRoot(m.Path, roots) || underAnyRoot(m.Path, failed) {
+			continue
+		}
 
-	logger.InfoLog.Printf("Scan completed: %d files, %d new, %d updated, %d duplicates skipped, %d errors",
-		s.progress.TotalFiles, s.progress.NewFiles, s.progress.UpdatedFiles, s.progress.SkippedDuplicates, s.progress.Errors)
+		if err := s.store.SoftDeleteMedia(m.ID); err != nil {
+			logger.InfoLog.Printf("Error moving missing media %s to trash: %v", m.Path, err)
+			continue
+		}
+		logger.InfoLog.Printf("File no longer exists, moved to trash: %s", m.Path)
+
+		s.counters.removedMissing.Add(1)
+	}
+}
+
+// underAnyRoot проверяет, находится ли путь внутри одного из корней
+func underAnyRoot(path string, roots []string) bool {
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceWithBetterCopy заменяет существующую копию новым файлом, если он лучше
+// по политике scan.duplicate_keep. Возвращает true, если существующая копия ушла в корзину.
+func (s *Scanner) replaceWithBetterCopy(candidate *storage.Media, existingID string) bool {
+	existing, err := s.store.GetMedia(existingID)
+	if err != nil || existing == nil || existing.DeletedAt != nil {
+		return false
+	}
+
+	switch s.cfg.Scan.DuplicateKeep {
+	case "larger":
+		if candidate.Size <= existing.Size {
+			return false
+		}
+	case "higher_res":
+		if candidate.Width*candidate.Height <= existing.Width*existing.Height {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if err := s.store.ReplaceDuplicate(candidate, existing); err != nil {
+		logger.InfoLog.Printf("Error replacing duplicate %s: %v", existing.Path, err)
+		return false
+	}
+	logger.InfoLog.Printf("Duplicate moved to trash: %s (replaced by better copy %s)", existing.Path, candidate.Path)
+	return true
+}
+
+// DuplicateScope возвращает ограничения поиска похожих дубликатов из конфигурации
+func DuplicateScope(cfg *config.Config) storage.DuplicateScope {
+	return storage.DuplicateScope{
+		SameCamera:   cfg.Scan.DuplicateScope.SameCamera,
+		MaxDays:      cfg.Scan.DuplicateScope.MaxDays,
+		MinDimension: cfg.Scan.MinDuplicateDimension,
+	}
+}
+
+// BurstOptions возвращает условия серии кадров из конфигурации
+func BurstOptions(cfg *config.Config) storage.BurstOptions {
+	return storage.BurstOptions{
+		MaxGap:  time.Duration(cfg.Scan.BurstGap) * time.Second,
+		MinSize: cfg.Scan.BurstMinSize,
+	}
 }
 
-func getMimeType(ext string) string {
-	mimeTypes := map[string]string{
-		".jpg":  "image/jpeg",
-		".jpeg": "image/jpeg",
-		".png":  "image/png",
-		".gif":  "image/gif",
-		".webp": "image/webp",
-		".heic": "image/heic",
-		".mp4":  "video/mp4",
-		".mov":  "video/quicktime",
-		".avi":  "video/x-msvideo",
-		".mkv":  "video/x-matroska",
-		".webm": "video/webm",
-		".raw":  "image/x-raw",
-		".cr2":  "image/x-canon-cr2",
-		".cr3":  "image/x-canon-cr3",
-		".nef":  "image/x-nikon-nef",
-		".arw":  "image/x-sony-arw",
-		".dng":  "image/x-adobe-dng",
-		".orf":  "image/x-olympus-orf",
-		".raf":  "image/x-fuji-raf",
-		".rw2":  "image/x-panasonic-rw2",
-	}
-	if mime, ok := mimeTypes[ext]; ok {
-		return mime
-	}
-	return "application/octet-stream"
+// DuplicateLimits возвращает ограничения объема и времени поиска дубликатов из конфигурации
+func DuplicateLimits(cfg *config.Config) storage.DuplicateLimits {
+	return storage.DuplicateLimits{
+		MaxGroups: max(cfg.Scan.DuplicateMaxGroups, 0),
+		Timeout:   time.Duration(max(cfg.Scan.DuplicateTimeout, 0)) * time.Second,
+	}
 }
@@ -0,0 +1,361 @@
+package scanner
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/config"
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// newTestScanner создает сканер с конфигурацией из extraYAML (раздел scan и т.п.)
+// над пустым медиа-корнем во временной директории
+func newTestScanner(tb testing.TB, extraYAML string) (*Scanner, *storage.Store, string) {
+	tb.Helper()
+	dir := tb.TempDir()
+	root := filepath.Join(dir, "media")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		tb.Fatal(err)
+	}
+	if err := logger.Init(filepath.Join(dir, "logs")); err != nil {
+		tb.Fatal(err)
+	}
+
+	yaml := fmt.Sprintf(`storage:
+  media_paths: [%q]
+  cache_path: %q
+  db_path: %q
+  logs_path: %q
+scan:
+  extensions:
+    images: [".jpg", ".png", ".webp"]
+    videos: [".mp4"]
+%s`, root, filepath.Join(dir, "cache"), filepath.Join(dir, "data", "test.db"), filepath.Join(dir, "logs"), extraYAML)
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	store, err := storage.NewStore(cfg.Storage.DBPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { store.Close() })
+	return NewScanner(cfg, store), store, root
+}
+
+// writeJPEG пишет однотонный JPEG; shade меняет содержимое, чтобы файлы не были дубликатами
+func writeJPEG(tb testing.TB, path string, shade int) {
+	tb.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		tb.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			// Полосы разной ширины дают разные pHash
+			v := uint8(0)
+			if (x/(shade%8+1))%2 == 0 {
+				v = 255
+			}
+			img.Set(x, y, color.RGBA{R: v, G: uint8(shade * 37), B: uint8(y * 8), A: 255})
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	if err := jpeg.Encode(f, img, nil); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// runScan запускает сканирование и ждет его завершения
+func runScan(tb testing.TB, s *Scanner) ScanProgress {
+	tb.Helper()
+	if err := s.Start(); err != nil {
+		tb.Fatal(err)
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for s.IsScanning() {
+		if time.Now().After(deadline) {
+			tb.Fatal("scan did not finish")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return s.Progress()
+}
+
+func TestScanRemoveMissing(t *testing.T) {
+	s, store, root := newTestScanner(t, "  remove_missing: true\n")
+	kept := filepath.Join(root, "kept.jpg")
+	removed := filepath.Join(root, "album", "removed.jpg")
+	writeJPEG(t, kept, 1)
+	writeJPEG(t, removed, 2)
+
+	if p := runScan(t, s); p.NewFiles != 2 {
+		t.Fatalf("first scan: new files = %d, want 2", p.NewFiles)
+	}
+
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	if p := runScan(t, s); p.RemovedMissing != 1 {
+		t.Fatalf("second scan: removed missing = %d, want 1", p.RemovedMissing)
+	}
+
+	m, err := store.GetMediaByPath(removed)
+	if err != nil || m == nil {
+		t.Fatalf("record of removed file: %v, %v", m, err)
+	}
+	if m.DeletedAt == nil {
+		t.Error("record of removed file is not in trash")
+	}
+	if m, _ := store.GetMediaByPath(kept); m == nil || m.DeletedAt != nil {
+		t.Error("record of existing file was moved to trash")
+	}
+}
+
+func TestScanRemoveMissingSkipsUnreadableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root reads directories regardless of permissions")
+	}
+	s, store, root := newTestScanner(t, "  remove_missing: true\n")
+	locked := filepath.Join(root, "locked")
+	inside := filepath.Join(locked, "photo.jpg")
+	writeJPEG(t, inside, 1)
+	runScan(t, s)
+
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	p := runScan(t, s)
+	if p.Errors == 0 {
+		t.Error("unreadable directory was not counted as an error")
+	}
+	if m, _ := store.GetMediaByPath(inside); m == nil || m.DeletedAt != nil {
+		t.Error("media in unreadable directory was moved to trash")
+	}
+}
+
+func TestRemoveMissingSkipsFailedPaths(t *testing.T) {
+	s, store, root := newTestScanner(t, "  remove_missing: true\n")
+	for _, path := range []string{
+		filepath.Join(root, "gone.jpg"),
+		filepath.Join(root, "broken", "a.jpg"),
+		filepath.Join(root, "broken", "deep", "b.jpg"),
+		filepath.Join(root, "unstatable.jpg"),
+	} {
+		m := &storage.Media{ID: storage.GenerateID(path), Path: path, Dir: filepath.Dir(path), Filename: filepath.Base(path)}
+		if err := store.SaveMedia(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failed := []string{filepath.Join(root, "broken"), filepath.Join(root, "unstatable.jpg")}
+	s.removeMissing(map[string]bool{}, []string{root}, failed)
+
+	if got := s.counters.removedMissing.Load(); got != 1 {
+		t.Fatalf("removed missing = %d, want 1 (only gone.jpg)", got)
+	}
+	if m, _ := store.GetMediaByPath(filepath.Join(root, "gone.jpg")); m.DeletedAt == nil {
+		t.Error("gone.jpg should be in trash")
+	}
+	if m, _ := store.GetMediaByPath(filepath.Join(root, "broken", "deep", "b.jpg")); m.DeletedAt != nil {
+		t.Error("media under a failed directory was moved to trash")
+	}
+}
+
+func BenchmarkRemoveMissing(b *testing.B) {
+	s, store, root := newTestScanner(b, "  remove_missing: true\n")
+	const records = 2000
+	seen := make(map[string]bool, records)
+	for i := 0; i < records; i++ {
+		path := filepath.Join(root, fmt.Sprintf("dir%d", i%50), fmt.Sprintf("img%d.jpg", i))
+		m := &storage.Media{ID: storage.GenerateID(path), Path: path, Dir: filepath.Dir(path), Filename: filepath.Base(path)}
+		if err := store.SaveMedia(m); err != nil {
+			b.Fatal(err)
+		}
+		seen[m.ID] = true // Все файлы на месте: измеряется сама сверка
+	}
+	failed := []string{filepath.Join(root, "dir7")}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.removeMissing(seen, []string{root}, failed)
+	}
+}
+
+func TestScanProgressSpeedAndETA(t *testing.T) {
+	s, _, root := newTestScanner(t, "")
+	const files = 12
+	for i := 0; i < files; i++ {
+		writeJPEG(t, filepath.Join(root, fmt.Sprintf("dir%d", i%3), "sub", fmt.Sprintf("img%d.jpg", i)), i+1)
+	}
+
+	p := runScan(t, s)
+	if p.TotalFiles != files || p.Scanned != files {
+		t.Fatalf("total/scanned = %d/%d, want %d/%d", p.TotalFiles, p.Scanned, files, files)
+	}
+	if math.IsNaN(p.FilesPerSecond) || math.IsInf(p.FilesPerSecond, 0) || p.FilesPerSecond <= 0 {
+		t.Errorf("files per second = %v, want a positive finite value", p.FilesPerSecond)
+	}
+	if p.ETASeconds != 0 {
+		t.Errorf("ETA after finish = %d, want 0", p.ETASeconds)
+	}
+
+	// Скорость после завершения считается по finishedAt и не падает со временем
+	time.Sleep(20 * time.Millisecond)
+	if again := s.Progress(); again.FilesPerSecond != p.FilesPerSecond {
+		t.Errorf("files per second changed after finish: %v -> %v", p.FilesPerSecond, again.FilesPerSecond)
+	}
+}
+
+func TestScanProgressETAMidRun(t *testing.T) {
+	s, _, _ := newTestScanner(t, "")
+	// Середина прогона: 4 из 10 файлов за 2 секунды — ~2 файла/с, осталось ~3 с
+	s.mu.Lock()
+	s.progress = ScanProgress{Running: true}
+	s.processingSince = time.Now().Add(-2 * time.Second)
+	s.finishedAt = time.Time{}
+	s.mu.Unlock()
+	s.counters.totalFiles.Store(10)
+	s.counters.scanned.Store(4)
+
+	p := s.Progress()
+	if p.FilesPerSecond < 1.9 || p.FilesPerSecond > 2.1 {
+		t.Errorf("files per second = %v, want ~2", p.FilesPerSecond)
+	}
+	// Прошло чуть больше 2 с, поэтому округление вверх может дать 4
+	if want := int(math.Ceil(6 / p.FilesPerSecond)); p.ETASeconds != want || p.ETASeconds < 3 || p.ETASeconds > 4 {
+		t.Errorf("ETA = %d, want ceil(6/%v) in [3, 4]", p.ETASeconds, p.FilesPerSecond)
+	}
+
+	// Пока идет подсчет, TotalFiles растет — ETA не выдается
+	s.mu.Lock()
+	s.progress.Counting = true
+	s.mu.Unlock()
+	if p := s.Progress(); p.ETASeconds != 0 {
+		t.Errorf("ETA while counting = %d, want 0", p.ETASeconds)
+	}
+}
+
+// touchFile меняет время изменения файла, как внешний редактор
+func touchFile(tb testing.TB, path string) {
+	tb.Helper()
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestRescanKeepsUploader(t *testing.T) {
+	s, store, root := newTestScanner(t, "")
+	path := filepath.Join(root, "upload.jpg")
+	writeJPEG(t, path, 1)
+	runScan(t, s)
+
+	m, err := store.GetMediaByPath(path)
+	if err != nil || m == nil {
+		t.Fatalf("scanned media: %v, %v", m, err)
+	}
+	m.UploadedBy = "user-x"
+	if err := store.SaveMedia(m); err != nil {
+		t.Fatal(err)
+	}
+
+	touchFile(t, path)
+	if p := runScan(t, s); p.UpdatedFiles != 1 {
+		t.Fatalf("updated files = %d, want 1", p.UpdatedFiles)
+	}
+	if m, _ := store.GetMediaByPath(path); m.UploadedBy != "user-x" {
+		t.Errorf("uploaded by after rescan = %q, want user-x", m.UploadedBy)
+	}
+}
+
+func TestRescanKeepsStack(t *testing.T) {
+	s, store, root := newTestScanner(t, "")
+	var ids []string
+	for i, name := range []string{"burst1.jpg", "burst2.jpg", "burst3.jpg"} {
+		writeJPEG(t, filepath.Join(root, name), i+1)
+		ids = append(ids, storage.GenerateID(filepath.Join(root, name)))
+	}
+	runScan(t, s)
+	stackID, err := store.StackMedia(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Внешнее редактирование одного кадра стопки
+	touchFile(t, filepath.Join(root, "burst2.jpg"))
+	runScan(t, s)
+
+	members, err := store.GetStackMedia(stackID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != len(ids) {
+		t.Errorf("stack members after rescan = %d, want %d", len(members), len(ids))
+	}
+	if m, _ := store.GetMedia(ids[1]); m.StackID != stackID {
+		t.Errorf("edited media stack = %q, want %q", m.StackID, stackID)
+	}
+}
+
+func TestDuplicateKeepPolicy(t *testing.T) {
+	tests := []struct {
+		policy   string
+		size     int64
+		width    int
+		replaced bool
+	}{
+		{"existing", 2000, 200, false},
+		{"larger", 2000, 50, true},
+		{"larger", 1000, 200, false}, // Тот же размер — остается существующая копия
+		{"higher_res", 500, 200, true},
+		{"higher_res", 2000, 100, false},
+	}
+	for _, tt := range tests {
+		s, store, root := newTestScanner(t, "  duplicate_keep: "+tt.policy+"\n")
+		copyOf := func(name string, size int64, width int) *storage.Media {
+			path := filepath.Join(root, name)
+			return &storage.Media{ID: storage.GenerateID(path), Path: path, Dir: root, Filename: name, Type: storage.MediaTypeImage, Size: size, Width: width, Height: 100}
+		}
+		existing := copyOf("old.jpg", 1000, 100)
+		if err := store.SaveMedia(existing); err != nil {
+			t.Fatal(err)
+		}
+		candidate := copyOf("new.jpg", tt.size, tt.width)
+
+		if got := s.replaceWithBetterCopy(candidate, existing.ID); got != tt.replaced {
+			t.Errorf("%s size=%d width=%d: replaced = %v, want %v", tt.policy, tt.size, tt.width, got, tt.replaced)
+			continue
+		}
+		if !tt.replaced {
+			continue
+		}
+		// Существующая копия в корзине как дубликат новой, новая — основная
+		old, _ := store.GetMedia(existing.ID)
+		if old.DeletedAt == nil || old.DuplicateOf != candidate.ID {
+			t.Errorf("%s: existing copy deleted=%v duplicate_of=%q, want trashed duplicate of the new copy", tt.policy, old.DeletedAt != nil, old.DuplicateOf)
+		}
+		if m, _ := store.GetMedia(candidate.ID); m == nil || m.DeletedAt != nil || m.DuplicateOf != "" {
+			t.Errorf("%s: new copy = %+v, want a primary record", tt.policy, m)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// ffprobeOutput часть JSON ответа ffprobe -show_format -show_streams
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		Duration  string `json:"duration"`
+		Tags      struct {
+			Rotate string `json:"rotate"`
+		} `json:"tags"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		Tags     struct {
+			CreationTime string `json:"creation_time"`
+		} `json:"tags"`
+	} `json:"format"`
+}
+
+// ffprobeMissingOnce чтобы не писать в лог про отсутствие ffprobe для каждого файла
+var ffprobeMissingOnce sync.Once
+
+// ExtractVideoMetadata извлекает длительность, разрешение и кодек видео через ffprobe.
+// Если ffprobe недоступен, поля остаются нулевыми (ошибки нет).
+func (s *Scanner) ExtractVideoMetadata(path string, media *storage.Media) error {
+	ffprobe, err := exec.LookPath(s.cfg.Tools.Ffprobe)
+	if err != nil {
+		ffprobeMissingOnce.Do(func() {
+			logger.InfoLog.Printf("WARNING: ffprobe not found (%s), video duration and resolution will not be extracted", s.cfg.Tools.Ffprobe)
+		})
+		return nil
+	}
+
+	// ffprobe -v error -print_format json -show_format -show_streams video.mp4
+	cmd := exec.Command(ffprobe,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "video" {
+			continue
+		}
+		media.Width = stream.Width
+		media.Height = stream.Height
+		media.Metadata.Codec = stream.CodecName
+
+		// Повернутое видео (телефоны пишут rotate=90) — меняем стороны местами
+		if stream.Tags.Rotate == "90" || stream.Tags.Rotate == "270" || stream.Tags.Rotate == "-90" {
+			media.Width, media.Height = media.Height, media.Width
+		}
+		if d, err := strconv.ParseFloat(stream.Duration, 64); err == nil {
+			media.Duration = d
+		}
+		break
+	}
+
+	// Длительность контейнера точнее, если у потока ее нет
+	if media.Duration == 0 {
+		if d, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+			media.Duration = d
+		}
+	}
+
+	if media.TakenAt.IsZero() && probe.Format.Tags.CreationTime != "" {
+		if t, err := time.Parse(time.RFC3339Nano, probe.Format.Tags.CreationTime); err == nil && t.Year() > 1970 {
+			media.TakenAt = t
+		}
+	}
+
+	return nil
+}
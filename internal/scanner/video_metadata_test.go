@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// stubFfprobe пишет заглушку ffprobe, печатающую output
+func stubFfprobe(tb testing.TB, output string) string {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "ffprobe")
+	script := fmt.Sprintf("#!/bin/sh\ncat <<'JSON'\n%s\nJSON\n", output)
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractVideoMetadata(t *testing.T) {
+	// Телефонное видео: поворот 90, длительность только у контейнера
+	ffprobe := stubFfprobe(t, `{
+  "streams": [
+    {"codec_type": "audio", "codec_name": "aac", "duration": "99.0"},
+    {"codec_type": "video", "codec_name": "hevc", "width": 1920, "height": 1080, "tags": {"rotate": "90"}}
+  ],
+  "format": {"duration": "12.5", "tags": {"creation_time": "2023-05-01T10:20:30.000000Z"}}
+}`)
+	s, _, _ := newTestScanner(t, fmt.Sprintf("tools:\n  ffprobe: %q\n", ffprobe))
+
+	m := &storage.Media{}
+	if err := s.ExtractVideoMetadata("clip.mp4", m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Width != 1080 || m.Height != 1920 {
+		t.Errorf("size = %dx%d, want rotated 1080x1920", m.Width, m.Height)
+	}
+	if m.Metadata.Codec != "hevc" || m.Duration != 12.5 {
+		t.Errorf("codec %q, duration %v; want hevc, 12.5 from the container", m.Metadata.Codec, m.Duration)
+	}
+	if want := time.Date(2023, time.May, 1, 10, 20, 30, 0, time.UTC); !m.TakenAt.Equal(want) {
+		t.Errorf("taken at = %v, want %v", m.TakenAt, want)
+	}
+
+	// Дата съемки из метаданных файла не перезаписывается
+	taken := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	m = &storage.Media{TakenAt: taken}
+	if err := s.ExtractVideoMetadata("clip.mp4", m); err != nil {
+		t.Fatal(err)
+	}
+	if !m.TakenAt.Equal(taken) {
+		t.Errorf("taken at = %v, want the existing %v", m.TakenAt, taken)
+	}
+}
+
+func TestExtractVideoMetadataWithoutFfprobe(t *testing.T) {
+	s, _, _ := newTestScanner(t, "tools:\n  ffprobe: /nonexistent/ffprobe\n")
+	m := &storage.Media{}
+	if err := s.ExtractVideoMetadata("clip.mp4", m); err != nil {
+		t.Errorf("error without ffprobe = %v, want nil", err)
+	}
+	if m.Width != 0 || m.Duration != 0 || m.Metadata.Codec != "" {
+		t.Errorf("metadata filled without ffprobe: %+v", m)
+	}
+}
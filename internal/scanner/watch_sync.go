@@ -0,0 +1,186 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// movedFileTTL сколько ждать create с тем же checksum после rename
+const movedFileTTL = time.Minute
+
+// movedFile запись, чей файл исчез при rename и ещё не найден на новом месте
+type movedFile struct {
+	mediaID string
+	at      time.Time
+}
+
+// WatchSync обновляет БД по событиям Watcher: удалённый с диска файл уходит в корзину,
+// переименованный или перемещённый — переносится на новый путь по checksum
+type WatchSync struct {
+	scanner *Scanner
+	store   *storage.Store
+
+	mu    sync.Mutex
+	moved map[string]movedFile // checksum -> запись, ожидающая нового пути
+
+	onMove func(oldID, newID string) // Вызывается после переноса записи под новый ID
+}
+
+// NewWatchSync создает обработчик событий для Watcher.AddHandler(ws.Handle)
+func NewWatchSync(scanner *Scanner, store *storage.Store) *WatchSync {
+	return &WatchSync{
+		scanner: scanner,
+		store:   store,
+		moved:   make(map[string]movedFile),
+	}
+}
+
+// OnMove задает fn, вызываемую после переноса записи под новый ID (например, для переименования превью)
+func (ws *WatchSync) OnMove(fn func(oldID, newID string)) {
+	ws.onMove = fn
+}
+
+// Handle обрабатывает событие файловой системы
+func (ws *WatchSync) Handle(event FileEvent) {
+	if event.IsDir {
+		return // Содержимое директорий сверяет полное сканирование
+	}
+
+	switch event.Operation {
+	case "delete":
+		ws.handleDelete(event.Path)
+	case "rename":
+		ws.handleRename(event.Path)
+	case "create":
+		ws.handleCreate(event.Path)
+	}
+}
+
+// handleDelete перемещает запись удалённого файла в корзину
+func (ws *WatchSync) handleDelete(path string) {
+	media, err := ws.store.GetMediaByPath(path)
+	if err != nil || media == nil || media.DeletedAt != nil {
+		return
+	}
+	if err := ws.store.SoftDeleteMedia(media.ID); err != nil {
+		logger.InfoLog.Printf("Watcher: error moving deleted media %s to trash: %v", path, err)
+		return
+	}
+	logger.InfoLog.Printf("Watcher: file deleted, moved to trash: %s", path)
+}
+
+// handleRename обрабатывает старый путь переименованного файла (fsnotify сообщает
+// новый путь отдельным create). Запись уходит в корзину и ждёт create с тем же checksum.
+func (ws *WatchSync) handleRename(path string) {
+	if _, err := os.Stat(path); err == nil {
+		return // Файл на месте (например, заменён атомарной записью)
+	}
+
+	media, err := ws.store.GetMediaByPath(path)
+	if err != nil || media == nil || media.DeletedAt != nil {
+		return
+	}
+
+	if media.Checksum != "" {
+		ws.mu.Lock()
+		ws.expireMoved()
+		ws.moved[media.Checksum] = movedFile{mediaID: media.ID, at: time.Now()}
+		ws.mu.Unlock()
+	}
+
+	// Если create уже обработан раньше rename, файл найдётся в handleCreate по checksum
+	if err := ws.store.SoftDeleteMedia(media.ID); err != nil {
+		logger.InfoLog.Printf("Watcher: error moving renamed media %s to trash: %v", path, err)
+	}
+}
+
+// handleCreate переносит запись на новый путь, если это перемещённый файл из библиотеки
+func (ws *WatchSync) handleCreate(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return
+	}
+	if existing, err := ws.store.GetMediaByPath(path); err != nil || existing != nil {
+		return // Запись уже есть (обновление файла подхватит сканирование)
+	}
+
+	relPath, ok := ws.relPath(path)
+	if !ok {
+		return
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	isImage := ws.scanner.cfg.IsImage(ext) || ws.scanner.cfg.IsRaw(ext)
+	hashes, err := CalculateHashes(path, isImage)
+	if err != nil {
+		logger.InfoLog.Printf("Watcher: error calculating hashes for %s: %v", path, err)
+		return
+	}
+
+	mediaID := ws.takeMoved(hashes.Checksum)
+	if mediaID == "" {
+		// rename ещё не обработан: ищем запись с тем же checksum, чьего файла больше нет
+		id, err := ws.store.ChecksumExists(hashes.Checksum)
+		if err != nil || id == "" {
+			return
+		}
+		media, err := ws.store.GetMedia(id)
+		if err != nil || media == nil {
+			return
+		}
+		if _, err := os.Stat(media.Path); err == nil {
+			return // Это копия, а не перемещение
+		}
+		mediaID = id
+	}
+
+	moved, err := ws.store.MoveMedia(mediaID, path, relPath)
+	if err != nil {
+		logger.InfoLog.Printf("Watcher: error moving media to %s: %v", path, err)
+		return
+	}
+	if moved.ID != mediaID && ws.onMove != nil {
+		ws.onMove(mediaID, moved.ID)
+	}
+	logger.InfoLog.Printf("Watcher: file moved, record updated: %s", moved.Path)
+}
+
+// takeMoved возвращает и забывает запись, ожидающую нового пути с таким checksum
+func (ws *WatchSync) takeMoved(checksum string) string {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.expireMoved()
+	m, ok := ws.moved[checksum]
+	if !ok {
+		return ""
+	}
+	delete(ws.moved, checksum)
+	return m.mediaID
+}
+
+// expireMoved забывает rename без парного create (файл ушёл за пределы библиотеки).
+// Вызывается под ws.mu.
+func (ws *WatchSync) expireMoved() {
+	cutoff := time.Now().Add(-movedFileTTL)
+	for checksum, m := range ws.moved {
+		if m.at.Before(cutoff) {
+			delete(ws.moved, checksum)
+		}
+	}
+}
+
+// relPath возвращает путь файла относительно медиа-корня, которому он принадлежит
+func (ws *WatchSync) relPath(path string) (string, bool) {
+	root, ok := ws.scanner.rootOf(path)
+	if !ok {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, path)
+	return rel, err == nil
+}
@@ -0,0 +1,90 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func TestWatchSyncDeleteMovesToTrash(t *testing.T) {
+	s, store, root := newTestScanner(t, "")
+	path := filepath.Join(root, "gone.jpg")
+	writeJPEG(t, path, 1)
+	runScan(t, s)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	NewWatchSync(s, store).Handle(FileEvent{Path: path, Operation: "delete"})
+
+	m, err := store.GetMediaByPath(path)
+	if err != nil || m == nil {
+		t.Fatalf("record of deleted file: %v, %v", m, err)
+	}
+	if m.DeletedAt == nil {
+		t.Error("deleted file record is not in trash")
+	}
+}
+
+func TestWatchSyncRenameMovesRecord(t *testing.T) {
+	s, store, root := newTestScanner(t, "")
+	oldPath := filepath.Join(root, "old.jpg")
+	newPath := filepath.Join(root, "trip", "new.jpg")
+	writeJPEG(t, oldPath, 1)
+	runScan(t, s)
+
+	old, _ := store.GetMediaByPath(oldPath)
+	if old == nil {
+		t.Fatal("scanned file has no record")
+	}
+	if err := store.AddTagsToMedia(old.ID, []string{"sea"}); err != nil {
+		t.Fatal(err)
+	}
+	album := &storage.Album{ID: "album", Name: "Trip", MediaIDs: []string{old.ID}, CoverID: old.ID}
+	if err := store.SaveAlbum(album); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var movedFrom, movedTo string
+	ws := NewWatchSync(s, store)
+	ws.OnMove(func(oldID, newID string) { movedFrom, movedTo = oldID, newID })
+	ws.Handle(FileEvent{Path: oldPath, Operation: "rename"})
+	ws.Handle(FileEvent{Path: newPath, Operation: "create"})
+
+	moved, err := store.GetMediaByPath(newPath)
+	if err != nil || moved == nil {
+		t.Fatalf("no record at new path: %v, %v", moved, err)
+	}
+	if moved.DeletedAt != nil {
+		t.Error("moved record is still in trash")
+	}
+	if moved.RelPath != filepath.Join("trip", "new.jpg") {
+		t.Errorf("rel path = %q", moved.RelPath)
+	}
+	if len(moved.Tags) != 1 || moved.Tags[0] != "sea" {
+		t.Errorf("tags = %v, want [sea]", moved.Tags)
+	}
+	if m, _ := store.GetMedia(old.ID); m != nil {
+		t.Error("record under the old ID still exists")
+	}
+	if movedFrom != old.ID || movedTo != moved.ID {
+		t.Errorf("OnMove(%q, %q), want (%q, %q)", movedFrom, movedTo, old.ID, moved.ID)
+	}
+
+	a, _ := store.GetAlbum(album.ID)
+	if len(a.MediaIDs) != 1 || a.MediaIDs[0] != moved.ID || a.CoverID != moved.ID {
+		t.Errorf("album = %v cover %s, want the moved ID", a.MediaIDs, a.CoverID)
+	}
+	if stats, _ := store.GetStats(); stats.TotalMedia != 1 {
+		t.Errorf("total media = %d, want 1", stats.TotalMedia)
+	}
+}
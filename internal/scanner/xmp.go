@@ -0,0 +1,228 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+const (
+	xmpNamespaceDC  = "http://purl.org/dc/elements/1.1/"
+	xmpNamespaceRDF = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+	// xmpScanLimit сколько байт начала файла просматривать в поисках XMP пакета
+	// в не-JPEG форматах (TIFF/RAW, PNG, HEIC хранят его обычным текстом в заголовке)
+	xmpScanLimit = 4 << 20
+
+	iptcResourceID     = 0x0404 // Photoshop Image Resource с записями IPTC-NAA
+	iptcRecordKeywords = 25     // 2:25 Keywords
+	iptcRecordCaption  = 120    // 2:120 Caption/Abstract
+)
+
+var (
+	jpegXMPHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegIPTCHeader = []byte("Photoshop 3.0\x00")
+	xmpPacketStart = []byte("<x:xmpmeta")
+	xmpPacketEnd   = []byte("</x:xmpmeta>")
+)
+
+// ExtractXMP читает ключевые слова и описание из XMP (dc:subject, dc:description)
+// и IPTC (Keywords, Caption/Abstract). Описание сохраняется в media.Metadata.Caption,
+// ключевые слова возвращаются в нижнем регистре без повторов — импортировать
+// их как теги решает вызывающий (Scan.ImportKeywords).
+func ExtractXMP(path string, media *storage.Media) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, xmpScanLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	var keywords []string
+	var caption string
+	if len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8 {
+		xmpPacket, iptc := jpegMetadataSegments(data)
+		if xmpPacket != nil {
+			keywords, caption = parseXMP(xmpPacket)
+		}
+		if iptc != nil {
+			iptcKeywords, iptcCaption := parseIPTC(iptc)
+			keywords = append(keywords, iptcKeywords...)
+			if caption == "" {
+				caption = iptcCaption
+			}
+		}
+	} else if xmpPacket := findXMPPacket(data); xmpPacket != nil {
+		keywords, caption = parseXMP(xmpPacket)
+	}
+
+	if caption != "" {
+		media.Metadata.Caption = caption
+	}
+	return normalizeKeywords(keywords), nil
+}
+
+// jpegMetadataSegments находит XMP (APP1) и IPTC (APP13) в заголовке JPEG
+func jpegMetadataSegments(data []byte) (xmpPacket, iptc []byte) {
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			break
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0xDA { // SOS: дальше сжатые данные
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		next := pos + 2 + length
+		if length < 2 || next > len(data) {
+			break
+		}
+		payload := data[pos+4 : next]
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(payload, jpegXMPHeader):
+			xmpPacket = payload[len(jpegXMPHeader):]
+		case marker == 0xED && bytes.HasPrefix(payload, jpegIPTCHeader):
+			iptc = photoshopIPTC(payload[len(jpegIPTCHeader):])
+		}
+		pos = next
+	}
+	return xmpPacket, iptc
+}
+
+// findXMPPacket ищет XMP пакет как текст в начале файла
+func findXMPPacket(data []byte) []byte {
+	start := bytes.Index(data, xmpPacketStart)
+	if start < 0 {
+		return nil
+	}
+	end := bytes.Index(data[start:], xmpPacketEnd)
+	if end < 0 {
+		return nil
+	}
+	return data[start : start+end+len(xmpPacketEnd)]
+}
+
+// parseXMP собирает rdf:li из dc:subject (ключевые слова) и первый из dc:description
+func parseXMP(packet []byte) (keywords []string, caption string) {
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	decoder.Strict = false
+
+	var field string // dc:subject или dc:description, внутри которого находимся
+	var inItem bool
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return keywords, caption
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == xmpNamespaceDC && (t.Name.Local == "subject" || t.Name.Local == "description"):
+				field = t.Name.Local
+			case field != "" && t.Name.Space == xmpNamespaceRDF && t.Name.Local == "li":
+				inItem = true
+				text.Reset()
+			}
+		case xml.CharData:
+			if inItem {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch {
+			case inItem && t.Name.Space == xmpNamespaceRDF && t.Name.Local == "li":
+				inItem = false
+				value := strings.TrimSpace(text.String())
+				if field == "subject" {
+					keywords = append(keywords, value)
+				} else if caption == "" {
+					caption = value
+				}
+			case t.Name.Space == xmpNamespaceDC && t.Name.Local == field:
+				field = ""
+			}
+		}
+	}
+}
+
+// photoshopIPTC достает блок IPTC-NAA из Photoshop Image Resources ("8BIM" блоки)
+func photoshopIPTC(data []byte) []byte {
+	for pos := 0; pos+12 <= len(data); {
+		if !bytes.Equal(data[pos:pos+4], []byte("8BIM")) {
+			return nil
+		}
+		id := binary.BigEndian.Uint16(data[pos+4:])
+		// Имя ресурса — Pascal-строка, выровненная до четной длины
+		nameLen := int(data[pos+6])
+		pos += 6 + (nameLen+2)&^1
+		if pos+4 > len(data) {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		pos += 4
+		if size < 0 || pos+size > len(data) {
+			return nil
+		}
+		if id == iptcResourceID {
+			return data[pos : pos+size]
+		}
+		pos += (size + 1) &^ 1
+	}
+	return nil
+}
+
+// parseIPTC читает записи 2:25 (ключевые слова) и 2:120 (описание)
+func parseIPTC(data []byte) (keywords []string, caption string) {
+	for pos := 0; pos+5 <= len(data); {
+		if data[pos] != 0x1C {
+			break
+		}
+		record, dataset := data[pos+1], data[pos+2]
+		size := int(binary.BigEndian.Uint16(data[pos+3:]))
+		pos += 5
+		if size&0x8000 != 0 || pos+size > len(data) {
+			break // Расширенные записи в ключевых словах не встречаются
+		}
+		value := strings.TrimSpace(string(data[pos : pos+size]))
+		pos += size
+
+		if record != 2 {
+			continue
+		}
+		switch dataset {
+		case iptcRecordKeywords:
+			keywords = append(keywords, value)
+		case iptcRecordCaption:
+			caption = value
+		}
+	}
+	return keywords, caption
+}
+
+// normalizeKeywords приводит ключевые слова к виду тегов: нижний регистр, без пустых и повторов
+func normalizeKeywords(keywords []string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, keyword := range keywords {
+		tag := strings.ToLower(strings.TrimSpace(keyword))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
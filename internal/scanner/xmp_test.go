@@ -0,0 +1,159 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+const testXMPPacket = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <dc:subject><rdf:Bag>
+    <rdf:li>Beach</rdf:li>
+    <rdf:li>Summer &amp; Sun</rdf:li>
+    <rdf:li>beach</rdf:li>
+   </rdf:Bag></dc:subject>
+   <dc:description><rdf:Alt>
+    <rdf:li xml:lang="x-default">Sunset at the pier</rdf:li>
+   </rdf:Alt></dc:description>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+// jpegSegment собирает APP-сегмент JPEG с маркером marker
+func jpegSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// iptcSegment собирает APP13 с Photoshop-ресурсом IPTC из записей 2:dataset
+func iptcSegment(records map[byte][]string) []byte {
+	var iptc bytes.Buffer
+	datasets := make([]int, 0, len(records))
+	for ds := range records {
+		datasets = append(datasets, int(ds))
+	}
+	sort.Ints(datasets)
+	for _, ds := range datasets {
+		for _, value := range records[byte(ds)] {
+			iptc.Write([]byte{0x1C, 2, byte(ds), 0, 0})
+			binary.BigEndian.PutUint16(iptc.Bytes()[iptc.Len()-2:], uint16(len(value)))
+			iptc.WriteString(value)
+		}
+	}
+
+	var res bytes.Buffer
+	res.Write(jpegIPTCHeader)
+	res.WriteString("8BIM")
+	res.Write([]byte{0x04, 0x04, 0, 0}) // ID 0x0404, пустое имя с выравниванием
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(iptc.Len()))
+	res.Write(size)
+	res.Write(iptc.Bytes())
+	return jpegSegment(0xED, res.Bytes())
+}
+
+// writeJPEGWithSegments пишет JPEG и вставляет сегменты сразу после SOI
+func writeJPEGWithSegments(tb testing.TB, path string, shade int, segments ...[]byte) {
+	tb.Helper()
+	writeJPEG(tb, path, shade)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	out := append([]byte{}, data[:2]...)
+	for _, seg := range segments {
+		out = append(out, seg...)
+	}
+	out = append(out, data[2:]...)
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestExtractXMPKeywordsAndCaption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tagged.jpg")
+	xmp := jpegSegment(0xE1, append(append([]byte{}, jpegXMPHeader...), testXMPPacket...))
+	iptc := iptcSegment(map[byte][]string{
+		iptcRecordKeywords: {"Pier", "SUMMER & SUN"},
+		iptcRecordCaption:  {"IPTC caption"},
+	})
+	writeJPEGWithSegments(t, path, 1, xmp, iptc)
+
+	m := &storage.Media{Path: path}
+	keywords, err := ExtractXMP(path, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"beach", "summer & sun", "pier"}
+	if len(keywords) != len(want) {
+		t.Fatalf("keywords = %q, want %q", keywords, want)
+	}
+	for i := range want {
+		if keywords[i] != want[i] {
+			t.Errorf("keywords[%d] = %q, want %q", i, keywords[i], want[i])
+		}
+	}
+	// XMP описание приоритетнее IPTC
+	if m.Metadata.Caption != "Sunset at the pier" {
+		t.Errorf("caption = %q, want the XMP description", m.Metadata.Caption)
+	}
+}
+
+func TestScanImportsKeywordsAsTags(t *testing.T) {
+	s, store, root := newTestScanner(t, "  import_keywords: true\n")
+	xmp := jpegSegment(0xE1, append(append([]byte{}, jpegXMPHeader...), testXMPPacket...))
+	writeJPEGWithSegments(t, filepath.Join(root, "a.jpg"), 1, xmp)
+	writeJPEGWithSegments(t, filepath.Join(root, "b.jpg"), 2, iptcSegment(map[byte][]string{
+		iptcRecordKeywords: {"Beach"},
+	}))
+	writeJPEG(t, filepath.Join(root, "plain.jpg"), 3)
+
+	if p := runScan(t, s); p.NewFiles != 3 {
+		t.Fatalf("new files = %d, want 3", p.NewFiles)
+	}
+
+	a, _ := store.GetMediaByPath(filepath.Join(root, "a.jpg"))
+	if a == nil || len(a.Tags) != 2 {
+		t.Fatalf("a.jpg tags = %v, want beach and summer & sun", a)
+	}
+	if a.Metadata.Caption != "Sunset at the pier" {
+		t.Errorf("a.jpg caption = %q", a.Metadata.Caption)
+	}
+
+	tags, err := store.ListAllTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, tag := range tags {
+		counts[tag.Name] = tag.MediaCount
+	}
+	if counts["beach"] != 2 || counts["summer & sun"] != 1 || len(counts) != 2 {
+		t.Errorf("tag counts = %v, want beach:2 summer & sun:1", counts)
+	}
+}
+
+func TestScanIgnoresKeywordsWhenDisabled(t *testing.T) {
+	s, store, root := newTestScanner(t, "")
+	xmp := jpegSegment(0xE1, append(append([]byte{}, jpegXMPHeader...), testXMPPacket...))
+	path := filepath.Join(root, "a.jpg")
+	writeJPEGWithSegments(t, path, 1, xmp)
+	runScan(t, s)
+
+	m, _ := store.GetMediaByPath(path)
+	if m == nil || len(m.Tags) != 0 {
+		t.Fatalf("tags = %v, want none with import_keywords off", m)
+	}
+	// Описание сохраняется независимо от import_keywords
+	if m.Metadata.Caption != "Sunset at the pier" {
+		t.Errorf("caption = %q", m.Metadata.Caption)
+	}
+}
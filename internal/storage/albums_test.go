@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSmartAlbumFollowsTagsAndFavorites(t *testing.T) {
+	s := newTestStore(t)
+	a := addMedia(t, s, "a.jpg", day(2023, time.May, 1), nil)
+	b := addMedia(t, s, "b.jpg", day(2023, time.May, 2), nil)
+	addMedia(t, s, "c.jpg", day(2023, time.May, 3), nil)
+
+	yes := true
+	album := &Album{ID: "smart", Name: "Best trips", Smart: true, Query: &SearchQuery{Tags: []string{"trip"}, IsFavorite: &yes}}
+	if err := s.SaveAlbum(album); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.AddTagsToMedia(a.ID, []string{"trip"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetFavorite(a.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddTagsToMedia(b.ID, []string{"trip"}); err != nil { // Не избранное
+		t.Fatal(err)
+	}
+
+	media, err := s.GetAlbumMedia(album.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(media) != 1 || media[0].ID != a.ID {
+		t.Fatalf("smart album media = %v, want only a.jpg", media)
+	}
+
+	// Новое медиа с тегом и в избранном попадает в альбом без правки альбома
+	if err := s.SetFavorite(b.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if in, err := s.AlbumHasMedia(album, b.ID); err != nil || !in {
+		t.Errorf("AlbumHasMedia(b) = %v, %v; want true", in, err)
+	}
+
+	albums := []*Album{album, {ID: "regular", Name: "Regular", MediaIDs: []string{a.ID}, MediaCount: 1}}
+	if err := s.FillSmartAlbumCounts(albums); err != nil {
+		t.Fatal(err)
+	}
+	if albums[0].MediaCount != 2 {
+		t.Errorf("smart album count = %d, want 2", albums[0].MediaCount)
+	}
+	if albums[1].MediaCount != 1 {
+		t.Errorf("regular album count changed to %d", albums[1].MediaCount)
+	}
+}
+
+func TestAlbumHasMediaSmartSkipsTrash(t *testing.T) {
+	s := newTestStore(t)
+	m := addMedia(t, s, "a.jpg", day(2023, time.May, 1), func(m *Media) { m.Tags = []string{"sea"} })
+	album := &Album{ID: "smart", Smart: true, Query: &SearchQuery{Tags: []string{"sea"}}}
+
+	if in, _ := s.AlbumHasMedia(album, m.ID); !in {
+		t.Fatal("tagged media should be in smart album")
+	}
+	if err := s.SoftDeleteMedia(m.ID); err != nil {
+		t.Fatal(err)
+	}
+	if in, _ := s.AlbumHasMedia(album, m.ID); in {
+		t.Error("trashed media is still in smart album")
+	}
+}
+
+func TestResolveAlbumCoversFallback(t *testing.T) {
+	s := newTestStore(t)
+	early := addMedia(t, s, "early.jpg", day(2021, time.March, 1), func(m *Media) { m.Tags = []string{"sea"} })
+	late := addMedia(t, s, "late.jpg", day(2022, time.March, 1), func(m *Media) { m.Tags = []string{"sea"} })
+	other := addMedia(t, s, "other.jpg", day(2020, time.March, 1), nil)
+
+	albums := []*Album{
+		{ID: "auto", Name: "Auto", MediaIDs: []string{late.ID, early.ID}},
+		{ID: "custom", Name: "Custom", MediaIDs: []string{late.ID, early.ID}, CoverID: late.ID},
+		{ID: "trashed-cover", Name: "Trashed", MediaIDs: []string{late.ID, early.ID}, CoverID: early.ID},
+		{ID: "smart", Name: "Sea", Smart: true, Query: &SearchQuery{Tags: []string{"sea"}}},
+		{ID: "empty", Name: "Empty", CoverID: other.ID + "-gone"},
+	}
+	for _, a := range albums {
+		if err := s.SaveAlbum(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SoftDeleteMedia(early.ID); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := s.ListAlbums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ResolveAlbumCovers(loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for _, a := range loaded {
+		got[a.ID] = a.CoverID
+	}
+	want := map[string]string{
+		"auto":          late.ID, // early в корзине — берется следующее по дате
+		"custom":        late.ID, // Своя обложка сохраняется
+		"trashed-cover": late.ID, // Обложка в корзине заменяется
+		"smart":         late.ID,
+		"empty":         "",
+	}
+	for id, cover := range want {
+		if got[id] != cover {
+			t.Errorf("album %s cover = %q, want %q", id, got[id], cover)
+		}
+	}
+
+	// Обложка по умолчанию не сохраняется в базе
+	if stored, _ := s.GetAlbum("auto"); stored.CoverID != "" {
+		t.Errorf("default cover was persisted: %q", stored.CoverID)
+	}
+
+	if err := s.RestoreMedia(early.ID); err != nil {
+		t.Fatal(err)
+	}
+	auto, _ := s.GetAlbum("auto")
+	if err := s.ResolveAlbumCovers([]*Album{auto}); err != nil {
+		t.Fatal(err)
+	}
+	if auto.CoverID != early.ID {
+		t.Errorf("cover after restore = %q, want the earliest media", auto.CoverID)
+	}
+}
+
+func TestSetAlbumOrderValidation(t *testing.T) {
+	s := newTestStore(t)
+	a := addMedia(t, s, "a.jpg", day(2023, time.May, 1), nil)
+	b := addMedia(t, s, "b.jpg", day(2023, time.May, 2), nil)
+	c := addMedia(t, s, "c.jpg", day(2023, time.May, 3), nil)
+	stranger := addMedia(t, s, "stranger.jpg", day(2023, time.May, 4), nil)
+	if err := s.SaveAlbum(&Album{ID: "trip", Name: "Trip", MediaIDs: []string{a.ID, b.ID, c.ID}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveAlbum(&Album{ID: "smart", Name: "Smart", Smart: true, Query: &SearchQuery{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SoftDeleteMedia(c.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		album string
+		ids   []string
+		want  error
+	}{
+		{"missing member", "trip", []string{b.ID}, ErrAlbumOrder},
+		{"trashed member listed", "trip", []string{b.ID, a.ID, c.ID}, ErrAlbumOrder},
+		{"duplicate", "trip", []string{b.ID, b.ID}, ErrAlbumOrder},
+		{"foreign media", "trip", []string{b.ID, stranger.ID}, ErrAlbumOrder},
+		{"unknown album", "nope", []string{a.ID}, ErrAlbumNotFound},
+		{"smart album", "smart", []string{a.ID}, ErrSmartAlbum},
+	} {
+		if err := s.SetAlbumOrder(tc.album, tc.ids); err != tc.want {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if album, _ := s.GetAlbum("trip"); album.CustomOrder {
+		t.Fatal("rejected order was saved")
+	}
+
+	if err := s.SetAlbumOrder("trip", []string{b.ID, a.ID}); err != nil {
+		t.Fatal(err)
+	}
+	album, _ := s.GetAlbum("trip")
+	if !album.CustomOrder || len(album.MediaIDs) != 3 || album.MediaIDs[0] != b.ID || album.MediaIDs[2] != c.ID {
+		t.Errorf("saved order = %v (custom %v), want b, a, then trashed c", album.MediaIDs, album.CustomOrder)
+	}
+	media, _ := s.GetAlbumMedia("trip")
+	if len(media) != 2 || media[0].ID != b.ID {
+		t.Errorf("album media order = %v, want b first", media)
+	}
+
+	// nil возвращает сортировку по дате
+	if err := s.SetAlbumOrder("trip", nil); err != nil {
+		t.Fatal(err)
+	}
+	if media, _ := s.GetAlbumMedia("trip"); media[0].ID != a.ID {
+		t.Errorf("date order first = %s, want a.jpg", media[0].Filename)
+	}
+}
+
+func TestBulkOperationsReportEachItem(t *testing.T) {
+	s := newTestStore(t)
+	a := addMedia(t, s, "a.jpg", day(2023, time.May, 1), nil)
+	trashed := addMedia(t, s, "trashed.jpg", day(2023, time.May, 2), nil)
+	if err := s.SoftDeleteMedia(trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveAlbum(&Album{ID: "trip", Name: "Trip"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ошибка одного ID не прерывает остальные, порядок результатов — порядок запроса
+	check := func(op string, results []BulkItemResult, wantOK ...bool) {
+		t.Helper()
+		if len(results) != len(wantOK) {
+			t.Fatalf("%s: %d results, want %d", op, len(results), len(wantOK))
+		}
+		for i, r := range results {
+			if r.OK != wantOK[i] || r.OK != (r.Error == "") { // Ошибка есть только у неудачных
+				t.Errorf("%s: result %d = %+v, want ok %v", op, i, r, wantOK[i])
+			}
+		}
+	}
+
+	check("favorite", s.BulkSetFavorite([]string{"missing", a.ID}, true), false, true)
+	check("tags", s.BulkAddTags([]string{a.ID, "missing"}, []string{"sea"}), true, false)
+	if m := mustGetMedia(t, s, a.ID); !m.IsFavorite || len(m.Tags) != 1 {
+		t.Errorf("a.jpg = favorite %v, tags %v; want favorite with tag sea", m.IsFavorite, m.Tags)
+	}
+
+	results, err := s.BulkAddToAlbum("trip", []string{a.ID, "missing", trashed.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("album", results, true, false, false)
+	album, err := s.GetAlbum("trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(album.MediaIDs) != 1 || album.MediaIDs[0] != a.ID {
+		t.Errorf("album media = %v, want only a.jpg", album.MediaIDs)
+	}
+
+	if _, err := s.BulkAddToAlbum("nope", []string{a.ID}); err != ErrAlbumNotFound {
+		t.Errorf("unknown album error = %v, want ErrAlbumNotFound", err)
+	}
+}
+
+func TestNestedAlbumsParentChecksAndDelete(t *testing.T) {
+	s := newTestStore(t)
+	// root > trip > day1, day2 > evening
+	for _, a := range []*Album{
+		{ID: "root", Name: "Root"},
+		{ID: "trip", Name: "Trip", ParentID: "root"},
+		{ID: "day1", Name: "Day 1", ParentID: "trip"},
+		{ID: "day2", Name: "Day 2", ParentID: "trip"},
+		{ID: "evening", Name: "Evening", ParentID: "day2"},
+	} {
+		if err := s.SaveAlbum(a); err != nil {
+			t.Fatalf("save %s: %v", a.ID, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name, id, parent string
+		want             error
+	}{
+		{"self", "trip", "trip", ErrAlbumCycle},
+		{"descendant", "trip", "evening", ErrAlbumCycle},
+		{"missing parent", "trip", "nope", ErrParentAlbum},
+	} {
+		if err := s.SaveAlbum(&Album{ID: tc.id, Name: tc.id, ParentID: tc.parent}); err != tc.want {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if album, _ := s.GetAlbum("trip"); album.ParentID != "root" {
+		t.Errorf("rejected parent was saved: trip parent = %q", album.ParentID)
+	}
+
+	childIDs := func(parent string) []string {
+		t.Helper()
+		children, err := s.GetChildAlbums(parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, a := range children {
+			ids = append(ids, a.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	if got := childIDs("trip"); !slices.Equal(got, []string{"day1", "day2"}) {
+		t.Errorf("children of trip = %v, want day1, day2", got)
+	}
+
+	// Без cascade прямые потомки переходят к родителю удаленного альбома
+	if err := s.DeleteAlbum("trip", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := childIDs("root"); !slices.Equal(got, []string{"day1", "day2"}) {
+		t.Errorf("children of root after reparent = %v, want day1, day2", got)
+	}
+	if got := childIDs("day2"); !slices.Equal(got, []string{"evening"}) {
+		t.Errorf("grandchild moved to %v, want to stay under day2", got)
+	}
+
+	// cascade удаляет все поддерево
+	if err := s.DeleteAlbum("day2", true); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"day2", "evening"} {
+		if album, _ := s.GetAlbum(id); album != nil {
+			t.Errorf("%s survived cascade delete", id)
+		}
+	}
+	if got := childIDs("root"); !slices.Equal(got, []string{"day1"}) {
+		t.Errorf("children of root after cascade = %v, want day1", got)
+	}
+}
@@ -1,12 +1,20 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/bits"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/photocore/photocore/internal/logger"
@@ -21,13 +29,39 @@ var (
 	bucketAlbums    = []byte("albums")
 	bucketTags      = []byte("tags")
 	bucketIdxDir    = []byte("idx_dir")
-	bucketIdxDate   = []byte("idx_date")
+	bucketIdxDate   = []byte("idx_date") // YYYY-MM (дата съёмки или модификации) -> ID медиа
 	bucketIdxTag    = []byte("idx_tag")
+	bucketIdxType   = []byte("idx_type")
+	bucketIdxCamera = []byte("idx_camera") // Камера -> ID медиа
 	bucketFavorites = []byte("favorites")
 	bucketUserFav   = []byte("userfav")
 	bucketAPITokens = []byte("api_tokens")
+	bucketShares    = []byte("share_links")
+	bucketIdxSlug   = []byte("idx_slug")   // slug -> ID медиа
+	bucketTaskQueue = []byte("task_queue") // Персистентная очередь задач воркеров
+	bucketStats     = []byte("stats")      // Счётчики для GetStats
 )
 
+// dateIndexVersionKey метка в bucketIdxDate: индекс включает медиа без даты съёмки (по ModifiedAt).
+// Ключ не похож на месяц, поэтому при обходе периодов пропускается.
+var dateIndexVersionKey = []byte("_v2")
+
+// Длина короткого ID медиа: начинаем с minSlugLength и удлиняем при коллизии
+const minSlugLength = 8
+
+// Ошибки операций с альбомами
+var (
+	ErrAlbumNotFound = errors.New("album not found")
+	ErrNotInAlbum    = errors.New("media is not in album")
+	ErrParentAlbum   = errors.New("parent album not found")
+	ErrAlbumCycle    = errors.New("album cannot be nested inside itself or its sub-album")
+	ErrSmartAlbum    = errors.New("smart album content is defined by its query and cannot be edited manually")
+	ErrAlbumOrder    = errors.New("order must list each current album media exactly once")
+)
+
+// ErrReassignTarget некому передать загрузки и альбомы удаляемого пользователя
+var ErrReassignTarget = errors.New("reassign target user not found")
+
 // LogShutdownSignal логирует получение сигнала завершения
 func LogShutdownSignal(sig string) {
 	logger.InfoLog.Printf("[DB] === SHUTDOWN SIGNAL RECEIVED: %s ===", sig)
@@ -35,8 +69,12 @@ func LogShutdownSignal(sig string) {
 
 // Store обертка над bbolt
 type Store struct {
-	db     *bolt.DB
-	dbPath string
+	db       *bolt.DB
+	dbPath   string
+	trashDir string     // Директория корзины относительно медиа-корня ("" = файлы не перемещаются)
+	hashes   *hashIndex // BK-дерево pHash для поиска похожих
+
+	navVersion atomic.Uint64 // Версия данных навигационного индекса, см. NavVersion
 }
 
 // NewStore создает новое хранилище
@@ -80,7 +118,9 @@ func NewStore(dbPath string) (*Store, error) {
 		buckets := [][]byte{
 			bucketMedia, bucketUsers, bucketSessions, bucketAlbums,
 			bucketTags, bucketIdxDir, bucketIdxDate, bucketIdxTag,
-			bucketFavorites, bucketUserFav, bucketAPITokens,
+			bucketFavorites, bucketUserFav, bucketAPITokens, bucketIdxType,
+			bucketShares, bucketIdxSlug, bucketTaskQueue, bucketStats,
+			bucketIdxCamera,
 		}
 		for _, name := range buckets {
 			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
@@ -89,6 +129,18 @@ func NewStore(dbPath string) (*Store, error) {
 		}
 		return nil
 	})
+	if err == nil {
+		err = db.Update(buildTypeIndexIfEmpty)
+	}
+	if err == nil {
+		err = db.Update(buildStatsIfEmpty)
+	}
+	if err == nil {
+		err = db.Update(buildCameraIndexIfEmpty)
+	}
+	if err == nil {
+		err = db.Update(rebuildDateIndexIfStale)
+	}
 	if err != nil {
 		db.Close()
 		logger.InfoLog.Printf("[DB] ERROR: Failed to create buckets: %v", err)
@@ -100,6 +152,11 @@ func NewStore(dbPath string) (*Store, error) {
 	store := &Store{
 		db:     db,
 		dbPath: dbPath,
+		hashes: newHashIndex(),
+	}
+	if err := db.View(store.hashes.load); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load image hashes: %w", err)
 	}
 
 	return store, nil
@@ -133,35 +190,179 @@ func (s *Store) Close() error {
 
 // === Media операции ===
 
+// buildTypeIndexIfEmpty заполняет индекс по типу для баз, созданных до его появления
+func buildTypeIndexIfEmpty(tx *bolt.Tx) error {
+	idx := tx.Bucket(bucketIdxType)
+	if k, _ := idx.Cursor().First(); k != nil {
+		return nil
+	}
+
+	count := 0
+	err := tx.Bucket(bucketMedia).ForEach(func(k, v []byte) error {
+		var media Media
+		if err := json.Unmarshal(v, &media); err != nil {
+			return nil
+		}
+		if media.Type == "" {
+			return nil
+		}
+		count++
+		return addToIndex(tx, bucketIdxType, string(media.Type), media.ID)
+	})
+	if err == nil && count > 0 {
+		logger.InfoLog.Printf("[DB] Built type index for %d media", count)
+	}
+	return err
+}
+
 // SaveMedia сохраняет медиа-файл
 func (s *Store) SaveMedia(m *Media) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
-		data, err := json.Marshal(m)
-		if err != nil {
+		return s.saveMediaTx(tx, m)
+	})
+}
+
+// saveMediaTx сохраняет запись медиа и обновляет индексы и счётчики (кроме тегов и избранного)
+func (s *Store) saveMediaTx(tx *bolt.Tx, m *Media) error {
+	s.touchNav(tx)
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	b := tx.Bucket(bucketMedia)
+
+	// Предыдущая версия записи нужна для удаления устаревших записей индексов
+	var prev *Media
+	if prevData := b.Get([]byte(m.ID)); prevData != nil {
+		var p Media
+		if json.Unmarshal(prevData, &p) == nil {
+			prev = &p
+		}
+	}
+
+	// Сохраняем основную запись
+	if err := b.Put([]byte(m.ID), data); err != nil {
+		return err
+	}
+
+	if err := updateStats(tx, prev, m); err != nil {
+		return err
+	}
+	s.trackImageHash(tx, prev, m)
+
+	// Обновляем индекс по типу
+	if prev != nil && prev.Type != m.Type && prev.Type != "" {
+		if err := removeFromIndex(tx, bucketIdxType, string(prev.Type), m.ID); err != nil {
 			return err
 		}
+	}
+	if m.Type != "" {
+		if err := addToIndex(tx, bucketIdxType, string(m.Type), m.ID); err != nil {
+			return err
+		}
+	}
 
-		// Сохраняем основную запись
-		b := tx.Bucket(bucketMedia)
-		if err := b.Put([]byte(m.ID), data); err != nil {
+	// Обновляем индекс по директории
+	if err := addToIndex(tx, bucketIdxDir, m.Dir, m.ID); err != nil {
+		return err
+	}
+
+	// Обновляем индекс по камере
+	if prev != nil && prev.Metadata.Camera != m.Metadata.Camera && prev.Metadata.Camera != "" {
+		if err := removeFromIndex(tx, bucketIdxCamera, prev.Metadata.Camera, m.ID); err != nil {
 			return err
 		}
+	}
+	if m.Metadata.Camera != "" {
+		if err := addToIndex(tx, bucketIdxCamera, m.Metadata.Camera, m.ID); err != nil {
+			return err
+		}
+	}
 
-		// Обновляем индекс по директории
-		if err := addToIndex(tx, bucketIdxDir, m.Dir, m.ID); err != nil {
+	// Обновляем индекс коротких ID
+	if prev != nil && prev.Slug != "" && prev.Slug != m.Slug {
+		if err := tx.Bucket(bucketIdxSlug).Delete([]byte(prev.Slug)); err != nil {
 			return err
 		}
+	}
+	if m.Slug != "" {
+		if err := tx.Bucket(bucketIdxSlug).Put([]byte(m.Slug), []byte(m.ID)); err != nil {
+			return err
+		}
+	}
 
-		// Обновляем индекс по дате (YYYY-MM)
-		if !m.TakenAt.IsZero() && m.TakenAt.Year() > 1900 {
-			dateKey := m.TakenAt.Format("2006-01")
-			if err := addToIndex(tx, bucketIdxDate, dateKey, m.ID); err != nil {
-				return err
+	// Обновляем индекс по дате (YYYY-MM)
+	if prev != nil && mediaDateKey(prev) != mediaDateKey(m) {
+		if err := removeFromIndex(tx, bucketIdxDate, mediaDateKey(prev), m.ID); err != nil {
+			return err
+		}
+	}
+	if err := addToIndex(tx, bucketIdxDate, mediaDateKey(m), m.ID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// EnsureSlug возвращает короткий ID медиа, создавая его при первом обращении.
+// Slug — самый короткий префикс ID (от minSlugLength символов), не занятый другим медиа.
+func (s *Store) EnsureSlug(mediaID string) (string, error) {
+	var slug string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMedia)
+		data := b.Get([]byte(mediaID))
+		if data == nil {
+			return fmt.Errorf("media not found")
+		}
+		var m Media
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		if m.Slug != "" {
+			slug = m.Slug
+			return nil
+		}
+
+		idx := tx.Bucket(bucketIdxSlug)
+		for n := minSlugLength; n < len(m.ID); n++ {
+			candidate := m.ID[:n]
+			if owner := idx.Get([]byte(candidate)); owner == nil || string(owner) == m.ID {
+				slug = candidate
+				break
 			}
 		}
+		if slug == "" {
+			return fmt.Errorf("no free slug for media %s", m.ID)
+		}
 
+		m.Slug = slug
+		updated, err := json.Marshal(&m)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(m.ID), updated); err != nil {
+			return err
+		}
+		return idx.Put([]byte(slug), []byte(m.ID))
+	})
+	return slug, err
+}
+
+// ResolveMediaID возвращает полный ID медиа по ID или короткому slug ("" если не найден)
+func (s *Store) ResolveMediaID(idOrSlug string) (string, error) {
+	var id string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketMedia).Get([]byte(idOrSlug)) != nil {
+			id = idOrSlug
+			return nil
+		}
+		if owner := tx.Bucket(bucketIdxSlug).Get([]byte(idOrSlug)); owner != nil {
+			id = string(owner)
+		}
 		return nil
 	})
+	return id, err
 }
 
 // GetMedia получает медиа по ID
@@ -212,22 +413,45 @@ func (s *Store) DeleteMedia(id string) error {
 	s.removeMediaFromAllUserFavorites(id)
 
 	// Удаляем из тегов
-	s.removeMediaFromAllTags(media.Tags)
+	s.removeMediaFromAllTags(id, media.Tags)
 
 	return s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
+
 		// Удаляем из индекса директории
 		if err := removeFromIndex(tx, bucketIdxDir, media.Dir, id); err != nil {
 			return err
 		}
 
-		// Удаляем из индекса даты
-		if !media.TakenAt.IsZero() && media.TakenAt.Year() > 1900 {
-			dateKey := media.TakenAt.Format("2006-01")
-			if err := removeFromIndex(tx, bucketIdxDate, dateKey, id); err != nil {
+		// Удаляем из индекса типа
+		if err := removeFromIndex(tx, bucketIdxType, string(media.Type), id); err != nil {
+			return err
+		}
+
+		// Удаляем из индекса камеры
+		if media.Metadata.Camera != "" {
+			if err := removeFromIndex(tx, bucketIdxCamera, media.Metadata.Camera, id); err != nil {
+				return err
+			}
+		}
+
+		// Удаляем короткий ID
+		if media.Slug != "" {
+			if err := tx.Bucket(bucketIdxSlug).Delete([]byte(media.Slug)); err != nil {
 				return err
 			}
 		}
 
+		// Удаляем из индекса даты
+		if err := removeFromIndex(tx, bucketIdxDate, mediaDateKey(media), id); err != nil {
+			return err
+		}
+
+		if err := updateStats(tx, media, nil); err != nil {
+			return err
+		}
+		s.trackImageHash(tx, media, nil)
+
 		// Удаляем основную запись
 		return tx.Bucket(bucketMedia).Delete([]byte(id))
 	})
@@ -279,127 +503,717 @@ func (s *Store) removeMediaFromAllUserFavorites(mediaID string) error {
 	})
 }
 
-// removeMediaFromAllTags уменьшает счётчики тегов
-func (s *Store) removeMediaFromAllTags(tags []string) error {
+// removeMediaFromAllTags убирает медиа из индекса тегов и уменьшает их счётчики
+func (s *Store) removeMediaFromAllTags(mediaID string, tags []string) error {
 	if len(tags) == 0 {
 		return nil
 	}
 	return s.db.Update(func(tx *bolt.Tx) error {
 		for _, tagName := range tags {
+			removeFromIndex(tx, bucketIdxTag, tagName, mediaID)
 			decrementTagCount(tx, tagName)
 		}
 		return nil
 	})
 }
 
-// ListMediaByDir получает список медиа в директории
-func (s *Store) ListMediaByDir(dir string) ([]*Media, error) {
-	ids, err := s.getIndex(bucketIdxDir, dir)
-	if err != nil {
-		return nil, err
-	}
-
-	var result []*Media
-	for _, id := range ids {
-		media, err := s.GetMedia(id)
+// MoveMedia переносит запись медиа на новый путь файла (файл переименован или перемещён).
+// ID зависит от пути, поэтому запись пересоздаётся под новым ID: альбомы, избранное,
+// теги и короткий ID переходят к ней. Запись из корзины восстанавливается.
+func (s *Store) MoveMedia(id, newPath, relPath string) (*Media, error) {
+	if GenerateID(newPath) == id {
+		old, err := s.GetMedia(id)
 		if err != nil {
-			continue
+			return nil, err
 		}
-		if media != nil && media.DeletedAt == nil {
-			result = append(result, media)
+		if old == nil {
+			return nil, fmt.Errorf("media not found")
 		}
+		moved := movedMedia(old, newPath, relPath)
+		return moved, s.SaveMedia(moved)
 	}
-	return result, nil
-}
 
-// ListAllMedia возвращает все медиа-файлы
-func (s *Store) ListAllMedia() ([]*Media, error) {
-	var result []*Media
-	err := s.db.View(func(tx *bolt.Tx) error {
+	var moved Media
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
 		b := tx.Bucket(bucketMedia)
-		return b.ForEach(func(k, v []byte) error {
-			var media Media
-			if err := json.Unmarshal(v, &media); err != nil {
-				return nil // skip invalid
+		// Запись читается в той же транзакции: счетчики и индексы правятся по актуальному состоянию
+		oldData := b.Get([]byte(id))
+		if oldData == nil {
+			return fmt.Errorf("media not found")
+		}
+		old := &Media{}
+		if err := json.Unmarshal(oldData, old); err != nil {
+			return err
+		}
+		moved = *movedMedia(old, newPath, relPath)
+		if b.Get([]byte(moved.ID)) != nil {
+			return fmt.Errorf("media already exists at %s", newPath)
+		}
+
+		data, err := json.Marshal(&moved)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(moved.ID), data); err != nil {
+			return err
+		}
+		if err := b.Delete([]byte(old.ID)); err != nil {
+			return err
+		}
+		if err := updateStats(tx, old, nil); err != nil {
+			return err
+		}
+		if err := updateStats(tx, nil, &moved); err != nil {
+			return err
+		}
+		s.trackImageHash(tx, old, &moved)
+
+		// Индексы по директории, типу, дате и тегам
+		if err := removeFromIndex(tx, bucketIdxDir, old.Dir, old.ID); err != nil {
+			return err
+		}
+		if err := addToIndex(tx, bucketIdxDir, moved.Dir, moved.ID); err != nil {
+			return err
+		}
+		if moved.Type != "" {
+			if err := removeFromIndex(tx, bucketIdxType, string(moved.Type), old.ID); err != nil {
+				return err
 			}
-			if media.DeletedAt == nil {
-				result = append(result, &media)
+			if err := addToIndex(tx, bucketIdxType, string(moved.Type), moved.ID); err != nil {
+				return err
 			}
-			return nil
-		})
-	})
-	return result, err
-}
+		}
+		if moved.Metadata.Camera != "" {
+			if err := removeFromIndex(tx, bucketIdxCamera, moved.Metadata.Camera, old.ID); err != nil {
+				return err
+			}
+			if err := addToIndex(tx, bucketIdxCamera, moved.Metadata.Camera, moved.ID); err != nil {
+				return err
+			}
+		}
+		if err := removeFromIndex(tx, bucketIdxDate, mediaDateKey(old), old.ID); err != nil {
+			return err
+		}
+		if err := addToIndex(tx, bucketIdxDate, mediaDateKey(&moved), moved.ID); err != nil {
+			return err
+		}
+		for _, tag := range moved.Tags {
+			if err := removeFromIndex(tx, bucketIdxTag, tag, old.ID); err != nil {
+				return err
+			}
+			if err := addToIndex(tx, bucketIdxTag, tag, moved.ID); err != nil {
+				return err
+			}
+		}
 
-// GetStats возвращает статистику
-func (s *Store) GetStats() (*Stats, error) {
-	stats := &Stats{}
-	dirs := make(map[string]bool)
+		// Старые ссылки по короткому ID продолжают работать
+		if moved.Slug != "" {
+			if err := tx.Bucket(bucketIdxSlug).Put([]byte(moved.Slug), []byte(moved.ID)); err != nil {
+				return err
+			}
+		}
 
-	err := s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketMedia)
-		return b.ForEach(func(k, v []byte) error {
-			var media Media
-			if err := json.Unmarshal(v, &media); err != nil {
-				return nil
+		// Избранное
+		if moved.IsFavorite {
+			if err := removeFromIndex(tx, bucketFavorites, "global", old.ID); err != nil {
+				return err
 			}
-			if media.DeletedAt != nil {
-				return nil
+			if err := addToIndex(tx, bucketFavorites, "global", moved.ID); err != nil {
+				return err
 			}
-			stats.TotalMedia++
-			stats.TotalSize += media.Size
-			dirs[media.Dir] = true
+		}
+		if err := replaceIDInBucket(tx.Bucket(bucketUserFav), old.ID, moved.ID); err != nil {
+			return err
+		}
 
-			switch media.Type {
-			case MediaTypeImage:
-				stats.TotalImages++
-			case MediaTypeVideo:
-				stats.TotalVideos++
-			case MediaTypeRaw:
-				stats.TotalRaw++
+		// Альбомы
+		albums := tx.Bucket(bucketAlbums)
+		var changedAlbums []*Album
+		err = albums.ForEach(func(k, v []byte) error {
+			var album Album
+			if err := json.Unmarshal(v, &album); err != nil {
+				return nil
+			}
+			ids, changed := replaceID(album.MediaIDs, old.ID, moved.ID)
+			if album.CoverID == old.ID {
+				album.CoverID = moved.ID
+				changed = true
+			}
+			if changed {
+				album.MediaIDs = ids
+				changedAlbums = append(changedAlbums, &album)
 			}
 			return nil
 		})
+		if err != nil {
+			return err
+		}
+		for _, album := range changedAlbums {
+			data, err := json.Marshal(album)
+			if err != nil {
+				return err
+			}
+			if err := albums.Put([]byte(album.ID), data); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return &moved, nil
+}
 
-	stats.TotalDirs = len(dirs)
-	return stats, err
+// movedMedia копия записи old для файла на новом пути
+func movedMedia(old *Media, newPath, relPath string) *Media {
+	moved := *old
+	moved.ID = GenerateID(newPath)
+	moved.Path = newPath
+	moved.RelPath = relPath
+	moved.Dir = filepath.Dir(relPath)
+	moved.Filename = filepath.Base(newPath)
+	moved.DeletedAt = nil
+	moved.TrashedFrom = ""
+	return &moved
 }
 
-// === User операции ===
+// replaceIDInBucket заменяет ID во всех списках ID (значениях) bucket
+func replaceIDInBucket(b *bolt.Bucket, oldID, newID string) error {
+	updates := make(map[string][]string)
+	err := b.ForEach(func(k, v []byte) error {
+		var ids []string
+		if err := json.Unmarshal(v, &ids); err != nil {
+			return nil
+		}
+		if ids, changed := replaceID(ids, oldID, newID); changed {
+			updates[string(k)] = ids
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-// SaveUser сохраняет пользователя
-func (s *Store) SaveUser(u *User) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		data, err := json.Marshal(u)
+	// Изменять bucket во время ForEach нельзя
+	for k, ids := range updates {
+		data, err := json.Marshal(ids)
 		if err != nil {
 			return err
 		}
-		return tx.Bucket(bucketUsers).Put([]byte(u.Username), data)
-	})
+		if err := b.Put([]byte(k), data); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// GetUser получает пользователя по username
-func (s *Store) GetUser(username string) (*User, error) {
-	var user User
-	err := s.db.View(func(tx *bolt.Tx) error {
-		data := tx.Bucket(bucketUsers).Get([]byte(username))
-		if data == nil {
-			return nil
+// replaceID заменяет oldID на newID в списке. Возвращает false, если oldID не найден.
+func replaceID(ids []string, oldID, newID string) ([]string, bool) {
+	changed := false
+	for i, id := range ids {
+		if id == oldID {
+			ids[i] = newID
+			changed = true
 		}
-		return json.Unmarshal(data, &user)
-	})
+	}
+	return ids, changed
+}
+
+// ListMediaByDir получает список медиа в директории
+func (s *Store) ListMediaByDir(dir string) ([]*Media, error) {
+	ids, err := s.getIndex(bucketIdxDir, dir)
 	if err != nil {
 		return nil, err
 	}
-	if user.ID == "" {
-		return nil, nil
-	}
-	return &user, nil
-}
 
-// GetUserByID получает пользователя по ID
-func (s *Store) GetUserByID(userID string) (*User, error) {
+	var result []*Media
+	for _, id := range ids {
+		media, err := s.GetMedia(id)
+		if err != nil {
+			continue
+		}
+		if media != nil && media.DeletedAt == nil {
+			result = append(result, media)
+		}
+	}
+	return result, nil
+}
+
+// ListMediaByType возвращает неудалённые медиа указанного типа через индекс
+func (s *Store) ListMediaByType(t MediaType) ([]*Media, error) {
+	var result []*Media
+	err := s.iterateIndexedMedia(bucketIdxType, string(t), func(m *Media) bool {
+		result = append(result, m)
+		return true
+	})
+	return result, err
+}
+
+// buildCameraIndexIfEmpty заполняет индекс по камере для баз, созданных до его появления
+func buildCameraIndexIfEmpty(tx *bolt.Tx) error {
+	idx := tx.Bucket(bucketIdxCamera)
+	if k, _ := idx.Cursor().First(); k != nil {
+		return nil
+	}
+
+	count := 0
+	err := tx.Bucket(bucketMedia).ForEach(func(k, v []byte) error {
+		var media Media
+		if err := json.Unmarshal(v, &media); err != nil {
+			return nil
+		}
+		if media.Metadata.Camera == "" {
+			return nil
+		}
+		count++
+		return addToIndex(tx, bucketIdxCamera, media.Metadata.Camera, media.ID)
+	})
+	if err == nil && count > 0 {
+		logger.InfoLog.Printf("[DB] Built camera index for %d media", count)
+	}
+	return err
+}
+
+// rebuildDateIndexIfStale перестраивает индекс по дате для баз, где в нём были
+// только медиа с датой съёмки (без метки dateIndexVersionKey)
+func rebuildDateIndexIfStale(tx *bolt.Tx) error {
+	if tx.Bucket(bucketIdxDate).Get(dateIndexVersionKey) != nil {
+		return nil
+	}
+
+	if err := tx.DeleteBucket(bucketIdxDate); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucket(bucketIdxDate); err != nil {
+		return err
+	}
+
+	count := 0
+	err := tx.Bucket(bucketMedia).ForEach(func(k, v []byte) error {
+		var media Media
+		if err := json.Unmarshal(v, &media); err != nil {
+			return nil
+		}
+		count++
+		return addToIndex(tx, bucketIdxDate, mediaDateKey(&media), media.ID)
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		logger.InfoLog.Printf("[DB] Built date index for %d media", count)
+	}
+	return tx.Bucket(bucketIdxDate).Put(dateIndexVersionKey, []byte("1"))
+}
+
+// iterateMediaByMonths передаёт в fn неудалённые медиа из периодов индекса по дате
+// между from и to включительно (nil — без границы) в рамках одной транзакции чтения.
+// Медиа на краях периода fn должна проверять сама: индекс хранит только месяц.
+func (s *Store) iterateMediaByMonths(from, to *time.Time, fn func(*Media) bool) error {
+	var first, last string
+	if from != nil {
+		first = from.Format("2006-01")
+	}
+	if to != nil {
+		last = to.Format("2006-01")
+	}
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMedia)
+		c := tx.Bucket(bucketIdxDate).Cursor()
+
+		k, v := c.First()
+		if first != "" {
+			k, v = c.Seek([]byte(first))
+		}
+		for ; k != nil; k, v = c.Next() {
+			if last != "" && string(k) > last {
+				break
+			}
+			if _, err := time.Parse("2006-01", string(k)); err != nil {
+				continue // dateIndexVersionKey
+			}
+
+			var ids []string
+			if err := json.Unmarshal(v, &ids); err != nil {
+				continue
+			}
+			for _, id := range ids {
+				data := b.Get([]byte(id))
+				if data == nil {
+					continue
+				}
+				var media Media
+				if err := json.Unmarshal(data, &media); err != nil {
+					continue
+				}
+				if media.DeletedAt != nil {
+					continue
+				}
+				if !fn(&media) {
+					return nil
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// iterateIndexedMedia передаёт в fn неудалённые медиа из записи индекса
+// в рамках одной транзакции чтения. Если fn возвращает false, обход прекращается.
+func (s *Store) iterateIndexedMedia(bucket []byte, key string, fn func(*Media) bool) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		var ids []string
+		if err := json.Unmarshal(data, &ids); err != nil {
+			return nil
+		}
+
+		b := tx.Bucket(bucketMedia)
+		for _, id := range ids {
+			v := b.Get([]byte(id))
+			if v == nil {
+				continue
+			}
+			var media Media
+			if err := json.Unmarshal(v, &media); err != nil {
+				continue
+			}
+			if media.DeletedAt != nil {
+				continue
+			}
+			if !fn(&media) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// ListAllMedia возвращает все медиа-файлы
+func (s *Store) ListAllMedia() ([]*Media, error) {
+	var result []*Media
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMedia)
+		return b.ForEach(func(k, v []byte) error {
+			var media Media
+			if err := json.Unmarshal(v, &media); err != nil {
+				return nil // skip invalid
+			}
+			if media.DeletedAt == nil {
+				result = append(result, &media)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// IterateMedia последовательно передаёт в fn все неудалённые медиа
+// в рамках одной транзакции чтения, не собирая их в слайс.
+// Если fn возвращает false, обход прекращается.
+// fn не должна вызывать методы Store, открывающие транзакции записи.
+func (s *Store) IterateMedia(fn func(*Media) bool) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketMedia).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var media Media
+			if err := json.Unmarshal(v, &media); err != nil {
+				continue // skip invalid
+			}
+			if media.DeletedAt != nil {
+				continue
+			}
+			if !fn(&media) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// === Статистика ===
+
+// Ключи bucket статистики: итоговые счётчики, число медиа в каждой директории и с каждой камеры
+var (
+	statsTotalsKey    = []byte("totals")
+	statsDirPrefix    = "dir:"
+	statsCameraPrefix = "camera:"
+	// statsVersionKey версия набора счётчиков: при её отсутствии они пересчитываются при запуске
+	statsVersionKey = []byte("version")
+)
+
+// statsVersion увеличивается при добавлении счётчиков (2 — счётчики камер)
+const statsVersion = "2"
+
+// countedInStats учитывается ли медиа в статистике (корзина не считается)
+func countedInStats(m *Media) bool {
+	return m != nil && m.DeletedAt == nil
+}
+
+// updateStats применяет к счётчикам изменение записи медиа prev -> next.
+// prev или next равны nil, если записи до/после изменения нет.
+func updateStats(tx *bolt.Tx, prev, next *Media) error {
+	wasCounted, isCounted := countedInStats(prev), countedInStats(next)
+	if !wasCounted && !isCounted {
+		return nil
+	}
+	if wasCounted && isCounted && prev.Type == next.Type && prev.Size == next.Size && prev.Dir == next.Dir &&
+		prev.Metadata.Camera == next.Metadata.Camera {
+		return nil
+	}
+
+	b := tx.Bucket(bucketStats)
+	var stats Stats
+	if data := b.Get(statsTotalsKey); data != nil {
+		if err := json.Unmarshal(data, &stats); err != nil {
+			return err
+		}
+	}
+
+	if wasCounted {
+		if err := applyStatsDelta(b, &stats, prev, -1); err != nil {
+			return err
+		}
+	}
+	if isCounted {
+		if err := applyStatsDelta(b, &stats, next, 1); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(&stats)
+	if err != nil {
+		return err
+	}
+	return b.Put(statsTotalsKey, data)
+}
+
+// applyStatsDelta добавляет (delta=1) или вычитает (delta=-1) медиа из счётчиков
+func applyStatsDelta(b *bolt.Bucket, stats *Stats, m *Media, delta int) error {
+	stats.TotalMedia += delta
+	stats.TotalSize += int64(delta) * m.Size
+	switch m.Type {
+	case MediaTypeImage:
+		stats.TotalImages += delta
+	case MediaTypeVideo:
+		stats.TotalVideos += delta
+	case MediaTypeRaw:
+		stats.TotalRaw += delta
+	}
+
+	if m.Metadata.Camera != "" {
+		if err := addCounter(b, []byte(statsCameraPrefix+m.Metadata.Camera), delta); err != nil {
+			return err
+		}
+	}
+
+	// Директория учитывается, пока в ней есть хотя бы одно медиа
+	key := []byte(statsDirPrefix + m.Dir)
+	count := 0
+	if data := b.Get(key); data != nil {
+		count, _ = strconv.Atoi(string(data))
+	}
+	if count == 0 && delta > 0 {
+		stats.TotalDirs++
+	}
+	count += delta
+	if count <= 0 {
+		if count == 0 {
+			stats.TotalDirs--
+		}
+		return b.Delete(key)
+	}
+	return b.Put(key, []byte(strconv.Itoa(count)))
+}
+
+// addCounter изменяет числовой счётчик на delta, удаляя его при нуле
+func addCounter(b *bolt.Bucket, key []byte, delta int) error {
+	count := 0
+	if data := b.Get(key); data != nil {
+		count, _ = strconv.Atoi(string(data))
+	}
+	count += delta
+	if count <= 0 {
+		return b.Delete(key)
+	}
+	return b.Put(key, []byte(strconv.Itoa(count)))
+}
+
+// rebuildStats пересчитывает счётчики статистики полным обходом медиа
+func rebuildStats(tx *bolt.Tx) error {
+	if err := tx.DeleteBucket(bucketStats); err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	if _, err := tx.CreateBucket(bucketStats); err != nil {
+		return err
+	}
+
+	// Пустая запись, чтобы база без медиа не пересчитывалась при каждом запуске
+	data, err := json.Marshal(&Stats{})
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketStats).Put(statsTotalsKey, data); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketStats).Put(statsVersionKey, []byte(statsVersion)); err != nil {
+		return err
+	}
+
+	return tx.Bucket(bucketMedia).ForEach(func(k, v []byte) error {
+		var media Media
+		if err := json.Unmarshal(v, &media); err != nil {
+			return nil // skip invalid
+		}
+		return updateStats(tx, nil, &media)
+	})
+}
+
+// buildStatsIfEmpty заполняет счётчики для баз, созданных до их появления или до текущей statsVersion
+func buildStatsIfEmpty(tx *bolt.Tx) error {
+	b := tx.Bucket(bucketStats)
+	if b.Get(statsTotalsKey) != nil && string(b.Get(statsVersionKey)) == statsVersion {
+		return nil
+	}
+	if err := rebuildStats(tx); err != nil {
+		return err
+	}
+	logger.InfoLog.Printf("[DB] Built media stats counters")
+	return nil
+}
+
+// NavVersion возвращает версию данных навигационного индекса: медиа, альбомов и тегов.
+// Растет после каждой фиксации транзакции, меняющей их (в том числе сканером);
+// сессии, токены, просмотры и прочие записи ее не меняют.
+func (s *Store) NavVersion() uint64 {
+	return s.navVersion.Load()
+}
+
+// touchNav отмечает, что tx меняет медиа, альбомы или теги: NavVersion вырастет после фиксации
+func (s *Store) touchNav(tx *bolt.Tx) {
+	tx.OnCommit(func() { s.navVersion.Add(1) })
+}
+
+// Ping проверяет, что база открыта и читается (пустая транзакция чтения)
+func (s *Store) Ping() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketMedia) == nil {
+			return errors.New("media bucket missing")
+		}
+		return nil
+	})
+}
+
+// GetStats возвращает статистику из счётчиков, поддерживаемых при записи медиа
+func (s *Store) GetStats() (*Stats, error) {
+	stats := &Stats{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketStats).Get(statsTotalsKey)
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, stats)
+	})
+	return stats, err
+}
+
+// RebuildStats пересчитывает счётчики статистики и тегов с нуля
+func (s *Store) RebuildStats() (*Stats, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
+		if err := rebuildStats(tx); err != nil {
+			return err
+		}
+		fixed, err := reconcileTags(tx)
+		if err != nil {
+			return err
+		}
+		if fixed > 0 {
+			logger.InfoLog.Printf("[DB] Reconciled %d tag counters", fixed)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStats()
+}
+
+// ListCameras возвращает камеры с числом медиа из счётчиков статистики (по убыванию числа)
+func (s *Store) ListCameras() ([]*CameraCount, error) {
+	var result []*CameraCount
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketStats).Cursor()
+		prefix := []byte(statsCameraPrefix)
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			count, _ := strconv.Atoi(string(v))
+			result = append(result, &CameraCount{
+				Camera:     string(k[len(prefix):]),
+				MediaCount: count,
+			})
+		}
+		return nil
+	})
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].MediaCount != result[j].MediaCount {
+			return result[i].MediaCount > result[j].MediaCount
+		}
+		return result[i].Camera < result[j].Camera
+	})
+	return result, err
+}
+
+// ListMediaByCamera возвращает неудалённые медиа, снятые камерой (точное совпадение названия)
+func (s *Store) ListMediaByCamera(camera string) ([]*Media, error) {
+	var result []*Media
+	err := s.iterateIndexedMedia(bucketIdxCamera, camera, func(m *Media) bool {
+		result = append(result, m)
+		return true
+	})
+	return result, err
+}
+
+// === User операции ===
+
+// SaveUser сохраняет пользователя
+func (s *Store) SaveUser(u *User) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketUsers).Put([]byte(u.Username), data)
+	})
+}
+
+// GetUser получает пользователя по username
+func (s *Store) GetUser(username string) (*User, error) {
+	var user User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketUsers).Get([]byte(username))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == "" {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// GetUserByID получает пользователя по ID
+func (s *Store) GetUserByID(userID string) (*User, error) {
 	var result *User
 	err := s.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucketUsers)
@@ -434,8 +1248,10 @@ func (s *Store) ListUsers() ([]*User, error) {
 	return result, err
 }
 
-// DeleteUser удаляет пользователя
-func (s *Store) DeleteUser(username string) error {
+// DeleteUser удаляет пользователя. policy (UserDelete*) определяет, что станет
+// с его загрузками (Media.UploadedBy) и альбомами (Album.OwnerID); при
+// UserDeleteReassign они передаются пользователю adminUsername.
+func (s *Store) DeleteUser(username, policy, adminUsername string) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucketUsers)
 		data := b.Get([]byte(username))
@@ -447,12 +1263,87 @@ func (s *Store) DeleteUser(username string) error {
 		if err := json.Unmarshal(data, &user); err == nil {
 			// Удаляем favorites пользователя
 			tx.Bucket(bucketUserFav).Delete([]byte(user.ID))
+
+			if err := transferUserContent(tx, user.ID, policy, adminUsername); err != nil {
+				return err
+			}
 		}
 
 		return b.Delete([]byte(username))
 	})
 }
 
+// transferUserContent меняет владельца загрузок и альбомов userID по политике удаления
+func transferUserContent(tx *bolt.Tx, userID, policy, adminUsername string) error {
+	var newOwner string
+	switch policy {
+	case UserDeleteOrphan:
+	case UserDeleteReassign:
+		var admin User
+		data := tx.Bucket(bucketUsers).Get([]byte(adminUsername))
+		if data == nil || json.Unmarshal(data, &admin) != nil {
+			return fmt.Errorf("%w: %s not found", ErrReassignTarget, adminUsername)
+		}
+		if admin.ID == userID {
+			return fmt.Errorf("%w: cannot reassign to the deleted user", ErrReassignTarget)
+		}
+		newOwner = admin.ID
+	default:
+		return nil // UserDeleteKeep
+	}
+
+	// Bucket нельзя менять внутри ForEach: сначала собираем, потом записываем
+	updates := make(map[string][]byte)
+	err := tx.Bucket(bucketMedia).ForEach(func(k, v []byte) error {
+		var m Media
+		if err := json.Unmarshal(v, &m); err != nil || m.UploadedBy != userID {
+			return nil
+		}
+		m.UploadedBy = newOwner
+		data, err := json.Marshal(&m)
+		if err != nil {
+			return err
+		}
+		updates[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := putAll(tx.Bucket(bucketMedia), updates); err != nil {
+		return err
+	}
+
+	updates = make(map[string][]byte)
+	err = tx.Bucket(bucketAlbums).ForEach(func(k, v []byte) error {
+		var album Album
+		if err := json.Unmarshal(v, &album); err != nil || album.OwnerID != userID {
+			return nil
+		}
+		album.OwnerID = newOwner
+		data, err := json.Marshal(&album)
+		if err != nil {
+			return err
+		}
+		updates[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return putAll(tx.Bucket(bucketAlbums), updates)
+}
+
+// putAll записывает в bucket набор ключ -> значение
+func putAll(b *bolt.Bucket, values map[string][]byte) error {
+	for k, v := range values {
+		if err := b.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // === Session операции ===
 
 // SaveSession сохраняет сессию
@@ -492,6 +1383,99 @@ func (s *Store) DeleteSession(id string) error {
 	})
 }
 
+// ListUserSessions возвращает все сессии пользователя
+func (s *Store) ListUserSessions(userID string) ([]*Session, error) {
+	var result []*Session
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketSessions)
+		return b.ForEach(func(k, v []byte) error {
+			var sess Session
+			if err := json.Unmarshal(v, &sess); err != nil {
+				return nil
+			}
+			if sess.UserID == userID {
+				result = append(result, &sess)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// SaveUserWithRole сохраняет пользователя и в той же транзакции переносит его роль
+// в сессии и API токены, чтобы смена прав вступала в силу немедленно и целиком,
+// а не после истечения сессии.
+// Возвращает количество обновлённых сессий и токенов.
+func (s *Store) SaveUserWithRole(u *User) (int, error) {
+	var updated int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketUsers).Put([]byte(u.Username), data); err != nil {
+			return err
+		}
+		updated, err = updateUserRole(tx, u.ID, u.Role)
+		return err
+	})
+	return updated, err
+}
+
+// updateUserRole меняет роль в сессиях и токенах пользователя внутри транзакции
+func updateUserRole(tx *bolt.Tx, userID, role string) (int, error) {
+	// Сначала собираем изменения, затем пишем: бакет не меняется во время обхода
+	changed := make(map[string][]byte)
+	sessions := tx.Bucket(bucketSessions)
+	err := sessions.ForEach(func(k, v []byte) error {
+		var sess Session
+		if err := json.Unmarshal(v, &sess); err != nil || sess.UserID != userID || sess.Role == role {
+			return nil
+		}
+		sess.Role = role
+		data, err := json.Marshal(&sess)
+		if err != nil {
+			return err
+		}
+		changed[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for k, data := range changed {
+		if err := sessions.Put([]byte(k), data); err != nil {
+			return 0, err
+		}
+	}
+	updated := len(changed)
+
+	changed = make(map[string][]byte)
+	tokens := tx.Bucket(bucketAPITokens)
+	err = tokens.ForEach(func(k, v []byte) error {
+		var token APIToken
+		if err := json.Unmarshal(v, &token); err != nil || token.UserID != userID || token.Role == role {
+			return nil
+		}
+		token.Role = role
+		data, err := json.Marshal(&token)
+		if err != nil {
+			return err
+		}
+		changed[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for k, data := range changed {
+		if err := tokens.Put([]byte(k), data); err != nil {
+			return 0, err
+		}
+	}
+	return updated + len(changed), nil
+}
+
 // === Вспомогательные функции для индексов ===
 
 func addToIndex(tx *bolt.Tx, bucket []byte, key, id string) error {
@@ -575,9 +1559,16 @@ func (s *Store) ListDirectories() ([]string, error) {
 
 // === Album операции ===
 
-// SaveAlbum сохраняет альбом
+// SaveAlbum сохраняет альбом (ParentID проверяется на существование и циклы)
 func (s *Store) SaveAlbum(album *Album) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
+		if err := checkAlbumParent(tx.Bucket(bucketAlbums), album.ID, album.ParentID); err != nil {
+			return err
+		}
+		if album.Smart {
+			album.MediaIDs = nil // Содержимое умного альбома вычисляется при чтении
+		}
 		album.MediaCount = len(album.MediaIDs)
 		data, err := json.Marshal(album)
 		if err != nil {
@@ -606,13 +1597,109 @@ func (s *Store) GetAlbum(id string) (*Album, error) {
 	return &album, nil
 }
 
-// DeleteAlbum удаляет альбом
-func (s *Store) DeleteAlbum(id string) error {
+// checkAlbumParent проверяет, что parentID существует и не является самим альбомом или его потомком
+func checkAlbumParent(b *bolt.Bucket, albumID, parentID string) error {
+	seen := make(map[string]bool)
+	for current := parentID; current != ""; {
+		if current == albumID {
+			return ErrAlbumCycle
+		}
+		if seen[current] {
+			return ErrAlbumCycle // Цикл среди уже сохраненных альбомов
+		}
+		seen[current] = true
+
+		data := b.Get([]byte(current))
+		if data == nil {
+			if current == parentID {
+				return ErrParentAlbum
+			}
+			return nil // Оборванная цепочка выше родителя — не мешает сохранению
+		}
+		var parent Album
+		if err := json.Unmarshal(data, &parent); err != nil {
+			return err
+		}
+		current = parent.ParentID
+	}
+	return nil
+}
+
+// DeleteAlbum удаляет альбом. cascade=true удаляет и все вложенные альбомы,
+// иначе прямые потомки переносятся к родителю удаляемого альбома.
+func (s *Store) DeleteAlbum(id string, cascade bool) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket(bucketAlbums).Delete([]byte(id))
+		s.touchNav(tx)
+		b := tx.Bucket(bucketAlbums)
+		data := b.Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		var album Album
+		if err := json.Unmarshal(data, &album); err != nil {
+			return err
+		}
+
+		// Связи родитель -> дети за один проход
+		children := make(map[string][]*Album)
+		if err := b.ForEach(func(k, v []byte) error {
+			var a Album
+			if err := json.Unmarshal(v, &a); err != nil {
+				return nil
+			}
+			if a.ParentID != "" {
+				children[a.ParentID] = append(children[a.ParentID], &a)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if cascade {
+			queue := []string{id}
+			for len(queue) > 0 {
+				current := queue[0]
+				queue = queue[1:]
+				for _, child := range children[current] {
+					queue = append(queue, child.ID)
+				}
+				if err := b.Delete([]byte(current)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		for _, child := range children[id] {
+			child.ParentID = album.ParentID
+			child.UpdatedAt = time.Now()
+			data, err := json.Marshal(child)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(child.ID), data); err != nil {
+				return err
+			}
+		}
+		return b.Delete([]byte(id))
 	})
 }
 
+// GetChildAlbums возвращает прямые вложенные альбомы (parentID "" — корневые)
+func (s *Store) GetChildAlbums(parentID string) ([]*Album, error) {
+	albums, err := s.ListAlbums()
+	if err != nil {
+		return nil, err
+	}
+	var result []*Album
+	for _, a := range albums {
+		if a.ParentID == parentID {
+			result = append(result, a)
+		}
+	}
+	return result, nil
+}
+
 // ListAlbums возвращает все альбомы
 func (s *Store) ListAlbums() ([]*Album, error) {
 	var result []*Album
@@ -639,6 +1726,9 @@ func (s *Store) AddMediaToAlbum(albumID string, mediaIDs []string) error {
 	if album == nil {
 		return fmt.Errorf("album not found")
 	}
+	if album.Smart {
+		return ErrSmartAlbum
+	}
 
 	existing := make(map[string]bool)
 	for _, id := range album.MediaIDs {
@@ -662,6 +1752,9 @@ func (s *Store) RemoveMediaFromAlbum(albumID string, mediaIDs []string) error {
 	if album == nil {
 		return fmt.Errorf("album not found")
 	}
+	if album.Smart {
+		return ErrSmartAlbum
+	}
 
 	toRemove := make(map[string]bool)
 	for _, id := range mediaIDs {
@@ -679,7 +1772,52 @@ func (s *Store) RemoveMediaFromAlbum(albumID string, mediaIDs []string) error {
 	return s.SaveAlbum(album)
 }
 
-// GetAlbumMedia получает медиа из альбома
+// SetAlbumCover устанавливает обложку альбома.
+// Обложкой может быть только медиа, входящее в альбом.
+func (s *Store) SetAlbumCover(albumID, mediaID string) error {
+	album, err := s.GetAlbum(albumID)
+	if err != nil {
+		return err
+	}
+	if album == nil {
+		return ErrAlbumNotFound
+	}
+
+	found, err := s.AlbumHasMedia(album, mediaID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotInAlbum
+	}
+
+	album.CoverID = mediaID
+	album.UpdatedAt = time.Now()
+	return s.SaveAlbum(album)
+}
+
+// SetAlbumSlideshow сохраняет настройки слайдшоу альбома
+func (s *Store) SetAlbumSlideshow(albumID string, intervalSeconds int, shuffle bool, transition string) (*Album, error) {
+	album, err := s.GetAlbum(albumID)
+	if err != nil {
+		return nil, err
+	}
+	if album == nil {
+		return nil, ErrAlbumNotFound
+	}
+
+	album.SlideIntervalSeconds = intervalSeconds
+	album.Shuffle = shuffle
+	album.Transition = transition
+	album.UpdatedAt = time.Now()
+	if err := s.SaveAlbum(album); err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+// GetAlbumMedia получает медиа из альбома.
+// Для умного альбома выполняется сохраненный поиск (без пагинации).
 func (s *Store) GetAlbumMedia(albumID string) ([]*Media, error) {
 	album, err := s.GetAlbum(albumID)
 	if err != nil {
@@ -689,6 +1827,20 @@ func (s *Store) GetAlbumMedia(albumID string) ([]*Media, error) {
 		return nil, nil
 	}
 
+	if album.Smart {
+		if album.Query == nil {
+			return nil, nil
+		}
+		query := *album.Query
+		query.Offset = 0
+		query.Limit = math.MaxInt32
+		result, err := s.Search(&query)
+		if err != nil {
+			return nil, err
+		}
+		return result.Media, nil
+	}
+
 	var result []*Media
 	for _, id := range album.MediaIDs {
 		media, err := s.GetMedia(id)
@@ -699,6 +1851,294 @@ func (s *Store) GetAlbumMedia(albumID string) ([]*Media, error) {
 			result = append(result, media)
 		}
 	}
+	if !album.CustomOrder {
+		sortAlbumMedia(result)
+	}
+	return result, nil
+}
+
+// sortAlbumMedia порядок альбома по умолчанию: по дате съемки от ранних к поздним
+func sortAlbumMedia(media []*Media) {
+	sort.SliceStable(media, func(i, j int) bool {
+		di, dj := media[i].Date(), media[j].Date()
+		if !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return media[i].ID < media[j].ID
+	})
+}
+
+// SetAlbumOrder сохраняет ручной порядок медиа альбома. mediaIDs должен содержать
+// каждое текущее (не удаленное) медиа альбома ровно один раз; медиа из корзины
+// остаются в конце. nil возвращает сортировку по дате съемки.
+// Проверка и запись идут в одной транзакции, чтобы не потерять параллельное добавление.
+func (s *Store) SetAlbumOrder(albumID string, mediaIDs []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
+		albums := tx.Bucket(bucketAlbums)
+		data := albums.Get([]byte(albumID))
+		if data == nil {
+			return ErrAlbumNotFound
+		}
+		var album Album
+		if err := json.Unmarshal(data, &album); err != nil {
+			return err
+		}
+		if album.Smart {
+			return ErrSmartAlbum
+		}
+
+		if mediaIDs != nil {
+			media := tx.Bucket(bucketMedia)
+			current := make(map[string]bool, len(album.MediaIDs))
+			for _, id := range album.MediaIDs {
+				data := media.Get([]byte(id))
+				if data == nil {
+					continue
+				}
+				var m Media
+				if err := json.Unmarshal(data, &m); err == nil && m.DeletedAt == nil {
+					current[id] = true
+				}
+			}
+			if len(mediaIDs) != len(current) {
+				return ErrAlbumOrder
+			}
+			listed := make(map[string]bool, len(mediaIDs))
+			for _, id := range mediaIDs {
+				if !current[id] || listed[id] {
+					return ErrAlbumOrder // Чужое медиа или повтор
+				}
+				listed[id] = true
+			}
+
+			ordered := append([]string{}, mediaIDs...)
+			for _, id := range album.MediaIDs {
+				if !listed[id] {
+					ordered = append(ordered, id)
+				}
+			}
+			album.MediaIDs = ordered
+		}
+
+		album.CustomOrder = mediaIDs != nil
+		album.UpdatedAt = time.Now()
+		out, err := json.Marshal(&album)
+		if err != nil {
+			return err
+		}
+		return albums.Put([]byte(album.ID), out)
+	})
+}
+
+// ResolveAlbumCovers подставляет обложку по умолчанию — самое раннее по дате медиа альбома —
+// альбомам, у которых CoverID не задан или указывает на удаленное медиа. Только для показа,
+// в базе не сохраняется, поэтому обложка по умолчанию следует за содержимым альбома.
+// Обычные альбомы разбираются за одну транзакцию, умные — за один общий проход по медиа.
+func (s *Store) ResolveAlbumCovers(albums []*Album) error {
+	type smartCover struct {
+		album    *Album
+		matches  func(*Media) bool
+		earliest *Media
+	}
+	var smart []*smartCover
+	var pending []*Album // Умные альбомы без действующей обложки
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMedia)
+		alive := func(id string) *Media {
+			data := b.Get([]byte(id))
+			if data == nil {
+				return nil
+			}
+			var m Media
+			if err := json.Unmarshal(data, &m); err != nil || m.DeletedAt != nil {
+				return nil
+			}
+			return &m
+		}
+
+		for _, a := range albums {
+			if a.CoverID != "" && alive(a.CoverID) != nil {
+				continue
+			}
+			a.CoverID = ""
+			if a.Smart {
+				if a.Query != nil {
+					pending = append(pending, a)
+				}
+				continue
+			}
+			var earliest *Media
+			for _, id := range a.MediaIDs {
+				if m := alive(id); m != nil && coverBefore(m, earliest) {
+					earliest = m
+				}
+			}
+			if earliest != nil {
+				a.CoverID = earliest.ID
+			}
+		}
+		return nil
+	})
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+
+	for _, a := range pending {
+		matches, err := s.searchMatcher(a.Query)
+		if err != nil {
+			return err
+		}
+		smart = append(smart, &smartCover{album: a, matches: matches})
+	}
+	err = s.IterateMedia(func(m *Media) bool {
+		for _, sc := range smart {
+			if sc.matches(m) && coverBefore(m, sc.earliest) {
+				sc.earliest = m
+			}
+		}
+		return true
+	})
+	for _, sc := range smart {
+		if sc.earliest != nil {
+			sc.album.CoverID = sc.earliest.ID
+		}
+	}
+	return err
+}
+
+// coverBefore раньше ли m текущего кандидата в обложки (при равных датах — меньший ID)
+func coverBefore(m, current *Media) bool {
+	if current == nil {
+		return true
+	}
+	dm, dc := m.Date(), current.Date()
+	if !dm.Equal(dc) {
+		return dm.Before(dc)
+	}
+	return m.ID < current.ID
+}
+
+// AlbumHasMedia проверяет, входит ли медиа в альбом. Для умного альбома условия
+// его запроса проверяются только на этом медиа, без поиска по библиотеке.
+func (s *Store) AlbumHasMedia(album *Album, mediaID string) (bool, error) {
+	if !album.Smart {
+		for _, id := range album.MediaIDs {
+			if id == mediaID {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	if album.Query == nil {
+		return false, nil
+	}
+
+	m, err := s.GetMedia(mediaID)
+	if err != nil || m == nil || m.DeletedAt != nil {
+		return false, err
+	}
+	matches, err := s.searchMatcher(album.Query)
+	if err != nil {
+		return false, err
+	}
+	return matches(m), nil
+}
+
+// FillSmartAlbumCounts вычисляет MediaCount умных альбомов из списка (в базе он не хранится).
+// Запросы всех умных альбомов проверяются за один общий проход по медиа.
+func (s *Store) FillSmartAlbumCounts(albums []*Album) error {
+	type smartCount struct {
+		album   *Album
+		matches func(*Media) bool
+	}
+	var smart []*smartCount
+	for _, a := range albums {
+		if !a.Smart {
+			continue
+		}
+		a.MediaCount = 0
+		if a.Query == nil {
+			continue
+		}
+		matches, err := s.searchMatcher(a.Query)
+		if err != nil {
+			return err
+		}
+		smart = append(smart, &smartCount{album: a, matches: matches})
+	}
+	if len(smart) == 0 {
+		return nil
+	}
+
+	return s.IterateMedia(func(m *Media) bool {
+		for _, sc := range smart {
+			if sc.matches(m) {
+				sc.album.MediaCount++
+			}
+		}
+		return true
+	})
+}
+
+// === Проверка (flag for review) ===
+
+// FlagMedia отмечает медиа для проверки администратором
+func (s *Store) FlagMedia(mediaID, reason, userID string) error {
+	media, err := s.GetMedia(mediaID)
+	if err != nil {
+		return err
+	}
+	if media == nil {
+		return fmt.Errorf("media not found")
+	}
+
+	now := time.Now()
+	media.Flagged = true
+	media.FlagReason = reason
+	media.FlaggedBy = userID
+	media.FlaggedAt = &now
+	return s.SaveMedia(media)
+}
+
+// UnflagMedia снимает отметку проверки
+func (s *Store) UnflagMedia(mediaID string) error {
+	media, err := s.GetMedia(mediaID)
+	if err != nil {
+		return err
+	}
+	if media == nil {
+		return fmt.Errorf("media not found")
+	}
+
+	media.Flagged = false
+	media.FlagReason = ""
+	media.FlaggedBy = ""
+	media.FlaggedAt = nil
+	return s.SaveMedia(media)
+}
+
+// ListFlaggedMedia возвращает отмеченные для проверки медиа (новые отметки первыми)
+func (s *Store) ListFlaggedMedia() ([]*Media, error) {
+	var result []*Media
+	err := s.IterateMedia(func(m *Media) bool {
+		if m.Flagged {
+			result = append(result, m)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i].FlaggedAt, result[j].FlaggedAt
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.After(*b)
+	})
 	return result, nil
 }
 
@@ -717,6 +2157,7 @@ func (s *Store) ToggleFavorite(mediaID string) (bool, error) {
 	media.IsFavorite = !media.IsFavorite
 
 	err = s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
 		data, err := json.Marshal(media)
 		if err != nil {
 			return err
@@ -751,6 +2192,7 @@ func (s *Store) SetFavorite(mediaID string, isFavorite bool) error {
 	media.IsFavorite = isFavorite
 
 	return s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
 		data, err := json.Marshal(media)
 		if err != nil {
 			return err
@@ -786,6 +2228,33 @@ func (s *Store) ListFavorites() ([]*Media, error) {
 	return result, nil
 }
 
+// FavoriteMediaIDs ID медиа в избранном глобально или хотя бы у одного пользователя
+func (s *Store) FavoriteMediaIDs() (map[string]bool, error) {
+	ids := make(map[string]bool)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(bucketFavorites).Get([]byte("global")); data != nil {
+			var global []string
+			if err := json.Unmarshal(data, &global); err != nil {
+				return err
+			}
+			for _, id := range global {
+				ids[id] = true
+			}
+		}
+		return tx.Bucket(bucketUserFav).ForEach(func(k, v []byte) error {
+			var userIDs []string
+			if err := json.Unmarshal(v, &userIDs); err != nil {
+				return nil
+			}
+			for _, id := range userIDs {
+				ids[id] = true
+			}
+			return nil
+		})
+	})
+	return ids, err
+}
+
 // === Per-User Favorites ===
 
 // GetUserFavorites возвращает список ID избранных медиа для пользователя
@@ -916,15 +2385,17 @@ func (s *Store) AddTagsToMedia(mediaID string, tags []string) error {
 	}
 
 	return s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
 		for _, tag := range tags {
 			tag = strings.TrimSpace(strings.ToLower(tag))
 			if tag == "" {
 				continue
 			}
-			if !existing[tag] {
-				media.Tags = append(media.Tags, tag)
-				existing[tag] = true
+			if existing[tag] {
+				continue // Повторный тег не должен увеличивать счетчик
 			}
+			media.Tags = append(media.Tags, tag)
+			existing[tag] = true
 			addToIndex(tx, bucketIdxTag, tag, mediaID)
 			incrementTagCount(tx, tag)
 		}
@@ -953,6 +2424,7 @@ func (s *Store) RemoveTagsFromMedia(mediaID string, tags []string) error {
 	}
 
 	return s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
 		var newTags []string
 		for _, t := range media.Tags {
 			if !toRemove[t] {
@@ -1026,6 +2498,9 @@ func incrementTagCount(tx *bolt.Tx, tagName string) error {
 	return b.Put([]byte(tagName), newData)
 }
 
+// decrementTagCount уменьшает счётчик тега (после removeFromIndex). Счётчик не опускается
+// ниже числа медиа в idx_tag: если он разошелся с реальностью, тег не удаляется,
+// пока у него остаются медиа. Точные значения восстанавливает ReconcileTags.
 func decrementTagCount(tx *bolt.Tx, tagName string) error {
 	b := tx.Bucket(bucketTags)
 	data := b.Get([]byte(tagName))
@@ -1033,9 +2508,9 @@ func decrementTagCount(tx *bolt.Tx, tagName string) error {
 		return nil
 	}
 
-	var tag Tag
+	tag := Tag{Name: tagName}
 	json.Unmarshal(data, &tag)
-	tag.MediaCount--
+	tag.MediaCount = max(tag.MediaCount-1, indexLen(tx, bucketIdxTag, tagName))
 
 	if tag.MediaCount <= 0 {
 		return b.Delete([]byte(tagName))
@@ -1045,6 +2520,96 @@ func decrementTagCount(tx *bolt.Tx, tagName string) error {
 	return b.Put([]byte(tagName), newData)
 }
 
+// indexLen число ID в записи индекса
+func indexLen(tx *bolt.Tx, bucket []byte, key string) int {
+	data := tx.Bucket(bucket).Get([]byte(key))
+	if data == nil {
+		return 0
+	}
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return 0
+	}
+	return len(ids)
+}
+
+// reconcileTags пересчитывает счётчики тегов и индекс idx_tag по тегам самих медиа
+// (как и при записи, учитываются и медиа в корзине). Возвращает число исправленных тегов.
+func reconcileTags(tx *bolt.Tx) (int, error) {
+	index := make(map[string][]string)
+	err := tx.Bucket(bucketMedia).ForEach(func(k, v []byte) error {
+		var media Media
+		if err := json.Unmarshal(v, &media); err != nil {
+			return nil // skip invalid
+		}
+		for _, tag := range media.Tags {
+			if ids := index[tag]; len(ids) == 0 || ids[len(ids)-1] != media.ID {
+				index[tag] = append(ids, media.ID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	fixed := 0
+	tags := tx.Bucket(bucketTags)
+	err = tags.ForEach(func(k, v []byte) error {
+		var tag Tag
+		json.Unmarshal(v, &tag)
+		if len(index[string(k)]) != tag.MediaCount {
+			fixed++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for name := range index {
+		if tags.Get([]byte(name)) == nil {
+			fixed++ // Тег у медиа есть, а в списке тегов пропал
+		}
+	}
+
+	for _, bucket := range [][]byte{bucketTags, bucketIdxTag} {
+		if err := tx.DeleteBucket(bucket); err != nil && err != bolt.ErrBucketNotFound {
+			return 0, err
+		}
+		if _, err := tx.CreateBucket(bucket); err != nil {
+			return 0, err
+		}
+	}
+	for name, ids := range index {
+		data, err := json.Marshal(Tag{Name: name, MediaCount: len(ids)})
+		if err != nil {
+			return 0, err
+		}
+		if err := tx.Bucket(bucketTags).Put([]byte(name), data); err != nil {
+			return 0, err
+		}
+		if data, err = json.Marshal(ids); err != nil {
+			return 0, err
+		}
+		if err := tx.Bucket(bucketIdxTag).Put([]byte(name), data); err != nil {
+			return 0, err
+		}
+	}
+	return fixed, nil
+}
+
+// ReconcileTags пересчитывает счётчики и индекс тегов с нуля; возвращает число исправленных тегов
+func (s *Store) ReconcileTags() (int, error) {
+	var fixed int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
+		var err error
+		fixed, err = reconcileTags(tx)
+		return err
+	})
+	return fixed, err
+}
+
 // === Search операции ===
 
 // Search выполняет поиск медиа
@@ -1053,40 +2618,139 @@ func (s *Store) Search(query *SearchQuery) (*SearchResult, error) {
 		query.Limit = 50
 	}
 
-	allMedia, err := s.ListAllMedia()
+	// В памяти держим только подходящие записи, а не всю библиотеку
+	var filtered []*Media
+	err := s.IterateSearch(query, func(m *Media) bool {
+		filtered = append(filtered, m)
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var filtered []*Media
-	for _, m := range allMedia {
-		if s.matchesQuery(m, query) {
-			filtered = append(filtered, m)
+	// Сортируем весь отфильтрованный набор до пагинации,
+	// чтобы порядок был одинаковым на всех страницах
+	sortMedia(filtered, query.SortBy, query.SortDir)
+
+	totalCount := len(filtered)
+
+	start := query.Offset
+	if start > len(filtered) {
+		start = len(filtered)
+	}
+	end := start + query.Limit
+	if end > len(filtered) {
+		end = len(filtered)
+	}
+
+	result := &SearchResult{
+		Media:      filtered[start:end],
+		TotalCount: totalCount,
+		HasMore:    end < totalCount,
+	}
+
+	return result, nil
+}
+
+// IterateSearch вызывает fn для каждого медиа, подходящего под условия query,
+// без сортировки и пагинации (порядок хранения). fn возвращает false, чтобы остановить обход.
+func (s *Store) IterateSearch(query *SearchQuery, fn func(*Media) bool) error {
+	matches, err := s.searchMatcher(query)
+	if err != nil {
+		return err
+	}
+	match := func(m *Media) bool {
+		if matches(m) {
+			return fn(m)
 		}
+		return true
 	}
 
-	totalCount := len(filtered)
+	// Фильтр по датам или одному типу сужаем через индекс, остальные условия проверяем как обычно
+	if query.DateFrom != nil || query.DateTo != nil {
+		return s.iterateMediaByMonths(query.DateFrom, query.DateTo, match)
+	}
+	if types := query.MediaTypes(); len(types) == 1 {
+		return s.iterateIndexedMedia(bucketIdxType, string(types[0]), match)
+	}
+	return s.IterateMedia(match)
+}
 
-	start := query.Offset
-	if start > len(filtered) {
-		start = len(filtered)
+// searchMatcher возвращает проверку одного медиа по условиям query. Данные об альбомах
+// (название в тексте запроса, Unalbumed) собираются один раз — проход по альбомам на поиск.
+// Вызывается вне транзакций: сам читает альбомы.
+func (s *Store) searchMatcher(query *SearchQuery) (func(*Media) bool, error) {
+	// Медиа из альбомов, чье название содержит текст запроса
+	var albumMatches map[string]bool
+	if query.Text != "" {
+		var err error
+		if albumMatches, err = s.mediaInAlbumsMatching(query.Text); err != nil {
+			return nil, err
+		}
 	}
-	end := start + query.Limit
-	if end > len(filtered) {
-		end = len(filtered)
+
+	// Медиа, разложенные по альбомам (для Unalbumed)
+	var inAlbums map[string]bool
+	if query.Unalbumed {
+		var err error
+		if inAlbums, err = s.mediaInAnyAlbum(); err != nil {
+			return nil, err
+		}
 	}
 
-	result := &SearchResult{
-		Media:      filtered[start:end],
-		TotalCount: totalCount,
-		HasMore:    end < totalCount,
+	return func(m *Media) bool {
+		return !inAlbums[m.ID] && s.matchesQuery(m, query, albumMatches)
+	}, nil
+}
+
+// sortMedia сортирует медиа по указанному полю.
+// По умолчанию taken_at desc; для taken_at используется ModifiedAt, если даты съёмки нет.
+// При равенстве значений порядок определяется ID, поэтому результат детерминирован.
+func sortMedia(media []*Media, sortBy, sortDir string) {
+	desc := sortDir != SortAsc
+
+	var less func(a, b *Media) int
+	switch sortBy {
+	case SortByModifiedAt:
+		less = func(a, b *Media) int { return a.ModifiedAt.Compare(b.ModifiedAt) }
+	case SortBySize:
+		less = func(a, b *Media) int {
+			switch {
+			case a.Size < b.Size:
+				return -1
+			case a.Size > b.Size:
+				return 1
+			}
+			return 0
+		}
+	case SortByFilename:
+		less = func(a, b *Media) int {
+			return strings.Compare(strings.ToLower(a.Filename), strings.ToLower(b.Filename))
+		}
+	default:
+		less = func(a, b *Media) int { return mediaDate(a).Compare(mediaDate(b)) }
 	}
 
-	return result, nil
+	sort.SliceStable(media, func(i, j int) bool {
+		c := less(media[i], media[j])
+		if c == 0 {
+			return media[i].ID < media[j].ID
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
 }
 
-func (s *Store) matchesQuery(m *Media, q *SearchQuery) bool {
-	if q.Text != "" {
+// albumMatches — медиа из альбомов, чье название содержит q.Text (см. mediaInAlbumsMatching)
+func (s *Store) matchesQuery(m *Media, q *SearchQuery, albumMatches map[string]bool) bool {
+	if q.Text != "" && q.Fuzzy {
+		fields := append([]string{m.Filename, m.Metadata.Camera, m.Metadata.Lens, m.Metadata.Artist}, m.Tags...)
+		if !fuzzyMatch(q.Text, fields) && !albumMatches[m.ID] {
+			return false
+		}
+	} else if q.Text != "" {
 		text := strings.ToLower(q.Text)
 		filename := strings.ToLower(m.Filename)
 		camera := strings.ToLower(m.Metadata.Camera)
@@ -1094,19 +2758,24 @@ func (s *Store) matchesQuery(m *Media, q *SearchQuery) bool {
 
 		if !strings.Contains(filename, text) &&
 			!strings.Contains(camera, text) &&
-			!strings.Contains(lens, text) {
+			!strings.Contains(lens, text) &&
+			!strings.Contains(strings.ToLower(m.Metadata.Caption), text) &&
+			!strings.Contains(strings.ToLower(m.Metadata.Artist), text) &&
+			!tagsContain(m.Tags, text) &&
+			!albumMatches[m.ID] {
 			return false
 		}
 	}
 
-	if q.Type != "" && m.Type != q.Type {
+	if types := q.MediaTypes(); len(types) > 0 && !slices.Contains(types, m.Type) {
 		return false
 	}
 
-	if q.DateFrom != nil && m.TakenAt.Before(*q.DateFrom) {
+	// Как в хронологии: без даты съёмки используется дата модификации
+	if q.DateFrom != nil && mediaDate(m).Before(*q.DateFrom) {
 		return false
 	}
-	if q.DateTo != nil && m.TakenAt.After(*q.DateTo) {
+	if q.DateTo != nil && mediaDate(m).After(*q.DateTo) {
 		return false
 	}
 
@@ -1122,9 +2791,21 @@ func (s *Store) matchesQuery(m *Media, q *SearchQuery) bool {
 		}
 	}
 
+	for _, t := range q.ExcludeTags {
+		if slices.Contains(m.Tags, strings.ToLower(strings.TrimSpace(t))) {
+			return false
+		}
+	}
+
 	if q.Camera != "" && !strings.Contains(strings.ToLower(m.Metadata.Camera), strings.ToLower(q.Camera)) {
 		return false
 	}
+	if len(q.Cameras) > 0 && !cameraMatchesAny(m.Metadata.Camera, q.Cameras) {
+		return false
+	}
+	if q.Artist != "" && !strings.Contains(strings.ToLower(m.Metadata.Artist), strings.ToLower(strings.TrimSpace(q.Artist))) {
+		return false
+	}
 
 	if q.IsFavorite != nil && m.IsFavorite != *q.IsFavorite {
 		return false
@@ -1137,137 +2818,570 @@ func (s *Store) matchesQuery(m *Media, q *SearchQuery) bool {
 		}
 	}
 
+	if q.Color != "" && !matchesColor(m.Colors, q.Color) {
+		return false
+	}
+
+	if q.Flagged != nil && m.Flagged != *q.Flagged {
+		return false
+	}
+
+	if q.MinSize > 0 && m.Size < q.MinSize {
+		return false
+	}
+	if q.MaxSize > 0 && m.Size > q.MaxSize {
+		return false
+	}
+
+	if !matchesExposure(&m.Metadata, q) {
+		return false
+	}
+
+	for _, field := range q.Missing {
+		switch field {
+		case MissingCamera:
+			if m.Metadata.Camera != "" {
+				return false
+			}
+		case MissingGPS:
+			if m.Metadata.GPSLat != 0 || m.Metadata.GPSLon != 0 {
+				return false
+			}
+		case MissingDate:
+			if !m.TakenAt.IsZero() && m.TakenAt.Year() > 1900 {
+				return false
+			}
+		}
+	}
+
 	return true
 }
 
+// cameraMatchesAny проверяет, содержит ли название камеры любую из подстрок
+func cameraMatchesAny(camera string, cameras []string) bool {
+	camera = strings.ToLower(camera)
+	for _, c := range cameras {
+		if strings.Contains(camera, strings.ToLower(c)) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagsContain проверяет, содержит ли какой-либо тег подстроку (text в нижнем регистре)
+func tagsContain(tags []string, text string) bool {
+	for _, t := range tags {
+		if strings.Contains(strings.ToLower(t), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaInAlbumsMatching возвращает ID медиа из обычных альбомов, чье название содержит text.
+// Умные альбомы не учитываются: их содержимое само определяется поиском.
+func (s *Store) mediaInAlbumsMatching(text string) (map[string]bool, error) {
+	albums, err := s.ListAlbums()
+	if err != nil {
+		return nil, err
+	}
+
+	text = strings.ToLower(text)
+	result := make(map[string]bool)
+	for _, album := range albums {
+		if album.Smart || !strings.Contains(strings.ToLower(album.Name), text) {
+			continue
+		}
+		for _, id := range album.MediaIDs {
+			result[id] = true
+		}
+	}
+	return result, nil
+}
+
+// mediaInAnyAlbum возвращает ID медиа, входящих хотя бы в один обычный альбом
+func (s *Store) mediaInAnyAlbum() (map[string]bool, error) {
+	result := make(map[string]bool)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketAlbums).ForEach(func(k, v []byte) error {
+			var album Album
+			if err := json.Unmarshal(v, &album); err != nil || album.Smart {
+				return nil
+			}
+			for _, id := range album.MediaIDs {
+				result[id] = true
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
 // === Timeline операции ===
 
-// GetTimeline возвращает группировку медиа по месяцам
+// GetTimeline возвращает группировку медиа по месяцам.
+// Месяцы берутся из индекса по дате: в нём каждое медиа ровно под одним ключом
+// (дата съёмки, без неё — дата модификации), поэтому повторного счёта нет.
 func (s *Store) GetTimeline() ([]*TimelineGroup, error) {
+	return s.getTimeline(0)
+}
+
+// GetTimelineWithMedia как GetTimeline, но заполняет Media у новейших месяцев,
+// пока в них не наберётся хотя бы limit медиа. Записи уже читаются для подсчёта,
+// поэтому первый экран галереи не требует отдельных запросов по месяцам.
+func (s *Store) GetTimelineWithMedia(limit int) ([]*TimelineGroup, error) {
+	return s.getTimeline(limit)
+}
+
+func (s *Store) getTimeline(keepMedia int) ([]*TimelineGroup, error) {
+	var result []*TimelineGroup
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMedia)
+		c := tx.Bucket(bucketIdxDate).Cursor()
+
+		// Ключи YYYY-MM идут по возрастанию, хронология — по убыванию
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if _, err := time.Parse("2006-01", string(k)); err != nil {
+				continue // dateIndexVersionKey
+			}
+			var ids []string
+			if err := json.Unmarshal(v, &ids); err != nil {
+				continue
+			}
+
+			count := 0
+			var kept []*Media
+			for _, id := range ids {
+				data := b.Get([]byte(id))
+				if data == nil {
+					continue
+				}
+				var media Media
+				if err := json.Unmarshal(data, &media); err != nil || media.DeletedAt != nil {
+					continue
+				}
+				count++
+				if keepMedia > 0 {
+					kept = append(kept, &media)
+				}
+			}
+			if count == 0 {
+				continue
+			}
+
+			date := string(k)
+			result = append(result, &TimelineGroup{
+				Date:       date,
+				Label:      formatMonthLabel(date),
+				MediaCount: count,
+				Media:      kept,
+			})
+			keepMedia -= count
+		}
+		return nil
+	})
+	return result, err
+}
+
+// GetTimelineMedia возвращает медиа для периода
+func (s *Store) GetTimelineMedia(period string) ([]*Media, error) {
+	return s.ListMediaByMonth(period)
+}
+
+// ListMediaByMonth возвращает неудалённые медиа периода YYYY-MM по индексу даты
+func (s *Store) ListMediaByMonth(period string) ([]*Media, error) {
+	var result []*Media
+	err := s.iterateIndexedMedia(bucketIdxDate, period, func(m *Media) bool {
+		result = append(result, m)
+		return true
+	})
+	return result, err
+}
+
+// GetOnThisDay возвращает неудалённые медиа (без дубликатов), снятые month/day в любой год,
+// по годам от новых к старым, внутри дня — по времени съемки. Учитывается только дата
+// съемки из EXIF: время изменения файла обычно говорит о копировании, а не о снимке.
+// Месяцы берутся из индекса дат, медиа других месяцев не читаются.
+func (s *Store) GetOnThisDay(month, day int) ([]*Media, error) {
+	suffix := fmt.Sprintf("-%02d", month)
+
+	var result []*Media
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMedia)
+		return tx.Bucket(bucketIdxDate).ForEach(func(k, v []byte) error {
+			if len(k) != len("2006-01") || !strings.HasSuffix(string(k), suffix) {
+				return nil // Другой месяц или dateIndexVersionKey
+			}
+			var ids []string
+			if err := json.Unmarshal(v, &ids); err != nil {
+				return nil
+			}
+			for _, id := range ids {
+				data := b.Get([]byte(id))
+				if data == nil {
+					continue
+				}
+				var media Media
+				if err := json.Unmarshal(data, &media); err != nil {
+					continue
+				}
+				if media.DeletedAt != nil || media.DuplicateOf != "" {
+					continue
+				}
+				if media.TakenAt.Year() <= 1900 || int(media.TakenAt.Month()) != month || media.TakenAt.Day() != day {
+					continue
+				}
+				result = append(result, &media)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].TakenAt, result[j].TakenAt
+		if a.Year() != b.Year() {
+			return a.Year() > b.Year()
+		}
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+func formatMonthLabel(date string) string {
+	months := map[string]string{
+		"01": "Январь", "02": "Февраль", "03": "Март",
+		"04": "Апрель", "05": "Май", "06": "Июнь",
+		"07": "Июль", "08": "Август", "09": "Сентябрь",
+		"10": "Октябрь", "11": "Ноябрь", "12": "Декабрь",
+	}
+	if len(date) >= 7 {
+		year := date[:4]
+		month := date[5:7]
+		if m, ok := months[month]; ok {
+			return m + " " + year
+		}
+	}
+	return date
+}
+
+// === Geo операции ===
+
+// GetGeoPoints возвращает все точки с GPS
+func (s *Store) GetGeoPoints() ([]*GeoPoint, error) {
+	return s.GetGeoPointsIn(nil)
+}
+
+// GetGeoPointsIn возвращает точки с GPS внутри bounds (nil — все точки)
+func (s *Store) GetGeoPointsIn(bounds *GeoBounds) ([]*GeoPoint, error) {
 	allMedia, err := s.ListAllMedia()
 	if err != nil {
 		return nil, err
 	}
 
-	groups := make(map[string]*TimelineGroup)
+	var result []*GeoPoint
 	for _, m := range allMedia {
-		var date string
-		if !m.TakenAt.IsZero() && m.TakenAt.Year() > 1900 {
-			date = m.TakenAt.Format("2006-01")
-		} else {
-			date = m.ModifiedAt.Format("2006-01")
+		if m.Metadata.GPSLat == 0 && m.Metadata.GPSLon == 0 {
+			continue
+		}
+		if bounds == nil || bounds.Contains(m.Metadata.GPSLat, m.Metadata.GPSLon) {
+			result = append(result, &GeoPoint{
+				MediaID:  m.ID,
+				Lat:      m.Metadata.GPSLat,
+				Lon:      m.Metadata.GPSLon,
+				ThumbURL: "/media/" + m.ID + "/thumb/small",
+			})
 		}
+	}
+	return result, nil
+}
 
-		if groups[date] == nil {
-			groups[date] = &TimelineGroup{
-				Date:  date,
-				Label: formatMonthLabel(date),
-			}
+// GetPlaces группирует медиа по месту съемки (Metadata.Place/Country), самые частые первыми
+func (s *Store) GetPlaces() ([]*PlaceGroup, error) {
+	groups := make(map[string]*PlaceGroup)
+	err := s.IterateMedia(func(m *Media) bool {
+		if m.Metadata.Place == "" {
+			return true
+		}
+		key := m.Metadata.Country + "|" + m.Metadata.Place
+		g, ok := groups[key]
+		if !ok {
+			g = &PlaceGroup{Place: m.Metadata.Place, Country: m.Metadata.Country}
+			groups[key] = g
 		}
-		groups[date].MediaCount++
+		g.Count++
+		g.MediaIDs = append(g.MediaIDs, m.ID)
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	var result []*TimelineGroup
+	result := make([]*PlaceGroup, 0, len(groups))
 	for _, g := range groups {
 		result = append(result, g)
 	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Place < result[j].Place
+	})
+	return result, nil
+}
 
-	// Сортировка по убыванию даты
-	for i := 0; i < len(result)-1; i++ {
-		for j := i + 1; j < len(result); j++ {
-			if result[i].Date < result[j].Date {
-				result[i], result[j] = result[j], result[i]
-			}
+// GetGearStats считает снимки по камерам, объективам, фокусным расстояниям и диафрагмам
+func (s *Store) GetGearStats() (*GearStats, error) {
+	cameras := newGearCounter()
+	lenses := newGearCounter()
+	focals := newGearCounter()
+	apertures := newGearCounter()
+	stats := &GearStats{}
+
+	err := s.IterateMedia(func(m *Media) bool {
+		camera := strings.Join(strings.Fields(m.Metadata.Camera), " ")
+		lens := NormalizeLensName(m.Metadata.Lens)
+		if camera == "" && lens == "" {
+			return true
 		}
+		stats.TotalShots++
+		cameras.add(camera)
+		lenses.add(lens)
+		focals.add(m.Metadata.FocalLength)
+		apertures.add(m.Metadata.Aperture)
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return result, nil
+	stats.Cameras = cameras.sorted()
+	stats.Lenses = lenses.sorted()
+	stats.FocalLengths = focals.sorted()
+	stats.Apertures = apertures.sorted()
+	return stats, nil
+}
+
+// gearCounter группирует значения без учёта регистра; имя группы — первое встреченное написание
+type gearCounter map[string]*GearCount
+
+func newGearCounter() gearCounter {
+	return make(gearCounter)
+}
+
+func (c gearCounter) add(name string) {
+	if name == "" {
+		return
+	}
+	key := strings.ToLower(name)
+	g, ok := c[key]
+	if !ok {
+		g = &GearCount{Name: name}
+		c[key] = g
+	}
+	g.Count++
+}
+
+func (c gearCounter) sorted() []*GearCount {
+	result := make([]*GearCount, 0, len(c))
+	for _, g := range c {
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// === Bulk операции ===
+
+// bulkApply выполняет операцию для каждого ID, не прерываясь на ошибках
+func bulkApply(mediaIDs []string, fn func(id string) error) []BulkItemResult {
+	results := make([]BulkItemResult, 0, len(mediaIDs))
+	for _, id := range mediaIDs {
+		item := BulkItemResult{ID: id, OK: true}
+		if err := fn(id); err != nil {
+			item.OK = false
+			item.Error = err.Error()
+		}
+		results = append(results, item)
+	}
+	return results
+}
+
+// BulkSetFavorite устанавливает избранное для нескольких медиа
+func (s *Store) BulkSetFavorite(mediaIDs []string, isFavorite bool) []BulkItemResult {
+	return bulkApply(mediaIDs, func(id string) error {
+		return s.SetFavorite(id, isFavorite)
+	})
+}
+
+// BulkAddTags добавляет теги к нескольким медиа
+func (s *Store) BulkAddTags(mediaIDs []string, tags []string) []BulkItemResult {
+	return bulkApply(mediaIDs, func(id string) error {
+		return s.AddTagsToMedia(id, tags)
+	})
+}
+
+// UpdateMediaMetadata перезаписывает заданные поля медиа в базе (файл не меняется).
+// Индексы даты и камеры и счётчики обновляются как при SaveMedia.
+func (s *Store) UpdateMediaMetadata(mediaID string, edit MetadataEdit) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketMedia).Get([]byte(mediaID))
+		if data == nil {
+			return fmt.Errorf("media not found")
+		}
+		var m Media
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		if m.DeletedAt != nil {
+			return fmt.Errorf("media not found")
+		}
+
+		if edit.TakenAt != nil {
+			m.TakenAt = *edit.TakenAt
+			m.Metadata.TZOffset = "" // Смещение из EXIF к новой дате не относится
+		}
+		if edit.Camera != nil {
+			m.Metadata.Camera = *edit.Camera
+		}
+		if edit.Caption != nil {
+			m.Metadata.Caption = *edit.Caption
+		}
+		return s.saveMediaTx(tx, &m)
+	})
+}
+
+// BulkUpdateMetadata перезаписывает поля метаданных у нескольких медиа
+func (s *Store) BulkUpdateMetadata(mediaIDs []string, edit MetadataEdit) []BulkItemResult {
+	return bulkApply(mediaIDs, func(id string) error {
+		return s.UpdateMediaMetadata(id, edit)
+	})
 }
 
-// GetTimelineMedia возвращает медиа для периода
-func (s *Store) GetTimelineMedia(period string) ([]*Media, error) {
-	allMedia, err := s.ListAllMedia()
+// BulkAddToAlbum добавляет в альбом только существующие медиа, возвращая результат по каждому ID
+func (s *Store) BulkAddToAlbum(albumID string, mediaIDs []string) ([]BulkItemResult, error) {
+	album, err := s.GetAlbum(albumID)
 	if err != nil {
 		return nil, err
 	}
+	if album == nil {
+		return nil, ErrAlbumNotFound
+	}
+	if album.Smart {
+		return nil, ErrSmartAlbum
+	}
 
-	var result []*Media
-	for _, m := range allMedia {
-		var date string
-		if !m.TakenAt.IsZero() && m.TakenAt.Year() > 1900 {
-			date = m.TakenAt.Format("2006-01")
-		} else {
-			date = m.ModifiedAt.Format("2006-01")
+	var valid []string
+	results := bulkApply(mediaIDs, func(id string) error {
+		media, err := s.GetMedia(id)
+		if err != nil {
+			return err
 		}
-
-		if date == period {
-			result = append(result, m)
+		if media == nil || media.DeletedAt != nil {
+			return fmt.Errorf("media not found")
 		}
-	}
-
-	return result, nil
-}
+		valid = append(valid, id)
+		return nil
+	})
 
-func formatMonthLabel(date string) string {
-	months := map[string]string{
-		"01": "Январь", "02": "Февраль", "03": "Март",
-		"04": "Апрель", "05": "Май", "06": "Июнь",
-		"07": "Июль", "08": "Август", "09": "Сентябрь",
-		"10": "Октябрь", "11": "Ноябрь", "12": "Декабрь",
-	}
-	if len(date) >= 7 {
-		year := date[:4]
-		month := date[5:7]
-		if m, ok := months[month]; ok {
-			return m + " " + year
+	if len(valid) > 0 {
+		if err := s.AddMediaToAlbum(albumID, valid); err != nil {
+			return nil, err
 		}
 	}
-	return date
+	return results, nil
 }
 
-// === Geo операции ===
+// maxDuplicateChain ограничивает переходы по DuplicateOf (защита от циклов в старых данных)
+const maxDuplicateChain = 16
 
-// GetGeoPoints возвращает все точки с GPS
-func (s *Store) GetGeoPoints() ([]*GeoPoint, error) {
-	allMedia, err := s.ListAllMedia()
-	if err != nil {
+// ResolveOriginal возвращает оригинал дубликата, проходя по цепочке DuplicateOf
+// (оригинал мог сам позже оказаться дубликатом). nil, если медиа не дубликат
+// или оригинал уже удален.
+func (s *Store) ResolveOriginal(id string) (*Media, error) {
+	media, err := s.GetMedia(id)
+	if err != nil || media == nil || media.DuplicateOf == "" {
 		return nil, err
 	}
 
-	var result []*GeoPoint
-	for _, m := range allMedia {
-		if m.Metadata.GPSLat != 0 || m.Metadata.GPSLon != 0 {
-			result = append(result, &GeoPoint{
-				MediaID:  m.ID,
-				Lat:      m.Metadata.GPSLat,
-				Lon:      m.Metadata.GPSLon,
-				ThumbURL: "/media/" + m.ID + "/thumb/small",
-			})
+	visited := map[string]bool{media.ID: true}
+	for i := 0; i < maxDuplicateChain && media.DuplicateOf != ""; i++ {
+		if visited[media.DuplicateOf] {
+			break // Цикл: останавливаемся на последней найденной записи
+		}
+		next, err := s.GetMedia(media.DuplicateOf)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			break
 		}
+		visited[next.ID] = true
+		media = next
 	}
-	return result, nil
+
+	if media.ID == id {
+		return nil, nil
+	}
+	return media, nil
 }
 
-// === Bulk операции ===
+// ReplaceDuplicate делает duplicate основной копией: original помечается дубликатом
+// и перемещается в корзину, duplicate восстанавливается из корзины.
+// При ошибке файлы возвращаются на прежние места, записи не меняются.
+func (s *Store) ReplaceDuplicate(duplicate, original *Media) error {
+	dupBefore, origBefore := *duplicate, *original
+	if err := s.restoreFile(duplicate); err != nil {
+		return err
+	}
+	if err := s.trashFile(original); err != nil {
+		moveFileBack(duplicate, &dupBefore)
+		*duplicate = dupBefore
+		return err
+	}
 
-// BulkSetFavorite устанавливает избранное для нескольких медиа
-func (s *Store) BulkSetFavorite(mediaIDs []string, isFavorite bool) error {
-	for _, id := range mediaIDs {
-		if err := s.SetFavorite(id, isFavorite); err != nil {
-			return err
+	now := time.Now()
+	original.DuplicateOf = duplicate.ID
+	original.DeletedAt = &now
+	duplicate.DuplicateOf = ""
+	duplicate.DeletedAt = nil
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := s.saveMediaTx(tx, original); err != nil {
+			return fmt.Errorf("failed to update original: %w", err)
+		}
+		if err := s.saveMediaTx(tx, duplicate); err != nil {
+			return fmt.Errorf("failed to update duplicate: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		moveFileBack(original, &origBefore)
+		moveFileBack(duplicate, &dupBefore)
+		*original, *duplicate = origBefore, dupBefore
+		return err
 	}
 	return nil
 }
 
-// BulkAddTags добавляет теги к нескольким медиа
-func (s *Store) BulkAddTags(mediaIDs []string, tags []string) error {
-	for _, id := range mediaIDs {
-		if err := s.AddTagsToMedia(id, tags); err != nil {
-			return err
-		}
+// moveFileBack возвращает файл m на путь из before (откат restoreFile/trashFile)
+func moveFileBack(m, before *Media) {
+	if m.Path == before.Path {
+		return
+	}
+	if err := os.Rename(m.Path, before.Path); err != nil {
+		logger.ErrorLog.Printf("[DB] Failed to move %s back to %s: %v", m.Path, before.Path, err)
 	}
-	return nil
 }
 
 // BulkDelete удаляет несколько медиа
@@ -1280,23 +3394,90 @@ func (s *Store) BulkDelete(mediaIDs []string) error {
 	return nil
 }
 
-// GetMediaByIDs возвращает медиа по списку ID
+// GetMediaByIDs возвращает медиа по списку ID одной транзакцией.
+// Отсутствующие и удаленные в корзину пропускаются.
 func (s *Store) GetMediaByIDs(ids []string) ([]*Media, error) {
 	var result []*Media
-	for _, id := range ids {
-		media, err := s.GetMedia(id)
-		if err != nil {
-			continue
-		}
-		if media != nil && media.DeletedAt == nil {
-			result = append(result, media)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMedia)
+		for _, id := range ids {
+			data := b.Get([]byte(id))
+			if data == nil {
+				continue
+			}
+			var media Media
+			if err := json.Unmarshal(data, &media); err != nil {
+				continue
+			}
+			if media.DeletedAt == nil {
+				result = append(result, &media)
+			}
 		}
-	}
-	return result, nil
+		return nil
+	})
+	return result, err
 }
 
 // === Trash операции ===
 
+// SetTrashDir включает перемещение файлов удалённых медиа в директорию dir
+// внутри их медиа-корня ("" — файлы остаются на месте)
+func (s *Store) SetTrashDir(dir string) {
+	s.trashDir = dir
+}
+
+// trashFile перемещает файл медиа в корзину на диске и обновляет Path.
+// Отсутствующий файл (удалён с диска) не перемещается.
+func (s *Store) trashFile(m *Media) error {
+	if s.trashDir == "" || m.TrashedFrom != "" || m.RelPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(m.Path); err != nil {
+		return nil
+	}
+
+	root := strings.TrimSuffix(m.Path, m.RelPath)
+	if root == m.Path {
+		return nil // Путь не соответствует RelPath — корень не определить
+	}
+	dest := filepath.Join(root, s.trashDir, m.RelPath)
+	if _, err := os.Stat(dest); err == nil {
+		// В корзине уже есть файл с таким путём (удалён ранее и заменён новым)
+		ext := filepath.Ext(dest)
+		dest = strings.TrimSuffix(dest, ext) + "_" + m.ID[:minSlugLength] + ext
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create trash directory: %w", err)
+	}
+	if err := os.Rename(m.Path, dest); err != nil {
+		return fmt.Errorf("failed to move file to trash: %w", err)
+	}
+	m.TrashedFrom = m.Path
+	m.Path = dest
+	return nil
+}
+
+// restoreFile возвращает файл из корзины на диске на исходное место
+func (s *Store) restoreFile(m *Media) error {
+	if m.TrashedFrom == "" {
+		return nil
+	}
+	if _, err := os.Stat(m.TrashedFrom); err == nil {
+		return fmt.Errorf("file already exists: %s", m.TrashedFrom)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.TrashedFrom), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.Rename(m.Path, m.TrashedFrom); err != nil {
+		return fmt.Errorf("failed to restore file from trash: %w", err)
+	}
+	m.Path = m.TrashedFrom
+	m.TrashedFrom = ""
+	return nil
+}
+
 // SoftDeleteMedia помечает медиа как удалённое
 func (s *Store) SoftDeleteMedia(id string) error {
 	media, err := s.GetMedia(id)
@@ -1307,15 +3488,18 @@ func (s *Store) SoftDeleteMedia(id string) error {
 		return fmt.Errorf("media not found")
 	}
 
+	if err := s.trashFile(media); err != nil {
+		return err
+	}
 	now := time.Now()
-	media.DeletedAt = &now
 
-	return s.db.Update(func(tx *bolt.Tx) error {
-		data, err := json.Marshal(media)
-		if err != nil {
-			return err
+	return s.updateTrashState(id, func(cur *Media) bool {
+		if cur.DeletedAt != nil {
+			return false // Уже в корзине
 		}
-		return tx.Bucket(bucketMedia).Put([]byte(media.ID), data)
+		cur.Path, cur.TrashedFrom = media.Path, media.TrashedFrom
+		cur.DeletedAt = &now
+		return true
 	})
 }
 
@@ -1332,14 +3516,49 @@ func (s *Store) RestoreMedia(id string) error {
 		return nil
 	}
 
-	media.DeletedAt = nil
+	if err := s.restoreFile(media); err != nil {
+		return err
+	}
+
+	return s.updateTrashState(id, func(cur *Media) bool {
+		if cur.DeletedAt == nil {
+			return false // Уже восстановлено
+		}
+		cur.Path, cur.TrashedFrom = media.Path, media.TrashedFrom
+		cur.DeletedAt = nil
+		return true
+	})
+}
 
+// updateTrashState перечитывает запись в той же транзакции, где правятся счетчики:
+// prev для updateStats берется из БД, а не из копии, прочитанной до перемещения файла.
+// apply меняет запись и возвращает false, если менять нечего.
+func (s *Store) updateTrashState(id string, apply func(cur *Media) bool) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
-		data, err := json.Marshal(media)
+		s.touchNav(tx)
+		b := tx.Bucket(bucketMedia)
+		data := b.Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("media not found")
+		}
+		var prev Media
+		if err := json.Unmarshal(data, &prev); err != nil {
+			return err
+		}
+		next := prev
+		if !apply(&next) {
+			return nil
+		}
+
+		data, err := json.Marshal(&next)
 		if err != nil {
 			return err
 		}
-		return tx.Bucket(bucketMedia).Put([]byte(media.ID), data)
+		if err := updateStats(tx, &prev, &next); err != nil {
+			return err
+		}
+		s.trackImageHash(tx, &prev, &next)
+		return b.Put([]byte(id), data)
 	})
 }
 
@@ -1362,8 +3581,10 @@ func (s *Store) ListTrashMedia() ([]*Media, error) {
 	return result, err
 }
 
-// CleanupTrash удаляет медиа из корзины старше указанного времени
-func (s *Store) CleanupTrash(olderThan time.Duration) (int, error) {
+// CleanupTrash удаляет медиа из корзины старше указанного времени.
+// purge (если задан) вызывается перед удалением записи, например для удаления файла с диска;
+// при ошибке запись остается в корзине.
+func (s *Store) CleanupTrash(olderThan time.Duration, purge func(*Media) error) (int, error) {
 	trashMedia, err := s.ListTrashMedia()
 	if err != nil {
 		return 0, err
@@ -1374,6 +3595,12 @@ func (s *Store) CleanupTrash(olderThan time.Duration) (int, error) {
 
 	for _, m := range trashMedia {
 		if m.DeletedAt != nil && m.DeletedAt.Before(cutoff) {
+			if purge != nil {
+				if err := purge(m); err != nil {
+					logger.InfoLog.Printf("Error purging media %s: %v", m.ID, err)
+					continue
+				}
+			}
 			if err := s.DeleteMedia(m.ID); err != nil {
 				logger.InfoLog.Printf("Error permanently deleting media %s: %v", m.ID, err)
 				continue
@@ -1402,16 +3629,78 @@ func (s *Store) GetTrashStats() (count int, totalSize int64, err error) {
 
 // === Duplicates операции ===
 
+// DuplicateScope ограничивает группировку визуально похожих медиа.
+// Глобальное сравнение pHash склеивает разные снимки одной достопримечательности,
+// поэтому можно требовать совпадения камеры и/или близости дат съёмки.
+// Точные дубликаты (SHA256) не ограничиваются.
+type DuplicateScope struct {
+	SameCamera   bool // Только медиа с одной и той же камеры
+	MaxDays      int  // Только медиа, снятые в пределах N дней (0 = без ограничения)
+	MinDimension int  // Не сравнивать изображения, у которых короткая сторона меньше N px (иконки, спрайты)
+}
+
+// allows проверяет, могут ли два медиа считаться похожими в рамках scope
+func (sc DuplicateScope) allows(a, b *Media) bool {
+	if sc.tooSmall(a) || sc.tooSmall(b) {
+		return false
+	}
+	if sc.SameCamera && !strings.EqualFold(a.Metadata.Camera, b.Metadata.Camera) {
+		return false
+	}
+	if sc.MaxDays > 0 {
+		diff := mediaDate(a).Sub(mediaDate(b))
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > time.Duration(sc.MaxDays)*24*time.Hour {
+			return false
+		}
+	}
+	return true
+}
+
+// tooSmall проверяет, что изображение меньше MinDimension по короткой стороне.
+// Медиа с неизвестными размерами не отсекаются.
+func (sc DuplicateScope) tooSmall(m *Media) bool {
+	if sc.MinDimension <= 0 || m.Width == 0 || m.Height == 0 {
+		return false
+	}
+	return min(m.Width, m.Height) < sc.MinDimension
+}
+
+// mediaDate возвращает дату съёмки или дату модификации, если EXIF-даты нет
+func mediaDate(m *Media) time.Time {
+	return m.Date()
+}
+
+// mediaDateKey ключ индекса по дате (YYYY-MM), тот же период, что в хронологии
+func mediaDateKey(m *Media) string {
+	return mediaDate(m).Format("2006-01")
+}
+
+// DuplicateLimits ограничивает поиск дубликатов на больших библиотеках; нулевые значения — без ограничений
+type DuplicateLimits struct {
+	MaxGroups int           // Сколько групп возвращать не больше
+	Timeout   time.Duration // Сколько времени искать похожие, после — вернуть найденное
+}
+
+// duplicateDeadlineCheck как часто (в изображениях) проверять время поиска похожих
+const duplicateDeadlineCheck = 256
+
 // FindDuplicates находит дубликаты медиа
-// Возвращает группы: exact (по SHA256) и similar (по perceptual hash)
-func (s *Store) FindDuplicates(similarityThreshold int) ([]*DuplicateGroup, error) {
+// Возвращает группы: exact (по SHA256) и similar (по perceptual hash).
+// truncated — поиск остановлен по limits и групп на самом деле может быть больше.
+func (s *Store) FindDuplicates(similarityThreshold int, scope DuplicateScope, limits DuplicateLimits) (groups []*DuplicateGroup, truncated bool, err error) {
+	var deadline time.Time
+	if limits.Timeout > 0 {
+		deadline = time.Now().Add(limits.Timeout)
+	}
+
 	allMedia, err := s.ListAllMedia()
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	var groups []*DuplicateGroup
-
 	// 1. Точные дубликаты по SHA256
 	checksumGroups := make(map[string][]*Media)
 	for _, m := range allMedia {
@@ -1430,85 +3719,94 @@ func (s *Store) FindDuplicates(similarityThreshold int) ([]*DuplicateGroup, erro
 		}
 	}
 
-	// 2. Похожие по perceptual hash (только изображения с ImageHash)
-	// Группируем по размеру файла сначала для оптимизации
-	sizeGroups := make(map[int64][]*Media)
-	for _, m := range allMedia {
-		if m.ImageHash != 0 && (m.Type == MediaTypeImage || m.Type == MediaTypeRaw) {
-			sizeGroups[m.Size] = append(sizeGroups[m.Size], m)
+	// 2. Похожие по perceptual hash (только изображения с ImageHash), кроме уже найденных точных копий
+	inExactGroup := make(map[string]bool)
+	for _, g := range groups {
+		for _, m := range g.Media {
+			inExactGroup[m.ID] = true
 		}
 	}
 
-	// Для файлов с разным размером но похожим содержимым
 	var imagesWithHash []*Media
+	position := make(map[string]int) // ID -> индекс в imagesWithHash
 	for _, m := range allMedia {
-		if m.ImageHash != 0 && (m.Type == MediaTypeImage || m.Type == MediaTypeRaw) {
-			// Проверяем, что это не уже найденный точный дубликат
-			isExact := false
-			for _, g := range groups {
-				if g.Type == "exact" {
-					for _, em := range g.Media {
-						if em.ID == m.ID {
-							isExact = true
-							break
-						}
-					}
-				}
-				if isExact {
-					break
-				}
-			}
-			if !isExact {
-				imagesWithHash = append(imagesWithHash, m)
-			}
+		if m.ImageHash != 0 && (m.Type == MediaTypeImage || m.Type == MediaTypeRaw) && !inExactGroup[m.ID] {
+			position[m.ID] = len(imagesWithHash)
+			imagesWithHash = append(imagesWithHash, m)
 		}
 	}
 
-	// Находим похожие изображения
+	// Находим похожие изображения: кандидаты из BK-дерева вместо сравнения каждого с каждым.
+	// Группа — первое необработанное изображение и все следующие за ним в пределах порога.
 	processed := make(map[string]bool)
 	for i, m1 := range imagesWithHash {
+		if !deadline.IsZero() && i%duplicateDeadlineCheck == 0 && time.Now().After(deadline) {
+			truncated = true
+			break
+		}
 		if processed[m1.ID] {
 			continue
 		}
 
-		var similarGroup []*Media
-		similarGroup = append(similarGroup, m1)
+		similarGroup := []*Media{m1}
 		processed[m1.ID] = true
+		maxDistance := 0
 
-		for j := i + 1; j < len(imagesWithHash); j++ {
-			m2 := imagesWithHash[j]
-			if processed[m2.ID] {
-				continue
+		var candidates []int
+		for _, id := range s.FindSimilar(m1.ImageHash, similarityThreshold) {
+			if j, ok := position[id]; ok && j > i && !processed[id] {
+				candidates = append(candidates, j)
 			}
+		}
+		sort.Ints(candidates)
 
-			distance := hammingDistance(m1.ImageHash, m2.ImageHash)
-			if distance <= similarityThreshold {
-				similarGroup = append(similarGroup, m2)
-				processed[m2.ID] = true
+		for _, j := range candidates {
+			m2 := imagesWithHash[j]
+			if !scope.allows(m1, m2) {
+				continue
 			}
+			similarGroup = append(similarGroup, m2)
+			processed[m2.ID] = true
+			maxDistance = max(maxDistance, hammingDistance(m1.ImageHash, m2.ImageHash))
 		}
 
 		if len(similarGroup) > 1 {
+			// Лимит отмечается, только когда найдена лишняя группа
+			if limits.MaxGroups > 0 && len(groups) >= limits.MaxGroups {
+				truncated = true
+				break
+			}
 			groups = append(groups, &DuplicateGroup{
 				Type:     "similar",
 				Media:    similarGroup,
-				Distance: similarityThreshold,
+				Distance: maxDistance,
 			})
 		}
 	}
 
-	return groups, nil
+	// Постоянный порядок групп, чтобы страницы результатов не перемешивались:
+	// сначала точные копии, затем похожие по возрастанию расстояния
+	sort.SliceStable(groups, func(i, j int) bool {
+		gi, gj := groups[i], groups[j]
+		if gi.Type != gj.Type {
+			return gi.Type == "exact"
+		}
+		if gi.Distance != gj.Distance {
+			return gi.Distance < gj.Distance
+		}
+		return gi.Media[0].ID < gj.Media[0].ID
+	})
+
+	if limits.MaxGroups > 0 && len(groups) > limits.MaxGroups {
+		groups = groups[:limits.MaxGroups]
+		truncated = true
+	}
+	return groups, truncated, nil
 }
 
 // hammingDistance вычисляет расстояние Хэмминга между двумя хешами
 func hammingDistance(hash1, hash2 uint64) int {
-	xor := hash1 ^ hash2
-	distance := 0
-	for xor != 0 {
-		distance++
-		xor &= xor - 1
-	}
-	return distance
+	return bits.OnesCount64(hash1 ^ hash2)
 }
 
 // ChecksumExists проверяет, существует ли медиа с таким же checksum
@@ -1586,12 +3884,15 @@ type DuplicateCheckResult struct {
 // CheckDuplicate выполняет гибридную проверку на дубликат:
 // 1. Фильтр по размеру (±10%) + SHA256 для точных дубликатов
 // 2. pHash для визуально похожих (проверяет ВСЕ изображения, без фильтра по размеру)
-func (s *Store) CheckDuplicate(size int64, checksum string, imageHash uint64, isImage bool, similarityThreshold int) (*DuplicateCheckResult, error) {
+// scope ограничивает шаг 2 медиа с той же камеры и/или близкой датой съёмки
+func (s *Store) CheckDuplicate(candidate *Media, isImage bool, similarityThreshold int, scope DuplicateScope) (*DuplicateCheckResult, error) {
 	result := &DuplicateCheckResult{IsDuplicate: false}
+	checksum := candidate.Checksum
+	imageHash := candidate.ImageHash
 
 	// Шаг 1: Точные дубликаты — фильтр по размеру (±10%) + SHA256
 	if checksum != "" {
-		candidates, err := s.FindMediaBySizeRange(size)
+		candidates, err := s.FindMediaBySizeRange(candidate.Size)
 		if err != nil {
 			return nil, err
 		}
@@ -1606,24 +3907,25 @@ func (s *Store) CheckDuplicate(size int64, checksum string, imageHash uint64, is
 		}
 	}
 
-	// Шаг 2: Визуально похожие — pHash по ВСЕМ изображениям (мессенджеры пережимают фото)
+	// Шаг 2: Визуально похожие — pHash по ВСЕМ изображениям (мессенджеры пережимают фото).
+	// Кандидаты в пределах порога берутся из BK-дерева, а не полным перебором
 	if isImage && imageHash != 0 {
-		allMedia, err := s.ListAllMedia()
-		if err != nil {
-			return nil, err
-		}
-		for _, m := range allMedia {
-			if m.ImageHash == 0 {
+		for _, id := range s.FindSimilar(imageHash, similarityThreshold) {
+			if id == candidate.ID {
 				continue
 			}
-			distance := hammingDistance(imageHash, m.ImageHash)
-			if distance <= similarityThreshold {
-				result.IsDuplicate = true
-				result.Type = "similar"
-				result.ExistingID = m.ID
-				result.Distance = distance
-				return result, nil
+			m, err := s.GetMedia(id)
+			if err != nil {
+				return nil, err
 			}
+			if m == nil || m.DeletedAt != nil || !scope.allows(candidate, m) {
+				continue
+			}
+			result.IsDuplicate = true
+			result.Type = "similar"
+			result.ExistingID = m.ID
+			result.Distance = hammingDistance(imageHash, m.ImageHash)
+			return result, nil
 		}
 	}
 
@@ -1631,8 +3933,8 @@ func (s *Store) CheckDuplicate(size int64, checksum string, imageHash uint64, is
 }
 
 // GetDuplicatesStats возвращает статистику дубликатов
-func (s *Store) GetDuplicatesStats() (exactCount int, similarCount int, savedSpace int64, err error) {
-	groups, err := s.FindDuplicates(10)
+func (s *Store) GetDuplicatesStats(scope DuplicateScope) (exactCount int, similarCount int, savedSpace int64, err error) {
+	groups, _, err := s.FindDuplicates(10, scope, DuplicateLimits{})
 	if err != nil {
 		return 0, 0, 0, err
 	}
@@ -1652,6 +3954,63 @@ func (s *Store) GetDuplicatesStats() (exactCount int, similarCount int, savedSpa
 	return exactCount, similarCount, savedSpace, nil
 }
 
+// === Публичные ссылки на альбомы ===
+
+// SaveShareLink сохраняет публичную ссылку
+func (s *Store) SaveShareLink(link *ShareLink) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(link)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketShares).Put([]byte(link.Token), data)
+	})
+}
+
+// GetShareLink получает публичную ссылку по токену
+func (s *Store) GetShareLink(token string) (*ShareLink, error) {
+	var link ShareLink
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketShares).Get([]byte(token))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &link)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if link.Token == "" {
+		return nil, nil
+	}
+	return &link, nil
+}
+
+// DeleteShareLink отзывает публичную ссылку
+func (s *Store) DeleteShareLink(token string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketShares).Delete([]byte(token))
+	})
+}
+
+// ListAlbumShareLinks возвращает все ссылки на альбом
+func (s *Store) ListAlbumShareLinks(albumID string) ([]*ShareLink, error) {
+	var result []*ShareLink
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketShares).ForEach(func(k, v []byte) error {
+			var link ShareLink
+			if err := json.Unmarshal(v, &link); err != nil {
+				return nil
+			}
+			if link.AlbumID == albumID {
+				result = append(result, &link)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
 // === API Token операции ===
 
 // SaveAPIToken сохраняет API токен
@@ -1691,7 +4050,7 @@ func (s *Store) DeleteAPIToken(token string) error {
 	})
 }
 
-// ListUserAPITokens возвращает все токены пользователя
+// ListUserAPITokens возвращает действующие токены пользователя
 func (s *Store) ListUserAPITokens(userID string) ([]*APIToken, error) {
 	var result []*APIToken
 	err := s.db.View(func(tx *bolt.Tx) error {
@@ -1701,7 +4060,7 @@ func (s *Store) ListUserAPITokens(userID string) ([]*APIToken, error) {
 			if err := json.Unmarshal(v, &token); err != nil {
 				return nil
 			}
-			if token.UserID == userID {
+			if token.UserID == userID && !token.Expired() {
 				result = append(result, &token)
 			}
 			return nil
@@ -1709,3 +4068,31 @@ func (s *Store) ListUserAPITokens(userID string) ([]*APIToken, error) {
 	})
 	return result, err
 }
+
+// === Очередь задач ===
+
+// SaveQueuedTask сохраняет задачу персистентной очереди (key — ключ дедупликации)
+func (s *Store) SaveQueuedTask(key string, data []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTaskQueue).Put([]byte(key), data)
+	})
+}
+
+// DeleteQueuedTask удаляет выполненную задачу из очереди
+func (s *Store) DeleteQueuedTask(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTaskQueue).Delete([]byte(key))
+	})
+}
+
+// ListQueuedTasks возвращает все незавершенные задачи: key -> данные задачи
+func (s *Store) ListQueuedTasks() (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTaskQueue).ForEach(func(k, v []byte) error {
+			result[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	return result, err
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bkNode узел BK-дерева: медиа с одинаковым pHash и потомки по расстоянию Хэмминга до него
+type bkNode struct {
+	hash     uint64
+	ids      []string
+	children []bkEdge // У большинства узлов потомков единицы, массив на 65 расстояний только мешал бы кешу
+}
+
+// bkEdge ссылка на потомка, находящегося на расстоянии dist от узла
+type bkEdge struct {
+	dist int32
+	node int32 // Индекс в hashIndex.nodes
+}
+
+// child индекс потомка на расстоянии dist (0 = нет)
+func (n *bkNode) child(dist int) int32 {
+	for _, e := range n.children {
+		if int(e.dist) == dist {
+			return e.node
+		}
+	}
+	return 0
+}
+
+// hashIndex BK-дерево pHash неудалённых медиа для поиска похожих без полного перебора.
+// Поиск с порогом t заходит только в потомков на расстоянии [d-t, d+t] от узла
+// (неравенство треугольника для метрики Хэмминга).
+// Удаление ленивое: ID убирается из узла, пустой узел остаётся для маршрутизации.
+type hashIndex struct {
+	mu     sync.RWMutex
+	nodes  []bkNode          // nodes[0] — корень; потомки ссылаются по индексу
+	hashes map[string]uint64 // ID медиа -> pHash в дереве
+}
+
+func newHashIndex() *hashIndex {
+	return &hashIndex{hashes: make(map[string]uint64)}
+}
+
+// indexedHash учитывается ли медиа в индексе похожих
+func indexedHash(m *Media) bool {
+	return m != nil && m.DeletedAt == nil && m.ImageHash != 0
+}
+
+// set добавляет медиа в дерево или переносит его под новый хеш
+func (x *hashIndex) set(id string, hash uint64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if old, ok := x.hashes[id]; ok {
+		if old == hash {
+			return
+		}
+		x.removeLocked(id, old)
+	}
+	x.hashes[id] = hash
+
+	if len(x.nodes) == 0 {
+		x.nodes = append(x.nodes, bkNode{hash: hash, ids: []string{id}})
+		return
+	}
+	for i := 0; ; {
+		node := &x.nodes[i]
+		d := hammingDistance(node.hash, hash)
+		if d == 0 {
+			node.ids = append(node.ids, id)
+			return
+		}
+		child := node.child(d)
+		if child == 0 {
+			node.children = append(node.children, bkEdge{dist: int32(d), node: int32(len(x.nodes))})
+			x.nodes = append(x.nodes, bkNode{hash: hash, ids: []string{id}})
+			return
+		}
+		i = int(child)
+	}
+}
+
+// remove убирает медиа из дерева
+func (x *hashIndex) remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if hash, ok := x.hashes[id]; ok {
+		x.removeLocked(id, hash)
+	}
+}
+
+// removeLocked убирает ID из узла с хешем hash. Вызывается под x.mu.
+func (x *hashIndex) removeLocked(id string, hash uint64) {
+	delete(x.hashes, id)
+	if len(x.nodes) == 0 {
+		return
+	}
+	for i := 0; ; {
+		node := &x.nodes[i]
+		d := hammingDistance(node.hash, hash)
+		if d == 0 {
+			if j := slices.Index(node.ids, id); j >= 0 {
+				node.ids = slices.Delete(node.ids, j, j+1)
+			}
+			return
+		}
+		child := node.child(d)
+		if child == 0 {
+			return
+		}
+		i = int(child)
+	}
+}
+
+// find возвращает ID медиа с расстоянием до hash не больше threshold
+func (x *hashIndex) find(hash uint64, threshold int) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if len(x.nodes) == 0 {
+		return nil
+	}
+
+	var result []string
+	stack := []int32{0}
+	for len(stack) > 0 {
+		node := &x.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+
+		d := hammingDistance(node.hash, hash)
+		if d <= threshold {
+			result = append(result, node.ids...)
+		}
+		for _, e := range node.children {
+			if int(e.dist) >= d-threshold && int(e.dist) <= d+threshold {
+				stack = append(stack, e.node)
+			}
+		}
+	}
+	return result
+}
+
+// load заполняет дерево из bucket медиа (при открытии хранилища)
+func (x *hashIndex) load(tx *bolt.Tx) error {
+	return tx.Bucket(bucketMedia).ForEach(func(k, v []byte) error {
+		var media Media
+		if err := json.Unmarshal(v, &media); err != nil {
+			return nil
+		}
+		if indexedHash(&media) {
+			x.set(media.ID, media.ImageHash)
+		}
+		return nil
+	})
+}
+
+// trackImageHash обновляет дерево после фиксации транзакции, изменившей запись prev -> next
+// (nil — записи нет), чтобы откат транзакции не рассинхронизировал индекс
+func (s *Store) trackImageHash(tx *bolt.Tx, prev, next *Media) {
+	tx.OnCommit(func() {
+		if prev != nil && (next == nil || prev.ID != next.ID) {
+			s.hashes.remove(prev.ID)
+		}
+		if next == nil {
+			return
+		}
+		if indexedHash(next) {
+			s.hashes.set(next.ID, next.ImageHash)
+		} else {
+			s.hashes.remove(next.ID)
+		}
+	})
+}
+
+// FindSimilar возвращает ID неудалённых медиа, pHash которых отличается от hash
+// не больше чем на threshold бит (по возрастанию ID)
+func (s *Store) FindSimilar(hash uint64, threshold int) []string {
+	ids := s.hashes.find(hash, threshold)
+	slices.Sort(ids)
+	return ids
+}
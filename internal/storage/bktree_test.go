@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// randomHashes n хешей группами: центры и их копии с несколькими измененными битами
+func randomHashes(rnd *rand.Rand, n int) map[string]uint64 {
+	hashes := make(map[string]uint64, n)
+	var center uint64
+	for i := 0; i < n; i++ {
+		if i%8 == 0 {
+			center = rnd.Uint64()
+		}
+		h := center
+		for flips := rnd.Intn(12); flips > 0; flips-- {
+			h ^= 1 << rnd.Intn(64)
+		}
+		hashes[fmt.Sprintf("media-%06d", i)] = h
+	}
+	return hashes
+}
+
+// linearSimilar эталон: перебор всех хешей
+func linearSimilar(hashes map[string]uint64, hash uint64, threshold int) []string {
+	var ids []string
+	for id, h := range hashes {
+		if bits.OnesCount64(h^hash) <= threshold {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestHashIndexMatchesLinearScan(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	hashes := randomHashes(rnd, 5000)
+	x := newHashIndex()
+	for id, h := range hashes {
+		x.set(id, h)
+	}
+
+	// Удаление и перенос под другой хеш тоже должны давать те же результаты
+	removed := 0
+	for id := range hashes {
+		switch {
+		case removed < 300:
+			x.remove(id)
+			delete(hashes, id)
+		case removed < 600:
+			hashes[id] = rnd.Uint64()
+			x.set(id, hashes[id])
+		default:
+		}
+		removed++
+		if removed >= 600 {
+			break
+		}
+	}
+
+	ids := make([]string, 0, len(hashes))
+	for id := range hashes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for q := 0; q < 200; q++ {
+		query := hashes[ids[rnd.Intn(len(ids))]] ^ (1 << rnd.Intn(64))
+		if q%4 == 0 {
+			query = rnd.Uint64() // Запросы вдали от всех групп
+		}
+		for _, threshold := range []int{0, 3, 10} {
+			got := x.find(query, threshold)
+			slices.Sort(got)
+			want := linearSimilar(hashes, query, threshold)
+			if !slices.Equal(got, want) {
+				t.Fatalf("find(%x, %d) = %d ids, linear scan %d", query, threshold, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestFindSimilarSkipsTrash(t *testing.T) {
+	s := newTestStore(t)
+	a := addMedia(t, s, "a.jpg", day(2023, time.May, 1), func(m *Media) { m.ImageHash = 0xFF00FF00FF00FF00 })
+	b := addMedia(t, s, "b.jpg", day(2023, time.May, 2), func(m *Media) { m.ImageHash = 0xFF00FF00FF00FF01 })
+
+	if got := s.FindSimilar(0xFF00FF00FF00FF00, 2); !slices.Equal(got, sortedIDs(a.ID, b.ID)) {
+		t.Fatalf("FindSimilar = %v, want both", got)
+	}
+	if err := s.SoftDeleteMedia(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.FindSimilar(0xFF00FF00FF00FF00, 2); !slices.Equal(got, []string{a.ID}) {
+		t.Errorf("FindSimilar after trash = %v, want only a", got)
+	}
+	if err := s.RestoreMedia(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.FindSimilar(0xFF00FF00FF00FF00, 2); len(got) != 2 {
+		t.Errorf("FindSimilar after restore = %v, want both", got)
+	}
+}
+
+func sortedIDs(ids ...string) []string {
+	slices.Sort(ids)
+	return ids
+}
+
+// benchmarkStore хранилище с 50k изображений (записаны одной транзакцией) и запросы к ним
+func benchmarkStore(b *testing.B) (*Store, []uint64) {
+	s := newTestStore(b)
+	rnd := rand.New(rand.NewSource(2))
+	hashes := randomHashes(rnd, 50000)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketMedia)
+		for id, h := range hashes {
+			data, err := json.Marshal(&Media{ID: id, Path: "/library/" + id + ".jpg", Type: MediaTypeImage, ImageHash: h})
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(id), data); err != nil {
+				return err
+			}
+			s.hashes.set(id, h)
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	queries := make([]uint64, 0, 256)
+	for _, h := range hashes {
+		queries = append(queries, h^(1<<rnd.Intn(64)))
+		if len(queries) == cap(queries) {
+			break
+		}
+	}
+	return s, queries
+}
+
+// Поиск похожих по BK-дереву против прежнего перебора всех записей медиа
+func BenchmarkFindSimilar(b *testing.B) {
+	s, queries := benchmarkStore(b)
+	for _, threshold := range []int{5, 10} {
+		b.Run(fmt.Sprintf("bktree/threshold=%d", threshold), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s.FindSimilar(queries[i%len(queries)], threshold)
+			}
+		})
+		b.Run(fmt.Sprintf("linear/threshold=%d", threshold), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				linearScanStore(b, s, queries[i%len(queries)], threshold)
+			}
+		})
+	}
+}
+
+// linearScanStore перебор всех медиа с чтением записей, как до BK-дерева
+func linearScanStore(tb testing.TB, s *Store, hash uint64, threshold int) []string {
+	var ids []string
+	err := s.IterateMedia(func(m *Media) bool {
+		if m.ImageHash != 0 && hammingDistance(m.ImageHash, hash) <= threshold {
+			ids = append(ids, m.ID)
+		}
+		return true
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return ids
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestListCamerasCounts(t *testing.T) {
+	s := newTestStore(t)
+	camera := func(name string) func(*Media) {
+		return func(m *Media) { m.Metadata.Camera = name }
+	}
+	addMedia(t, s, "a.jpg", day(2023, time.May, 1), camera("Canon EOS R"))
+	addMedia(t, s, "b.jpg", day(2023, time.May, 2), camera("Canon EOS R"))
+	addMedia(t, s, "c.jpg", day(2023, time.May, 3), camera("Canon EOS R"))
+	phone := addMedia(t, s, "d.jpg", day(2023, time.May, 4), camera("iPhone 13"))
+	trashed := addMedia(t, s, "e.jpg", day(2023, time.May, 5), camera("iPhone 13"))
+	addMedia(t, s, "f.jpg", day(2023, time.May, 6), nil) // Без камеры не учитывается
+
+	if err := s.SoftDeleteMedia(trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	cameras, err := s.ListCameras()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cameras) != 2 {
+		t.Fatalf("cameras = %d, want 2", len(cameras))
+	}
+	if cameras[0].Camera != "Canon EOS R" || cameras[0].MediaCount != 3 {
+		t.Errorf("first camera = %+v, want Canon EOS R with 3", cameras[0])
+	}
+	if cameras[1].Camera != "iPhone 13" || cameras[1].MediaCount != 1 {
+		t.Errorf("second camera = %+v, want iPhone 13 with 1 (trash excluded)", cameras[1])
+	}
+
+	// Смена камеры переносит медиа между счетчиками, индекс тоже обновляется
+	phone.Metadata.Camera = "Canon EOS R"
+	if err := s.SaveMedia(phone); err != nil {
+		t.Fatal(err)
+	}
+	if got := cameraCount(t, s, "Canon EOS R"); got != 4 {
+		t.Errorf("Canon count after edit = %d, want 4", got)
+	}
+	if got := cameraCount(t, s, "iPhone 13"); got != 0 {
+		t.Errorf("iPhone count after edit = %d, want 0", got)
+	}
+	media, err := s.ListMediaByCamera("Canon EOS R")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(media) != 4 {
+		t.Errorf("ListMediaByCamera = %d media, want 4", len(media))
+	}
+}
+
+func TestCameraIndexMaintenance(t *testing.T) {
+	s := newTestStore(t)
+	a := addMedia(t, s, "a.jpg", day(2023, time.May, 1), func(m *Media) { m.Metadata.Camera = "Nikon Z6" })
+	b := addMedia(t, s, "b.jpg", day(2023, time.May, 2), func(m *Media) { m.Metadata.Camera = "Nikon Z6" })
+
+	if err := s.DeleteMedia(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	media, err := s.ListMediaByCamera("Nikon Z6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(media) != 1 || media[0].ID != b.ID {
+		t.Errorf("camera index after delete = %v, want only b.jpg", media)
+	}
+	if got := cameraCount(t, s, "Nikon Z6"); got != 1 {
+		t.Errorf("camera count after delete = %d, want 1", got)
+	}
+
+	// Запись в обход SaveMedia не попадает в индекс: ListCameras (список камер SearchPage)
+	// читает счетчики, а не перебирает все медиа
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(&Media{ID: "ghost", Path: "/library/ghost.jpg", Metadata: Metadata{Camera: "Ghost"}})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketMedia).Put([]byte("ghost"), data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cameraCount(t, s, "Ghost"); got != 0 {
+		t.Errorf("ListCameras found a camera outside the index (count %d): it scans all media", got)
+	}
+}
+
+func TestNormalizeLensName(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"RF24 - 70 mm  F/2.8L", "RF24-70mm f/2.8L"},
+		{"  EF50mm f/1.8 STM ", "EF50mm f/1.8 STM"},
+		{"----", ""},
+		{"Unknown", ""},
+		{"0mm f/0", ""},
+		{" -- ", ""},
+	} {
+		if got := NormalizeLensName(tc.in); got != tc.want {
+			t.Errorf("NormalizeLensName(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestGearStatsGroupsShots(t *testing.T) {
+	s := newTestStore(t)
+	shot := func(name, camera, lens, focal, aperture string) {
+		addMedia(t, s, name, day(2023, time.May, 1), func(m *Media) {
+			m.Metadata.Camera, m.Metadata.Lens = camera, lens
+			m.Metadata.FocalLength, m.Metadata.Aperture = focal, aperture
+		})
+	}
+	shot("a.jpg", "Canon EOS R", "RF24-70mm F2.8", "50mm", "f/2.8")
+	shot("b.jpg", "Canon  EOS R", "RF24 - 70 mm F2.8", "24mm", "f/2.8") // Тот же объектив в другом написании
+	shot("c.jpg", "Nikon Z6", "----", "50mm", "f/4")
+	shot("d.jpg", "", "", "35mm", "f/8") // Без камеры и объектива не учитывается
+
+	stats, err := s.GetGearStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := func(counts []*GearCount) []string {
+		var out []string
+		for _, c := range counts {
+			out = append(out, fmt.Sprintf("%s:%d", c.Name, c.Count))
+		}
+		return out
+	}
+	if stats.TotalShots != 3 {
+		t.Errorf("total shots = %d, want 3", stats.TotalShots)
+	}
+	for _, tc := range []struct {
+		name string
+		got  []*GearCount
+		want string
+	}{
+		{"cameras", stats.Cameras, "[Canon EOS R:2 Nikon Z6:1]"},
+		{"lenses", stats.Lenses, "[RF24-70mm F2.8:2]"},
+		{"focal lengths", stats.FocalLengths, "[50mm:2 24mm:1]"},
+		{"apertures", stats.Apertures, "[f/2.8:2 f/4:1]"},
+	} {
+		if got := fmt.Sprint(groups(tc.got)); got != tc.want {
+			t.Errorf("%s = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
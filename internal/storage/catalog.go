@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// catalogVersion версия формата экспорта каталога
+const catalogVersion = 1
+
+// Типы записей каталога
+const (
+	catalogRecordHeader    = "catalog"
+	catalogRecordMedia     = "media"
+	catalogRecordAlbum     = "album"
+	catalogRecordTag       = "tag"
+	catalogRecordFavorites = "favorites"
+)
+
+// ErrCatalogFormat файл не является экспортом каталога или его версия новее поддерживаемой
+var ErrCatalogFormat = errors.New("invalid catalog format")
+
+// catalogRecord строка экспорта (NDJSON): тип и содержимое записи
+type catalogRecord struct {
+	Type string `json:"type"`
+
+	// catalog
+	Version    int        `json:"version,omitempty"`
+	ExportedAt *time.Time `json:"exported_at,omitempty"`
+
+	Media *Media `json:"media,omitempty"`
+	Album *Album `json:"album,omitempty"`
+	Tag   *Tag   `json:"tag,omitempty"`
+
+	// favorites: избранное пользователя. Пользователь указывается по имени —
+	// ID, пароли и токены не экспортируются, а при переносе ID пользователей другие.
+	Username string   `json:"username,omitempty"`
+	MediaIDs []string `json:"media_ids,omitempty"`
+}
+
+// catalogPageSize сколько записей читается за одну транзакцию экспорта
+const catalogPageSize = 500
+
+// ExportCatalog пишет медиа, альбомы, теги и избранное пользователей в w
+// построчно в JSON (NDJSON), первой строкой — заголовок с версией формата.
+// Учетные записи, сессии, токены и ссылки не выгружаются.
+// Записи читаются страницами в коротких транзакциях и пишутся в w вне их:
+// медленный клиент не держит транзакцию чтения (и рост файла базы) на всю выгрузку.
+func (s *Store) ExportCatalog(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	now := time.Now()
+	if err := enc.Encode(&catalogRecord{Type: catalogRecordHeader, Version: catalogVersion, ExportedAt: &now}); err != nil {
+		return err
+	}
+
+	err := s.exportBucket(bucketMedia, func(v []byte) error {
+		var media Media
+		if err := json.Unmarshal(v, &media); err != nil {
+			return nil // skip invalid
+		}
+		return enc.Encode(&catalogRecord{Type: catalogRecordMedia, Media: &media})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.exportBucket(bucketAlbums, func(v []byte) error {
+		var album Album
+		if err := json.Unmarshal(v, &album); err != nil {
+			return nil
+		}
+		return enc.Encode(&catalogRecord{Type: catalogRecordAlbum, Album: &album})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.exportBucket(bucketTags, func(v []byte) error {
+		var tag Tag
+		if err := json.Unmarshal(v, &tag); err != nil {
+			return nil
+		}
+		return enc.Encode(&catalogRecord{Type: catalogRecordTag, Tag: &tag})
+	})
+	if err != nil {
+		return err
+	}
+
+	favorites, err := s.exportFavorites()
+	if err != nil {
+		return err
+	}
+	for _, record := range favorites {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportBucket вызывает fn для каждого значения bucket по порядку ключей.
+// Значения копируются страницами по catalogPageSize, fn вызывается вне транзакции.
+func (s *Store) exportBucket(bucket []byte, fn func(v []byte) error) error {
+	var after []byte
+	for {
+		var page [][]byte
+		err := s.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(bucket).Cursor()
+			k, v := c.First()
+			if after != nil {
+				if k, v = c.Seek(after); k != nil && bytes.Equal(k, after) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil && len(page) < catalogPageSize; k, v = c.Next() {
+				page = append(page, append([]byte{}, v...))
+				after = append(after[:0], k...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, v := range page {
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		if len(page) < catalogPageSize {
+			return nil
+		}
+	}
+}
+
+// exportFavorites записи избранного пользователей (по имени) для экспорта
+func (s *Store) exportFavorites() ([]*catalogRecord, error) {
+	var records []*catalogRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		usernames := make(map[string]string)
+		err := tx.Bucket(bucketUsers).ForEach(func(k, v []byte) error {
+			var user User
+			if err := json.Unmarshal(v, &user); err == nil {
+				usernames[user.ID] = user.Username
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(bucketUserFav).ForEach(func(k, v []byte) error {
+			var ids []string
+			if err := json.Unmarshal(v, &ids); err != nil || len(ids) == 0 {
+				return nil
+			}
+			username, ok := usernames[string(k)]
+			if !ok {
+				return nil // Избранное удаленного пользователя
+			}
+			records = append(records, &catalogRecord{Type: catalogRecordFavorites, Username: username, MediaIDs: ids})
+			return nil
+		})
+	})
+	return records, err
+}
+
+// ImportCatalog восстанавливает каталог из экспорта ExportCatalog одной транзакцией:
+// медиа и альбомы обновляются или создаются по ID, остальные записи базы не трогаются.
+// Счётчики тегов пересчитываются по медиа, избранное пользователей
+// заменяется для существующих пользователей с тем же именем.
+func (s *Store) ImportCatalog(r io.Reader) error {
+	dec := json.NewDecoder(r)
+
+	var header catalogRecord
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("%w: %v", ErrCatalogFormat, err)
+	}
+	if header.Type != catalogRecordHeader || header.Version < 1 || header.Version > catalogVersion {
+		return ErrCatalogFormat
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
+		userIDs := make(map[string]string) // Имя -> ID пользователя
+		err := tx.Bucket(bucketUsers).ForEach(func(k, v []byte) error {
+			var user User
+			if err := json.Unmarshal(v, &user); err == nil {
+				userIDs[user.Username] = user.ID
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		media := tx.Bucket(bucketMedia)
+		albums := tx.Bucket(bucketAlbums)
+		var imported []*Album
+		for {
+			var record catalogRecord
+			if err := dec.Decode(&record); err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("%w: %v", ErrCatalogFormat, err)
+			}
+
+			switch record.Type {
+			case catalogRecordMedia:
+				m := record.Media
+				if m == nil || m.ID == "" {
+					return fmt.Errorf("%w: media record without id", ErrCatalogFormat)
+				}
+				var prev Media
+				if data := media.Get([]byte(m.ID)); data == nil || json.Unmarshal(data, &prev) != nil {
+					prev = Media{}
+				}
+				if err := s.saveMediaTx(tx, m); err != nil {
+					return err
+				}
+				if err := syncImportedMedia(tx, &prev, m); err != nil {
+					return err
+				}
+
+			case catalogRecordAlbum:
+				album := record.Album
+				if album == nil || album.ID == "" {
+					return fmt.Errorf("%w: album record without id", ErrCatalogFormat)
+				}
+				if album.Smart {
+					album.MediaIDs = nil
+				}
+				album.MediaCount = len(album.MediaIDs)
+				data, err := json.Marshal(album)
+				if err != nil {
+					return err
+				}
+				if err := albums.Put([]byte(album.ID), data); err != nil {
+					return err
+				}
+				imported = append(imported, album)
+
+			case catalogRecordFavorites:
+				userID, ok := userIDs[record.Username]
+				if !ok {
+					continue // Такого пользователя здесь нет
+				}
+				data, err := json.Marshal(record.MediaIDs)
+				if err != nil {
+					return err
+				}
+				if err := tx.Bucket(bucketUserFav).Put([]byte(userID), data); err != nil {
+					return err
+				}
+
+			case catalogRecordTag:
+				// Счётчики тегов выводятся из медиа и пересчитываются ниже
+
+			default:
+				return fmt.Errorf("%w: unknown record type %q", ErrCatalogFormat, record.Type)
+			}
+		}
+
+		// Родители проверяются после загрузки всех альбомов: в файле они могут идти после дочерних
+		for _, album := range imported {
+			if err := checkAlbumParent(albums, album.ID, album.ParentID); err != nil {
+				return fmt.Errorf("album %s: %w", album.ID, err)
+			}
+		}
+
+		_, err = reconcileTags(tx)
+		return err
+	})
+}
+
+// syncImportedMedia обновляет то, что saveMediaTx не ведет: глобальное избранное
+// и индекс папок при смене папки (prev пустой для новых медиа)
+func syncImportedMedia(tx *bolt.Tx, prev, m *Media) error {
+	if prev.ID != "" && prev.Dir != m.Dir {
+		if err := removeFromIndex(tx, bucketIdxDir, prev.Dir, m.ID); err != nil {
+			return err
+		}
+	}
+	if m.IsFavorite && m.DeletedAt == nil {
+		return addToIndex(tx, bucketFavorites, "global", m.ID)
+	}
+	return removeFromIndex(tx, bucketFavorites, "global", m.ID)
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// addManyMedia сохраняет n медиа одной транзакцией (быстрее, чем SaveMedia по одному)
+func addManyMedia(tb testing.TB, s *Store, n int) []string {
+	tb.Helper()
+	ids := make([]string, 0, n)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for i := 0; i < n; i++ {
+			path := fmt.Sprintf("/library/bulk/%05d.jpg", i)
+			m := &Media{ID: GenerateID(path), Path: path, RelPath: path[len("/library/"):], Dir: "bulk",
+				Filename: fmt.Sprintf("%05d.jpg", i), Ext: ".jpg", Type: MediaTypeImage, Size: 1000,
+				TakenAt: day(2020, time.January, 1).Add(time.Duration(i) * time.Hour)}
+			if err := s.saveMediaTx(tx, m); err != nil {
+				return err
+			}
+			ids = append(ids, m.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return ids
+}
+
+func TestCatalogExportImportRoundTrip(t *testing.T) {
+	src := newTestStore(t)
+	// Больше двух страниц экспорта
+	bulk := addManyMedia(t, src, 2*catalogPageSize+7)
+	a := addMedia(t, src, "a.jpg", day(2023, time.May, 1), func(m *Media) { m.Metadata.Caption = "Pier" })
+	if err := src.AddTagsToMedia(a.ID, []string{"sea", "sun"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.AddTagsToMedia(bulk[0], []string{"sea"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SaveAlbum(&Album{ID: "parent", Name: "Trips"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SaveAlbum(&Album{ID: "child", Name: "Sea", ParentID: "parent", MediaIDs: []string{a.ID, bulk[1]}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SaveUser(&User{ID: "u-src", Username: "anna", PasswordHash: "secret-hash", Role: RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetUserFavorite("u-src", a.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := src.ExportCatalog(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "secret-hash") {
+		t.Fatal("export contains password hashes")
+	}
+	counts := map[string]int{}
+	lines := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	lines.Buffer(nil, 1<<20)
+	for lines.Scan() {
+		var record catalogRecord
+		if err := json.Unmarshal(lines.Bytes(), &record); err != nil {
+			t.Fatalf("line %q: %v", lines.Text(), err)
+		}
+		counts[record.Type]++
+	}
+	if counts["media"] != len(bulk)+1 || counts["album"] != 2 || counts["tag"] != 2 || counts["favorites"] != 1 || counts["catalog"] != 1 {
+		t.Fatalf("record counts = %v", counts)
+	}
+
+	dst := newTestStore(t)
+	if err := dst.SaveUser(&User{ID: "u-dst", Username: "anna", Role: RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.ImportCatalog(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	got := mustGetMedia(t, dst, a.ID)
+	if got.Metadata.Caption != "Pier" || len(got.Tags) != 2 {
+		t.Errorf("imported media = caption %q tags %v", got.Metadata.Caption, got.Tags)
+	}
+	var total int
+	if err := dst.IterateMedia(func(*Media) bool { total++; return true }); err != nil {
+		t.Fatal(err)
+	}
+	if total != len(bulk)+1 {
+		t.Errorf("imported %d media, want %d", total, len(bulk)+1)
+	}
+	child, _ := dst.GetAlbum("child")
+	if child == nil || child.ParentID != "parent" || child.MediaCount != 2 {
+		t.Errorf("imported album = %+v", child)
+	}
+	if tags := tagCounts(t, dst); tags["sea"] != 2 || tags["sun"] != 1 {
+		t.Errorf("imported tag counts = %v", tags)
+	}
+	if fav, _ := dst.IsUserFavorite("u-dst", a.ID); !fav {
+		t.Error("favorite was not mapped to the user with the same name")
+	}
+
+	// Повторный импорт того же файла не дублирует счётчики
+	if err := dst.ImportCatalog(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if tags := tagCounts(t, dst); tags["sea"] != 2 {
+		t.Errorf("tag counts after second import = %v", tags)
+	}
+}
+
+func TestImportCatalogRejectsBadFormat(t *testing.T) {
+	s := newTestStore(t)
+	for _, input := range []string{
+		"",
+		`{"type":"media","media":{"id":"x"}}`,
+		`{"type":"catalog","version":99}`,
+		"{\"type\":\"catalog\",\"version\":1}\n{\"type\":\"unknown\"}",
+	} {
+		if err := s.ImportCatalog(strings.NewReader(input)); !errors.Is(err, ErrCatalogFormat) {
+			t.Errorf("ImportCatalog(%q) = %v, want ErrCatalogFormat", input, err)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// addFileMedia создает файл root/rel и его запись
+func addFileMedia(tb testing.TB, s *Store, root, rel string) *Media {
+	tb.Helper()
+	path := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(rel), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	m := &Media{
+		ID:       GenerateID(path),
+		Path:     path,
+		RelPath:  rel,
+		Dir:      filepath.Dir(rel),
+		Filename: filepath.Base(rel),
+		Type:     MediaTypeImage,
+		Size:     int64(len(rel)),
+		TakenAt:  day(2023, time.May, 1),
+	}
+	if err := s.SaveMedia(m); err != nil {
+		tb.Fatal(err)
+	}
+	return m
+}
+
+// trashedDuplicate создает оригинал и его дубликат, перемещенный в корзину на диске
+func trashedDuplicate(tb testing.TB, s *Store, root, origRel, dupRel string) (original, duplicate *Media) {
+	tb.Helper()
+	original = addFileMedia(tb, s, root, origRel)
+	duplicate = addFileMedia(tb, s, root, dupRel)
+	duplicate.DuplicateOf = original.ID
+	if err := s.SaveMedia(duplicate); err != nil {
+		tb.Fatal(err)
+	}
+	if err := s.SoftDeleteMedia(duplicate.ID); err != nil {
+		tb.Fatal(err)
+	}
+	return mustGetMedia(tb, s, original.ID), mustGetMedia(tb, s, duplicate.ID)
+}
+
+func TestReplaceDuplicateSwapsFiles(t *testing.T) {
+	s := newTestStore(t)
+	root := t.TempDir()
+	s.SetTrashDir(".trash")
+	original, duplicate := trashedDuplicate(t, s, root, "orig.jpg", "dup.jpg")
+
+	if err := s.ReplaceDuplicate(duplicate, original); err != nil {
+		t.Fatal(err)
+	}
+
+	dup := mustGetMedia(t, s, duplicate.ID)
+	if dup.DeletedAt != nil || dup.DuplicateOf != "" || dup.Path != filepath.Join(root, "dup.jpg") {
+		t.Errorf("duplicate = deleted %v, of %q, path %s; want restored main copy", dup.DeletedAt, dup.DuplicateOf, dup.Path)
+	}
+	orig := mustGetMedia(t, s, original.ID)
+	if orig.DeletedAt == nil || orig.DuplicateOf != duplicate.ID {
+		t.Errorf("original = deleted %v, of %q; want trashed duplicate", orig.DeletedAt, orig.DuplicateOf)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".trash", "orig.jpg")); err != nil {
+		t.Errorf("original file is not in trash: %v", err)
+	}
+}
+
+func TestReplaceDuplicateRollsBackOnFailure(t *testing.T) {
+	s := newTestStore(t)
+	root := t.TempDir()
+	s.SetTrashDir(".trash")
+	original, duplicate := trashedDuplicate(t, s, root, "sub/orig.jpg", "dup.jpg")
+	trashedPath := duplicate.Path
+
+	// Файл на месте директории корзины: перемещение оригинала не удастся
+	if err := os.WriteFile(filepath.Join(root, ".trash", "sub"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ReplaceDuplicate(duplicate, original); err == nil {
+		t.Fatal("ReplaceDuplicate succeeded, want an error")
+	}
+
+	if _, err := os.Stat(trashedPath); err != nil {
+		t.Errorf("duplicate file was not moved back to trash: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "dup.jpg")); err == nil {
+		t.Error("duplicate file stayed restored after failure")
+	}
+	if duplicate.Path != trashedPath {
+		t.Errorf("duplicate.Path = %s, want %s", duplicate.Path, trashedPath)
+	}
+
+	dup := mustGetMedia(t, s, duplicate.ID)
+	if dup.DeletedAt == nil || dup.Path != trashedPath {
+		t.Errorf("duplicate record changed: deleted %v, path %s", dup.DeletedAt, dup.Path)
+	}
+	if orig := mustGetMedia(t, s, original.ID); orig.DeletedAt != nil {
+		t.Error("original record was trashed")
+	}
+}
+
+// duplicateFixture сохраняет exact пар с общей SHA256 и similar пар с близкими pHash
+func duplicateFixture(tb testing.TB, s *Store, exact, similar int) {
+	tb.Helper()
+	for i := 0; i < exact; i++ {
+		for _, copy := range []string{"a", "b"} {
+			addMedia(tb, s, fmt.Sprintf("exact%d-%s.jpg", i, copy), day(2023, time.May, 1+i), func(m *Media) {
+				m.Checksum = fmt.Sprintf("sha-%d", i)
+			})
+		}
+	}
+	for i := 0; i < similar; i++ {
+		// Базовые хеши далеко друг от друга, копия отличается одним битом
+		base := uint64(0x9E3779B97F4A7C15) * uint64(i+1)
+		for j, hash := range []uint64{base, base ^ 1} {
+			addMedia(tb, s, fmt.Sprintf("similar%d-%d.jpg", i, j), day(2022, time.May, 1+i), func(m *Media) {
+				m.ImageHash = hash
+			})
+		}
+	}
+}
+
+func TestFindDuplicatesMaxGroups(t *testing.T) {
+	s := newTestStore(t)
+	duplicateFixture(t, s, 3, 3)
+
+	count := func(groups []*DuplicateGroup, kind string) int {
+		n := 0
+		for _, g := range groups {
+			if g.Type == kind {
+				n++
+			}
+		}
+		return n
+	}
+
+	groups, truncated, err := s.FindDuplicates(10, DuplicateScope{}, DuplicateLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 6 || truncated || count(groups, "exact") != 3 || count(groups, "similar") != 3 {
+		t.Fatalf("unlimited: %d groups (%d exact), truncated %v; want 3+3", len(groups), count(groups, "exact"), truncated)
+	}
+
+	for _, tc := range []struct {
+		max, want int
+		truncated bool
+	}{
+		{6, 6, false},
+		{4, 4, true},
+		{2, 2, true}, // Меньше, чем точных групп
+	} {
+		groups, truncated, err := s.FindDuplicates(10, DuplicateScope{}, DuplicateLimits{MaxGroups: tc.max})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != tc.want || truncated != tc.truncated {
+			t.Errorf("max %d: %d groups, truncated %v; want %d, %v", tc.max, len(groups), truncated, tc.want, tc.truncated)
+		}
+	}
+
+	// Истекшее время: точные копии найдены, поиск похожих остановлен
+	groups, truncated, err = s.FindDuplicates(10, DuplicateScope{}, DuplicateLimits{Timeout: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !truncated || count(groups, "exact") != 3 || count(groups, "similar") != 0 {
+		t.Errorf("timeout: %d exact, %d similar, truncated %v", count(groups, "exact"), count(groups, "similar"), truncated)
+	}
+}
+
+func TestDuplicateScopeLimitsSimilarMatches(t *testing.T) {
+	s := newTestStore(t)
+	const hash = 0xF0F0F0F0F0F0F0F0
+	existing := addMedia(t, s, "canon-may1.jpg", day(2023, time.May, 1), func(m *Media) {
+		m.ImageHash = hash
+		m.Metadata.Camera = "Canon EOS R"
+	})
+	// Та же достопримечательность: близкий pHash, но другая камера или другой месяц
+	addMedia(t, s, "nikon-may2.jpg", day(2023, time.May, 2), func(m *Media) {
+		m.ImageHash = hash ^ 1
+		m.Metadata.Camera = "Nikon Z6"
+	})
+	addMedia(t, s, "canon-aug.jpg", day(2023, time.August, 1), func(m *Media) {
+		m.ImageHash = hash ^ 2
+		m.Metadata.Camera = "canon eos r" // Камера сравнивается без учета регистра
+	})
+
+	similarSizes := func(scope DuplicateScope) []int {
+		t.Helper()
+		groups, _, err := s.FindDuplicates(10, scope, DuplicateLimits{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sizes []int
+		for _, g := range groups {
+			if g.Type == "similar" {
+				sizes = append(sizes, len(g.Media))
+			}
+		}
+		return sizes
+	}
+
+	tests := []struct {
+		name  string
+		scope DuplicateScope
+		want  []int
+	}{
+		{"unscoped", DuplicateScope{}, []int{3}},
+		{"same camera", DuplicateScope{SameCamera: true}, []int{2}},
+		{"within a week", DuplicateScope{MaxDays: 7}, []int{2}},
+		{"same camera within a week", DuplicateScope{SameCamera: true, MaxDays: 7}, nil},
+	}
+	for _, tt := range tests {
+		if got := similarSizes(tt.scope); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: similar group sizes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Проверка нового файла при сканировании учитывает те же ограничения
+	candidate := &Media{ID: "new", ImageHash: hash ^ 4, TakenAt: day(2023, time.May, 3)}
+	candidate.Metadata.Camera = "Sony A7 III"
+	if res, err := s.CheckDuplicate(candidate, true, 10, DuplicateScope{}); err != nil || !res.IsDuplicate {
+		t.Errorf("unscoped CheckDuplicate = %+v, %v; want similar", res, err)
+	}
+	if res, err := s.CheckDuplicate(candidate, true, 10, DuplicateScope{SameCamera: true}); err != nil || res.IsDuplicate {
+		t.Errorf("same-camera CheckDuplicate = %+v, %v; want no match", res, err)
+	}
+	candidate.Metadata.Camera = "Canon EOS R"
+	res, err := s.CheckDuplicate(candidate, true, 10, DuplicateScope{SameCamera: true, MaxDays: 7})
+	if err != nil || !res.IsDuplicate || res.ExistingID != existing.ID {
+		t.Errorf("scoped CheckDuplicate = %+v, %v; want match with %s", res, err, existing.Filename)
+	}
+}
+
+func TestDuplicateScopeMinDimension(t *testing.T) {
+	s := newTestStore(t)
+	const photoHash, iconHash = 0xF0F0F0F0F0F0F0F0, 0x0F0F0F0F0F0F0F0F
+	sized := func(name string, hash uint64, width, height int) *Media {
+		return addMedia(t, s, name, day(2023, time.May, 1), func(m *Media) {
+			m.ImageHash, m.Width, m.Height = hash, width, height
+		})
+	}
+	sized("photo.jpg", photoHash, 4000, 3000)
+	sized("photo-copy.jpg", photoHash^1, 2000, 1500)
+	sized("unknown-size.jpg", photoHash^2, 0, 0) // Размеры неизвестны — не отсекается
+	icon := sized("icon.png", iconHash, 64, 64)
+	sized("icon-wide.png", iconHash^1, 512, 48) // Короткая сторона меньше порога
+
+	similarSizes := func(scope DuplicateScope) []int {
+		t.Helper()
+		groups, _, err := s.FindDuplicates(10, scope, DuplicateLimits{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sizes []int
+		for _, g := range groups {
+			if g.Type == "similar" {
+				sizes = append(sizes, len(g.Media))
+			}
+		}
+		slices.Sort(sizes)
+		return sizes
+	}
+	if got := similarSizes(DuplicateScope{}); !slices.Equal(got, []int{2, 3}) {
+		t.Errorf("unscoped similar groups = %v, want [2 3]", got)
+	}
+	if got := similarSizes(DuplicateScope{MinDimension: 256}); !slices.Equal(got, []int{3}) {
+		t.Errorf("min dimension 256 similar groups = %v, want only the photos [3]", got)
+	}
+
+	// Новая иконка при сканировании тоже не сравнивается
+	candidate := &Media{ID: "new-icon", ImageHash: iconHash ^ 2, Width: 32, Height: 32}
+	if res, err := s.CheckDuplicate(candidate, true, 10, DuplicateScope{}); err != nil || !res.IsDuplicate {
+		t.Errorf("unscoped CheckDuplicate = %+v, %v; want similar to %s", res, err, icon.Filename)
+	}
+	if res, err := s.CheckDuplicate(candidate, true, 10, DuplicateScope{MinDimension: 256}); err != nil || res.IsDuplicate {
+		t.Errorf("CheckDuplicate with min dimension = %+v, %v; want no match", res, err)
+	}
+}
+
+func TestResolveOriginalFollowsChain(t *testing.T) {
+	s := newTestStore(t)
+	dupOf := func(name, original string) *Media {
+		return addMedia(t, s, name, day(2023, time.May, 1), func(m *Media) { m.DuplicateOf = original })
+	}
+	// c — дубликат b, который позже сам оказался дубликатом a
+	a := dupOf("a.jpg", "")
+	b := dupOf("b.jpg", a.ID)
+	c := dupOf("c.jpg", b.ID)
+	// Цикл x <-> y в старых данных
+	x := dupOf("x.jpg", GenerateID("/library/y.jpg"))
+	y := dupOf("y.jpg", x.ID)
+	orphan := dupOf("orphan.jpg", "deleted-original")
+
+	tests := []struct {
+		name string
+		id   string
+		want *Media
+	}{
+		{"chain", c.ID, a},
+		{"direct", b.ID, a},
+		{"not a duplicate", a.ID, nil},
+		{"cycle", x.ID, y}, // Останавливается на последней записи перед повтором
+		{"original deleted", orphan.ID, nil},
+		{"unknown media", "nope", nil},
+	}
+	for _, tt := range tests {
+		got, err := s.ResolveOriginal(tt.id)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if (got == nil) != (tt.want == nil) || (got != nil && got.ID != tt.want.ID) {
+			t.Errorf("%s: original = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
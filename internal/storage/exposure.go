@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseAperture разбирает диафрагму: "f/2.8", "F2.8", "2.8"
+func ParseAperture(s string) (float64, bool) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "f"), "/")
+	return parsePositive(s)
+}
+
+// ParseShutter разбирает выдержку в секунды: "1/250", "1.5s", "2", "0.004"
+func ParseShutter(s string) (float64, bool) {
+	s = strings.TrimSuffix(strings.TrimSpace(strings.ToLower(s)), "s")
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, okNum := parsePositive(num)
+		d, okDen := parsePositive(den)
+		if !okNum || !okDen || math.IsInf(n/d, 0) {
+			return 0, false
+		}
+		return n / d, true
+	}
+	return parsePositive(s)
+}
+
+// ParseFocal разбирает фокусное расстояние: "50mm", "50 mm", "50"
+func ParseFocal(s string) (float64, bool) {
+	return parsePositive(strings.TrimSuffix(strings.TrimSpace(strings.ToLower(s)), "mm"))
+}
+
+func parsePositive(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	// ParseFloat принимает "NaN" и "Inf": такие границы фильтра не имеют смысла
+	if err != nil || v <= 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// ApertureValue число диафрагмы; у медиа, отсканированных до появления ApertureF, — из строки
+func (md *Metadata) ApertureValue() float64 {
+	if md.ApertureF > 0 {
+		return md.ApertureF
+	}
+	v, _ := ParseAperture(md.Aperture)
+	return v
+}
+
+// ShutterValue выдержка в секундах (ShutterSec или разбор ShutterSpeed)
+func (md *Metadata) ShutterValue() float64 {
+	if md.ShutterSec > 0 {
+		return md.ShutterSec
+	}
+	v, _ := ParseShutter(md.ShutterSpeed)
+	return v
+}
+
+// FocalValue фокусное расстояние в мм (FocalMM или разбор FocalLength)
+func (md *Metadata) FocalValue() float64 {
+	if md.FocalMM > 0 {
+		return md.FocalMM
+	}
+	v, _ := ParseFocal(md.FocalLength)
+	return v
+}
+
+// inRange проверяет v по границам фильтра (0 — граница не задана);
+// без значения (v == 0) медиа не подходит, если задана хотя бы одна граница
+func inRange(v, lo, hi float64) bool {
+	if lo <= 0 && hi <= 0 {
+		return true
+	}
+	if v <= 0 {
+		return false
+	}
+	return (lo <= 0 || v >= lo) && (hi <= 0 || v <= hi)
+}
+
+// matchesExposure фильтры по ISO, диафрагме, выдержке и фокусному расстоянию
+func matchesExposure(md *Metadata, q *SearchQuery) bool {
+	return inRange(float64(md.ISO), float64(q.MinISO), float64(q.MaxISO)) &&
+		inRange(md.ApertureValue(), q.MinAperture, q.MaxAperture) &&
+		inRange(md.ShutterValue(), q.MinShutter, q.MaxShutter) &&
+		inRange(md.FocalValue(), q.MinFocal, q.MaxFocal)
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExposureValues(t *testing.T) {
+	for _, tc := range []struct {
+		parse func(string) (float64, bool)
+		in    string
+		want  float64
+		ok    bool
+	}{
+		{ParseAperture, "f/2.8", 2.8, true},
+		{ParseAperture, "F2.8", 2.8, true},
+		{ParseAperture, " 4 ", 4, true},
+		{ParseAperture, "f/0", 0, false},
+		{ParseAperture, "NaN", 0, false},
+		{ParseShutter, "1/250", 0.004, true},
+		{ParseShutter, "1.5s", 1.5, true},
+		{ParseShutter, "2", 2, true},
+		{ParseShutter, "1/0", 0, false},
+		{ParseShutter, "1e308/1e-308", 0, false},
+		{ParseShutter, "Inf", 0, false},
+		{ParseFocal, "50mm", 50, true},
+		{ParseFocal, "85 mm", 85, true},
+		{ParseFocal, "-10", 0, false},
+		{ParseFocal, "", 0, false},
+	} {
+		got, ok := tc.parse(tc.in)
+		if ok != tc.ok || math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("parse %q = %v, %v; want %v, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestSearchByExposureRange(t *testing.T) {
+	s := newTestStore(t)
+	addMedia(t, s, "portrait.jpg", day(2023, time.May, 1), func(m *Media) {
+		m.Metadata = Metadata{ISO: 100, Aperture: "f/1.8", ApertureF: 1.8, ShutterSpeed: "1/500", ShutterSec: 0.002, FocalLength: "85mm", FocalMM: 85}
+	})
+	addMedia(t, s, "night.jpg", day(2023, time.May, 2), func(m *Media) {
+		m.Metadata = Metadata{ISO: 3200, Aperture: "f/8.0", ApertureF: 8, ShutterSpeed: "2.0s", ShutterSec: 2, FocalLength: "24mm", FocalMM: 24}
+	})
+	// Отсканировано до появления числовых полей: значения берутся из строк
+	addMedia(t, s, "legacy.jpg", day(2023, time.May, 3), func(m *Media) {
+		m.Metadata = Metadata{ISO: 400, Aperture: "f/2.8", ShutterSpeed: "1/60", FocalLength: "50mm"}
+	})
+	addMedia(t, s, "no-exif.jpg", day(2023, time.May, 4), nil)
+
+	for _, tc := range []struct {
+		name  string
+		query SearchQuery
+		want  string
+	}{
+		{"no filter", SearchQuery{}, "legacy.jpg night.jpg no-exif.jpg portrait.jpg"},
+		{"bright lenses", SearchQuery{MaxAperture: 2.8}, "legacy.jpg portrait.jpg"},
+		{"long exposures", SearchQuery{MinShutter: 1}, "night.jpg"},
+		{"handheld shutter", SearchQuery{MaxShutter: 1.0 / 60}, "legacy.jpg portrait.jpg"},
+		{"telephoto", SearchQuery{MinFocal: 50, MaxFocal: 100}, "legacy.jpg portrait.jpg"},
+		{"low iso", SearchQuery{MaxISO: 400}, "legacy.jpg portrait.jpg"},
+		{"combined", SearchQuery{MinISO: 200, MaxAperture: 4}, "legacy.jpg"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.query
+			result, err := s.Search(&q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, m := range result.Media {
+				names = append(names, m.Filename)
+			}
+			sort.Strings(names)
+			if got := strings.Join(names, " "); got != tc.want {
+				t.Errorf("results = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// geoClusterCellsPerTile ячеек сетки кластеризации на тайл карты по каждой оси
+	// (тайл 256px — ячейка около 64px)
+	geoClusterCellsPerTile = 4
+
+	// GeoMaxClusterZoom начиная с этого масштаба точки не кластеризуются
+	GeoMaxClusterZoom = 18
+)
+
+// GeoBounds прямоугольник карты; MinLon > MaxLon — область пересекает 180-й меридиан
+type GeoBounds struct {
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
+}
+
+// Contains входит ли точка в прямоугольник
+func (b *GeoBounds) Contains(lat, lon float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return lon >= b.MinLon && lon <= b.MaxLon
+	}
+	return lon >= b.MinLon || lon <= b.MaxLon
+}
+
+// GeoCluster маркер карты: одиночная точка (Count = 1) или группа близких точек.
+// Координаты группы — среднее ее точек, MediaID и ThumbURL — первой точки группы.
+type GeoCluster struct {
+	MediaID  string  `json:"media_id"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	ThumbURL string  `json:"thumb_url"`
+	Count    int     `json:"count"`
+}
+
+// ClusterGeoPoints объединяет точки, попавшие в одну ячейку сетки масштаба zoom
+// (ячейки равны по пикселям в проекции Web Mercator, как тайлы карты).
+// С GeoMaxClusterZoom и крупнее каждая точка остается отдельным маркером.
+// Результат отсортирован по убыванию размера группы.
+func ClusterGeoPoints(points []*GeoPoint, zoom int) []*GeoCluster {
+	if zoom >= GeoMaxClusterZoom {
+		result := make([]*GeoCluster, 0, len(points))
+		for _, p := range points {
+			result = append(result, &GeoCluster{MediaID: p.MediaID, Lat: p.Lat, Lon: p.Lon, ThumbURL: p.ThumbURL, Count: 1})
+		}
+		return result
+	}
+	if zoom < 0 {
+		zoom = 0
+	}
+
+	grid := float64(int(1)<<zoom) * geoClusterCellsPerTile
+	type cell struct{ x, y int }
+	cells := make(map[cell]*GeoCluster)
+	var result []*GeoCluster
+	for _, p := range points {
+		x, y := mercatorXY(p.Lat, p.Lon)
+		key := cell{int(math.Min(x*grid, grid-1)), int(math.Min(y*grid, grid-1))}
+		c, ok := cells[key]
+		if !ok {
+			c = &GeoCluster{MediaID: p.MediaID, ThumbURL: p.ThumbURL}
+			cells[key] = c
+			result = append(result, c)
+		}
+		// Пока в Lat/Lon копится сумма, среднее считается ниже
+		c.Lat += p.Lat
+		c.Lon += p.Lon
+		c.Count++
+	}
+
+	for _, c := range result {
+		c.Lat /= float64(c.Count)
+		c.Lon /= float64(c.Count)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Count > result[j].Count
+	})
+	return result
+}
+
+// mercatorXY переводит координаты в доли карты Web Mercator [0, 1]
+func mercatorXY(lat, lon float64) (x, y float64) {
+	// Web Mercator не определен у полюсов, карты обрезают широту до ±85.05°
+	lat = math.Max(-85.05112878, math.Min(85.05112878, lat))
+	x = (lon + 180) / 360
+	rad := lat * math.Pi / 180
+	y = (1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2
+	return math.Max(0, math.Min(1, x)), math.Max(0, math.Min(1, y))
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// addGeoMedia сохраняет изображение с GPS координатами
+func addGeoMedia(tb testing.TB, s *Store, name string, lat, lon float64) *Media {
+	tb.Helper()
+	return addMedia(tb, s, name, day(2023, time.May, 1), func(m *Media) {
+		m.Metadata.GPSLat = lat
+		m.Metadata.GPSLon = lon
+	})
+}
+
+func TestGetGeoPointsInBounds(t *testing.T) {
+	s := newTestStore(t)
+	moscow := addGeoMedia(t, s, "moscow.jpg", 55.75, 37.62)
+	addGeoMedia(t, s, "paris.jpg", 48.86, 2.35)
+	fiji := addGeoMedia(t, s, "fiji.jpg", -17.7, 178.1)
+	samoa := addGeoMedia(t, s, "samoa.jpg", -13.8, -172.1)
+	addMedia(t, s, "nogps.jpg", day(2023, time.May, 1), nil)
+
+	all, err := s.GetGeoPointsIn(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("points without bbox = %d, want 4", len(all))
+	}
+
+	cases := []struct {
+		name   string
+		bounds GeoBounds
+		want   []string
+	}{
+		{"europe east", GeoBounds{MinLat: 50, MinLon: 30, MaxLat: 60, MaxLon: 40}, []string{moscow.ID}},
+		{"across antimeridian", GeoBounds{MinLat: -20, MinLon: 170, MaxLat: -10, MaxLon: -170}, []string{fiji.ID, samoa.ID}},
+		{"empty ocean", GeoBounds{MinLat: -60, MinLon: -40, MaxLat: -50, MaxLon: -30}, nil},
+	}
+	for _, c := range cases {
+		points, err := s.GetGeoPointsIn(&c.bounds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for _, p := range points {
+			got[p.MediaID] = true
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("%s: %d points, want %d", c.name, len(got), len(c.want))
+			continue
+		}
+		for _, id := range c.want {
+			if !got[id] {
+				t.Errorf("%s: point %s is missing", c.name, id)
+			}
+		}
+	}
+}
+
+func TestClusterGeoPointsReducesMarkersAtLowZoom(t *testing.T) {
+	// Две плотные группы: Москва и Париж, по 20 точек в пределах сотен метров
+	var points []*GeoPoint
+	for i := 0; i < 20; i++ {
+		d := float64(i) * 0.001
+		points = append(points,
+			&GeoPoint{MediaID: fmt.Sprintf("msk%d", i), Lat: 55.75 + d, Lon: 37.62 + d},
+			&GeoPoint{MediaID: fmt.Sprintf("par%d", i), Lat: 48.86 + d, Lon: 2.35 + d},
+		)
+	}
+
+	low := ClusterGeoPoints(points, 4)
+	if len(low) != 2 {
+		t.Fatalf("markers at zoom 4 = %d, want 2 clusters", len(low))
+	}
+	total := 0
+	for _, c := range low {
+		total += c.Count
+		if c.Count != 20 {
+			t.Errorf("cluster %s count = %d, want 20", c.MediaID, c.Count)
+		}
+		if c.MediaID == "" {
+			t.Error("cluster has no representative media")
+		}
+	}
+	if total != len(points) {
+		t.Errorf("clusters cover %d points, want %d", total, len(points))
+	}
+
+	if high := ClusterGeoPoints(points, GeoMaxClusterZoom); len(high) != len(points) {
+		t.Errorf("markers at max zoom = %d, want every point (%d)", len(high), len(points))
+	}
+	mid := ClusterGeoPoints(points, 12)
+	if len(mid) <= len(low) || len(mid) > len(points) {
+		t.Errorf("markers at zoom 12 = %d, want between %d and %d", len(mid), len(low), len(points))
+	}
+}
+
+func TestGetPlacesGroupsByCityAndCountry(t *testing.T) {
+	s := newTestStore(t)
+	place := func(name, city, country string) {
+		addMedia(t, s, name, day(2023, time.May, 1), func(m *Media) {
+			m.Metadata.Place, m.Metadata.Country = city, country
+		})
+	}
+	place("a.jpg", "Paris", "FR")
+	place("b.jpg", "Moscow", "RU")
+	place("c.jpg", "Paris", "FR")
+	place("d.jpg", "Paris", "US") // Одноименный город другой страны — отдельное место
+	place("e.jpg", "", "")
+
+	groups, err := s.GetPlaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, g := range groups {
+		got = append(got, fmt.Sprintf("%s/%s:%d", g.Place, g.Country, g.Count))
+	}
+	// Частые места первыми, при равенстве — по названию
+	want := "[Paris/FR:2 Moscow/RU:1 Paris/US:1]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("places = %v, want %s", got, want)
+	}
+}
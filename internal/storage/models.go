@@ -20,9 +20,29 @@ const (
 	RoleViewer = "viewer" // Только просмотр и своё избранное
 )
 
+// Что делать с загрузками и альбомами удаляемого пользователя (users.on_delete)
+const (
+	UserDeleteKeep     = "keep"              // Оставить как есть (ID удаленного пользователя)
+	UserDeleteReassign = "reassign-to-admin" // Передать администратору
+	UserDeleteOrphan   = "orphan"            // Убрать владельца
+)
+
+// Области доступа API токенов (токен без областей имеет все права роли)
+const (
+	ScopeRead   = "read"   // Только чтение (GET/HEAD)
+	ScopeUpload = "upload" // Загрузка файлов
+	ScopeAdmin  = "admin"  // Любые изменения в пределах роли
+)
+
+// IsValidScope проверяет область доступа API токена
+func IsValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeUpload || scope == ScopeAdmin
+}
+
 // Media представляет медиа-файл в галерее
 type Media struct {
 	ID          string     `json:"id"`                     // SHA256 от пути
+	Slug        string     `json:"slug,omitempty"`         // Короткий ID для ссылок (префикс ID без коллизий)
 	Path        string     `json:"path"`                   // Полный путь к файлу
 	RelPath     string     `json:"rel_path"`               // Относительный путь от корня медиа
 	Dir         string     `json:"dir"`                    // Директория файла
@@ -38,14 +58,23 @@ type Media struct {
 	CreatedAt   time.Time  `json:"created_at"`             // Дата добавления в БД
 	ModifiedAt  time.Time  `json:"modified_at"`            // Дата модификации файла
 	DeletedAt   *time.Time `json:"deleted_at"`             // Дата удаления (nil = не удалено)
+	TrashedFrom string     `json:"trashed_from,omitempty"` // Исходный путь файла, перемещённого в корзину на диске
 	Checksum    string     `json:"checksum"`               // SHA256 хеш файла (для точных дубликатов)
 	ImageHash   uint64     `json:"image_hash"`             // Perceptual hash (для визуальных дубликатов)
 	DuplicateOf string     `json:"duplicate_of,omitempty"` // ID оригинала (если дубликат)
 	ThumbSmall  string     `json:"thumb_small"`            // Путь к маленькому превью
 	ThumbLarge  string     `json:"thumb_large"`            // Путь к большому превью
+	BlurHash    string     `json:"blur_hash,omitempty"`    // BlurHash плейсхолдер (считается при генерации small превью)
+	Colors      []string   `json:"colors,omitempty"`       // Доминирующие цвета #rrggbb (по small превью)
 	Metadata    Metadata   `json:"metadata"`               // Дополнительные метаданные
 	IsFavorite  bool       `json:"is_favorite"`            // Отмечено как избранное
 	Tags        []string   `json:"tags"`                   // Теги
+	Flagged     bool       `json:"flagged,omitempty"`      // Отмечено для проверки администратором
+	FlagReason  string     `json:"flag_reason,omitempty"`  // Причина отметки (неверная дата, удалить и т.п.)
+	FlaggedBy   string     `json:"flagged_by,omitempty"`   // ID пользователя, отметившего медиа
+	FlaggedAt   *time.Time `json:"flagged_at,omitempty"`   // Когда отмечено
+	UploadedBy  string     `json:"uploaded_by,omitempty"`  // ID пользователя, загрузившего файл (пусто — найден сканером)
+	StackID     string     `json:"stack_id,omitempty"`     // Стопка (серия кадров): ID верхнего медиа стопки
 }
 
 // Metadata содержит EXIF и другие метаданные
@@ -58,7 +87,58 @@ type Metadata struct {
 	ISO          int     `json:"iso,omitempty"`
 	GPSLat       float64 `json:"gps_lat,omitempty"`
 	GPSLon       float64 `json:"gps_lon,omitempty"`
+	Codec        string  `json:"codec,omitempty"`   // Видеокодек (ffprobe)
+	Place        string  `json:"place,omitempty"`   // Ближайший город (обратное геокодирование)
+	Country      string  `json:"country,omitempty"` // Код страны
 	Orientation  int     `json:"orientation,omitempty"`
+	Caption      string  `json:"caption,omitempty"`   // Описание из XMP dc:description или IPTC Caption
+	TZOffset     string  `json:"tz_offset,omitempty"` // Смещение времени съемки от UTC из EXIF OffsetTimeOriginal ("+03:00")
+	Software     string  `json:"software,omitempty"`  // Программа обработки (EXIF Software)
+	Artist       string  `json:"artist,omitempty"`    // Автор (EXIF Artist)
+	Copyright    string  `json:"copyright,omitempty"` // Правообладатель (EXIF Copyright)
+
+	// Числовые значения для фильтров по диапазону (строки выше — для показа)
+	ApertureF  float64 `json:"aperture_f,omitempty"`  // Число диафрагмы: 2.8
+	ShutterSec float64 `json:"shutter_sec,omitempty"` // Выдержка в секундах: 0.004
+	FocalMM    float64 `json:"focal_mm,omitempty"`    // Фокусное расстояние в мм
+}
+
+// Date дата для хронологии: дата съемки, а без нее — дата изменения файла
+func (m *Media) Date() time.Time {
+	if !m.TakenAt.IsZero() && m.TakenAt.Year() > 1900 {
+		return m.TakenAt
+	}
+	return m.ModifiedAt
+}
+
+// ThumbnailURL возвращает URL превью заданного размера
+func (m *Media) ThumbnailURL(size string) string {
+	return "/media/" + m.ID + "/thumb/" + size
+}
+
+// ThumbnailURLs возвращает URL превью размеров sizes (cfg.SrcsetSizes): {size: url}
+func (m *Media) ThumbnailURLs(sizes []string) map[string]string {
+	urls := make(map[string]string, len(sizes))
+	for _, size := range sizes {
+		urls[size] = m.ThumbnailURL(size)
+	}
+	return urls
+}
+
+// ShareLink публичная ссылка на альбом для пользователей без аккаунта
+type ShareLink struct {
+	Token        string     `json:"token"`
+	AlbumID      string     `json:"album_id"`
+	CreatedBy    string     `json:"created_by"` // ID пользователя
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at"` // nil = бессрочно
+	PasswordHash string     `json:"password_hash,omitempty"`
+	HasPassword  bool       `json:"has_password"`
+}
+
+// Expired проверяет, истек ли срок действия ссылки
+func (l *ShareLink) Expired() bool {
+	return l.ExpiresAt != nil && time.Now().After(*l.ExpiresAt)
 }
 
 // User представляет пользователя системы
@@ -70,6 +150,19 @@ type User struct {
 	Role         string    `json:"role"` // admin, editor, viewer
 	CreatedAt    time.Time `json:"created_at"`
 	LastLogin    time.Time `json:"last_login"`
+	Theme        string    `json:"theme,omitempty"` // Тема интерфейса: dark, light, system ("" = dark)
+}
+
+// Темы интерфейса
+const (
+	ThemeDark   = "dark"
+	ThemeLight  = "light"
+	ThemeSystem = "system" // По настройке ОС (prefers-color-scheme)
+)
+
+// IsValidTheme проверяет название темы интерфейса
+func IsValidTheme(theme string) bool {
+	return theme == ThemeDark || theme == ThemeLight || theme == ThemeSystem
 }
 
 // Session представляет сессию пользователя
@@ -91,6 +184,26 @@ type APIToken struct {
 	CreatedAt  time.Time `json:"created_at"`
 	ExpiresAt  time.Time `json:"expires_at"`
 	DeviceName string    `json:"device_name"`
+	Scopes     []string  `json:"scopes,omitempty"` // Области доступа (пусто — все права роли)
+}
+
+// Expired проверяет, истек ли срок действия токена
+func (t *APIToken) Expired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// HasScope проверяет, разрешена ли токену область доступа.
+// Токен без областей (созданный до их появления) имеет все права роли, admin включает остальные.
+func (t *APIToken) HasScope(scope string) bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
 }
 
 // Directory представляет директорию в галерее
@@ -113,14 +226,46 @@ type Stats struct {
 
 // Album представляет альбом (коллекцию медиа)
 type Album struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CoverID     string    `json:"cover_id"`      // ID медиа для обложки
-	MediaIDs    []string  `json:"media_ids"`     // ID медиа в альбоме
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	MediaCount  int       `json:"media_count"`   // Кэшированное количество
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	CoverID     string       `json:"cover_id"`  // ID медиа для обложки
+	MediaIDs    []string     `json:"media_ids"` // ID медиа в альбоме
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	MediaCount  int          `json:"media_count"`            // Кэшированное количество
+	ParentID    string       `json:"parent_id,omitempty"`    // Родительский альбом ("" = корневой)
+	Smart       bool         `json:"smart,omitempty"`        // Умный альбом: содержимое определяется Query, MediaIDs не используются
+	Query       *SearchQuery `json:"query,omitempty"`        // Сохраненный поиск умного альбома
+	CustomOrder bool         `json:"custom_order,omitempty"` // MediaIDs упорядочены вручную, иначе медиа по дате съемки
+	OwnerID     string       `json:"owner_id,omitempty"`     // ID пользователя, создавшего альбом
+
+	// Настройки слайдшоу (режим цифровой фоторамки); нулевые значения — настройки по умолчанию
+	SlideIntervalSeconds int    `json:"slide_interval_seconds,omitempty"` // Время показа кадра
+	Shuffle              bool   `json:"shuffle,omitempty"`                // Случайный порядок
+	Transition           string `json:"transition,omitempty"`             // Эффект смены кадра: fade, slide, none
+}
+
+// Эффекты смены кадра слайдшоу
+const (
+	TransitionFade  = "fade"
+	TransitionSlide = "slide"
+	TransitionNone  = "none"
+)
+
+// DefaultSlideIntervalSeconds время показа кадра, если в альбоме не задано
+const DefaultSlideIntervalSeconds = 5
+
+// MaxSlideIntervalSeconds максимальное время показа кадра (1 час)
+const MaxSlideIntervalSeconds = 3600
+
+// IsValidTransition проверяет эффект смены кадра
+func IsValidTransition(t string) bool {
+	switch t {
+	case TransitionFade, TransitionSlide, TransitionNone:
+		return true
+	}
+	return false
 }
 
 // Tag представляет тег для организации медиа
@@ -131,17 +276,81 @@ type Tag struct {
 
 // SearchQuery представляет параметры поиска
 type SearchQuery struct {
-	Text       string     `json:"text"`        // Поиск по тексту (имя файла, метаданные)
-	Type       MediaType  `json:"type"`        // Фильтр по типу
-	DateFrom   *time.Time `json:"date_from"`   // От даты
-	DateTo     *time.Time `json:"date_to"`     // До даты
-	Tags       []string   `json:"tags"`        // Фильтр по тегам
-	Camera     string     `json:"camera"`      // Фильтр по камере
-	IsFavorite *bool      `json:"is_favorite"` // Только избранное
-	HasGPS     *bool      `json:"has_gps"`     // Только с геоданными
-	AlbumID    string     `json:"album_id"`    // В конкретном альбоме
-	Limit      int        `json:"limit"`
-	Offset     int        `json:"offset"`
+	Text        string      `json:"text"`         // Поиск по тексту (имя файла, метаданные)
+	Fuzzy       bool        `json:"fuzzy"`        // Нечеткое сравнение текста (опечатки), медленнее обычного
+	Type        MediaType   `json:"type"`         // Фильтр по типу
+	Types       []MediaType `json:"types"`        // Любой из типов (вместе с Type)
+	DateFrom    *time.Time  `json:"date_from"`    // От даты
+	DateTo      *time.Time  `json:"date_to"`      // До даты
+	Tags        []string    `json:"tags"`         // Фильтр по тегам
+	ExcludeTags []string    `json:"exclude_tags"` // Исключить медиа с любым из тегов
+	Camera      string      `json:"camera"`       // Фильтр по камере
+	Cameras     []string    `json:"cameras"`      // Любая из камер (вместе с Camera)
+	Artist      string      `json:"artist"`       // Автор (EXIF Artist), подстрока без учета регистра
+	IsFavorite  *bool       `json:"is_favorite"`  // Только избранное
+	HasGPS      *bool       `json:"has_gps"`      // Только с геоданными
+	AlbumID     string      `json:"album_id"`     // В конкретном альбоме
+	Unalbumed   bool        `json:"unalbumed"`    // Только медиа, которых нет ни в одном обычном альбоме
+	Missing     []string    `json:"missing"`      // Только медиа без указанных метаданных: camera, gps, date
+	Color       string      `json:"color"`        // Ближайший цвет палитры (#rrggbb)
+	Flagged     *bool       `json:"flagged"`      // Только отмеченные для проверки
+	MinSize     int64       `json:"min_size"`     // Размер файла от (байт)
+	MaxSize     int64       `json:"max_size"`     // Размер файла до (байт)
+
+	// Параметры съемки; медиа без значения в фильтр по нему не попадают
+	MinISO      int     `json:"min_iso"`
+	MaxISO      int     `json:"max_iso"`
+	MinAperture float64 `json:"min_aperture"` // Число диафрагмы от (f/2.8 -> 2.8)
+	MaxAperture float64 `json:"max_aperture"` // Число диафрагмы до: max_aperture=2 — светлые кадры
+	MinShutter  float64 `json:"min_shutter"`  // Выдержка от (секунды)
+	MaxShutter  float64 `json:"max_shutter"`  // Выдержка до (секунды)
+	MinFocal    float64 `json:"min_focal"`    // Фокусное расстояние от (мм)
+	MaxFocal    float64 `json:"max_focal"`    // Фокусное расстояние до (мм)
+
+	SortBy  string `json:"sort_by"`  // taken_at, modified_at, size, filename (по умолчанию taken_at)
+	SortDir string `json:"sort_dir"` // asc или desc (по умолчанию desc)
+	Limit   int    `json:"limit"`
+	Offset  int    `json:"offset"`
+}
+
+// MediaTypes возвращает типы из Type и Types (пусто — любой тип)
+func (q *SearchQuery) MediaTypes() []MediaType {
+	if q.Type == "" {
+		return q.Types
+	}
+	return append([]MediaType{q.Type}, q.Types...)
+}
+
+// Поля метаданных для фильтра Missing
+const (
+	MissingCamera = "camera"
+	MissingGPS    = "gps"
+	MissingDate   = "date"
+)
+
+// Поля сортировки результатов поиска
+const (
+	SortByTakenAt    = "taken_at"
+	SortByModifiedAt = "modified_at"
+	SortBySize       = "size"
+	SortByFilename   = "filename"
+
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// BulkItemResult результат bulk операции для одного медиа
+type BulkItemResult struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// MetadataEdit поля медиа для перезаписи вручную; nil — поле не меняется
+type MetadataEdit struct {
+	TakenAt *time.Time
+	Camera  *string
+	Caption *string
 }
 
 // SearchResult представляет результат поиска
@@ -151,14 +360,37 @@ type SearchResult struct {
 	HasMore    bool     `json:"has_more"`
 }
 
+// CameraCount камера и число медиа, снятых ею (без корзины)
+type CameraCount struct {
+	Camera     string `json:"camera"`
+	MediaCount int    `json:"media_count"`
+}
+
 // TimelineGroup группа медиа по дате
 type TimelineGroup struct {
-	Date       string   `json:"date"`        // YYYY-MM или YYYY-MM-DD
-	Label      string   `json:"label"`       // Человекочитаемая метка
+	Date       string   `json:"date"`  // YYYY-MM или YYYY-MM-DD
+	Label      string   `json:"label"` // Человекочитаемая метка
 	MediaCount int      `json:"media_count"`
 	Media      []*Media `json:"media,omitempty"`
 }
 
+// NavIndex навигационный индекс для фронтенда: альбомы, теги, камеры и хронология одним ответом
+type NavIndex struct {
+	Albums   []*NavAlbum      `json:"albums"`
+	Tags     []*Tag           `json:"tags"`
+	Cameras  []*CameraCount   `json:"cameras"`
+	Timeline []*TimelineGroup `json:"timeline"`
+}
+
+// NavAlbum альбом в навигационном индексе (без списка медиа)
+type NavAlbum struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	ParentID   string `json:"parent_id,omitempty"`
+	MediaCount int    `json:"media_count"`
+	CoverID    string `json:"cover_id"`
+}
+
 // GeoPoint представляет точку на карте
 type GeoPoint struct {
 	MediaID  string  `json:"media_id"`
@@ -167,9 +399,32 @@ type GeoPoint struct {
 	ThumbURL string  `json:"thumb_url"`
 }
 
+// PlaceGroup медиа, снятые в одном месте (по обратному геокодированию)
+type PlaceGroup struct {
+	Place    string   `json:"place"`
+	Country  string   `json:"country"`
+	Count    int      `json:"count"`
+	MediaIDs []string `json:"media_ids"`
+}
+
+// GearCount сколько снимков сделано камерой, объективом, на фокусном расстоянии или диафрагме
+type GearCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// GearStats статистика фототехники по EXIF, самые частые значения первыми
+type GearStats struct {
+	TotalShots   int          `json:"total_shots"` // Снимков с известной камерой или объективом
+	Cameras      []*GearCount `json:"cameras"`
+	Lenses       []*GearCount `json:"lenses"`
+	FocalLengths []*GearCount `json:"focal_lengths"`
+	Apertures    []*GearCount `json:"apertures"`
+}
+
 // DuplicateGroup представляет группу дубликатов
 type DuplicateGroup struct {
-	Type     string   `json:"type"`      // "exact" или "similar"
-	Media    []*Media `json:"media"`     // Медиа в группе
-	Distance int      `json:"distance"`  // Hamming distance (для similar)
+	Type     string   `json:"type"`     // "exact" или "similar"
+	Media    []*Media `json:"media"`    // Медиа в группе
+	Distance int      `json:"distance"` // Наибольшее расстояние Хэмминга до первого медиа группы (для similar)
 }
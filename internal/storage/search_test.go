@@ -0,0 +1,376 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// searchBenchmarkStore хранилище со 100k медиа. Записи и индексы типа и даты пишутся
+// одной транзакцией напрямую: SaveMedia на таком объеме заняла бы минуты
+func searchBenchmarkStore(b *testing.B) *Store {
+	s := newTestStore(b)
+	const records = 100000
+	cameras := []string{"Canon EOS R", "Nikon Z6", "Sony A7 III", "FUJIFILM X-T4"}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketMedia)
+		byType := map[string][]string{}
+		byDate := map[string][]string{}
+		for i := 0; i < records; i++ {
+			name := fmt.Sprintf("%d/img%06d.jpg", 2015+i%10, i)
+			m := &Media{
+				ID:         GenerateID("/library/" + name),
+				Path:       "/library/" + name,
+				RelPath:    name,
+				Filename:   fmt.Sprintf("img%06d.jpg", i),
+				Type:       MediaTypeImage,
+				Size:       int64(1000 + i),
+				TakenAt:    time.Date(2015+i%10, time.Month(1+i%12), 1+i%28, 12, 0, 0, 0, time.UTC),
+				IsFavorite: i%50 == 0,
+			}
+			if i%10 == 0 {
+				m.Type = MediaTypeVideo
+			}
+			m.ModifiedAt = m.TakenAt
+			m.Metadata.Camera = cameras[i%len(cameras)]
+			if i%7 == 0 {
+				m.Tags = []string{"sea"}
+			}
+			data, err := json.Marshal(m)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(m.ID), data); err != nil {
+				return err
+			}
+			byType[string(m.Type)] = append(byType[string(m.Type)], m.ID)
+			byDate[mediaDateKey(m)] = append(byDate[mediaDateKey(m)], m.ID)
+		}
+		putIndex := func(bucket []byte, keys map[string][]string) error {
+			for key, ids := range keys {
+				data, err := json.Marshal(ids)
+				if err != nil {
+					return err
+				}
+				if err := tx.Bucket(bucket).Put([]byte(key), data); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := putIndex(bucketIdxType, byType); err != nil {
+			return err
+		}
+		return putIndex(bucketIdxDate, byDate)
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return s
+}
+
+// Поиск по библиотеке из 100k записей: полный обход, обход по индексу типа и по индексу дат
+func BenchmarkSearch(b *testing.B) {
+	s := searchBenchmarkStore(b)
+	from, to := day(2020, time.March, 1), day(2020, time.May, 31)
+	favorite := true
+
+	queries := []struct {
+		name  string
+		query SearchQuery
+	}{
+		{"all", SearchQuery{}},
+		{"text", SearchQuery{Text: "img0421"}},
+		{"tags", SearchQuery{Tags: []string{"sea"}}},
+		{"type+camera", SearchQuery{Type: MediaTypeVideo, Camera: "Canon EOS R"}},
+		{"date range", SearchQuery{DateFrom: &from, DateTo: &to}},
+		{"favorites by name", SearchQuery{IsFavorite: &favorite, SortBy: "name"}},
+	}
+	for _, q := range queries {
+		b.Run(q.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				query := q.query
+				if _, err := s.Search(&query); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// searchIDs ID найденных медиа в порядке выдачи
+func searchIDs(tb testing.TB, s *Store, query SearchQuery) []string {
+	tb.Helper()
+	result, err := s.Search(&query)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ids := []string{}
+	for _, m := range result.Media {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+// indexHas проверяет, что ключ key индекса bucket содержит id
+func indexHas(tb testing.TB, s *Store, bucket []byte, key, id string) bool {
+	tb.Helper()
+	var ids []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(bucket).Get([]byte(key)); data != nil {
+			return json.Unmarshal(data, &ids)
+		}
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return slices.Contains(ids, id)
+}
+
+func TestTypeIndexFollowsMediaChanges(t *testing.T) {
+	s := newTestStore(t)
+	a := addMedia(t, s, "a.jpg", day(2023, time.May, 1), nil)
+	b := addMedia(t, s, "b.jpg", day(2023, time.May, 2), nil)
+	if err := s.AddTagsToMedia(a.ID, []string{"sea"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Тип сменился (файл перераспознан как видео): старая запись индекса удаляется
+	a = mustGetMedia(t, s, a.ID)
+	a.Type = MediaTypeVideo
+	if err := s.SaveMedia(a); err != nil {
+		t.Fatal(err)
+	}
+	if indexHas(t, s, bucketIdxType, string(MediaTypeImage), a.ID) {
+		t.Error("type index still lists a.jpg under image")
+	}
+	if got := searchIDs(t, s, SearchQuery{Type: MediaTypeImage}); !slices.Equal(got, []string{b.ID}) {
+		t.Errorf("search type=image = %v, want only b.jpg", got)
+	}
+	if got := searchIDs(t, s, SearchQuery{Types: []MediaType{MediaTypeVideo}}); !slices.Equal(got, []string{a.ID}) {
+		t.Errorf("search types=[video] = %v, want only a.jpg", got)
+	}
+
+	// Удаление убирает медиа из индексов типа, даты и тегов
+	if err := s.DeleteMedia(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if indexHas(t, s, bucketIdxType, string(MediaTypeVideo), a.ID) || indexHas(t, s, bucketIdxDate, "2023-05", a.ID) || indexHas(t, s, bucketIdxTag, "sea", a.ID) {
+		t.Error("deleted a.jpg is still in the type, date or tag index")
+	}
+	if got := searchIDs(t, s, SearchQuery{Type: MediaTypeVideo}); len(got) != 0 {
+		t.Errorf("search type=video after delete = %v, want none", got)
+	}
+	if got := searchIDs(t, s, SearchQuery{Tags: []string{"sea"}}); len(got) != 0 {
+		t.Errorf("search tag=sea after delete = %v, want none", got)
+	}
+	from := day(2023, time.May, 1)
+	if got := searchIDs(t, s, SearchQuery{DateFrom: &from}); !slices.Equal(got, []string{b.ID}) {
+		t.Errorf("search by date after delete = %v, want only b.jpg", got)
+	}
+}
+
+func TestSortMediaOrder(t *testing.T) {
+	may1, may2, may3 := day(2023, time.May, 1), day(2023, time.May, 2), day(2023, time.May, 3)
+	// b и c сняты одновременно, у d нет даты съемки — берется дата изменения
+	fixture := func() []*Media {
+		return []*Media{
+			{ID: "c", Filename: "C.jpg", TakenAt: may2, ModifiedAt: may1, Size: 20},
+			{ID: "a", Filename: "a.jpg", TakenAt: may1, ModifiedAt: may3, Size: 10},
+			{ID: "d", Filename: "d.jpg", ModifiedAt: may3, Size: 20},
+			{ID: "b", Filename: "B.jpg", TakenAt: may2, ModifiedAt: may2, Size: 30},
+		}
+	}
+
+	tests := []struct {
+		sortBy, sortDir string
+		want            []string
+	}{
+		{SortByTakenAt, SortAsc, []string{"a", "b", "c", "d"}},
+		{SortByTakenAt, SortDesc, []string{"d", "b", "c", "a"}},
+		{"", "", []string{"d", "b", "c", "a"}}, // По умолчанию — дата съемки, новые первые
+		{SortByModifiedAt, SortAsc, []string{"c", "b", "a", "d"}},
+		{SortByModifiedAt, SortDesc, []string{"a", "d", "b", "c"}},
+		{SortBySize, SortAsc, []string{"a", "c", "d", "b"}},
+		{SortBySize, SortDesc, []string{"b", "c", "d", "a"}},
+		{SortByFilename, SortAsc, []string{"a", "b", "c", "d"}},
+		{SortByFilename, SortDesc, []string{"d", "c", "b", "a"}},
+	}
+	for _, tt := range tests {
+		media := fixture()
+		sortMedia(media, tt.sortBy, tt.sortDir)
+		var got []string
+		for _, m := range media {
+			got = append(got, m.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("sortMedia(%q, %q) = %v, want %v", tt.sortBy, tt.sortDir, got, tt.want)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want int64
+	}{
+		{"1048576", 1 << 20},
+		{"50MB", 50 << 20},
+		{"1.5 GB", 3 << 29},
+		{"500k", 500 << 10},
+		{" 2tb ", 2 << 40},
+		{"10B", 10},
+	} {
+		if got, err := ParseSize(tc.in); err != nil || got != tc.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", tc.in, got, err, tc.want)
+		}
+	}
+	for _, bad := range []string{"", "MB", "-5MB", "10 PB", "1.2.3K"} {
+		if got, err := ParseSize(bad); err == nil {
+			t.Errorf("ParseSize(%q) = %d, want an error", bad, got)
+		}
+	}
+}
+
+func TestSearchBySizeRange(t *testing.T) {
+	s := newTestStore(t)
+	sized := func(name string, size int64) *Media {
+		return addMedia(t, s, name, day(2023, time.May, 1), func(m *Media) { m.Size = size })
+	}
+	small := sized("small.jpg", 100<<10)
+	medium := sized("medium.jpg", 5<<20)
+	large := sized("large.jpg", 50<<20)
+
+	tests := []struct {
+		name     string
+		min, max int64
+		want     []string
+	}{
+		{"min only", 1 << 20, 0, []string{large.ID, medium.ID}},
+		{"max only", 0, 5 << 20, []string{medium.ID, small.ID}}, // Границы включаются
+		{"range", 1 << 20, 10 << 20, []string{medium.ID}},
+		{"empty range", 60 << 20, 0, []string{}},
+	}
+	for _, tt := range tests {
+		got := searchIDs(t, s, SearchQuery{MinSize: tt.min, MaxSize: tt.max, SortBy: SortBySize})
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSearchTextMatchesTagsAndAlbums(t *testing.T) {
+	s := newTestStore(t)
+	tagged := addMedia(t, s, "img001.jpg", day(2023, time.May, 1), nil)
+	inAlbum := addMedia(t, s, "img002.jpg", day(2023, time.May, 2), nil)
+	inSmart := addMedia(t, s, "img003.jpg", day(2023, time.May, 3), nil)
+	if err := s.AddTagsToMedia(tagged.ID, []string{"Sunset"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveAlbum(&Album{ID: "summer", Name: "Summer in Lisbon", MediaIDs: []string{inAlbum.ID}}); err != nil {
+		t.Fatal(err)
+	}
+	// Название умного альбома не учитывается: его содержимое само задается поиском
+	if err := s.SaveAlbum(&Album{ID: "smart", Name: "Lisbon favorites", Smart: true, Query: &SearchQuery{}, MediaIDs: []string{inSmart.ID}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"sunset", []string{tagged.ID}}, // Тег без учета регистра
+		{"suns", []string{tagged.ID}},   // Часть тега
+		{"LISBON", []string{inAlbum.ID}},
+		{"summer in", []string{inAlbum.ID}},
+		{"img003", []string{inSmart.ID}},
+	}
+	for _, tt := range tests {
+		if got := searchIDs(t, s, SearchQuery{Text: tt.text}); !slices.Equal(got, tt.want) {
+			t.Errorf("text %q = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzySearchToleratesTypos(t *testing.T) {
+	s := newTestStore(t)
+	beach := addMedia(t, s, "beach-vacation.jpg", day(2023, time.May, 1), nil)
+	canon := addMedia(t, s, "img001.jpg", day(2023, time.May, 2), func(m *Media) { m.Metadata.Camera = "Canon EOS R" })
+	cat := addMedia(t, s, "cat.jpg", day(2023, time.May, 3), nil)
+	if err := s.AddTagsToMedia(cat.ID, []string{"sunset"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text  string
+		fuzzy bool
+		want  []string
+	}{
+		{"vacaton", true, []string{beach.ID}}, // Пропущена одна буква
+		{"vacaton", false, []string{}},        // Обычный поиск опечаток не прощает
+		{"cannon", true, []string{canon.ID}},  // Лишняя буква
+		{"sunsed", true, []string{cat.ID}},    // Замена буквы в теге
+		{"beach vacaton", true, []string{beach.ID}},
+		{"beach sunsed", true, []string{}}, // Каждое слово запроса должно совпасть
+		{"cst", true, []string{cat.ID}},    // В коротком слове допускается одна опечатка
+		{"ct", true, []string{}},           // В слове из двух букв — ни одной
+		{"bech", true, []string{beach.ID}},
+		{"bch", true, []string{}}, // Две опечатки для слова из трех букв — слишком много
+	}
+	for _, tt := range tests {
+		if got := searchIDs(t, s, SearchQuery{Text: tt.text, Fuzzy: tt.fuzzy}); !slices.Equal(got, tt.want) {
+			t.Errorf("text %q fuzzy=%v = %v, want %v", tt.text, tt.fuzzy, got, tt.want)
+		}
+	}
+}
+
+func TestSearchCombinesTypesCamerasAndExcludedTags(t *testing.T) {
+	s := newTestStore(t)
+	canon := addMedia(t, s, "canon.jpg", day(2023, time.May, 1), func(m *Media) { m.Metadata.Camera = "Canon EOS R" })
+	nikon := addMedia(t, s, "nikon.mp4", day(2023, time.May, 2), func(m *Media) {
+		m.Type = MediaTypeVideo
+		m.Metadata.Camera = "NIKON Z6"
+	})
+	sony := addMedia(t, s, "sony.arw", day(2023, time.May, 3), func(m *Media) {
+		m.Type = MediaTypeRaw
+		m.Metadata.Camera = "Sony A7 III"
+	})
+	if err := s.AddTagsToMedia(canon.ID, []string{"sea", "family"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddTagsToMedia(nikon.ID, []string{"sea"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []string
+	}{
+		{"any of types", SearchQuery{Types: []MediaType{MediaTypeImage, MediaTypeVideo}}, []string{canon.ID, nikon.ID}},
+		{"type and types", SearchQuery{Type: MediaTypeRaw, Types: []MediaType{MediaTypeVideo}}, []string{nikon.ID, sony.ID}},
+		{"any of cameras", SearchQuery{Cameras: []string{"nikon", "sony"}}, []string{nikon.ID, sony.ID}},
+		{"camera and cameras", SearchQuery{Camera: "canon", Cameras: []string{"canon", "sony"}}, []string{canon.ID}},
+		{"exclude tag", SearchQuery{ExcludeTags: []string{"Family "}}, []string{nikon.ID, sony.ID}},
+		{"tag minus excluded", SearchQuery{Tags: []string{"sea"}, ExcludeTags: []string{"family"}}, []string{nikon.ID}},
+		{"exclude any of tags", SearchQuery{ExcludeTags: []string{"family", "sea"}}, []string{sony.ID}},
+		{"types, cameras and exclusion", SearchQuery{
+			Types:       []MediaType{MediaTypeImage, MediaTypeRaw},
+			Cameras:     []string{"canon", "sony"},
+			ExcludeTags: []string{"sea"},
+		}, []string{sony.ID}},
+	}
+	for _, tt := range tests {
+		tt.query.SortDir = SortAsc
+		if got := searchIDs(t, s, tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
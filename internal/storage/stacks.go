@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Ошибки операций со стопками
+var (
+	ErrStackSize     = errors.New("stack needs at least two media")
+	ErrStackMedia    = errors.New("media not found")
+	ErrStackNotFound = errors.New("stack not found")
+)
+
+// BurstOptions условия серии: снимки одной камеры, между соседними кадрами не больше MaxGap,
+// не меньше MinSize кадров
+type BurstOptions struct {
+	MaxGap  time.Duration
+	MinSize int
+}
+
+// DetectBursts находит серии среди изображений, еще не собранных в стопки.
+// Кадры серии упорядочены по времени съемки, серии — от новых к старым.
+func (s *Store) DetectBursts(opts BurstOptions) ([][]*Media, error) {
+	var candidates []*Media
+	err := s.IterateMedia(func(m *Media) bool {
+		if (m.Type == MediaTypeImage || m.Type == MediaTypeRaw) &&
+			m.StackID == "" && m.DuplicateOf == "" && m.TakenAt.Year() > 1900 {
+			candidates = append(candidates, m)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Metadata.Camera != b.Metadata.Camera {
+			return a.Metadata.Camera < b.Metadata.Camera
+		}
+		if !a.TakenAt.Equal(b.TakenAt) {
+			return a.TakenAt.Before(b.TakenAt)
+		}
+		return a.Filename < b.Filename
+	})
+
+	minSize := max(opts.MinSize, 2)
+	var bursts [][]*Media
+	var current []*Media
+	flush := func() {
+		if len(current) >= minSize {
+			bursts = append(bursts, current)
+		}
+		current = nil
+	}
+	for _, m := range candidates {
+		if len(current) > 0 {
+			prev := current[len(current)-1]
+			if prev.Metadata.Camera != m.Metadata.Camera || m.TakenAt.Sub(prev.TakenAt) > opts.MaxGap {
+				flush()
+			}
+		}
+		current = append(current, m)
+	}
+	flush()
+
+	sort.SliceStable(bursts, func(i, j int) bool {
+		return bursts[i][0].TakenAt.After(bursts[j][0].TakenAt)
+	})
+	return bursts, nil
+}
+
+// StackMedia собирает медиа в стопку: у каждого StackID становится равным ID
+// первого (верхнего) медиа. Медиа из других стопок переносятся в эту, а то, что
+// остается от прежних стопок, пересобирается (см. detachFromStacks).
+func (s *Store) StackMedia(ids []string) (string, error) {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	ids = unique
+	if len(ids) < 2 {
+		return "", ErrStackSize
+	}
+	stackID := ids[0]
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
+		if err := detachFromStacks(tx, ids, stackID); err != nil {
+			return err
+		}
+		return setStackID(tx, ids, stackID)
+	})
+	if err != nil {
+		return "", err
+	}
+	return stackID, nil
+}
+
+// StackBursts собирает в стопки все найденные серии и возвращает число созданных стопок
+func (s *Store) StackBursts(opts BurstOptions) (int, error) {
+	bursts, err := s.DetectBursts(opts)
+	if err != nil {
+		return 0, err
+	}
+	if len(bursts) == 0 {
+		return 0, nil
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
+		for _, burst := range bursts {
+			ids := make([]string, len(burst))
+			for i, m := range burst {
+				ids[i] = m.ID
+			}
+			if err := setStackID(tx, ids, ids[0]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(bursts), nil
+}
+
+// GetStackMedia возвращает неудаленные медиа стопки по времени съемки
+func (s *Store) GetStackMedia(stackID string) ([]*Media, error) {
+	var result []*Media
+	err := s.IterateMedia(func(m *Media) bool {
+		if m.StackID == stackID {
+			result = append(result, m)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TakenAt.Before(result[j].TakenAt)
+	})
+	return result, nil
+}
+
+// UnstackMedia разбирает стопку; ErrStackNotFound — в ней нет ни одного медиа
+func (s *Store) UnstackMedia(stackID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		s.touchNav(tx)
+		var ids []string
+		err := tx.Bucket(bucketMedia).ForEach(func(k, v []byte) error {
+			var m Media
+			if err := json.Unmarshal(v, &m); err == nil && m.StackID == stackID {
+				ids = append(ids, m.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return ErrStackNotFound
+		}
+		return setStackID(tx, ids, "")
+	})
+}
+
+// detachFromStacks убирает ids из прежних стопок перед переносом в стопку stackID.
+// Если из стопки уходит верхнее медиа, верхним становится самое раннее из оставшихся;
+// стопка, где осталось меньше двух медиа, разбирается. Стопка stackID не трогается:
+// ее остальные медиа и так попадают в новую.
+func detachFromStacks(tx *bolt.Tx, ids []string, stackID string) error {
+	b := tx.Bucket(bucketMedia)
+	moving := make(map[string]bool, len(ids))
+	prior := make(map[string]bool)
+	for _, id := range ids {
+		moving[id] = true
+		data := b.Get([]byte(id))
+		if data == nil {
+			continue // Ошибку вернет setStackID
+		}
+		var m Media
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		if m.StackID != "" && m.StackID != stackID {
+			prior[m.StackID] = true
+		}
+	}
+	if len(prior) == 0 {
+		return nil
+	}
+
+	// Bucket нельзя менять внутри ForEach: сначала собираем остатки стопок
+	rest := make(map[string][]*Media)
+	err := b.ForEach(func(k, v []byte) error {
+		var m Media
+		if err := json.Unmarshal(v, &m); err == nil && prior[m.StackID] && !moving[m.ID] {
+			rest[m.StackID] = append(rest[m.StackID], &m)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for old := range prior {
+		members := rest[old]
+		memberIDs := make([]string, len(members))
+		topStays := false
+		for i, m := range members {
+			memberIDs[i] = m.ID
+			topStays = topStays || m.ID == old
+		}
+		switch {
+		case len(members) < 2:
+			err = setStackID(tx, memberIDs, "")
+		case !topStays:
+			sort.Slice(members, func(i, j int) bool {
+				if !members[i].TakenAt.Equal(members[j].TakenAt) {
+					return members[i].TakenAt.Before(members[j].TakenAt)
+				}
+				return members[i].ID < members[j].ID
+			})
+			err = setStackID(tx, memberIDs, members[0].ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setStackID записывает StackID медиа ids
+func setStackID(tx *bolt.Tx, ids []string, stackID string) error {
+	b := tx.Bucket(bucketMedia)
+	for _, id := range ids {
+		data := b.Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("%w: %s", ErrStackMedia, id)
+		}
+		var m Media
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		m.StackID = stackID
+		updated, err := json.Marshal(&m)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(id), updated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CollapseStacks оставляет от каждой стопки одно медиа — верхнее (ID == StackID),
+// а если его в списке нет, первое встреченное — на его месте в списке.
+// counts — сколько медиа стопки было в списке, для показанных вместо стопки.
+func CollapseStacks(media []*Media) (collapsed []*Media, counts map[string]int) {
+	shown := make(map[string]*Media) // StackID -> показанное медиа
+	members := make(map[string]int)
+	for _, m := range media {
+		if m.StackID == "" {
+			continue
+		}
+		members[m.StackID]++
+		if top, ok := shown[m.StackID]; !ok || (m.ID == m.StackID && top.ID != m.StackID) {
+			shown[m.StackID] = m
+		}
+	}
+
+	counts = make(map[string]int)
+	collapsed = make([]*Media, 0, len(media))
+	for _, m := range media {
+		if m.StackID != "" && shown[m.StackID] != m {
+			continue
+		}
+		if m.StackID != "" && members[m.StackID] > 1 {
+			counts[m.ID] = members[m.StackID]
+		}
+		collapsed = append(collapsed, m)
+	}
+	return collapsed, counts
+}
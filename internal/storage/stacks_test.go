@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// stackOf возвращает текущий StackID медиа m
+func stackOf(tb testing.TB, s *Store, m *Media) string {
+	tb.Helper()
+	return mustGetMedia(tb, s, m.ID).StackID
+}
+
+func TestStackMediaRebuildsPriorStacks(t *testing.T) {
+	s := newTestStore(t)
+	a1 := addMedia(t, s, "a1.jpg", day(2023, time.May, 1), nil)
+	a2 := addMedia(t, s, "a2.jpg", day(2023, time.May, 2), nil)
+	a3 := addMedia(t, s, "a3.jpg", day(2023, time.May, 3), nil)
+	c1 := addMedia(t, s, "c1.jpg", day(2023, time.June, 1), nil)
+	c2 := addMedia(t, s, "c2.jpg", day(2023, time.June, 2), nil)
+	n := addMedia(t, s, "n.jpg", day(2023, time.July, 1), nil)
+
+	if _, err := s.StackMedia([]string{a1.ID, a3.ID, a2.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.StackMedia([]string{c1.ID, c2.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Верхнее a1 уходит из стопки, c2 оставляет от второй стопки одно медиа
+	stackID, err := s.StackMedia([]string{n.ID, a1.ID, c2.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stackID != n.ID {
+		t.Fatalf("stack id = %s, want %s", stackID, n.ID)
+	}
+	for _, m := range []*Media{n, a1, c2} {
+		if got := stackOf(t, s, m); got != n.ID {
+			t.Errorf("%s stack = %q, want new stack", m.Filename, got)
+		}
+	}
+	for _, m := range []*Media{a2, a3} {
+		if got := stackOf(t, s, m); got != a2.ID {
+			t.Errorf("%s stack = %q, want rest of old stack topped by a2", m.Filename, got)
+		}
+	}
+	if got := stackOf(t, s, c1); got != "" {
+		t.Errorf("c1 stack = %q, want dissolved single-media stack", got)
+	}
+
+	members, err := s.GetStackMedia(a2.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 {
+		t.Errorf("rebuilt stack has %d media, want 2", len(members))
+	}
+}
+
+func TestStackMediaExtendsStackOfTop(t *testing.T) {
+	s := newTestStore(t)
+	a1 := addMedia(t, s, "a1.jpg", day(2023, time.May, 1), nil)
+	a2 := addMedia(t, s, "a2.jpg", day(2023, time.May, 2), nil)
+	x := addMedia(t, s, "x.jpg", day(2023, time.May, 3), nil)
+	if _, err := s.StackMedia([]string{a1.ID, a2.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Верхнее медиа стопки остается верхним: прежние кадры остаются с ним
+	if _, err := s.StackMedia([]string{a1.ID, x.ID}); err != nil {
+		t.Fatal(err)
+	}
+	members, err := s.GetStackMedia(a1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 3 {
+		t.Errorf("stack has %d media, want 3", len(members))
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsCountersAcrossTrashLifecycle(t *testing.T) {
+	s := newTestStore(t)
+	img := addMedia(t, s, "2023/a.jpg", day(2023, time.May, 1), func(m *Media) { m.Metadata.Camera = "Canon EOS R" })
+	addMedia(t, s, "2023/b.jpg", day(2023, time.May, 2), func(m *Media) { m.Metadata.Camera = "Canon EOS R" })
+	video := addMedia(t, s, "clips/c.mp4", day(2023, time.May, 3), func(m *Media) {
+		m.Type = MediaTypeVideo
+		m.Size = 5000
+	})
+
+	check := func(step string, total, images, videos int, size int64, canon int) {
+		t.Helper()
+		stats, err := s.GetStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.TotalMedia != total || stats.TotalImages != images || stats.TotalVideos != videos || stats.TotalSize != size {
+			t.Errorf("%s: stats = %+v, want total %d, images %d, videos %d, size %d", step, stats, total, images, videos, size)
+		}
+		if got := cameraCount(t, s, "Canon EOS R"); got != canon {
+			t.Errorf("%s: camera count = %d, want %d", step, got, canon)
+		}
+	}
+
+	check("add", 3, 2, 1, 7000, 2)
+
+	if err := s.SoftDeleteMedia(img.ID); err != nil {
+		t.Fatal(err)
+	}
+	check("trash", 2, 1, 1, 6000, 1)
+
+	// Повторное удаление уже удаленного не уменьшает счетчики еще раз
+	if err := s.SoftDeleteMedia(img.ID); err != nil {
+		t.Fatal(err)
+	}
+	check("trash twice", 2, 1, 1, 6000, 1)
+
+	if err := s.RestoreMedia(img.ID); err != nil {
+		t.Fatal(err)
+	}
+	check("restore", 3, 2, 1, 7000, 2)
+
+	if err := s.DeleteMedia(video.ID); err != nil {
+		t.Fatal(err)
+	}
+	check("delete", 2, 2, 0, 2000, 2)
+
+	// Окончательное удаление из корзины не трогает счетчики: медиа уже не учитывалось
+	if err := s.SoftDeleteMedia(img.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteMedia(img.ID); err != nil {
+		t.Fatal(err)
+	}
+	check("delete from trash", 1, 1, 0, 1000, 1)
+
+	rebuilt, err := s.RebuildStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.TotalMedia != 1 || rebuilt.TotalSize != 1000 {
+		t.Errorf("rebuilt stats = %+v, want incremental counters to match a full recount", rebuilt)
+	}
+}
+
+// cameraCount число медиа камеры из счетчиков статистики
+func cameraCount(tb testing.TB, s *Store, camera string) int {
+	tb.Helper()
+	cameras, err := s.ListCameras()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, c := range cameras {
+		if c.Camera == camera {
+			return c.MediaCount
+		}
+	}
+	return 0
+}
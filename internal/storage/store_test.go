@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/logger"
+	bolt "go.etcd.io/bbolt"
+)
+
+// newTestStore открывает пустую БД во временной директории
+func newTestStore(tb testing.TB) *Store {
+	tb.Helper()
+	dir := tb.TempDir()
+	if err := logger.Init(filepath.Join(dir, "logs")); err != nil {
+		tb.Fatal(err)
+	}
+	s, err := NewStore(filepath.Join(dir, "test.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { s.Close() })
+	return s
+}
+
+// addMedia сохраняет изображение /library/<name> с датой съемки takenAt; edit дополняет запись
+func addMedia(tb testing.TB, s *Store, name string, takenAt time.Time, edit func(m *Media)) *Media {
+	tb.Helper()
+	path := "/library/" + name
+	m := &Media{
+		ID:         GenerateID(path),
+		Path:       path,
+		RelPath:    name,
+		Dir:        filepath.Dir(name),
+		Filename:   filepath.Base(name),
+		Ext:        filepath.Ext(name),
+		Type:       MediaTypeImage,
+		Size:       1000,
+		TakenAt:    takenAt,
+		ModifiedAt: takenAt,
+	}
+	if edit != nil {
+		edit(m)
+	}
+	if err := s.SaveMedia(m); err != nil {
+		tb.Fatal(err)
+	}
+	return m
+}
+
+// day дата в полдень UTC
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 12, 0, 0, 0, time.UTC)
+}
+
+// mustGetMedia читает запись медиа, которая должна существовать
+func mustGetMedia(tb testing.TB, s *Store, id string) *Media {
+	tb.Helper()
+	m, err := s.GetMedia(id)
+	if err != nil || m == nil {
+		tb.Fatalf("GetMedia(%s) = %v, %v", id, m, err)
+	}
+	return m
+}
+
+func TestNavVersionTracksNavigationData(t *testing.T) {
+	s := newTestStore(t)
+	m := addMedia(t, s, "a.jpg", day(2023, time.May, 1), nil)
+
+	changes := []struct {
+		name  string
+		write func() error
+	}{
+		{"save media", func() error { return s.SaveMedia(m) }},
+		{"save album", func() error { return s.SaveAlbum(&Album{ID: "trip", Name: "Trip"}) }},
+		{"add to album", func() error { return s.AddMediaToAlbum("trip", []string{m.ID}) }},
+		{"add tags", func() error { return s.AddTagsToMedia(m.ID, []string{"sea"}) }},
+		{"soft delete", func() error { return s.SoftDeleteMedia(m.ID) }},
+	}
+	for _, c := range changes {
+		before := s.NavVersion()
+		if err := c.write(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if s.NavVersion() == before {
+			t.Errorf("%s did not change NavVersion", c.name)
+		}
+	}
+
+	before := s.NavVersion()
+	if err := s.SaveUser(&User{ID: "u1", Username: "alice", Role: RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveSession(&Session{ID: "s1", UserID: "u1", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if s.NavVersion() != before {
+		t.Error("user and session writes changed NavVersion")
+	}
+}
+
+func TestSearchByArtist(t *testing.T) {
+	s := newTestStore(t)
+	anna := addMedia(t, s, "anna.jpg", day(2023, time.May, 1), func(m *Media) { m.Metadata.Artist = "Anna Petrova" })
+	addMedia(t, s, "ivan.jpg", day(2023, time.May, 2), func(m *Media) { m.Metadata.Artist = "Ivan Sidorov" })
+	addMedia(t, s, "none.jpg", day(2023, time.May, 3), nil)
+
+	for _, q := range []*SearchQuery{{Artist: " petrova"}, {Text: "anna"}} {
+		result, err := s.Search(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.TotalCount != 1 || result.Media[0].ID != anna.ID {
+			t.Errorf("search %+v: %d results, want only anna.jpg", *q, result.TotalCount)
+		}
+	}
+}
+
+func TestEnsureSlugAvoidsCollisions(t *testing.T) {
+	s := newTestStore(t)
+	// У обоих ID одинаковые первые 8 символов
+	first := addMedia(t, s, "a.jpg", day(2023, time.May, 1), func(m *Media) { m.ID = "0123456789abcdef" + m.ID[16:] })
+	second := addMedia(t, s, "b.jpg", day(2023, time.May, 2), func(m *Media) { m.ID = "01234567ffffffff" + m.ID[16:] })
+
+	slug1, err := s.EnsureSlug(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slug2, err := s.EnsureSlug(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slug1 != "01234567" || slug2 != "01234567f" {
+		t.Errorf("slugs = %q, %q; want 01234567 and the longer 01234567f", slug1, slug2)
+	}
+	// Повторный вызов возвращает сохраненный slug
+	if again, _ := s.EnsureSlug(second.ID); again != slug2 {
+		t.Errorf("second EnsureSlug = %q, want %q", again, slug2)
+	}
+
+	for _, tc := range []struct{ in, want string }{
+		{slug1, first.ID},
+		{slug2, second.ID},
+		{second.ID, second.ID},
+		{"0123456", ""}, // Префикс короче slug не ищется
+	} {
+		if got, err := s.ResolveMediaID(tc.in); err != nil || got != tc.want {
+			t.Errorf("ResolveMediaID(%q) = %q, %v; want %q", tc.in, got, err, tc.want)
+		}
+	}
+
+	// После удаления медиа slug освобождается
+	if err := s.DeleteMedia(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.ResolveMediaID(slug1); got != "" {
+		t.Errorf("slug of deleted media resolves to %q", got)
+	}
+}
+
+func TestDateIndexServesTimelineAndSearch(t *testing.T) {
+	s := newTestStore(t)
+	may := addMedia(t, s, "may.jpg", day(2023, time.May, 31), nil)
+	june := addMedia(t, s, "june.jpg", day(2023, time.June, 1), nil)
+	// Без даты съемки медиа попадает в период по дате модификации
+	undated := addMedia(t, s, "undated.png", time.Time{}, func(m *Media) { m.ModifiedAt = day(2023, time.May, 10) })
+
+	monthIDs := func(period string) []string {
+		t.Helper()
+		media, err := s.GetTimelineMedia(period)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, m := range media {
+			ids = append(ids, m.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	want := []string{may.ID, undated.ID}
+	slices.Sort(want)
+	if got := monthIDs("2023-05"); !slices.Equal(got, want) {
+		t.Errorf("2023-05 = %v, want may.jpg and undated.png", got)
+	}
+
+	// Край периода проверяется по точной дате, а не только по месяцу
+	from, to := day(2023, time.May, 20), day(2023, time.June, 1)
+	if got := searchIDs(t, s, SearchQuery{DateFrom: &from, DateTo: &to, SortDir: SortAsc}); !slices.Equal(got, []string{may.ID, june.ID}) {
+		t.Errorf("search May 20 - June 1 = %v, want may.jpg, june.jpg", got)
+	}
+	to = day(2023, time.May, 15)
+	if got := searchIDs(t, s, SearchQuery{DateTo: &to}); !slices.Equal(got, []string{undated.ID}) {
+		t.Errorf("search up to May 15 = %v, want undated.png by its modification date", got)
+	}
+
+	// Смена даты переносит медиа в другой период
+	june.TakenAt = day(2023, time.July, 4)
+	if err := s.SaveMedia(june); err != nil {
+		t.Fatal(err)
+	}
+	if got := monthIDs("2023-06"); len(got) != 0 {
+		t.Errorf("2023-06 after date change = %v, want none", got)
+	}
+	if got := monthIDs("2023-07"); !slices.Equal(got, []string{june.ID}) {
+		t.Errorf("2023-07 = %v, want june.jpg", got)
+	}
+
+	// Индекс старой базы без медиа без даты съемки перестраивается при открытии
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketIdxDate).Delete(dateIndexVersionKey); err != nil {
+			return err
+		}
+		if err := removeFromIndex(tx, bucketIdxDate, "2023-05", undated.ID); err != nil {
+			return err
+		}
+		return rebuildDateIndexIfStale(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !indexHas(t, s, bucketIdxDate, "2023-05", undated.ID) {
+		t.Error("rebuilt date index is missing undated.png")
+	}
+}
+
+func TestTimelineCountsMonthsFromDateIndex(t *testing.T) {
+	s := newTestStore(t)
+	addMedia(t, s, "a.jpg", day(2023, time.May, 1), nil)
+	addMedia(t, s, "b.jpg", day(2023, time.May, 20), nil)
+	addMedia(t, s, "c.png", time.Time{}, func(m *Media) { m.ModifiedAt = day(2024, time.January, 5) })
+	// Медиа в корзине не считаются, а месяц только из них не показывается
+	deleted := day(2024, time.March, 1)
+	addMedia(t, s, "d.jpg", day(2023, time.May, 2), func(m *Media) { m.DeletedAt = &deleted })
+	addMedia(t, s, "e.jpg", day(2022, time.December, 31), func(m *Media) { m.DeletedAt = &deleted })
+
+	groups, err := s.GetTimeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, g := range groups {
+		got = append(got, fmt.Sprintf("%s:%d", g.Date, g.MediaCount))
+	}
+	// По убыванию даты
+	if want := []string{"2024-01:1", "2023-05:2"}; !slices.Equal(got, want) {
+		t.Errorf("timeline = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// tagCounts счётчики тегов из списка тегов
+func tagCounts(tb testing.TB, s *Store) map[string]int {
+	tb.Helper()
+	tags, err := s.ListAllTags()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	counts := make(map[string]int, len(tags))
+	for _, tag := range tags {
+		counts[tag.Name] = tag.MediaCount
+	}
+	return counts
+}
+
+// driftTagCount записывает счётчик тега в обход учета, как после сбоя
+func driftTagCount(tb testing.TB, s *Store, name string, count int) {
+	tb.Helper()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(Tag{Name: name, MediaCount: count})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketTags).Put([]byte(name), data)
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestReconcileTagsFixesDriftedCount(t *testing.T) {
+	s := newTestStore(t)
+	a := addMedia(t, s, "a.jpg", day(2023, time.May, 1), nil)
+	b := addMedia(t, s, "b.jpg", day(2023, time.May, 2), nil)
+	for _, m := range []*Media{a, b} {
+		if err := s.AddTagsToMedia(m.ID, []string{"sea"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddTagsToMedia(a.ID, []string{"sun"}); err != nil {
+		t.Fatal(err)
+	}
+
+	driftTagCount(t, s, "sea", 7)
+	driftTagCount(t, s, "ghost", 3) // Тег без медиа
+	if err := s.db.Update(func(tx *bolt.Tx) error { return tx.Bucket(bucketTags).Delete([]byte("sun")) }); err != nil {
+		t.Fatal(err)
+	}
+
+	fixed, err := s.ReconcileTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixed != 3 {
+		t.Errorf("fixed = %d, want 3 (sea, ghost, sun)", fixed)
+	}
+	counts := tagCounts(t, s)
+	if counts["sea"] != 2 || counts["sun"] != 1 || len(counts) != 2 {
+		t.Errorf("counts after reconcile = %v, want sea:2 sun:1", counts)
+	}
+	if media, _ := s.ListMediaByTag("sea"); len(media) != 2 {
+		t.Errorf("sea index = %d media, want 2", len(media))
+	}
+
+	// Повторная сверка ничего не меняет
+	if fixed, err := s.ReconcileTags(); err != nil || fixed != 0 {
+		t.Errorf("second reconcile fixed %d (%v), want 0", fixed, err)
+	}
+}
+
+func TestTagCountNotBelowIndex(t *testing.T) {
+	s := newTestStore(t)
+	a := addMedia(t, s, "a.jpg", day(2023, time.May, 1), nil)
+	b := addMedia(t, s, "b.jpg", day(2023, time.May, 2), nil)
+	for _, m := range []*Media{a, b} {
+		if err := s.AddTagsToMedia(m.ID, []string{"sea"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Заниженный счётчик не должен удалить тег, пока у него есть медиа
+	driftTagCount(t, s, "sea", 1)
+	if err := s.RemoveTagsFromMedia(a.ID, []string{"sea"}); err != nil {
+		t.Fatal(err)
+	}
+	if counts := tagCounts(t, s); counts["sea"] != 1 {
+		t.Errorf("sea count = %d, want 1 (b still tagged)", counts["sea"])
+	}
+}
+
+func TestRebuildStatsReconcilesTags(t *testing.T) {
+	s := newTestStore(t)
+	a := addMedia(t, s, "a.jpg", day(2023, time.May, 1), nil)
+	if err := s.AddTagsToMedia(a.ID, []string{"sea"}); err != nil {
+		t.Fatal(err)
+	}
+	driftTagCount(t, s, "sea", 5)
+
+	if _, err := s.RebuildStats(); err != nil {
+		t.Fatal(err)
+	}
+	if counts := tagCounts(t, s); counts["sea"] != 1 {
+		t.Errorf("sea count after stats rebuild = %d, want 1", counts["sea"])
+	}
+}
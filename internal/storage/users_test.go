@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// userContentFixture создает администратора, пользователя bob с загрузкой и альбомом
+// и чужую загрузку; возвращает ID администратора, bob и медиа bob и чужого медиа
+func userContentFixture(tb testing.TB, s *Store) (adminID, bobID, bobMedia, otherMedia string) {
+	tb.Helper()
+	for _, u := range []*User{
+		{ID: "u-admin", Username: "admin", Role: RoleAdmin},
+		{ID: "u-bob", Username: "bob", Role: RoleEditor},
+		{ID: "u-eve", Username: "eve", Role: RoleEditor},
+	} {
+		if err := s.SaveUser(u); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	bob := addMedia(tb, s, "bob.jpg", day(2023, time.May, 1), func(m *Media) { m.UploadedBy = "u-bob" })
+	other := addMedia(tb, s, "eve.jpg", day(2023, time.May, 2), func(m *Media) { m.UploadedBy = "u-eve" })
+	for _, a := range []*Album{
+		{ID: "bob-album", Name: "Bob", OwnerID: "u-bob"},
+		{ID: "eve-album", Name: "Eve", OwnerID: "u-eve"},
+	} {
+		if err := s.SaveAlbum(a); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return "u-admin", "u-bob", bob.ID, other.ID
+}
+
+func TestDeleteUserPolicies(t *testing.T) {
+	cases := []struct {
+		policy string
+		owner  func(adminID, bobID string) string
+	}{
+		{UserDeleteKeep, func(_, bobID string) string { return bobID }},
+		{UserDeleteReassign, func(adminID, _ string) string { return adminID }},
+		{UserDeleteOrphan, func(_, _ string) string { return "" }},
+	}
+	for _, c := range cases {
+		t.Run(c.policy, func(t *testing.T) {
+			s := newTestStore(t)
+			adminID, bobID, bobMedia, otherMedia := userContentFixture(t, s)
+
+			if err := s.DeleteUser("bob", c.policy, "admin"); err != nil {
+				t.Fatal(err)
+			}
+			if u, _ := s.GetUser("bob"); u != nil {
+				t.Fatal("user was not deleted")
+			}
+
+			want := c.owner(adminID, bobID)
+			if got := mustGetMedia(t, s, bobMedia).UploadedBy; got != want {
+				t.Errorf("uploaded_by = %q, want %q", got, want)
+			}
+			album, err := s.GetAlbum("bob-album")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if album.OwnerID != want {
+				t.Errorf("album owner = %q, want %q", album.OwnerID, want)
+			}
+
+			// Содержимое других пользователей не меняется
+			if got := mustGetMedia(t, s, otherMedia).UploadedBy; got != "u-eve" {
+				t.Errorf("other upload owner = %q, want u-eve", got)
+			}
+			if other, _ := s.GetAlbum("eve-album"); other.OwnerID != "u-eve" {
+				t.Errorf("other album owner = %q, want u-eve", other.OwnerID)
+			}
+		})
+	}
+}
+
+func TestDeleteUserReassignNeedsTarget(t *testing.T) {
+	s := newTestStore(t)
+	_, bobID, bobMedia, _ := userContentFixture(t, s)
+
+	for _, target := range []string{"missing", "bob"} {
+		err := s.DeleteUser("bob", UserDeleteReassign, target)
+		if !errors.Is(err, ErrReassignTarget) {
+			t.Fatalf("reassign to %q: err = %v, want ErrReassignTarget", target, err)
+		}
+	}
+
+	// Ошибка откатывает транзакцию целиком: пользователь и владельцы на месте
+	if u, _ := s.GetUser("bob"); u == nil {
+		t.Error("user was deleted despite the failed reassignment")
+	}
+	if got := mustGetMedia(t, s, bobMedia).UploadedBy; got != bobID {
+		t.Errorf("uploaded_by = %q after failed reassignment, want %q", got, bobID)
+	}
+}
+
+func TestSaveUserWithRoleUpdatesSessionsAndTokens(t *testing.T) {
+	s := newTestStore(t)
+	bob := &User{ID: "u-bob", Username: "bob", Role: RoleAdmin}
+	if err := s.SaveUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	for _, sess := range []*Session{
+		{ID: "bob-1", UserID: "u-bob", Role: RoleAdmin},
+		{ID: "bob-2", UserID: "u-bob", Role: RoleAdmin},
+		{ID: "eve-1", UserID: "u-eve", Role: RoleAdmin},
+	} {
+		if err := s.SaveSession(sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SaveAPIToken(&APIToken{Token: "bob-token", UserID: "u-bob", Role: RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+
+	bob.Role = RoleViewer
+	updated, err := s.SaveUserWithRole(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 3 {
+		t.Errorf("updated = %d, want 2 sessions and 1 token", updated)
+	}
+	for id, want := range map[string]string{"bob-1": RoleViewer, "bob-2": RoleViewer, "eve-1": RoleAdmin} {
+		if sess, _ := s.GetSession(id); sess.Role != want {
+			t.Errorf("session %s role = %q, want %q", id, sess.Role, want)
+		}
+	}
+	if token, _ := s.GetAPIToken("bob-token"); token.Role != RoleViewer {
+		t.Errorf("token role = %q, want viewer", token.Role)
+	}
+	if u, _ := s.GetUser("bob"); u.Role != RoleViewer {
+		t.Errorf("user role = %q, want viewer", u.Role)
+	}
+}
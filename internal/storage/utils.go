@@ -3,6 +3,11 @@ package storage
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
 // GenerateID генерирует уникальный ID на основе пути файла
@@ -10,3 +15,212 @@ func GenerateID(path string) string {
 	hash := sha256.Sum256([]byte(path))
 	return hex.EncodeToString(hash[:])
 }
+
+// NamedColors базовые цвета, которые можно указать в фильтре поиска (?color=red)
+var NamedColors = map[string]string{
+	"red":    "#d32f2f",
+	"orange": "#f57c00",
+	"yellow": "#fbc02d",
+	"green":  "#388e3c",
+	"blue":   "#1976d2",
+	"purple": "#7b1fa2",
+	"pink":   "#e91e63",
+	"brown":  "#795548",
+	"black":  "#111111",
+	"white":  "#f5f5f5",
+	"gray":   "#9e9e9e",
+}
+
+// colorMatchDistance максимальное расстояние до ближайшего цвета палитры для совпадения
+const colorMatchDistance = 150
+
+// NormalizeColor приводит имя цвета или hex (#rgb, #rrggbb) к виду #rrggbb ("" если не распознан)
+func NormalizeColor(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if hex, ok := NamedColors[s]; ok {
+		return hex
+	}
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if _, _, _, ok := parseHexColor("#" + s); !ok {
+		return ""
+	}
+	return "#" + s
+}
+
+// parseHexColor разбирает цвет вида #rrggbb
+func parseHexColor(s string) (r, g, b int, ok bool) {
+	if len(s) != 7 || s[0] != '#' {
+		return 0, 0, 0, false
+	}
+	if _, err := fmt.Sscanf(s[1:], "%02x%02x%02x", &r, &g, &b); err != nil {
+		return 0, 0, 0, false
+	}
+	return r, g, b, true
+}
+
+// colorDistance перцептивно взвешенное расстояние между цветами ("redmean")
+func colorDistance(r1, g1, b1, r2, g2, b2 int) float64 {
+	rmean := float64(r1+r2) / 2
+	dr, dg, db := float64(r1-r2), float64(g1-g2), float64(b1-b2)
+	return math.Sqrt((2+rmean/256)*dr*dr + 4*dg*dg + (2+(255-rmean)/256)*db*db)
+}
+
+// matchesColor проверяет, что ближайший к color цвет палитры достаточно близок
+func matchesColor(palette []string, color string) bool {
+	r, g, b, ok := parseHexColor(color)
+	if !ok {
+		return true
+	}
+	nearest := math.MaxFloat64
+	for _, c := range palette {
+		pr, pg, pb, ok := parseHexColor(c)
+		if !ok {
+			continue
+		}
+		nearest = math.Min(nearest, colorDistance(r, g, b, pr, pg, pb))
+	}
+	return nearest <= colorMatchDistance
+}
+
+// lensPlaceholders значения LensModel, которые камеры пишут вместо названия объектива
+var lensPlaceholders = map[string]bool{
+	"":        true,
+	"----":    true,
+	"unknown": true,
+	"0mm f/0": true,
+}
+
+// NormalizeLensName приводит название объектива к единому виду: лишние пробелы убираются,
+// "24 - 70 mm" -> "24-70mm". Возвращает "" для пустых и служебных значений.
+func NormalizeLensName(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.ReplaceAll(s, " - ", "-")
+	s = strings.ReplaceAll(s, " mm", "mm")
+	s = strings.ReplaceAll(s, "F/", "f/")
+	if lensPlaceholders[strings.ToLower(s)] || strings.Trim(s, "-. ") == "" {
+		return ""
+	}
+	return s
+}
+
+// sizeUnits множители единиц размера (двоичные: 1KB = 1024 байт)
+var sizeUnits = map[string]float64{
+	"":   1,
+	"B":  1,
+	"K":  1 << 10,
+	"KB": 1 << 10,
+	"M":  1 << 20,
+	"MB": 1 << 20,
+	"G":  1 << 30,
+	"GB": 1 << 30,
+	"T":  1 << 40,
+	"TB": 1 << 40,
+}
+
+// ParseSize разбирает размер файла: "1048576", "50MB", "1.5 GB", "500k"
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], strings.TrimSpace(s[i:])
+	}
+
+	mult, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit %q", unit)
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * mult), nil
+}
+
+// splitWords разбивает строку на слова в нижнем регистре ("IMG_2041 Canon-EOS" -> img, 2041, canon, eos)
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// maxFuzzyDistance допустимое число опечаток для слова запроса:
+// короткие слова с 2 опечатками совпадали бы почти с чем угодно
+func maxFuzzyDistance(word []rune) int {
+	switch {
+	case len(word) <= 2:
+		return 0
+	case len(word) <= 4:
+		return 1
+	}
+	return 2
+}
+
+// fuzzyMatch проверяет, что каждое слово запроса совпадает (подстрока или
+// расстояние Левенштейна в пределах maxFuzzyDistance) хотя бы с одним словом полей.
+// Стоимость — O(слов запроса × слов полей × длина²) на каждое медиа, поэтому
+// используется только по явному fuzzy=true, обычный поиск остается подстрочным.
+func fuzzyMatch(text string, fields []string) bool {
+	queryWords := splitWords(text)
+	if len(queryWords) == 0 {
+		return true
+	}
+
+	var words []string
+	for _, f := range fields {
+		words = append(words, splitWords(f)...)
+	}
+
+	for _, qw := range queryWords {
+		q := []rune(qw)
+		maxDist := maxFuzzyDistance(q)
+		found := false
+		for _, w := range words {
+			if strings.Contains(w, qw) || levenshtein(q, []rune(w), maxDist) <= maxDist {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// levenshtein вычисляет расстояние редактирования между a и b.
+// Если расстояние заведомо больше limit, возвращает limit+1 без полного расчета.
+func levenshtein(a, b []rune, limit int) int {
+	if d := len(a) - len(b); d > limit || -d > limit {
+		return limit + 1
+	}
+
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// conditionalGet выполняет GET с токеном администратора и If-None-Match (если задан)
+func (ts *testServer) conditionalGet(tb testing.TB, path, etag string) (int, string, []byte) {
+	tb.Helper()
+	req, _ := http.NewRequest(http.MethodGet, ts.http.URL+path, nil)
+	req.Header.Set("Authorization", "Bearer "+ts.token)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get("ETag"), body
+}
+
+func TestMediaETagRevalidation(t *testing.T) {
+	ts := newTestServer(t)
+	path := filepath.Join(ts.cfg.Storage.MediaPaths[0], "a.jpg")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &storage.Media{ID: storage.GenerateID(path), Path: path, Dir: filepath.Dir(path), Filename: "a.jpg", Type: storage.MediaTypeImage, MimeType: "image/jpeg"}
+	if err := ts.store.SaveMedia(m); err != nil {
+		t.Fatal(err)
+	}
+	thumbPath := ts.thumbGen.GetThumbnailPath(m.ID, "small")
+	if err := os.WriteFile(thumbPath, []byte("thumbnail"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name, url, file string
+	}{
+		{"original", "/media/" + m.ID, path},
+		{"thumbnail", "/media/" + m.ID + "/thumb/small", thumbPath},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			code, etag, body := ts.conditionalGet(t, c.url, "")
+			if code != http.StatusOK || etag == "" || len(body) == 0 {
+				t.Fatalf("first GET = %d, ETag %q, %d bytes; want 200 with ETag and body", code, etag, len(body))
+			}
+
+			// Повторный запрос с тем же ETag — 304 без тела
+			code, again, body := ts.conditionalGet(t, c.url, etag)
+			if code != http.StatusNotModified || len(body) != 0 {
+				t.Errorf("revalidation = %d with %d bytes, want 304 without body", code, len(body))
+			}
+			if again != etag {
+				t.Errorf("ETag on 304 = %q, want %q", again, etag)
+			}
+
+			// Файл изменился — новый ETag, старый больше не подходит
+			if err := os.WriteFile(c.file, []byte("edited content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(c.file, later, later); err != nil {
+				t.Fatal(err)
+			}
+			code, changed, body := ts.conditionalGet(t, c.url, etag)
+			if code != http.StatusOK || string(body) != "edited content" {
+				t.Errorf("after modification = %d %q, want 200 with new content", code, body)
+			}
+			if changed == "" || changed == etag {
+				t.Errorf("ETag after modification = %q, want a new value (was %q)", changed, etag)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func albumsRouter(h *Handlers) http.Handler {
+	r := chi.NewRouter()
+	r.Put("/api/albums/{id}/cover", h.SetAlbumCover)
+	r.Put("/api/albums/{id}/slideshow", h.SetAlbumSlideshow)
+	return r
+}
+
+// albumRequest выполняет запрос к albumsRouter от имени role
+func albumRequest(h *Handlers, role, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	albumsRouter(h).ServeHTTP(rec, withRole(httptest.NewRequest(method, path, strings.NewReader(body)), role))
+	return rec
+}
+
+func TestSetAlbumCoverOnlyFromMembers(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	member := addTestMedia(t, h, filepath.Join(root, "member.jpg"), nil)
+	outsider := addTestMedia(t, h, filepath.Join(root, "outsider.jpg"), nil)
+	if err := h.store.SaveAlbum(&storage.Album{ID: "trip", Name: "Trip"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.store.AddMediaToAlbum("trip", []string{member.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, role, album, body string
+		want                    int
+	}{
+		{"viewer", storage.RoleViewer, "trip", `{"media_id": "` + member.ID + `"}`, http.StatusForbidden},
+		{"missing media_id", storage.RoleEditor, "trip", `{}`, http.StatusBadRequest},
+		{"not in album", storage.RoleEditor, "trip", `{"media_id": "` + outsider.ID + `"}`, http.StatusBadRequest},
+		{"unknown album", storage.RoleEditor, "nope", `{"media_id": "` + member.ID + `"}`, http.StatusNotFound},
+		{"member", storage.RoleEditor, "trip", `{"media_id": "` + member.ID + `"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := albumRequest(h, tt.role, http.MethodPut, "/api/albums/"+tt.album+"/cover", tt.body); rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	album, err := h.store.GetAlbum("trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if album.CoverID != member.ID {
+		t.Errorf("cover = %q, want %q", album.CoverID, member.ID)
+	}
+}
+
+func TestSetAlbumSlideshowValidation(t *testing.T) {
+	h, _ := newTestHandlers(t, "")
+	if err := h.store.SaveAlbum(&storage.Album{ID: "trip", Name: "Trip"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, role, album, body string
+		want                    int
+	}{
+		{"viewer", storage.RoleViewer, "trip", `{"slide_interval_seconds": 10}`, http.StatusForbidden},
+		{"negative interval", storage.RoleEditor, "trip", `{"slide_interval_seconds": -1}`, http.StatusBadRequest},
+		{"interval over an hour", storage.RoleEditor, "trip", `{"slide_interval_seconds": 3601}`, http.StatusBadRequest},
+		{"unknown transition", storage.RoleEditor, "trip", `{"transition": "zoom"}`, http.StatusBadRequest},
+		{"unknown album", storage.RoleEditor, "nope", `{"slide_interval_seconds": 10}`, http.StatusNotFound},
+		{"valid", storage.RoleEditor, "trip", `{"slide_interval_seconds": 10, "shuffle": true, "transition": "slide"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := albumRequest(h, tt.role, http.MethodPut, "/api/albums/"+tt.album+"/slideshow", tt.body); rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	album, err := h.store.GetAlbum("trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if album.SlideIntervalSeconds != 10 || !album.Shuffle || album.Transition != storage.TransitionSlide {
+		t.Errorf("slideshow = %ds shuffle=%v %q, want 10s shuffle slide", album.SlideIntervalSeconds, album.Shuffle, album.Transition)
+	}
+
+	// Нули возвращают настройки по умолчанию
+	if rec := albumRequest(h, storage.RoleEditor, http.MethodPut, "/api/albums/trip/slideshow", `{}`); rec.Code != http.StatusOK {
+		t.Fatalf("reset = %d: %s", rec.Code, rec.Body)
+	}
+	if album, _ := h.store.GetAlbum("trip"); album.SlideIntervalSeconds != 0 || album.Shuffle || album.Transition != "" {
+		t.Errorf("after reset = %ds shuffle=%v %q, want defaults", album.SlideIntervalSeconds, album.Shuffle, album.Transition)
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/photocore/photocore/internal/auth"
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// ExportCatalog отдает каталог (медиа, альбомы, теги, избранное) файлом NDJSON (только admin)
+func (h *Handlers) ExportCatalog(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanManageUsers(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	filename := "photocore-catalog-" + time.Now().Format("20060102") + ".ndjson"
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+
+	// Данные пишутся потоком: после первой строки сменить статус ответа уже нельзя
+	if err := h.store.ExportCatalog(w); err != nil {
+		logger.ErrorLog.Printf("Catalog export failed: %v", err)
+	}
+}
+
+// ImportCatalog восстанавливает каталог из экспорта ExportCatalog в теле запроса (только admin)
+func (h *Handlers) ImportCatalog(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanManageUsers(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if err := h.store.ImportCatalog(r.Body); err != nil {
+		if errors.Is(err, storage.ErrCatalogFormat) || errors.Is(err, storage.ErrParentAlbum) || errors.Is(err, storage.ErrAlbumCycle) {
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.cache.Clear()
+
+	h.jsonResponse(w, map[string]string{"status": "imported"})
+}
+
+// csvColumns столбцы выгрузки метаданных в CSV
+var csvColumns = []string{
+	"filename", "taken_at", "camera", "lens", "focal_length", "aperture",
+	"shutter_speed", "iso", "gps_lat", "gps_lon", "tags",
+}
+
+// csvPageSize сколько медиа читается из базы за раз при выгрузке CSV
+const csvPageSize = 500
+
+// ExportCSV выгружает метаданные медиа в CSV для анализа в таблицах.
+// Фильтры те же, что у /api/search; сортировка и пагинация не применяются (порядок хранения).
+// Сначала собираются ID подходящих медиа, затем записи читаются страницами и пишутся
+// вне транзакций — медленный клиент не держит транзакцию чтения. Координаты — только с доступом к геоданным.
+func (h *Handlers) ExportCSV(w http.ResponseWriter, r *http.Request) {
+	query := h.searchQuery(r)
+	showGPS := h.canViewGeo(r)
+
+	var ids []string
+	err := h.store.IterateSearch(query, func(m *storage.Media) bool {
+		ids = append(ids, m.ID)
+		return true
+	})
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := "photocore-metadata-" + time.Now().Format("20060102") + ".csv"
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+
+	cw := csv.NewWriter(w)
+	err = cw.Write(csvColumns)
+	for start := 0; err == nil && start < len(ids); start += csvPageSize {
+		var page []*storage.Media
+		if page, err = h.store.GetMediaByIDs(ids[start:min(start+csvPageSize, len(ids))]); err != nil {
+			break
+		}
+		for _, m := range page {
+			if err = cw.Write(csvRow(m, showGPS)); err != nil {
+				break // Клиент отключился — дальше не читаем
+			}
+		}
+	}
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		logger.ErrorLog.Printf("CSV export failed: %v", err)
+	}
+}
+
+// csvRow строка CSV для медиа; пустые значения метаданных — пустые ячейки
+func csvRow(m *storage.Media, showGPS bool) []string {
+	takenAt := ""
+	if !m.TakenAt.IsZero() && m.TakenAt.Year() > 1900 {
+		takenAt = m.TakenAt.Format(time.RFC3339)
+	}
+	iso := ""
+	if m.Metadata.ISO > 0 {
+		iso = strconv.Itoa(m.Metadata.ISO)
+	}
+	lat, lon := "", ""
+	if showGPS && (m.Metadata.GPSLat != 0 || m.Metadata.GPSLon != 0) {
+		lat = strconv.FormatFloat(m.Metadata.GPSLat, 'f', 6, 64)
+		lon = strconv.FormatFloat(m.Metadata.GPSLon, 'f', 6, 64)
+	}
+
+	return []string{
+		csvText(m.Filename),
+		takenAt,
+		csvText(m.Metadata.Camera),
+		csvText(m.Metadata.Lens),
+		csvText(m.Metadata.FocalLength),
+		csvText(m.Metadata.Aperture),
+		csvText(m.Metadata.ShutterSpeed),
+		iso,
+		lat,
+		lon,
+		csvText(strings.Join(m.Tags, "; ")),
+	}
+}
+
+// csvText защищает текст от выполнения как формулы в Excel и LibreOffice
+// (значения, начинающиеся с = + - @). Кавычки и запятые экранирует csv.Writer.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
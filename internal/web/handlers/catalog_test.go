@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// exportCSV выполняет ExportCSV с параметрами query от имени роли role и разбирает ответ
+func exportCSV(tb testing.TB, h *Handlers, role, query string) [][]string {
+	tb.Helper()
+	rec := httptest.NewRecorder()
+	h.ExportCSV(rec, withRole(httptest.NewRequest(http.MethodGet, "/api/export/csv?"+query, nil), role))
+	if rec.Code != http.StatusOK {
+		tb.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		tb.Errorf("content type = %q", ct)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		tb.Fatalf("response is not valid CSV: %v", err)
+	}
+	return rows
+}
+
+func TestExportCSVSpecialCharacters(t *testing.T) {
+	h, root := newTestHandlers(t, "server:\n  geo_visibility: editor\n")
+	tricky := addTestMedia(t, h, filepath.Join(root, `sea, "pier".jpg`), func(m *storage.Media) {
+		m.TakenAt = time.Date(2023, 5, 1, 14, 30, 0, 0, time.UTC)
+		m.Metadata.Camera = "=HYPERLINK(\"http://evil\")"
+		m.Metadata.Lens = "24-70mm\nf/2.8"
+		m.Metadata.ISO = 200
+		m.Metadata.GPSLat = 59.9386
+		m.Metadata.GPSLon = 30.3141
+		m.Tags = []string{"sea", "+1"}
+	})
+	addTestMedia(t, h, filepath.Join(root, "plain.jpg"), nil)
+
+	rows := exportCSV(t, h, storage.RoleEditor, "")
+	if len(rows) != 3 {
+		t.Fatalf("rows = %d, want header and 2 media", len(rows))
+	}
+	if strings.Join(rows[0], ",") != strings.Join(csvColumns, ",") {
+		t.Errorf("header = %v, want %v", rows[0], csvColumns)
+	}
+
+	var row []string
+	for _, r := range rows[1:] {
+		if r[0] == tricky.Filename {
+			row = r
+		}
+	}
+	if row == nil {
+		t.Fatalf("no row for %q in %v", tricky.Filename, rows)
+	}
+	want := map[string]string{
+		"taken_at": "2023-05-01T14:30:00Z",
+		"camera":   "'=HYPERLINK(\"http://evil\")", // Формулы экранируются
+		"lens":     "24-70mm\nf/2.8",
+		"iso":      "200",
+		"gps_lat":  "59.938600",
+		"gps_lon":  "30.314100",
+		"tags":     "sea; +1",
+	}
+	for i, column := range csvColumns {
+		if expected, ok := want[column]; ok && row[i] != expected {
+			t.Errorf("%s = %q, want %q", column, row[i], expected)
+		}
+	}
+
+	// Без доступа к геоданным координаты пустые
+	for _, r := range exportCSV(t, h, storage.RoleViewer, "") {
+		if r[8] != "gps_lat" && (r[8] != "" || r[9] != "") {
+			t.Errorf("viewer sees coordinates %q, %q", r[8], r[9])
+		}
+	}
+}
+
+func TestExportCSVFiltersAndPages(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	// Больше одной страницы выгрузки
+	for i := 0; i < csvPageSize+3; i++ {
+		addTestMedia(t, h, filepath.Join(root, fmt.Sprintf("img%04d.jpg", i)), nil)
+	}
+	addTestMedia(t, h, filepath.Join(root, "clip.mp4"), func(m *storage.Media) { m.Type = storage.MediaTypeVideo })
+
+	if rows := exportCSV(t, h, storage.RoleViewer, ""); len(rows) != csvPageSize+5 {
+		t.Errorf("all media: %d rows, want %d", len(rows), csvPageSize+5)
+	}
+	rows := exportCSV(t, h, storage.RoleViewer, "type=video")
+	if len(rows) != 2 || rows[1][0] != "clip.mp4" {
+		t.Errorf("type=video rows = %v", rows)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func colorsRouter(h *Handlers) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/api/media/{id}/colors", h.MediaColors)
+	r.Post("/api/media/{id}/colors", h.ComputeMediaColors)
+	return r
+}
+
+func TestMediaColorsGetIsReadOnly(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	path := filepath.Join(root, "red.jpg")
+	writeSolidJPEG(t, path, color.RGBA{R: 220, G: 20, B: 30, A: 255}, 64)
+	m := addTestMedia(t, h, path, nil)
+
+	rec := httptest.NewRecorder()
+	req := withRole(httptest.NewRequest(http.MethodGet, "/api/media/"+m.ID+"/colors", nil), storage.RoleViewer)
+	colorsRouter(h).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET status = %d, want 200", rec.Code)
+	}
+
+	saved, _ := h.store.GetMedia(m.ID)
+	if len(saved.Colors) != 0 {
+		t.Errorf("GET saved colors %v, want no write", saved.Colors)
+	}
+}
+
+func TestComputeMediaColorsRequiresEdit(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	path := filepath.Join(root, "red.jpg")
+	writeSolidJPEG(t, path, color.RGBA{R: 220, G: 20, B: 30, A: 255}, 64)
+	m := addTestMedia(t, h, path, nil)
+
+	rec := httptest.NewRecorder()
+	req := withRole(httptest.NewRequest(http.MethodPost, "/api/media/"+m.ID+"/colors", nil), storage.RoleViewer)
+	colorsRouter(h).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("viewer POST status = %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = withRole(httptest.NewRequest(http.MethodPost, "/api/media/"+m.ID+"/colors", nil), storage.RoleEditor)
+	colorsRouter(h).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("editor POST status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Colors []string `json:"colors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || len(body.Colors) == 0 {
+		t.Fatalf("POST colors = %v (%v), want a palette", body.Colors, err)
+	}
+
+	saved, _ := h.store.GetMedia(m.ID)
+	if len(saved.Colors) == 0 {
+		t.Error("computed palette was not saved")
+	}
+}
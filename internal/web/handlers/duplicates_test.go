@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func TestListDuplicatesGroups(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	withHash := func(checksum string, hash uint64) func(*storage.Media) {
+		return func(m *storage.Media) {
+			m.Checksum = checksum
+			m.ImageHash = hash
+			m.Size = 1000
+		}
+	}
+	// Точные копии: одинаковый checksum
+	addTestMedia(t, h, root+"/a.jpg", withHash("sum-a", 0xF0F0F0F0F0F0F0F0))
+	addTestMedia(t, h, root+"/a-copy.jpg", withHash("sum-a", 0xF0F0F0F0F0F0F0F0))
+	// Похожие: pHash отличается на 2 бита
+	addTestMedia(t, h, root+"/b.jpg", withHash("sum-b", 0x0123456789ABCDEF))
+	addTestMedia(t, h, root+"/b-edit.jpg", withHash("sum-b2", 0x0123456789ABCDEF^0b101))
+	// Непохожее
+	addTestMedia(t, h, root+"/c.jpg", withHash("sum-c", 0xAAAAAAAAAAAAAAAA))
+
+	rec := httptest.NewRecorder()
+	req := withRole(httptest.NewRequest(http.MethodGet, "/api/duplicates?threshold=5", nil), storage.RoleEditor)
+	h.ListDuplicates(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var page struct {
+		Groups []struct {
+			Type     string `json:"type"`
+			Distance int    `json:"distance"`
+			Media    []struct {
+				ID       string `json:"id"`
+				Filename string `json:"filename"`
+			} `json:"media"`
+		} `json:"groups"`
+		TotalCount int  `json:"total_count"`
+		HasMore    bool `json:"has_more"`
+		Threshold  int  `json:"threshold"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+
+	if page.TotalCount != 2 || len(page.Groups) != 2 || page.HasMore || page.Threshold != 5 {
+		t.Fatalf("page = %+v, want 2 groups with threshold 5", page)
+	}
+	exact, similar := page.Groups[0], page.Groups[1]
+	if exact.Type != "exact" || exact.Distance != 0 || len(exact.Media) != 2 {
+		t.Errorf("first group = %+v, want exact pair", exact)
+	}
+	if similar.Type != "similar" || similar.Distance != 2 || len(similar.Media) != 2 {
+		t.Errorf("second group = %+v, want similar pair at distance 2", similar)
+	}
+	for _, g := range page.Groups {
+		for _, m := range g.Media {
+			if m.ID == "" || m.Filename == "" {
+				t.Errorf("group media lacks details: %+v", m)
+			}
+		}
+	}
+
+	// Пагинация: limit=1 отдает первую группу и признак продолжения
+	rec = httptest.NewRecorder()
+	req = withRole(httptest.NewRequest(http.MethodGet, "/api/duplicates?threshold=5&limit=1", nil), storage.RoleEditor)
+	h.ListDuplicates(rec, req)
+	page.Groups = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Groups) != 1 || !page.HasMore || page.TotalCount != 2 {
+		t.Errorf("limit=1 page: %d groups, has_more %v, total %d", len(page.Groups), page.HasMore, page.TotalCount)
+	}
+}
+
+func TestListDuplicatesRequiresEdit(t *testing.T) {
+	h, _ := newTestHandlers(t, "")
+	rec := httptest.NewRecorder()
+	h.ListDuplicates(rec, withRole(httptest.NewRequest(http.MethodGet, "/api/duplicates", nil), storage.RoleViewer))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("viewer status = %d, want 403", rec.Code)
+	}
+}
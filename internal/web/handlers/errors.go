@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// ErrorCode машиночитаемый код ошибки API (поле "code" рядом с текстом "error")
+type ErrorCode string
+
+const (
+	ErrCodeValidation   ErrorCode = "validation_failed" // Неверные параметры или тело запроса
+	ErrCodeUnauthorized ErrorCode = "unauthorized"      // Нет сессии или токена
+	ErrCodeForbidden    ErrorCode = "forbidden"         // Не хватает прав роли или токена
+	ErrCodeNotFound     ErrorCode = "not_found"
+	ErrCodeConflict     ErrorCode = "conflict"          // Противоречит текущему состоянию (имя занято и т.п.)
+	ErrCodeUnsupported  ErrorCode = "unsupported"       // Формат файла не поддерживается
+	ErrCodeProcessing   ErrorCode = "processing_failed" // Файл не удалось обработать (превью, палитра)
+	ErrCodeRateLimited  ErrorCode = "rate_limited"      // Слишком много запросов, повторить позже
+	ErrCodeUnavailable  ErrorCode = "unavailable"       // Временно недоступно (превью генерируется, база закрыта)
+	ErrCodeInternal     ErrorCode = "internal"
+)
+
+// apiError тело ответа с ошибкой
+type apiError struct {
+	Error string    `json:"error"`
+	Code  ErrorCode `json:"code"`
+}
+
+// errorCodeFor код ошибки по умолчанию для HTTP-статуса
+func errorCodeFor(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrCodeValidation
+	case http.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrCodeForbidden
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusConflict:
+		return ErrCodeConflict
+	case http.StatusUnsupportedMediaType:
+		return ErrCodeUnsupported
+	case http.StatusUnprocessableEntity:
+		return ErrCodeProcessing
+	case http.StatusTooManyRequests:
+		return ErrCodeRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrCodeUnavailable
+	default:
+		return ErrCodeInternal
+	}
+}
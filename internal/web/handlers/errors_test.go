@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/photocore/photocore/internal/storage"
+	"github.com/photocore/photocore/internal/worker"
+)
+
+// errorCode разбирает тело ответа с ошибкой API и возвращает его code
+func errorCode(tb testing.TB, rec *httptest.ResponseRecorder) ErrorCode {
+	tb.Helper()
+	var body apiError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		tb.Fatalf("error body %q is not JSON: %v", rec.Body, err)
+	}
+	if body.Error == "" {
+		tb.Errorf("error body %s has no message", rec.Body)
+	}
+	return body.Code
+}
+
+func TestJSONErrorDefaultCodes(t *testing.T) {
+	h, _ := newTestHandlers(t, "")
+	for status, want := range map[int]ErrorCode{
+		http.StatusBadRequest:          ErrCodeValidation,
+		http.StatusForbidden:           ErrCodeForbidden,
+		http.StatusNotFound:            ErrCodeNotFound,
+		http.StatusConflict:            ErrCodeConflict,
+		http.StatusTooManyRequests:     ErrCodeRateLimited,
+		http.StatusServiceUnavailable:  ErrCodeUnavailable,
+		http.StatusInternalServerError: ErrCodeInternal,
+	} {
+		rec := httptest.NewRecorder()
+		h.jsonError(rec, "failed", status)
+		if rec.Code != status {
+			t.Errorf("status = %d, want %d", rec.Code, status)
+		}
+		if got := errorCode(t, rec); got != want {
+			t.Errorf("status %d: code = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestThumbnailErrorsAreJSON(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	// Пул не запущен: задачи только ставятся в очередь
+	h.thumbService = worker.NewThumbnailService(worker.NewPool(1, 10, nil), h.store, h.thumbGen)
+
+	path := filepath.Join(root, "broken.jpg")
+	if err := os.WriteFile(path, []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := addTestMedia(t, h, path, nil)
+
+	r := chi.NewRouter()
+	r.Get("/thumb/{id}", h.ServeThumbnail)
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, withRole(httptest.NewRequest(http.MethodGet, "/thumb/"+m.ID+query, nil), storage.RoleViewer))
+		return rec
+	}
+
+	// Превью еще нет: 503, пока оно генерируется
+	rec := get("")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("missing thumbnail status = %d, want 503", rec.Code)
+	}
+	if got := errorCode(t, rec); got != ErrCodeUnavailable {
+		t.Errorf("missing thumbnail code = %q, want %q", got, ErrCodeUnavailable)
+	}
+
+	// Синхронная генерация падает на битом файле, дальше ошибка постоянная: 422
+	get("?wait=1")
+	rec = get("")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("failed thumbnail status = %d, want 422", rec.Code)
+	}
+	if got := errorCode(t, rec); got != ErrCodeProcessing {
+		t.Errorf("failed thumbnail code = %q, want %q", got, ErrCodeProcessing)
+	}
+}
+
+func TestTemplateErrorServesCleanErrorPage(t *testing.T) {
+	h, _ := newTestHandlers(t, "")
+	// Ошибка выполнения после уже выведенной разметки
+	tmpl := template.Must(template.New("page.html").Parse(`{{define "base"}}<p>top of the page</p>{{index .Items 5}}{{end}}`))
+
+	rec := httptest.NewRecorder()
+	h.executeTemplate(rec, tmpl, "page.html", "base", map[string]interface{}{"Items": []string{"a"}})
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+	if body := rec.Body.String(); body != errorPageHTML {
+		t.Errorf("body = %q, want only the error page", body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+
+	rec = httptest.NewRecorder()
+	h.executeTemplate(rec, tmpl, "page.html", "base", map[string]interface{}{"Items": []string{"a", "b", "c", "d", "e", "f"}})
+	if rec.Code != http.StatusOK || rec.Body.String() != "<p>top of the page</p>f" {
+		t.Errorf("successful render = %d %q", rec.Code, rec.Body)
+	}
+}
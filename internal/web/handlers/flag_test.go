@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func flagRouter(h *Handlers) http.Handler {
+	r := chi.NewRouter()
+	r.Post("/api/media/{id}/flag", h.FlagMedia)
+	r.Delete("/api/media/{id}/flag", h.UnflagMedia)
+	r.Get("/api/flagged", h.ListFlagged)
+	return r
+}
+
+func TestFlagForReviewWorkflow(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	m := addTestMedia(t, h, filepath.Join(root, "wrong-date.jpg"), nil)
+	trashed := addTestMedia(t, h, filepath.Join(root, "trashed.jpg"), nil)
+	if err := h.store.SoftDeleteMedia(trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(role, method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		flagRouter(h).ServeHTTP(rec, withRole(httptest.NewRequest(method, path, strings.NewReader(body)), role))
+		return rec
+	}
+
+	// Отметить может любой пользователь, но не медиа из корзины
+	if rec := do(storage.RoleViewer, http.MethodPost, "/api/media/"+m.ID+"/flag", `{"reason": "  wrong date  "}`); rec.Code != http.StatusOK {
+		t.Fatalf("viewer flag = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(storage.RoleViewer, http.MethodPost, "/api/media/"+trashed.ID+"/flag", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("flag trashed media = %d, want 404", rec.Code)
+	}
+	flagged := mustGetTestMedia(t, h, m.ID)
+	if !flagged.Flagged || flagged.FlagReason != "wrong date" || flagged.FlaggedBy != "user-viewer" || flagged.FlaggedAt == nil {
+		t.Errorf("flagged media = %v %q by %q at %v, want flagged with trimmed reason by user-viewer", flagged.Flagged, flagged.FlagReason, flagged.FlaggedBy, flagged.FlaggedAt)
+	}
+
+	// Список и снятие отметки — только для администратора
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/api/flagged"},
+		{http.MethodDelete, "/api/media/" + m.ID + "/flag"},
+	} {
+		if rec := do(storage.RoleEditor, req.method, req.path, ""); rec.Code != http.StatusForbidden {
+			t.Errorf("editor %s %s = %d, want 403", req.method, req.path, rec.Code)
+		}
+	}
+	rec := do(storage.RoleAdmin, http.MethodGet, "/api/flagged", "")
+	var list []storage.Media
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || len(list) != 1 || list[0].ID != m.ID {
+		t.Errorf("flagged list = %d %d items, want only %s", rec.Code, len(list), m.Filename)
+	}
+
+	flag := true
+	if result, _ := h.store.Search(&storage.SearchQuery{Flagged: &flag}); result.TotalCount != 1 {
+		t.Errorf("search flagged = %d, want 1", result.TotalCount)
+	}
+
+	if rec := do(storage.RoleAdmin, http.MethodDelete, "/api/media/"+m.ID+"/flag", ""); rec.Code != http.StatusOK {
+		t.Fatalf("admin unflag = %d: %s", rec.Code, rec.Body)
+	}
+	if m := mustGetTestMedia(t, h, m.ID); m.Flagged || m.FlagReason != "" || m.FlaggedBy != "" || m.FlaggedAt != nil {
+		t.Errorf("unflagged media still has flag data: %+v", m)
+	}
+}
+
+// mustGetTestMedia читает запись медиа из хранилища
+func mustGetTestMedia(tb testing.TB, h *Handlers, id string) *storage.Media {
+	tb.Helper()
+	m, err := h.store.GetMedia(id)
+	if err != nil || m == nil {
+		tb.Fatalf("media %s: %v, %v", id, m, err)
+	}
+	return m
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// getGeo запрашивает /api/geo с параметрами query от имени администратора
+func getGeo(tb testing.TB, h *Handlers, query string) *httptest.ResponseRecorder {
+	tb.Helper()
+	rec := httptest.NewRecorder()
+	req := withRole(httptest.NewRequest(http.MethodGet, "/api/geo"+query, nil), storage.RoleAdmin)
+	h.GeoPoints(rec, req)
+	return rec
+}
+
+func TestGeoPointsBBoxAndZoom(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	for i, coords := range [][2]float64{{55.75, 37.62}, {55.751, 37.621}, {48.86, 2.35}} {
+		addTestMedia(t, h, filepath.Join(root, string(rune('a'+i))+".jpg"), func(m *storage.Media) {
+			m.Metadata.GPSLat, m.Metadata.GPSLon = coords[0], coords[1]
+		})
+	}
+
+	var points []*storage.GeoPoint
+	rec := getGeo(t, h, "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &points); err != nil || len(points) != 3 {
+		t.Fatalf("no params: %d points (%v), want all 3", len(points), err)
+	}
+
+	points = nil
+	rec = getGeo(t, h, "?bbox=50,30,60,40")
+	if err := json.Unmarshal(rec.Body.Bytes(), &points); err != nil || len(points) != 2 {
+		t.Fatalf("bbox: %d points (%v), want 2 in Moscow", len(points), err)
+	}
+
+	var clusters []*storage.GeoCluster
+	rec = getGeo(t, h, "?zoom=3")
+	if err := json.Unmarshal(rec.Body.Bytes(), &clusters); err != nil || len(clusters) != 2 {
+		t.Fatalf("zoom 3: %d markers (%v), want 2", len(clusters), err)
+	}
+	if clusters[0].Count != 2 {
+		t.Errorf("largest cluster count = %d, want 2", clusters[0].Count)
+	}
+
+	for _, query := range []string{"?bbox=1,2,3", "?bbox=60,30,50,40", "?bbox=a,b,c,d", "?zoom=-1", "?zoom=x"} {
+		if rec := getGeo(t, h, query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestParseGeoBoundsWrapsLongitude(t *testing.T) {
+	b, err := parseGeoBounds("-10,170,10,190")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.MinLon != 170 || b.MaxLon != -170 {
+		t.Errorf("bounds = %+v, want lon 170..-170", b)
+	}
+	if !b.Contains(0, 179) || !b.Contains(0, -175) || b.Contains(0, 0) {
+		t.Error("wrapped bounds do not cross the antimeridian")
+	}
+
+	b, err = parseGeoBounds("-80,-400,80,400")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.MinLon != -180 || b.MaxLon != 180 {
+		t.Errorf("world-wide bounds = %+v, want full longitude range", b)
+	}
+}
+
+func TestGeoVisibilityHidesGPS(t *testing.T) {
+	h, root := newTestHandlers(t, "server:\n  geo_visibility: editor\n")
+	m := addTestMedia(t, h, filepath.Join(root, "a.jpg"), func(m *storage.Media) {
+		m.Metadata.GPSLat, m.Metadata.GPSLon = 55.75, 37.62
+		m.Metadata.Place, m.Metadata.Country = "Moscow", "Russia"
+	})
+
+	for role, want := range map[string]int{
+		storage.RoleViewer: http.StatusForbidden,
+		storage.RoleEditor: http.StatusOK,
+		storage.RoleAdmin:  http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		h.GeoPoints(rec, withRole(httptest.NewRequest(http.MethodGet, "/api/geo", nil), role))
+		if rec.Code != want {
+			t.Errorf("%s: /api/geo = %d, want %d", role, rec.Code, want)
+		}
+	}
+
+	viewer := withRole(httptest.NewRequest(http.MethodGet, "/api/media", nil), storage.RoleViewer)
+	stripped := h.stripGPS(viewer, []*storage.Media{m})
+	if md := stripped[0].Metadata; md.GPSLat != 0 || md.GPSLon != 0 || md.Place != "" || md.Country != "" {
+		t.Errorf("viewer sees location %+v", md)
+	}
+	// Запись из кэша общая: исходный объект не меняется
+	if m.Metadata.GPSLat != 55.75 || m.Metadata.Place != "Moscow" {
+		t.Errorf("stripGPS modified the original media: %+v", m.Metadata)
+	}
+
+	editor := withRole(httptest.NewRequest(http.MethodGet, "/api/media", nil), storage.RoleEditor)
+	if kept := h.stripGPS(editor, []*storage.Media{m}); kept[0].Metadata.GPSLat != 55.75 {
+		t.Errorf("editor lost GPS: %+v", kept[0].Metadata)
+	}
+}
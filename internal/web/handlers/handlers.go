@@ -2,12 +2,19 @@ package handlers
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"image/jpeg"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -30,16 +37,20 @@ import (
 
 // Handlers содержит все HTTP-обработчики
 type Handlers struct {
-	cfg           *config.Config
-	store         *storage.Store
-	scanner       *scanner.Scanner
-	thumbGen      *media.ThumbnailGenerator
-	auth          *auth.Auth
-	pageTemplates map[string]*template.Template // Шаблоны с наследованием от base
-	cache         *cache.MediaCache
-	workerPool    *worker.Pool
-	thumbService  *worker.ThumbnailService
-	buildVersion  string // Версия сборки для cache busting
+	cfg            *config.Config
+	store          *storage.Store
+	scanner        *scanner.Scanner
+	thumbGen       *media.ThumbnailGenerator
+	auth           *auth.Auth
+	pageTemplates  map[string]*template.Template // Шаблоны с наследованием от base
+	cache          *cache.MediaCache
+	workerPool     *worker.Pool
+	thumbService   *worker.ThumbnailService
+	trashUndo      *trashUndoLog // Недавние перемещения в корзину для отмены
+	heavy          *heavyLimiter // Лимит одновременных тяжелых запросов с одного IP
+	thumbWaits     *heavyLimiter // Лимит одновременных ?wait=1 превью с одного IP
+	trustedProxies []*net.IPNet  // Прокси, которым доверяем X-Forwarded-For
+	buildVersion   string        // Версия сборки для cache busting
 }
 
 // NewHandlers создает новый экземпляр обработчиков
@@ -56,16 +67,20 @@ func NewHandlers(
 	buildVersion string,
 ) *Handlers {
 	return &Handlers{
-		cfg:           cfg,
-		store:         store,
-		scanner:       scanner,
-		thumbGen:      thumbGen,
-		auth:          auth,
-		pageTemplates: pageTemplates,
-		cache:         mediaCache,
-		workerPool:    workerPool,
-		thumbService:  thumbService,
-		buildVersion:  buildVersion,
+		cfg:            cfg,
+		store:          store,
+		scanner:        scanner,
+		thumbGen:       thumbGen,
+		auth:           auth,
+		pageTemplates:  pageTemplates,
+		cache:          mediaCache,
+		workerPool:     workerPool,
+		thumbService:   thumbService,
+		trashUndo:      newTrashUndoLog(),
+		heavy:          newHeavyLimiter(cfg.Server.MaxHeavyPerIP),
+		thumbWaits:     newHeavyLimiter(cfg.Thumbnails.WaitPerIP),
+		trustedProxies: parseTrustedProxies(cfg.Server.TrustedProxies),
+		buildVersion:   buildVersion,
 	}
 }
 
@@ -81,6 +96,13 @@ func (h *Handlers) baseData(r *http.Request) map[string]interface{} {
 		data["Role"] = session.Role
 		data["IsAdmin"] = session.Role == storage.RoleAdmin
 		data["CanEdit"] = session.Role == storage.RoleAdmin || session.Role == storage.RoleEditor
+		data["CanViewGeo"] = h.auth.CanViewGeo(session.Role)
+
+		// Тема выставляется сервером, чтобы страница сразу рендерилась в нужных цветах
+		data["Theme"] = storage.ThemeDark
+		if user, err := h.store.GetUser(session.Username); err == nil && user != nil && user.Theme != "" {
+			data["Theme"] = user.Theme
+		}
 
 		// Загружаем избранные один раз для всей страницы
 		if favIDs, err := h.store.GetUserFavorites(session.UserID); err == nil {
@@ -113,7 +135,19 @@ func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 
-	session, err := h.auth.Login(username, password)
+	session, err := h.auth.Login(username, password, h.clientIP(r))
+	var lockout *auth.LockoutError
+	if errors.As(err, &lockout) {
+		minutes := int(math.Ceil(lockout.RetryAfter.Minutes()))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.RetryAfter.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		h.render(w, "login.html", map[string]interface{}{
+			"HideHeader": true,
+			"Error":      fmt.Sprintf("Слишком много неудачных попыток входа. Повторите через %d мин.", minutes),
+		})
+		return
+	}
 	if err != nil {
 		h.render(w, "login.html", map[string]interface{}{
 			"HideHeader": true,
@@ -154,7 +188,7 @@ func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
 
 // ViewMedia отображает отдельное медиа
 func (h *Handlers) ViewMedia(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id := h.mediaID(r)
 
 	// Пробуем кэш
 	m, found := h.cache.GetMedia(id)
@@ -168,6 +202,16 @@ func (h *Handlers) ViewMedia(w http.ResponseWriter, r *http.Request) {
 		h.cache.SetMedia(m)
 	}
 
+	// Короткий ID создается при первом просмотре (у медиа из старых сканов его нет)
+	if m.Slug == "" {
+		if slug, err := h.store.EnsureSlug(m.ID); err == nil {
+			c := *m
+			c.Slug = slug
+			m = &c
+			h.cache.SetMedia(m)
+		}
+	}
+
 	isHTMX := r.Header.Get("HX-Request") == "true"
 
 	data := h.baseData(r)
@@ -183,9 +227,27 @@ func (h *Handlers) ViewMedia(w http.ResponseWriter, r *http.Request) {
 
 // === Медиа ===
 
+// mediaID возвращает полный ID медиа из параметра {id}: принимается и ID, и короткий slug
+func (h *Handlers) mediaID(r *http.Request) string {
+	id := chi.URLParam(r, "id")
+	if fullID, err := h.store.ResolveMediaID(id); err == nil && fullID != "" {
+		return fullID
+	}
+	return id
+}
+
+// serveFileWithETag отдает файл с ETag по времени изменения и размеру.
+// http.ServeFile сам отвечает 304 на совпавший If-None-Match.
+func serveFileWithETag(w http.ResponseWriter, r *http.Request, path string) {
+	if info, err := os.Stat(path); err == nil {
+		w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	}
+	http.ServeFile(w, r, path)
+}
+
 // ServeMedia отдает оригинальный медиа-файл
 func (h *Handlers) ServeMedia(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id := h.mediaID(r)
 
 	m, found := h.cache.GetMedia(id)
 	if !found {
@@ -204,7 +266,7 @@ func (h *Handlers) ServeMedia(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", m.MimeType)
-	http.ServeFile(w, r, m.Path)
+	serveFileWithETag(w, r, m.Path)
 }
 
 // ServeThumbnail отдает превью
@@ -222,7 +284,7 @@ func (h *Handlers) ServeThumbnailSize(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) serveThumbnailWithSize(w http.ResponseWriter, r *http.Request, size string) {
-	id := chi.URLParam(r, "id")
+	id := h.mediaID(r)
 
 	m, found := h.cache.GetMedia(id)
 	if !found {
@@ -238,16 +300,44 @@ func (h *Handlers) serveThumbnailWithSize(w http.ResponseWriter, r *http.Request
 	// Проверяем, есть ли превью
 	thumbPath := h.thumbGen.GetThumbnailPath(id, size)
 	if _, err := os.Stat(thumbPath); os.IsNotExist(err) {
+		// Формат превью сменился: отдаем старый JPEG, а новое генерируем в фоне
+		if legacyPath := h.thumbGen.LegacyThumbnailPath(id, size); legacyPath != "" {
+			if !h.thumbService.IsProcessing(id, size) {
+				h.thumbService.QueueThumbnail(id, size)
+			}
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Header().Set("Cache-Control", "no-cache")
+			serveFileWithETag(w, r, legacyPath)
+			return
+		}
+
 		// Проверяем, не было ли постоянной ошибки
 		if hasFailed, errMsg := h.thumbService.HasFailed(id, size); hasFailed {
 			logger.InfoLog.Printf("Thumbnail %s/%s permanently failed: %s", id[:16], size, errMsg)
 			w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
 			w.Header().Set("X-Thumbnail-Status", "failed")
 			w.Header().Set("X-Thumbnail-Error", errMsg)
-			http.Error(w, "Thumbnail generation failed: "+errMsg, http.StatusUnprocessableEntity)
+			h.jsonErrorCode(w, "Thumbnail generation failed: "+errMsg, http.StatusUnprocessableEntity, ErrCodeProcessing)
 			return
 		}
 
+		// ?wait=1 - генерируем синхронно; одновременные запросы ждут одну генерацию.
+		// Сверх thumbnails.wait_per_ip не ждем, а ставим в очередь, как без wait
+		ip := h.clientIP(r)
+		if r.URL.Query().Get("wait") == "1" && h.cfg.Thumbnails.WaitTimeout > 0 && h.thumbWaits.acquire(ip) {
+			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(h.cfg.Thumbnails.WaitTimeout)*time.Second)
+			path, err := h.thumbService.GenerateNow(ctx, id, size)
+			cancel()
+			h.thumbWaits.release(ip)
+			if err == nil {
+				w.Header().Set("Content-Type", h.thumbGen.ThumbnailContentType())
+				w.Header().Set("Cache-Control", "public, max-age=86400")
+				serveFileWithETag(w, r, path)
+				return
+			}
+			logger.InfoLog.Printf("Synchronous thumbnail for %s/%s not ready: %v", id[:16], size, err)
+		}
+
 		// Превью нет - ставим в очередь и возвращаем 503 (Service Unavailable)
 		isProcessing := h.thumbService.IsProcessing(id, size)
 		if !isProcessing {
@@ -265,13 +355,20 @@ func (h *Handlers) serveThumbnailWithSize(w http.ResponseWriter, r *http.Request
 		w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
 		w.Header().Set("Retry-After", "2") // Попробовать через 2 секунды
 		w.Header().Set("X-Thumbnail-Status", fmt.Sprintf("processing=%v", isProcessing))
-		http.Error(w, "Thumbnail is being generated", http.StatusServiceUnavailable)
+		h.jsonErrorCode(w, "Thumbnail is being generated", http.StatusServiceUnavailable, ErrCodeUnavailable)
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/jpeg")
+	servePath, contentType, webpMissing := h.thumbGen.NegotiateThumbnail(id, size, r.Header.Get("Accept"))
+	if webpMissing && !h.thumbService.IsProcessing(id, size) {
+		// Досоздаем WebP вариант в фоне, пока отдаем JPEG
+		h.thumbService.QueueThumbnail(id, size)
+	}
+
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Cache-Control", "public, max-age=86400")
-	http.ServeFile(w, r, thumbPath)
+	w.Header().Set("Vary", "Accept")
+	serveFileWithETag(w, r, servePath)
 }
 
 // === API ===
@@ -315,18 +412,26 @@ func (h *Handlers) Stats(w http.ResponseWriter, r *http.Request) {
 	h.jsonResponse(w, stats)
 }
 
+// RebuildStats пересчитывает счётчики статистики и тегов с нуля (только admin)
+func (h *Handlers) RebuildStats(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanManageUsers(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	stats, err := h.store.RebuildStats()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.cache.SetStats(stats)
+
+	h.jsonResponse(w, stats)
+}
+
 // QueueStats возвращает статистику очереди задач
 func (h *Handlers) QueueStats(w http.ResponseWriter, r *http.Request) {
-	stats := h.workerPool.Stats()
-	h.jsonResponse(w, map[string]interface{}{
-		"total_tasks":     stats.TotalTasks,
-		"completed_tasks": stats.CompletedTasks,
-		"failed_tasks":    stats.FailedTasks,
-		"queued_tasks":    stats.QueuedTasks,
-		"active_workers":  stats.ActiveWorkers,
-		"queue_length":    h.workerPool.QueueLength(),
-		"processing":      h.thumbService.ProcessingCount(),
-	})
+	h.jsonResponse(w, h.queueStats())
 }
 
 // CacheStats возвращает статистику кэша
@@ -337,7 +442,7 @@ func (h *Handlers) CacheStats(w http.ResponseWriter, r *http.Request) {
 
 // GenerateThumbnails запускает генерацию превью
 func (h *Handlers) GenerateThumbnails(w http.ResponseWriter, r *http.Request) {
-	if err := h.thumbService.PregenerateThumbnails(); err != nil {
+	if err := h.thumbService.PregenerateThumbnails(h.cfg.Thumbnails.PregenerateOrder); err != nil {
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -348,20 +453,118 @@ func (h *Handlers) GenerateThumbnails(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// RegenerateThumbnails удаляет и заново ставит в очередь превью медиа по фильтру:
+// {"filter": "all"}, {"filter": "album", "value": id}, {"filter": "tag", "value": тег},
+// {"filter": "camera", "value": модель}. Нужно после смены режима или формата превью.
+func (h *Handlers) RegenerateThumbnails(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanEdit(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Filter string `json:"filter"`
+		Value  string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Filter != "all" && req.Value == "" {
+		h.jsonError(w, "value is required for filter "+strconv.Quote(req.Filter), http.StatusBadRequest)
+		return
+	}
+
+	var mediaList []*storage.Media
+	var err error
+	switch req.Filter {
+	case "all":
+		mediaList, err = h.store.ListAllMedia()
+	case "album":
+		var album *storage.Album
+		if album, err = h.store.GetAlbum(req.Value); err == nil && album == nil {
+			h.jsonError(w, "Album not found", http.StatusNotFound)
+			return
+		}
+		if err == nil {
+			mediaList, err = h.store.GetAlbumMedia(req.Value)
+		}
+	case "tag", "camera":
+		query := &storage.SearchQuery{Limit: math.MaxInt32}
+		if req.Filter == "tag" {
+			query.Tags = []string{req.Value}
+		} else {
+			query.Camera = req.Value
+		}
+		var result *storage.SearchResult
+		if result, err = h.store.Search(query); err == nil {
+			mediaList = result.Media
+		}
+	default:
+		h.jsonError(w, "filter must be all, album, tag or camera", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	queued, pending := h.thumbService.RegenerateThumbnails(mediaList)
+	h.jsonResponse(w, map[string]int{
+		"matched": len(mediaList),
+		"queued":  queued,
+		"pending": pending, // Не поместились в очередь: досылаются в фоне по мере ее освобождения
+	})
+}
+
 // === Поиск ===
 
 // Search выполняет поиск медиа
 func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
+	query := h.searchQuery(r)
+
+	result, err := h.store.Search(query)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Проверяем, запрашивается ли HTML или JSON
+	isHTMX := r.Header.Get("HX-Request") == "true"
+	if isHTMX {
+		h.renderPartial(w, "search_results.html", map[string]interface{}{
+			"Media":      result.Media,
+			"TotalCount": result.TotalCount,
+			"HasMore":    result.HasMore,
+			"Query":      query.Text,
+		})
+		return
+	}
+
+	result.Media = h.stripGPS(r, result.Media)
+	h.jsonResponse(w, result)
+}
+
+// searchQuery собирает условия поиска из параметров запроса /api/search
+func (h *Handlers) searchQuery(r *http.Request) *storage.SearchQuery {
 	query := &storage.SearchQuery{
-		Text:   r.URL.Query().Get("q"),
-		Camera: r.URL.Query().Get("camera"),
+		Text: r.URL.Query().Get("q"),
 	}
 
-	// Тип медиа
-	if t := r.URL.Query().Get("type"); t != "" {
-		query.Type = storage.MediaType(t)
+	// Нечеткий поиск с учетом опечаток
+	query.Fuzzy = r.URL.Query().Get("fuzzy") == "true"
+
+	// Типы медиа (type=image,video — любой из перечисленных)
+	for _, t := range splitParam(r.URL.Query().Get("type")) {
+		query.Types = append(query.Types, storage.MediaType(t))
 	}
 
+	// Камеры (camera=canon,nikon — любая из перечисленных)
+	query.Cameras = splitParam(r.URL.Query().Get("camera"))
+
+	// Автор (EXIF Artist)
+	query.Artist = r.URL.Query().Get("artist")
+
 	// Даты
 	if from := r.URL.Query().Get("from"); from != "" {
 		if t, err := time.Parse("2006-01-02", from); err == nil {
@@ -374,23 +577,74 @@ func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Теги
-	if tags := r.URL.Query().Get("tags"); tags != "" {
-		query.Tags = strings.Split(tags, ",")
-	}
+	// Теги (все перечисленные) и исключаемые теги (ни одного из перечисленных)
+	query.Tags = splitParam(r.URL.Query().Get("tags"))
+	query.ExcludeTags = splitParam(r.URL.Query().Get("exclude_tags"))
 
-	// Избранное
-	if fav := r.URL.Query().Get("favorite"); fav == "true" {
+	// Избранное: favorite=true — только избранное, favorite=false или not_favorite=true — кроме избранного
+	switch {
+	case r.URL.Query().Get("favorite") == "true":
 		t := true
 		query.IsFavorite = &t
+	case r.URL.Query().Get("favorite") == "false", r.URL.Query().Get("not_favorite") == "true":
+		f := false
+		query.IsFavorite = &f
 	}
 
-	// GPS
-	if gps := r.URL.Query().Get("gps"); gps == "true" {
+	// GPS (фильтр раскрывает наличие координат, поэтому только с доступом к геоданным)
+	if gps := r.URL.Query().Get("gps"); gps == "true" && h.canViewGeo(r) {
 		t := true
 		query.HasGPS = &t
 	}
 
+	// Цвет палитры (имя или hex)
+	if c := r.URL.Query().Get("color"); c != "" {
+		query.Color = storage.NormalizeColor(c)
+	}
+
+	// Отмеченные для проверки
+	if flagged := r.URL.Query().Get("flagged"); flagged == "true" {
+		t := true
+		query.Flagged = &t
+	}
+
+	// Размер файла (байты или "50MB", "1.5GB")
+	if minSize := r.URL.Query().Get("min_size"); minSize != "" {
+		if n, err := storage.ParseSize(minSize); err == nil {
+			query.MinSize = n
+		}
+	}
+	if maxSize := r.URL.Query().Get("max_size"); maxSize != "" {
+		if n, err := storage.ParseSize(maxSize); err == nil {
+			query.MaxSize = n
+		}
+	}
+
+	// Параметры съемки: min_iso=100, max_aperture=2.8 (или f/2.8), min_shutter=1/60 (или 0.5, 2s), min_focal=85
+	params := r.URL.Query()
+	if n, err := strconv.Atoi(params.Get("min_iso")); err == nil {
+		query.MinISO = n
+	}
+	if n, err := strconv.Atoi(params.Get("max_iso")); err == nil {
+		query.MaxISO = n
+	}
+	query.MinAperture, _ = storage.ParseAperture(params.Get("min_aperture"))
+	query.MaxAperture, _ = storage.ParseAperture(params.Get("max_aperture"))
+	query.MinShutter, _ = storage.ParseShutter(params.Get("min_shutter"))
+	query.MaxShutter, _ = storage.ParseShutter(params.Get("max_shutter"))
+	query.MinFocal, _ = storage.ParseFocal(params.Get("min_focal"))
+	query.MaxFocal, _ = storage.ParseFocal(params.Get("max_focal"))
+
+	// Сортировка
+	switch sortBy := r.URL.Query().Get("sort"); sortBy {
+	case storage.SortByTakenAt, storage.SortByModifiedAt, storage.SortBySize, storage.SortByFilename:
+		query.SortBy = sortBy
+	}
+	switch order := r.URL.Query().Get("order"); order {
+	case storage.SortAsc, storage.SortDesc:
+		query.SortDir = order
+	}
+
 	// Пагинация
 	if limit := r.URL.Query().Get("limit"); limit != "" {
 		if l, err := strconv.Atoi(limit); err == nil {
@@ -403,24 +657,78 @@ func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	return query
+}
+
+// splitParam разбивает значение параметра через запятую, пропуская пустые элементы
+func splitParam(value string) []string {
+	var result []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// UnalbumedMedia возвращает медиа, которых нет ни в одном обычном альбоме (еще не разобранные).
+// Фильтры, сортировка и пагинация (limit, offset) — как у /api/search.
+func (h *Handlers) UnalbumedMedia(w http.ResponseWriter, r *http.Request) {
+	query := h.searchQuery(r)
+	query.Unalbumed = true
+
 	result, err := h.store.Search(query)
 	if err != nil {
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Проверяем, запрашивается ли HTML или JSON
-	isHTMX := r.Header.Get("HX-Request") == "true"
-	if isHTMX {
-		h.renderPartial(w, "search_results.html", map[string]interface{}{
-			"Media":      result.Media,
-			"TotalCount": result.TotalCount,
-			"HasMore":    result.HasMore,
-			"Query":      query.Text,
-		})
+	result.Media = h.stripGPS(r, result.Media)
+	h.jsonResponse(w, result)
+}
+
+// IncompleteMedia возвращает медиа без указанных метаданных (?missing=gps,date,camera)
+func (h *Handlers) IncompleteMedia(w http.ResponseWriter, r *http.Request) {
+	query := &storage.SearchQuery{}
+
+	missing := r.URL.Query().Get("missing")
+	if missing == "" {
+		missing = strings.Join([]string{storage.MissingCamera, storage.MissingGPS, storage.MissingDate}, ",")
+	}
+	for _, field := range strings.Split(missing, ",") {
+		field = strings.TrimSpace(strings.ToLower(field))
+		switch field {
+		case storage.MissingGPS:
+			if h.canViewGeo(r) {
+				query.Missing = append(query.Missing, field)
+			}
+		case storage.MissingCamera, storage.MissingDate:
+			query.Missing = append(query.Missing, field)
+		case "":
+		default:
+			h.jsonError(w, "Unknown metadata field: "+field, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil {
+			query.Limit = l
+		}
+	}
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		if o, err := strconv.Atoi(offset); err == nil {
+			query.Offset = o
+		}
+	}
+
+	result, err := h.store.Search(query)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	result.Media = h.stripGPS(r, result.Media)
 	h.jsonResponse(w, result)
 }
 
@@ -429,17 +737,11 @@ func (h *Handlers) SearchPage(w http.ResponseWriter, r *http.Request) {
 	// Получаем все теги для фильтров
 	tags, _ := h.store.ListAllTags()
 
-	// Получаем уникальные камеры
-	allMedia, _ := h.store.ListAllMedia()
-	cameras := make(map[string]bool)
-	for _, m := range allMedia {
-		if m.Metadata.Camera != "" {
-			cameras[m.Metadata.Camera] = true
-		}
-	}
+	// Уникальные камеры из счётчиков, без обхода всех медиа
+	cameras, _ := h.store.ListCameras()
 	var cameraList []string
-	for c := range cameras {
-		cameraList = append(cameraList, c)
+	for _, c := range cameras {
+		cameraList = append(cameraList, c.Camera)
 	}
 	sort.Strings(cameraList)
 
@@ -459,17 +761,50 @@ func (h *Handlers) ListAlbums(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Для браузерных запросов рендерим HTML
+	// Для браузерных запросов рендерим HTML (только корневые, вложенные видны внутри родителя)
 	if h.wantsHTML(r) {
+		var roots []*storage.Album
+		for _, a := range albums {
+			if a.ParentID == "" {
+				roots = append(roots, a)
+			}
+		}
+		h.fillAlbumCovers(roots)
+		h.fillSmartAlbumCounts(roots)
 		data := h.baseData(r)
-		data["Albums"] = albums
+		data["Albums"] = roots
 		h.render(w, "albums.html", data)
 		return
 	}
 
+	// ?parent=<id> — только прямые потомки альбома
+	if r.URL.Query().Has("parent") {
+		albums, err = h.store.GetChildAlbums(r.URL.Query().Get("parent"))
+		if err != nil {
+			h.jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.fillAlbumCovers(albums)
+	h.fillSmartAlbumCounts(albums)
 	h.jsonResponse(w, albums)
 }
 
+// fillSmartAlbumCounts вычисляет MediaCount умных альбомов (в базе он не хранится)
+func (h *Handlers) fillSmartAlbumCounts(albums []*storage.Album) {
+	if err := h.store.FillSmartAlbumCounts(albums); err != nil {
+		logger.InfoLog.Printf("Failed to count smart album media: %v", err)
+	}
+}
+
+// fillAlbumCovers подставляет обложки по умолчанию альбомам без своей или с удаленной
+func (h *Handlers) fillAlbumCovers(albums []*storage.Album) {
+	if err := h.store.ResolveAlbumCovers(albums); err != nil {
+		logger.InfoLog.Printf("Failed to resolve album covers: %v", err)
+	}
+}
+
 // GetAlbum возвращает альбом с медиа
 func (h *Handlers) GetAlbum(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
@@ -489,18 +824,36 @@ func (h *Handlers) GetAlbum(w http.ResponseWriter, r *http.Request) {
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if album.Smart {
+		album.MediaCount = len(media)
+	}
+
+	children, err := h.store.GetChildAlbums(id)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.fillAlbumCovers(append([]*storage.Album{album}, children...))
 
 	if h.wantsHTML(r) {
 		data := h.baseData(r)
 		data["Album"] = album
 		data["Media"] = media
+		data["Children"] = children
+		data["DefaultSlideInterval"] = storage.DefaultSlideIntervalSeconds
+		if album.ParentID != "" {
+			if parent, err := h.store.GetAlbum(album.ParentID); err == nil && parent != nil {
+				data["Parent"] = parent
+			}
+		}
 		h.render(w, "album.html", data)
 		return
 	}
 
 	h.jsonResponse(w, map[string]interface{}{
-		"album": album,
-		"media": media,
+		"album":    album,
+		"media":    h.stripGPS(r, media),
+		"children": children,
 	})
 }
 
@@ -514,8 +867,10 @@ func (h *Handlers) CreateAlbum(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
+		Name        string               `json:"name"`
+		Description string               `json:"description"`
+		ParentID    string               `json:"parent_id"`
+		Query       *storage.SearchQuery `json:"query"` // Если задан — умный альбом
 	}
 
 	if r.Header.Get("Content-Type") == "application/json" {
@@ -526,6 +881,7 @@ func (h *Handlers) CreateAlbum(w http.ResponseWriter, r *http.Request) {
 	} else {
 		req.Name = r.FormValue("name")
 		req.Description = r.FormValue("description")
+		req.ParentID = r.FormValue("parent_id")
 	}
 
 	if req.Name == "" {
@@ -537,12 +893,16 @@ func (h *Handlers) CreateAlbum(w http.ResponseWriter, r *http.Request) {
 		ID:          generateID(),
 		Name:        req.Name,
 		Description: req.Description,
+		ParentID:    req.ParentID,
+		Smart:       req.Query != nil,
+		Query:       req.Query,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
+		OwnerID:     auth.GetUserID(r),
 	}
 
 	if err := h.store.SaveAlbum(album); err != nil {
-		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		h.albumSaveError(w, err)
 		return
 	}
 
@@ -571,9 +931,11 @@ func (h *Handlers) UpdateAlbum(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		CoverID     string `json:"cover_id"`
+		Name        string               `json:"name"`
+		Description string               `json:"description"`
+		CoverID     string               `json:"cover_id"`
+		ParentID    *string              `json:"parent_id"` // "" — сделать корневым
+		Query       *storage.SearchQuery `json:"query"`     // Превращает альбом в умный или меняет его поиск
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -590,37 +952,87 @@ func (h *Handlers) UpdateAlbum(w http.ResponseWriter, r *http.Request) {
 	if req.CoverID != "" {
 		album.CoverID = req.CoverID
 	}
+	if req.ParentID != nil {
+		album.ParentID = *req.ParentID
+	}
+	if req.Query != nil {
+		album.Smart = true
+		album.Query = req.Query
+	}
 	album.UpdatedAt = time.Now()
 
 	if err := h.store.SaveAlbum(album); err != nil {
-		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		h.albumSaveError(w, err)
 		return
 	}
 
 	h.jsonResponse(w, album)
 }
 
-// DeleteAlbum удаляет альбом
-func (h *Handlers) DeleteAlbum(w http.ResponseWriter, r *http.Request) {
-	// Проверка прав: только admin
+// albumSaveError отвечает на ошибку SaveAlbum: неверный родитель — 400
+func (h *Handlers) albumSaveError(w http.ResponseWriter, err error) {
+	switch err {
+	case storage.ErrAlbumCycle:
+		h.jsonErrorCode(w, err.Error(), http.StatusBadRequest, ErrCodeConflict)
+	case storage.ErrParentAlbum:
+		h.jsonErrorCode(w, err.Error(), http.StatusBadRequest, ErrCodeNotFound)
+	default:
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ReorderAlbum сохраняет ручной порядок медиа альбома.
+// Тело: {"media_ids": [...]} — все текущие медиа альбома в новом порядке
+// или {"sort": "date"} — вернуть порядок по дате съемки.
+func (h *Handlers) ReorderAlbum(w http.ResponseWriter, r *http.Request) {
+	// Проверка прав: только admin и editor
 	role := auth.GetUserRole(r)
-	if !auth.CanDeleteAlbum(role) {
+	if !auth.CanEditAlbum(role) {
 		h.jsonError(w, "Forbidden: недостаточно прав", http.StatusForbidden)
 		return
 	}
 
-	id := chi.URLParam(r, "id")
+	var req struct {
+		MediaIDs []string `json:"media_ids"`
+		Sort     string   `json:"sort"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
 
-	if err := h.store.DeleteAlbum(id); err != nil {
-		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+	mediaIDs := req.MediaIDs
+	switch {
+	case req.Sort == "date":
+		mediaIDs = nil
+	case req.Sort != "":
+		h.jsonError(w, "sort must be \"date\"", http.StatusBadRequest)
+		return
+	case mediaIDs == nil:
+		h.jsonError(w, "media_ids is required", http.StatusBadRequest)
 		return
 	}
 
-	h.jsonResponse(w, map[string]string{"status": "deleted"})
+	if err := h.store.SetAlbumOrder(chi.URLParam(r, "id"), mediaIDs); err != nil {
+		switch err {
+		case storage.ErrAlbumNotFound:
+			h.jsonError(w, err.Error(), http.StatusNotFound)
+		case storage.ErrAlbumOrder, storage.ErrSmartAlbum:
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+		default:
+			h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"status":       "updated",
+		"custom_order": mediaIDs != nil,
+	})
 }
 
-// AddToAlbum добавляет медиа в альбом
-func (h *Handlers) AddToAlbum(w http.ResponseWriter, r *http.Request) {
+// SetAlbumCover устанавливает обложку альбома из его медиа
+func (h *Handlers) SetAlbumCover(w http.ResponseWriter, r *http.Request) {
 	// Проверка прав: только admin и editor
 	role := auth.GetUserRole(r)
 	if !auth.CanEditAlbum(role) {
@@ -631,7 +1043,7 @@ func (h *Handlers) AddToAlbum(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
 	var req struct {
-		MediaIDs []string `json:"media_ids"`
+		MediaID string `json:"media_id"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -639,16 +1051,31 @@ func (h *Handlers) AddToAlbum(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.AddMediaToAlbum(id, req.MediaIDs); err != nil {
-		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+	if req.MediaID == "" {
+		h.jsonError(w, "media_id is required", http.StatusBadRequest)
 		return
 	}
 
-	h.jsonResponse(w, map[string]string{"status": "added"})
+	if err := h.store.SetAlbumCover(id, req.MediaID); err != nil {
+		switch err {
+		case storage.ErrAlbumNotFound:
+			h.jsonError(w, err.Error(), http.StatusNotFound)
+		case storage.ErrNotInAlbum:
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+		default:
+			h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status":   "updated",
+		"cover_id": req.MediaID,
+	})
 }
 
-// RemoveFromAlbum удаляет медиа из альбома
-func (h *Handlers) RemoveFromAlbum(w http.ResponseWriter, r *http.Request) {
+// SetAlbumSlideshow сохраняет настройки слайдшоу альбома
+func (h *Handlers) SetAlbumSlideshow(w http.ResponseWriter, r *http.Request) {
 	// Проверка прав: только admin и editor
 	role := auth.GetUserRole(r)
 	if !auth.CanEditAlbum(role) {
@@ -659,7 +1086,9 @@ func (h *Handlers) RemoveFromAlbum(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
 	var req struct {
-		MediaIDs []string `json:"media_ids"`
+		SlideIntervalSeconds int    `json:"slide_interval_seconds"`
+		Shuffle              bool   `json:"shuffle"`
+		Transition           string `json:"transition"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -667,33 +1096,135 @@ func (h *Handlers) RemoveFromAlbum(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.RemoveMediaFromAlbum(id, req.MediaIDs); err != nil {
+	// 0 — время показа по умолчанию
+	if req.SlideIntervalSeconds < 0 || req.SlideIntervalSeconds > storage.MaxSlideIntervalSeconds {
+		h.jsonError(w, fmt.Sprintf("slide_interval_seconds must be between 0 and %d", storage.MaxSlideIntervalSeconds), http.StatusBadRequest)
+		return
+	}
+	if req.Transition != "" && !storage.IsValidTransition(req.Transition) {
+		h.jsonError(w, "transition must be fade, slide or none", http.StatusBadRequest)
+		return
+	}
+
+	album, err := h.store.SetAlbumSlideshow(id, req.SlideIntervalSeconds, req.Shuffle, req.Transition)
+	if err != nil {
+		if err == storage.ErrAlbumNotFound {
+			h.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	h.jsonResponse(w, map[string]string{"status": "removed"})
+	h.jsonResponse(w, album)
 }
 
-// === Избранное (per-user) ===
-
-// ToggleFavorite переключает статус избранного для текущего пользователя
-func (h *Handlers) ToggleFavorite(w http.ResponseWriter, r *http.Request) {
-	userID := auth.GetUserID(r)
-	if userID == "" {
-		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+// DeleteAlbum удаляет альбом
+func (h *Handlers) DeleteAlbum(w http.ResponseWriter, r *http.Request) {
+	// Проверка прав: только admin
+	role := auth.GetUserRole(r)
+	if !auth.CanDeleteAlbum(role) {
+		h.jsonError(w, "Forbidden: недостаточно прав", http.StatusForbidden)
 		return
 	}
 
 	id := chi.URLParam(r, "id")
 
-	isFavorite, err := h.store.ToggleUserFavorite(userID, id)
-	if err != nil {
+	// cascade=true удаляет вложенные альбомы, иначе они переносятся к родителю
+	cascade := r.URL.Query().Get("cascade") == "true"
+
+	if err := h.store.DeleteAlbum(id, cascade); err != nil {
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	h.jsonResponse(w, map[string]interface{}{
+	h.jsonResponse(w, map[string]string{"status": "deleted"})
+}
+
+// AddToAlbum добавляет медиа в альбом
+func (h *Handlers) AddToAlbum(w http.ResponseWriter, r *http.Request) {
+	// Проверка прав: только admin и editor
+	role := auth.GetUserRole(r)
+	if !auth.CanEditAlbum(role) {
+		h.jsonError(w, "Forbidden: недостаточно прав", http.StatusForbidden)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+
+	var req struct {
+		MediaIDs []string `json:"media_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.AddMediaToAlbum(id, req.MediaIDs); err != nil {
+		h.albumEditError(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{"status": "added"})
+}
+
+// RemoveFromAlbum удаляет медиа из альбома
+func (h *Handlers) RemoveFromAlbum(w http.ResponseWriter, r *http.Request) {
+	// Проверка прав: только admin и editor
+	role := auth.GetUserRole(r)
+	if !auth.CanEditAlbum(role) {
+		h.jsonError(w, "Forbidden: недостаточно прав", http.StatusForbidden)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+
+	var req struct {
+		MediaIDs []string `json:"media_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.RemoveMediaFromAlbum(id, req.MediaIDs); err != nil {
+		h.albumEditError(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{"status": "removed"})
+}
+
+// albumEditError отвечает на ошибку изменения состава альбома: умный альбом — 400
+func (h *Handlers) albumEditError(w http.ResponseWriter, err error) {
+	if err == storage.ErrSmartAlbum {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.jsonError(w, err.Error(), http.StatusInternalServerError)
+}
+
+// === Избранное (per-user) ===
+
+// ToggleFavorite переключает статус избранного для текущего пользователя
+func (h *Handlers) ToggleFavorite(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r)
+	if userID == "" {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+
+	isFavorite, err := h.store.ToggleUserFavorite(userID, id)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
 		"id":          id,
 		"is_favorite": isFavorite,
 	})
@@ -725,7 +1256,7 @@ func (h *Handlers) ListFavorites(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.jsonResponse(w, media)
+	h.jsonResponse(w, h.stripGPS(r, media))
 }
 
 // === Теги ===
@@ -821,29 +1352,112 @@ func (h *Handlers) MediaByTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.jsonResponse(w, media)
+	h.jsonResponse(w, h.stripGPS(r, media))
 }
 
-// === Timeline ===
+// === Камеры ===
 
-// Timeline возвращает группировку медиа по датам
-func (h *Handlers) Timeline(w http.ResponseWriter, r *http.Request) {
-	timeline, err := h.store.GetTimeline()
+// ListCameras возвращает камеры с количеством медиа
+func (h *Handlers) ListCameras(w http.ResponseWriter, r *http.Request) {
+	cameras, err := h.store.ListCameras()
 	if err != nil {
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if cameras == nil {
+		cameras = []*storage.CameraCount{}
+	}
+	h.jsonResponse(w, cameras)
+}
 
+// MediaByCamera отображает медиа, снятые камерой
+func (h *Handlers) MediaByCamera(w http.ResponseWriter, r *http.Request) {
+	camera := chi.URLParam(r, "camera")
+
+	media, err := h.store.ListMediaByCamera(camera)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Сортируем по дате
+	sort.Slice(media, func(i, j int) bool {
+		return media[i].TakenAt.After(media[j].TakenAt)
+	})
+
+	if h.wantsHTML(r) {
+		data := h.baseData(r)
+		data["Camera"] = camera
+		data["Media"] = media
+		h.render(w, "camera.html", data)
+		return
+	}
+
+	h.jsonResponse(w, h.stripGPS(r, media))
+}
+
+// === Timeline ===
+
+// Timeline возвращает группировку медиа по датам
+func (h *Handlers) Timeline(w http.ResponseWriter, r *http.Request) {
 	if h.wantsHTML(r) {
+		// Медиа новейших месяцев читаются вместе с группами — для Link: preload
+		timeline, err := h.store.GetTimelineWithMedia(h.cfg.Server.PreloadThumbnails)
+		if err != nil {
+			h.jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.setThumbnailPreloadLinks(w, timeline)
+		for _, group := range timeline {
+			group.Media = nil
+		}
 		data := h.baseData(r)
 		data["Timeline"] = timeline
 		h.render(w, "gallery.html", data)
 		return
 	}
 
+	timeline, err := h.store.GetTimeline()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	h.jsonResponse(w, timeline)
 }
 
+// setThumbnailPreloadLinks добавляет заголовок Link: rel=preload для превью
+// первого экрана галереи, чтобы браузер начал загрузку до разбора HTML.
+// URL совпадают с src карточек (media_card.html), порядок — как в TimelineAllMedia.
+func (h *Handlers) setThumbnailPreloadLinks(w http.ResponseWriter, timeline []*storage.TimelineGroup) {
+	limit := h.cfg.Server.PreloadThumbnails
+	if limit <= 0 {
+		return
+	}
+
+	var links []string
+	for _, group := range timeline {
+		if len(links) >= limit {
+			break
+		}
+
+		media := group.Media
+		sort.Slice(media, func(i, j int) bool {
+			return media[i].Date().After(media[j].Date())
+		})
+
+		for _, m := range media {
+			if len(links) >= limit {
+				break
+			}
+			links = append(links, "<"+m.ThumbnailURL("small")+">; rel=preload; as=image")
+		}
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
 // TimelineMedia возвращает медиа за определенный период
 func (h *Handlers) TimelineMedia(w http.ResponseWriter, r *http.Request) {
 	period := chi.URLParam(r, "period")
@@ -860,14 +1474,17 @@ func (h *Handlers) TimelineMedia(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if h.wantsHTML(r) {
+		// Стопка серии — одна карточка со счетчиком кадров
+		media, stackCounts := storage.CollapseStacks(media)
 		h.renderPartial(w, "gallery_content.html", map[string]interface{}{
-			"Media":  media,
-			"Period": period,
+			"Media":       media,
+			"Period":      period,
+			"StackCounts": stackCounts,
 		})
 		return
 	}
 
-	h.jsonResponse(w, media)
+	h.jsonResponse(w, h.stripGPS(r, media))
 }
 
 // TimelineAllMedia возвращает все медиа сгруппированные по периодам
@@ -880,15 +1497,7 @@ func (h *Handlers) TimelineAllMedia(w http.ResponseWriter, r *http.Request) {
 
 	// Сортируем по дате (новые первые)
 	sort.Slice(allMedia, func(i, j int) bool {
-		dateI := allMedia[i].TakenAt
-		if dateI.IsZero() || dateI.Year() < 1900 {
-			dateI = allMedia[i].ModifiedAt
-		}
-		dateJ := allMedia[j].TakenAt
-		if dateJ.IsZero() || dateJ.Year() < 1900 {
-			dateJ = allMedia[j].ModifiedAt
-		}
-		return dateI.After(dateJ)
+		return allMedia[i].Date().After(allMedia[j].Date())
 	})
 
 	// Группируем по периодам
@@ -940,13 +1549,26 @@ func (h *Handlers) TimelineAllMedia(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if h.wantsHTML(r) {
+		// Стопки сворачиваются в пределах периода
+		stackCounts := make(map[string]int)
+		for i := range groups {
+			var counts map[string]int
+			groups[i].Media, counts = storage.CollapseStacks(groups[i].Media)
+			for id, n := range counts {
+				stackCounts[id] = n
+			}
+		}
 		h.renderPartial(w, "gallery_all.html", map[string]interface{}{
-			"Groups": groups,
-			"Total":  len(allMedia),
+			"Groups":      groups,
+			"Total":       len(allMedia),
+			"StackCounts": stackCounts,
 		})
 		return
 	}
 
+	for i := range groups {
+		groups[i].Media = h.stripGPS(r, groups[i].Media)
+	}
 	h.jsonResponse(w, groups)
 }
 
@@ -954,20 +1576,122 @@ func (h *Handlers) TimelineAllMedia(w http.ResponseWriter, r *http.Request) {
 
 // MapPage отображает страницу карты
 func (h *Handlers) MapPage(w http.ResponseWriter, r *http.Request) {
+	if !h.canViewGeo(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 	h.render(w, "map.html", h.baseData(r))
 }
 
-// GeoPoints возвращает точки с GPS координатами
+// GeoPoints возвращает точки с GPS координатами.
+// ?bbox=minLat,minLon,maxLat,maxLon — только точки в видимой области карты;
+// ?zoom=N — вместо точек маркеры, где близкие точки сгруппированы по сетке масштаба N.
+// Без параметров — все точки, как раньше.
 func (h *Handlers) GeoPoints(w http.ResponseWriter, r *http.Request) {
-	points, err := h.store.GetGeoPoints()
+	if !h.canViewGeo(r) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var bounds *storage.GeoBounds
+	if value := r.URL.Query().Get("bbox"); value != "" {
+		var err error
+		if bounds, err = parseGeoBounds(value); err != nil {
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	zoom := -1
+	if value := r.URL.Query().Get("zoom"); value != "" {
+		z, err := strconv.Atoi(value)
+		if err != nil || z < 0 || z > 30 {
+			h.jsonError(w, "Invalid zoom", http.StatusBadRequest)
+			return
+		}
+		zoom = z
+	}
+
+	points, err := h.store.GetGeoPointsIn(bounds)
 	if err != nil {
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if zoom >= 0 {
+		h.jsonResponse(w, storage.ClusterGeoPoints(points, zoom))
+		return
+	}
 	h.jsonResponse(w, points)
 }
 
+// parseGeoBounds разбирает bbox вида minLat,minLon,maxLat,maxLon
+func parseGeoBounds(value string) (*storage.GeoBounds, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, errors.New("invalid bbox, expected minLat,minLon,maxLat,maxLon")
+	}
+	var coords [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(v) {
+			return nil, fmt.Errorf("invalid bbox coordinate %q", part)
+		}
+		coords[i] = v
+	}
+
+	bounds := &storage.GeoBounds{MinLat: coords[0], MinLon: coords[1], MaxLat: coords[2], MaxLon: coords[3]}
+	if bounds.MinLat > bounds.MaxLat || bounds.MinLat < -90 || bounds.MaxLat > 90 {
+		return nil, errors.New("invalid bbox latitude range")
+	}
+	// Карта при прокрутке отдает долготы за пределами ±180
+	if bounds.MaxLon-bounds.MinLon >= 360 {
+		bounds.MinLon, bounds.MaxLon = -180, 180
+	} else {
+		bounds.MinLon, bounds.MaxLon = wrapLongitude(bounds.MinLon), wrapLongitude(bounds.MaxLon)
+	}
+	return bounds, nil
+}
+
+// wrapLongitude приводит долготу к диапазону [-180, 180]
+func wrapLongitude(lon float64) float64 {
+	if lon >= -180 && lon <= 180 {
+		return lon
+	}
+	lon = math.Mod(lon+180, 360)
+	if lon < 0 {
+		lon += 360
+	}
+	return lon - 180
+}
+
+// GeoPlaces возвращает медиа, сгруппированные по месту съемки
+func (h *Handlers) GeoPlaces(w http.ResponseWriter, r *http.Request) {
+	if !h.canViewGeo(r) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	places, err := h.store.GetPlaces()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, places)
+}
+
+// GearInsights возвращает статистику фототехники: камеры, объективы, фокусные расстояния, диафрагмы
+func (h *Handlers) GearInsights(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.store.GetGearStats()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, stats)
+}
+
 // === Bulk операции ===
 
 // BulkFavorite устанавливает избранное для нескольких медиа
@@ -982,20 +1706,14 @@ func (h *Handlers) BulkFavorite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.BulkSetFavorite(req.MediaIDs, req.IsFavorite); err != nil {
-		h.jsonError(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	results := h.store.BulkSetFavorite(req.MediaIDs, req.IsFavorite)
 
 	// Инвалидируем кэш
 	for _, id := range req.MediaIDs {
 		h.cache.DeleteMedia(id)
 	}
 
-	h.jsonResponse(w, map[string]interface{}{
-		"status": "updated",
-		"count":  len(req.MediaIDs),
-	})
+	h.bulkResponse(w, "updated", results)
 }
 
 // BulkAddTags добавляет теги к нескольким медиа
@@ -1017,20 +1735,14 @@ func (h *Handlers) BulkAddTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.BulkAddTags(req.MediaIDs, req.Tags); err != nil {
-		h.jsonError(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	results := h.store.BulkAddTags(req.MediaIDs, req.Tags)
 
 	// Инвалидируем кэш
 	for _, id := range req.MediaIDs {
 		h.cache.DeleteMedia(id)
 	}
 
-	h.jsonResponse(w, map[string]interface{}{
-		"status": "updated",
-		"count":  len(req.MediaIDs),
-	})
+	h.bulkResponse(w, "updated", results)
 }
 
 // BulkAddToAlbum добавляет медиа в альбом
@@ -1052,14 +1764,33 @@ func (h *Handlers) BulkAddToAlbum(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.AddMediaToAlbum(req.AlbumID, req.MediaIDs); err != nil {
-		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+	results, err := h.store.BulkAddToAlbum(req.AlbumID, req.MediaIDs)
+	if err != nil {
+		if err == storage.ErrAlbumNotFound {
+			h.jsonError(w, err.Error(), http.StatusNotFound)
+		} else {
+			h.albumEditError(w, err)
+		}
 		return
 	}
 
+	h.bulkResponse(w, "added", results)
+}
+
+// bulkResponse отвечает итогом bulk операции: count — число успешных, results — по каждому ID
+func (h *Handlers) bulkResponse(w http.ResponseWriter, status string, results []storage.BulkItemResult) {
+	succeeded := 0
+	for _, item := range results {
+		if item.OK {
+			succeeded++
+		}
+	}
+
 	h.jsonResponse(w, map[string]interface{}{
-		"status": "added",
-		"count":  len(req.MediaIDs),
+		"status":  status,
+		"count":   succeeded,
+		"failed":  len(results) - succeeded,
+		"results": results,
 	})
 }
 
@@ -1073,72 +1804,475 @@ func (h *Handlers) BulkDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		MediaIDs []string `json:"media_ids"`
+		MediaIDs []string `json:"media_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Удаляем из кэша и thumbnail файлы
+	for _, id := range req.MediaIDs {
+		h.cache.DeleteMedia(id)
+		h.thumbGen.DeleteThumbnails(id)
+	}
+
+	if err := h.store.BulkDelete(req.MediaIDs); err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Инвалидируем весь кэш
+	h.cache.Clear()
+
+	h.jsonResponse(w, map[string]interface{}{
+		"status": "deleted",
+		"count":  len(req.MediaIDs),
+	})
+}
+
+// BulkDownload скачивает несколько файлов в ZIP
+func (h *Handlers) BulkDownload(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MediaIDs []string `json:"media_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	media, err := h.store.GetMediaByIDs(req.MediaIDs)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"photos.zip\"")
+
+	zipWriter := zip.NewWriter(w)
+	defer zipWriter.Close()
+
+	for _, m := range media {
+		file, err := os.Open(m.Path)
+		if err != nil {
+			continue
+		}
+
+		writer, err := zipWriter.Create(m.Filename)
+		if err != nil {
+			file.Close()
+			continue
+		}
+
+		io.Copy(writer, file)
+		file.Close()
+	}
+}
+
+// ContactSheet собирает превью выбранных медиа в один JPEG (контактный лист)
+func (h *Handlers) ContactSheet(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MediaIDs []string `json:"media_ids"`
+		AlbumID  string   `json:"album_id"`
+		Query    string   `json:"q"`
+		Columns  int      `json:"columns"`
+		CellSize int      `json:"cell_size"`
+		Padding  int      `json:"padding"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var items []*storage.Media
+	var err error
+	switch {
+	case len(req.MediaIDs) > 0:
+		items, err = h.store.GetMediaByIDs(req.MediaIDs)
+	case req.AlbumID != "":
+		items, err = h.store.GetAlbumMedia(req.AlbumID)
+	case req.Query != "":
+		var result *storage.SearchResult
+		result, err = h.store.Search(&storage.SearchQuery{Text: req.Query, Limit: media.ContactSheetMaxItems})
+		if result != nil {
+			items = result.Media
+		}
+	default:
+		h.jsonError(w, "media_ids, album_id or q is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(items) == 0 {
+		h.jsonError(w, "No media found", http.StatusNotFound)
+		return
+	}
+
+	sheet, err := h.thumbGen.ContactSheet(items, media.ContactSheetOptions{
+		Columns:  req.Columns,
+		CellSize: req.CellSize,
+		Padding:  req.Padding,
+	})
+	if errors.Is(err, media.ErrContactSheetTooLarge) {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"contact-sheet.jpg\"")
+	if err := jpeg.Encode(w, sheet, &jpeg.Options{Quality: h.cfg.Thumbnails.Quality}); err != nil {
+		logger.ErrorLog.Printf("Failed to encode contact sheet: %v", err)
+	}
+}
+
+// === Публичные ссылки на альбомы ===
+
+// CreateShareLink создает публичную ссылку на альбом (опционально со сроком и паролем)
+func (h *Handlers) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	role := auth.GetUserRole(r)
+	if !auth.CanEditAlbum(role) {
+		h.jsonError(w, "Forbidden: недостаточно прав", http.StatusForbidden)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	album, err := h.store.GetAlbum(id)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if album == nil {
+		h.jsonError(w, "Album not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+		Password  string     `json:"password"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		h.jsonError(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		h.jsonError(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	link := &storage.ShareLink{
+		Token:     hex.EncodeToString(b),
+		AlbumID:   album.ID,
+		CreatedBy: auth.GetUserID(r),
+		CreatedAt: time.Now(),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if req.Password != "" {
+		hash, err := h.auth.HashPassword(req.Password)
+		if err != nil {
+			h.jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		link.PasswordHash = hash
+		link.HasPassword = true
+	}
+
+	if err := h.store.SaveShareLink(link); err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"link": publicShareLink(link),
+		"url":  "/share/" + link.Token,
+	})
+}
+
+// ListShareLinks возвращает публичные ссылки альбома
+func (h *Handlers) ListShareLinks(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanEditAlbum(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden: недостаточно прав", http.StatusForbidden)
+		return
+	}
+
+	links, err := h.store.ListAlbumShareLinks(chi.URLParam(r, "id"))
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]*storage.ShareLink, 0, len(links))
+	for _, link := range links {
+		result = append(result, publicShareLink(link))
+	}
+	h.jsonResponse(w, result)
+}
+
+// RevokeShareLink отзывает публичную ссылку
+func (h *Handlers) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanEditAlbum(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden: недостаточно прав", http.StatusForbidden)
+		return
+	}
+
+	link, err := h.store.GetShareLink(chi.URLParam(r, "token"))
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if link == nil || link.AlbumID != chi.URLParam(r, "id") {
+		h.jsonError(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.store.DeleteShareLink(link.Token); err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{"status": "revoked"})
+}
+
+// publicShareLink копия ссылки без хеша пароля для ответа API
+func publicShareLink(link *storage.ShareLink) *storage.ShareLink {
+	c := *link
+	c.PasswordHash = ""
+	return &c
+}
+
+// shareCookieName имя cookie, подтверждающей ввод пароля ссылки
+func shareCookieName(token string) string {
+	return "share_" + token[:16]
+}
+
+// shareCookieValue значение cookie выводится из хеша пароля: смена пароля или отзыв ссылки его обнуляют
+func shareCookieValue(link *storage.ShareLink) string {
+	sum := sha256.Sum256([]byte(link.Token + ":" + link.PasswordHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// resolveShare проверяет токен, срок действия и альбом.
+// Для всего невалидного отвечает 404, чтобы не раскрывать существование ссылок.
+func (h *Handlers) resolveShare(w http.ResponseWriter, r *http.Request) (*storage.ShareLink, *storage.Album, bool) {
+	link, err := h.store.GetShareLink(chi.URLParam(r, "token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if link == nil || link.Expired() {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+
+	album, err := h.store.GetAlbum(link.AlbumID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if album == nil {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	return link, album, true
+}
+
+// shareUnlocked проверяет, что пароль ссылки (если есть) уже введен
+func shareUnlocked(r *http.Request, link *storage.ShareLink) bool {
+	if !link.HasPassword {
+		return true
+	}
+	cookie, err := r.Cookie(shareCookieName(link.Token))
+	return err == nil && cookie.Value == shareCookieValue(link)
+}
+
+// SharedAlbumPage отображает альбом по публичной ссылке (только просмотр, без сессии)
+func (h *Handlers) SharedAlbumPage(w http.ResponseWriter, r *http.Request) {
+	link, album, ok := h.resolveShare(w, r)
+	if !ok {
+		return
+	}
+
+	data := map[string]interface{}{
+		"HideHeader":   true,
+		"BuildVersion": h.buildVersion,
+		"Token":        link.Token,
+		"Album":        album,
+	}
+
+	if r.Method == http.MethodPost && link.HasPassword {
+		if !h.auth.CheckPassword(link.PasswordHash, r.FormValue("password")) {
+			data["NeedPassword"] = true
+			data["Error"] = "Неверный пароль"
+			w.WriteHeader(http.StatusUnauthorized)
+			h.render(w, "share.html", data)
+			return
+		}
+		cookie := &http.Cookie{
+			Name:     shareCookieName(link.Token),
+			Value:    shareCookieValue(link),
+			Path:     "/share/" + link.Token,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}
+		if link.ExpiresAt != nil {
+			cookie.Expires = *link.ExpiresAt
+		}
+		http.SetCookie(w, cookie)
+		http.Redirect(w, r, "/share/"+link.Token, http.StatusSeeOther)
+		return
+	}
+
+	if !shareUnlocked(r, link) {
+		data["NeedPassword"] = true
+		h.render(w, "share.html", data)
+		return
+	}
+
+	media, err := h.store.GetAlbumMedia(album.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	visible := make([]*storage.Media, 0, len(media))
+	for _, m := range media {
+		if m.DeletedAt == nil {
+			visible = append(visible, m)
+		}
+	}
+	data["Media"] = visible
+	h.render(w, "share.html", data)
+}
+
+// sharedMediaAllowed проверяет ссылку, пароль и то, что медиа входит в общий альбом и не в корзине
+func (h *Handlers) sharedMediaAllowed(w http.ResponseWriter, r *http.Request) bool {
+	link, album, ok := h.resolveShare(w, r)
+	if !ok {
+		return false
+	}
+	if !shareUnlocked(r, link) {
+		http.Error(w, "Password required", http.StatusUnauthorized)
+		return false
+	}
+
+	id := h.mediaID(r)
+	inAlbum, err := h.store.AlbumHasMedia(album, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !inAlbum {
+		http.NotFound(w, r)
+		return false
+	}
+
+	m, err := h.store.GetMedia(id)
+	if err != nil || m == nil || m.DeletedAt != nil {
+		http.NotFound(w, r)
+		return false
+	}
+	return true
+}
+
+// SharedMedia отдает оригинал медиа из общего альбома
+func (h *Handlers) SharedMedia(w http.ResponseWriter, r *http.Request) {
+	if h.sharedMediaAllowed(w, r) {
+		h.ServeMedia(w, r)
+	}
+}
+
+// SharedThumbnail отдает превью медиа из общего альбома
+func (h *Handlers) SharedThumbnail(w http.ResponseWriter, r *http.Request) {
+	if h.sharedMediaAllowed(w, r) {
+		h.ServeThumbnailSize(w, r)
+	}
+}
+
+// === Проверка (flag for review) ===
+
+// FlagMedia отмечает медиа для проверки (доступно любому пользователю)
+func (h *Handlers) FlagMedia(w http.ResponseWriter, r *http.Request) {
+	id := h.mediaID(r)
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if reason := []rune(req.Reason); len(reason) > 500 {
+		req.Reason = string(reason[:500])
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+	m, err := h.store.GetMedia(id)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// Удаляем из кэша и thumbnail файлы
-	for _, id := range req.MediaIDs {
-		h.cache.DeleteMedia(id)
-		h.thumbGen.DeleteThumbnails(id)
+	if m == nil || m.DeletedAt != nil {
+		h.jsonError(w, "Media not found", http.StatusNotFound)
+		return
 	}
 
-	if err := h.store.BulkDelete(req.MediaIDs); err != nil {
+	if err := h.store.FlagMedia(id, strings.TrimSpace(req.Reason), auth.GetUserID(r)); err != nil {
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.cache.DeleteMedia(id)
 
-	// Инвалидируем весь кэш
-	h.cache.Clear()
-
-	h.jsonResponse(w, map[string]interface{}{
-		"status": "deleted",
-		"count":  len(req.MediaIDs),
-	})
+	h.jsonResponse(w, map[string]string{"status": "flagged"})
 }
 
-// BulkDownload скачивает несколько файлов в ZIP
-func (h *Handlers) BulkDownload(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		MediaIDs []string `json:"media_ids"`
+// UnflagMedia снимает отметку проверки (только admin)
+func (h *Handlers) UnflagMedia(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanManageUsers(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+	id := h.mediaID(r)
+	if err := h.store.UnflagMedia(id); err != nil {
+		h.jsonError(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	h.cache.DeleteMedia(id)
 
-	media, err := h.store.GetMediaByIDs(req.MediaIDs)
+	h.jsonResponse(w, map[string]string{"status": "unflagged"})
+}
+
+// ListFlagged возвращает медиа, отмеченные для проверки (только admin)
+func (h *Handlers) ListFlagged(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanManageUsers(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	media, err := h.store.ListFlaggedMedia()
 	if err != nil {
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/zip")
-	w.Header().Set("Content-Disposition", "attachment; filename=\"photos.zip\"")
-
-	zipWriter := zip.NewWriter(w)
-	defer zipWriter.Close()
-
-	for _, m := range media {
-		file, err := os.Open(m.Path)
-		if err != nil {
-			continue
-		}
-
-		writer, err := zipWriter.Create(m.Filename)
-		if err != nil {
-			file.Close()
-			continue
-		}
-
-		io.Copy(writer, file)
-		file.Close()
-	}
+	h.jsonResponse(w, h.stripGPS(r, media))
 }
 
 // === Admin ===
@@ -1159,9 +2293,54 @@ func (h *Handlers) AdminPage(w http.ResponseWriter, r *http.Request) {
 
 	data := h.baseData(r)
 	data["Users"] = users
+	data["PasswordMinLength"] = h.cfg.Auth.PasswordMinLength
 	h.render(w, "admin.html", data)
 }
 
+// SetTheme сохраняет тему интерфейса текущего пользователя
+func (h *Handlers) SetTheme(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSession(r)
+	if session == nil {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Theme string `json:"theme"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !storage.IsValidTheme(req.Theme) {
+		h.jsonError(w, "theme must be dark, light or system", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.store.GetUser(session.Username)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		h.jsonError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	user.Theme = req.Theme
+	if err := h.store.SaveUser(user); err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status": "updated",
+		"theme":  user.Theme,
+	})
+}
+
 // ListUsers возвращает список пользователей (API)
 func (h *Handlers) ListUsers(w http.ResponseWriter, r *http.Request) {
 	role := auth.GetUserRole(r)
@@ -1237,6 +2416,11 @@ func (h *Handlers) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.auth.ValidatePassword(req.Password); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Хешируем пароль
 	hash, err := h.auth.HashPassword(req.Password)
 	if err != nil {
@@ -1304,13 +2488,19 @@ func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		user.DisplayName = req.DisplayName
 	}
 
+	roleChanged := false
 	if req.Role != "" {
 		if req.Role == storage.RoleAdmin || req.Role == storage.RoleEditor || req.Role == storage.RoleViewer {
+			roleChanged = user.Role != req.Role
 			user.Role = req.Role
 		}
 	}
 
 	if req.Password != "" {
+		if err := h.auth.ValidatePassword(req.Password); err != nil {
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		hash, err := h.auth.HashPassword(req.Password)
 		if err != nil {
 			h.jsonError(w, "Failed to hash password", http.StatusInternalServerError)
@@ -1319,7 +2509,16 @@ func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		user.PasswordHash = hash
 	}
 
-	if err := h.store.SaveUser(user); err != nil {
+	// Роль хранится в сессии - вместе с пользователем обновляем активные сессии и токены,
+	// иначе понижённый пользователь сохранит права до истечения сессии
+	if roleChanged {
+		updated, err := h.store.SaveUserWithRole(user)
+		if err != nil {
+			h.jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.InfoLog.Printf("Role of %s changed to %s, updated %d sessions/tokens", user.Username, user.Role, updated)
+	} else if err := h.store.SaveUser(user); err != nil {
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -1344,11 +2543,18 @@ func (h *Handlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteUser(username); err != nil {
+	if err := h.store.DeleteUser(username, h.cfg.Users.OnDelete, h.cfg.Auth.AdminUsername); err != nil {
+		if errors.Is(err, storage.ErrReassignTarget) {
+			h.jsonError(w, err.Error(), http.StatusConflict)
+			return
+		}
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Могли смениться владельцы медиа
+	h.cache.Clear()
+
 	h.jsonResponse(w, map[string]string{"status": "deleted"})
 }
 
@@ -1380,31 +2586,44 @@ func (h *Handlers) TrashPage(w http.ResponseWriter, r *http.Request) {
 	// Добавляем информацию о днях до удаления
 	type TrashItem struct {
 		*storage.Media
-		DaysRemaining int
+		DaysRemaining  int
 		DeletedDaysAgo int
+		Original       *storage.Media // Оригинал, если медиа попало в корзину как дубликат
 	}
 
+	// retention 0 — автоочистка выключена, дни до удаления не показываются
+	retention := h.cfg.TrashRetentionDays()
+
 	var items []TrashItem
 	for _, m := range trashMedia {
 		daysAgo := 0
-		remaining := 30
+		remaining := retention
 		if m.DeletedAt != nil {
 			daysAgo = int(time.Since(*m.DeletedAt).Hours() / 24)
-			remaining = 30 - daysAgo
+			if retention > 0 {
+				remaining = retention - daysAgo
+			}
 			if remaining < 0 {
 				remaining = 0
 			}
 		}
-		items = append(items, TrashItem{
+		item := TrashItem{
 			Media:          m,
 			DaysRemaining:  remaining,
 			DeletedDaysAgo: daysAgo,
-		})
+		}
+		if m.DuplicateOf != "" {
+			if original, err := h.store.ResolveOriginal(m.ID); err == nil {
+				item.Original = original
+			}
+		}
+		items = append(items, item)
 	}
 
 	data := h.baseData(r)
 	data["TrashItems"] = items
 	data["TrashCount"] = len(items)
+	data["RetentionDays"] = retention
 	h.render(w, "trash.html", data)
 }
 
@@ -1429,8 +2648,9 @@ func (h *Handlers) MoveToTrash(w http.ResponseWriter, r *http.Request) {
 	h.cache.Clear()
 
 	h.jsonResponse(w, map[string]interface{}{
-		"status":  "moved_to_trash",
-		"message": "Файл перемещён в корзину",
+		"status":     "moved_to_trash",
+		"message":    "Файл перемещён в корзину",
+		"undo_token": h.trashUndo.remember(auth.GetUserID(r), []string{id}),
 	})
 }
 
@@ -1482,14 +2702,12 @@ func (h *Handlers) PermanentDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Удаляем физический файл с диска
-	if err := os.Remove(media.Path); err != nil && !os.IsNotExist(err) {
-		logger.InfoLog.Printf("Warning: failed to delete file %s: %v", media.Path, err)
+	// Удаляем физический файл с диска и thumbnails
+	if err := h.thumbGen.PurgeFiles(media); err != nil {
+		logger.InfoLog.Printf("Warning: %v", err)
+		h.thumbGen.DeleteThumbnails(id)
 	}
 
-	// Удаляем thumbnails
-	h.thumbGen.DeleteThumbnails(id)
-
 	// Удаляем из БД и индексов
 	if err := h.store.DeleteMedia(id); err != nil {
 		h.jsonError(w, err.Error(), http.StatusInternalServerError)
@@ -1521,16 +2739,27 @@ func (h *Handlers) EmptyTrash(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// ?force=true удаляет записи даже для файлов, которые не удалось стереть с диска
+	force := r.URL.Query().Get("force") == "true"
+
+	type failedFile struct {
+		ID    string `json:"id"`
+		Path  string `json:"path"`
+		Error string `json:"error"`
+	}
 	var deleted int
+	failed := []failedFile{}
 	for _, m := range trashMedia {
-		// Удаляем физический файл с диска
-		if err := os.Remove(m.Path); err != nil && !os.IsNotExist(err) {
-			logger.InfoLog.Printf("Warning: failed to delete file %s: %v", m.Path, err)
+		// Удаляем физический файл с диска и thumbnails
+		if err := h.thumbGen.PurgeFiles(m); err != nil {
+			logger.InfoLog.Printf("Warning: %v", err)
+			failed = append(failed, failedFile{ID: m.ID, Path: m.Path, Error: err.Error()})
+			if !force {
+				continue // Оставляем запись в корзине, чтобы можно было повторить
+			}
+			h.thumbGen.DeleteThumbnails(m.ID)
 		}
 
-		// Удаляем thumbnails
-		h.thumbGen.DeleteThumbnails(m.ID)
-
 		// Удаляем из БД
 		if err := h.store.DeleteMedia(m.ID); err != nil {
 			logger.InfoLog.Printf("Error deleting media %s: %v", m.ID, err)
@@ -1542,16 +2771,79 @@ func (h *Handlers) EmptyTrash(w http.ResponseWriter, r *http.Request) {
 	// Инвалидируем кэш
 	h.cache.Clear()
 
+	status, message := "emptied", "Корзина очищена"
+	if len(failed) > 0 {
+		status, message = "partial", fmt.Sprintf("Не удалось удалить файлов: %d", len(failed))
+	}
+
 	h.jsonResponse(w, map[string]interface{}{
-		"status":  "emptied",
+		"status":  status,
 		"deleted": deleted,
-		"message": "Корзина очищена",
+		"failed":  failed,
+		"message": message,
 	})
 }
 
+// MediaColors возвращает сохраненные доминирующие цвета медиа (пусто, если палитра еще не посчитана)
+func (h *Handlers) MediaColors(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.colorsMedia(w, r)
+	if !ok {
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"id":     m.ID,
+		"colors": m.Colors,
+	})
+}
+
+// ComputeMediaColors вычисляет палитру по small превью и сохраняет ее, если она еще не посчитана
+func (h *Handlers) ComputeMediaColors(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanEdit(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	m, ok := h.colorsMedia(w, r)
+	if !ok {
+		return
+	}
+
+	if len(m.Colors) == 0 {
+		// GenerateThumbnail досчитывает палитру и для уже существующего превью
+		if _, err := h.thumbGen.GenerateThumbnail(m, "small"); err != nil {
+			h.jsonError(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := h.store.SaveMedia(m); err != nil {
+			h.jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.cache.DeleteMedia(m.ID)
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"id":     m.ID,
+		"colors": m.Colors,
+	})
+}
+
+// colorsMedia находит медиа для MediaColors и ComputeMediaColors; при ошибке ответ уже записан
+func (h *Handlers) colorsMedia(w http.ResponseWriter, r *http.Request) (*storage.Media, bool) {
+	m, err := h.store.GetMedia(chi.URLParam(r, "id"))
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if m == nil || m.DeletedAt != nil {
+		h.jsonError(w, "Media not found", http.StatusNotFound)
+		return nil, false
+	}
+	return m, true
+}
+
 // GetMediaInfo возвращает информацию о медиа в JSON
 func (h *Handlers) GetMediaInfo(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id := h.mediaID(r)
 
 	media, err := h.store.GetMedia(id)
 	if err != nil {
@@ -1563,7 +2855,36 @@ func (h *Handlers) GetMediaInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.jsonResponse(w, media)
+	if !h.canViewGeo(r) {
+		media = withoutGPS(media)
+	}
+	h.jsonResponse(w, struct {
+		*storage.Media
+		Thumbnails map[string]string `json:"thumbnails"` // URL превью по размерам (для srcset)
+	}{media, media.ThumbnailURLs(h.cfg.SrcsetSizes())})
+}
+
+// GetMediaOriginal возвращает оригинал дубликата с учетом цепочки замен
+func (h *Handlers) GetMediaOriginal(w http.ResponseWriter, r *http.Request) {
+	id := h.mediaID(r)
+
+	original, err := h.store.ResolveOriginal(id)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if original == nil {
+		h.jsonError(w, "Original not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.canViewGeo(r) {
+		original = withoutGPS(original)
+	}
+	h.jsonResponse(w, struct {
+		*storage.Media
+		Thumbnails map[string]string `json:"thumbnails"` // URL превью по размерам (для srcset)
+	}{original, original.ThumbnailURLs(h.cfg.SrcsetSizes())})
 }
 
 // ReplaceDuplicate заменяет оригинал на дубликат
@@ -1599,20 +2920,9 @@ func (h *Handlers) ReplaceDuplicate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 1. Оригинал становится дубликатом и перемещается в корзину
-	now := time.Now()
-	original.DuplicateOf = req.DuplicateID
-	original.DeletedAt = &now
-	if err := h.store.SaveMedia(original); err != nil {
-		h.jsonError(w, "Failed to update original: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// 2. Дубликат становится основным файлом и восстанавливается из корзины
-	duplicate.DuplicateOf = ""
-	duplicate.DeletedAt = nil
-	if err := h.store.SaveMedia(duplicate); err != nil {
-		h.jsonError(w, "Failed to update duplicate: "+err.Error(), http.StatusInternalServerError)
+	// Оригинал уходит в корзину как дубликат, дубликат становится основным файлом
+	if err := h.store.ReplaceDuplicate(duplicate, original); err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -1668,6 +2978,104 @@ func (h *Handlers) UnmarkDuplicate(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Параметры поиска дубликатов для просмотра
+const (
+	defaultDuplicateThreshold = 10 // Как в GetDuplicatesStats
+	maxDuplicateThreshold     = 64 // Длина pHash в битах
+	defaultDuplicateLimit     = 20
+	maxDuplicateLimit         = 200
+)
+
+// duplicatePage страница групп дубликатов
+type duplicatePage struct {
+	Groups     []*storage.DuplicateGroup `json:"groups"`
+	TotalCount int                       `json:"total_count"`
+	HasMore    bool                      `json:"has_more"`
+	Truncated  bool                      `json:"truncated"` // Поиск остановлен по лимиту групп или времени
+	Threshold  int                       `json:"threshold"`
+	Limit      int                       `json:"limit"`
+	Offset     int                       `json:"offset"`
+}
+
+// findDuplicatePage ищет группы дубликатов по параметрам threshold, limit, offset
+func (h *Handlers) findDuplicatePage(r *http.Request) (*duplicatePage, error) {
+	page := &duplicatePage{
+		Threshold: defaultDuplicateThreshold,
+		Limit:     defaultDuplicateLimit,
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("threshold")); err == nil && v >= 0 && v <= maxDuplicateThreshold {
+		page.Threshold = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		page.Limit = min(v, maxDuplicateLimit)
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && v > 0 {
+		page.Offset = v
+	}
+
+	groups, truncated, err := h.store.FindDuplicates(page.Threshold, scanner.DuplicateScope(h.cfg), scanner.DuplicateLimits(h.cfg))
+	if err != nil {
+		return nil, err
+	}
+	page.Truncated = truncated
+
+	page.TotalCount = len(groups)
+	start := min(page.Offset, len(groups))
+	end := min(start+page.Limit, len(groups))
+	page.Groups = groups[start:end]
+	page.HasMore = end < len(groups)
+	return page, nil
+}
+
+// ListDuplicates возвращает группы точных и похожих дубликатов среди медиа вне корзины
+func (h *Handlers) ListDuplicates(w http.ResponseWriter, r *http.Request) {
+	// Проверка прав: только admin и editor
+	role := auth.GetUserRole(r)
+	if !auth.CanEdit(role) {
+		h.jsonError(w, "Forbidden: недостаточно прав", http.StatusForbidden)
+		return
+	}
+
+	page, err := h.findDuplicatePage(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if page.Groups == nil {
+		page.Groups = []*storage.DuplicateGroup{}
+	}
+	for _, g := range page.Groups {
+		g.Media = h.stripGPS(r, g.Media)
+	}
+	h.jsonResponse(w, page)
+}
+
+// DuplicatesPage отображает группы дубликатов рядом для ручного разбора
+func (h *Handlers) DuplicatesPage(w http.ResponseWriter, r *http.Request) {
+	// Проверка прав: только admin и editor
+	role := auth.GetUserRole(r)
+	if !auth.CanEdit(role) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	page, err := h.findDuplicatePage(r)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	data := h.baseData(r)
+	data["Duplicates"] = page
+	data["HasPrev"] = page.Offset > 0
+	data["PrevOffset"] = max(page.Offset-page.Limit, 0)
+	if page.HasMore {
+		data["NextOffset"] = page.Offset + page.Limit
+	}
+	h.render(w, "duplicates.html", data)
+}
+
 // BulkMoveToTrash перемещает несколько медиа в корзину
 func (h *Handlers) BulkMoveToTrash(w http.ResponseWriter, r *http.Request) {
 	// Проверка прав: только admin
@@ -1686,21 +3094,22 @@ func (h *Handlers) BulkMoveToTrash(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var moved int
+	var moved []string
 	for _, id := range req.MediaIDs {
 		if err := h.store.SoftDeleteMedia(id); err != nil {
 			logger.InfoLog.Printf("Error moving media %s to trash: %v", id, err)
 			continue
 		}
 		h.cache.DeleteMedia(id)
-		moved++
+		moved = append(moved, id)
 	}
 
 	h.cache.Clear()
 
 	h.jsonResponse(w, map[string]interface{}{
-		"status": "moved_to_trash",
-		"count":  moved,
+		"status":     "moved_to_trash",
+		"count":      len(moved),
+		"undo_token": h.trashUndo.remember(auth.GetUserID(r), moved),
 	})
 }
 
@@ -1778,10 +3187,7 @@ func (h *Handlers) render(w http.ResponseWriter, name string, data interface{})
 	}
 
 	// Выполняем шаблон "base" который использует блоки определённые в странице
-	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-		logger.ErrorLog.Printf("Template execution error for %s: %v", name, err)
-		http.Error(w, "Internal error", http.StatusInternalServerError)
-	}
+	h.executeTemplate(w, tmpl, name, "base", data)
 }
 
 // renderPartial рендерит фрагмент шаблона (без base)
@@ -1796,10 +3202,61 @@ func (h *Handlers) renderPartial(w http.ResponseWriter, name string, data interf
 	}
 
 	// Выполняем шаблон напрямую по имени (для фрагментов)
-	if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
+	h.executeTemplate(w, tmpl, name, name, data)
+}
+
+// errorPageHTML страница ошибки рендеринга: без деталей, они только в логе
+const errorPageHTML = `<!DOCTYPE html>
+<html lang="ru"><head><meta charset="utf-8"><title>Ошибка - PhotoCore</title></head>
+<body style="font-family: sans-serif; text-align: center; padding: 4rem 1rem;">
+<h1>Что-то пошло не так</h1>
+<p>Не удалось отобразить страницу. Попробуйте обновить её позже.</p>
+<p><a href="/">На главную</a></p>
+</body></html>`
+
+// executeTemplate рендерит шаблон в буфер и отправляет клиенту только при успехе,
+// чтобы ошибка посередине шаблона не оставляла обрезанную страницу со статусом 200
+func (h *Handlers) executeTemplate(w http.ResponseWriter, tmpl *template.Template, name, templateName string, data interface{}) {
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, templateName, data); err != nil {
 		logger.ErrorLog.Printf("Template execution error for %s: %v", name, err)
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, errorPageHTML)
+		return
+	}
+	if h.cfg.Server.MinifyHTML {
+		w.Write(minifyHTML(buf.Bytes()))
+		return
+	}
+	buf.WriteTo(w)
+}
+
+// canViewGeo проверяет, доступны ли текущему пользователю карта и GPS координаты
+func (h *Handlers) canViewGeo(r *http.Request) bool {
+	return h.auth.CanViewGeo(auth.GetUserRole(r))
+}
+
+// stripGPS убирает GPS координаты из списка медиа, если у пользователя нет доступа к геоданным
+func (h *Handlers) stripGPS(r *http.Request, media []*storage.Media) []*storage.Media {
+	if h.canViewGeo(r) {
+		return media
 	}
+	result := make([]*storage.Media, len(media))
+	for i, m := range media {
+		result[i] = withoutGPS(m)
+	}
+	return result
+}
+
+// withoutGPS возвращает копию медиа без координат и места (объекты из кэша общие, менять их нельзя)
+func withoutGPS(m *storage.Media) *storage.Media {
+	c := *m
+	c.Metadata.GPSLat = 0
+	c.Metadata.GPSLon = 0
+	c.Metadata.Place = ""
+	c.Metadata.Country = ""
+	return &c
 }
 
 func (h *Handlers) jsonResponse(w http.ResponseWriter, data interface{}) {
@@ -1807,39 +3264,16 @@ func (h *Handlers) jsonResponse(w http.ResponseWriter, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-func (h *Handlers) jsonError(w http.ResponseWriter, message string, code int) {
+// jsonError отвечает ошибкой API с кодом по статусу (см. errorCodeFor)
+func (h *Handlers) jsonError(w http.ResponseWriter, message string, status int) {
+	h.jsonErrorCode(w, message, status, errorCodeFor(status))
+}
+
+// jsonErrorCode отвечает ошибкой API с явным кодом, когда статус его не определяет
+func (h *Handlers) jsonErrorCode(w http.ResponseWriter, message string, status int, code ErrorCode) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
-}
-
-func (h *Handlers) getMimeType(ext string) string {
-	mimeTypes := map[string]string{
-		".jpg":  "image/jpeg",
-		".jpeg": "image/jpeg",
-		".png":  "image/png",
-		".gif":  "image/gif",
-		".webp": "image/webp",
-		".heic": "image/heic",
-		".mp4":  "video/mp4",
-		".mov":  "video/quicktime",
-		".avi":  "video/x-msvideo",
-		".mkv":  "video/x-matroska",
-		".webm": "video/webm",
-		".raw":  "image/x-raw",
-		".cr2":  "image/x-canon-cr2",
-		".cr3":  "image/x-canon-cr3",
-		".nef":  "image/x-nikon-nef",
-		".arw":  "image/x-sony-arw",
-		".dng":  "image/x-adobe-dng",
-		".orf":  "image/x-olympus-orf",
-		".raf":  "image/x-fuji-raf",
-		".rw2":  "image/x-panasonic-rw2",
-	}
-	if mime, ok := mimeTypes[ext]; ok {
-		return mime
-	}
-	return "application/octet-stream"
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&apiError{Error: message, Code: code})
 }
 
 // === Upload Page ===
@@ -1891,13 +3325,14 @@ func (h *Handlers) UploadMedia(w http.ResponseWriter, r *http.Request) {
 
 	// Создаем map расширений для быстрой проверки
 	extensions := make(map[string]storage.MediaType)
-	for _, ext := range h.cfg.Scan.Extensions.Images {
+	exts := h.cfg.Extensions()
+	for _, ext := range exts.Images {
 		extensions[strings.ToLower(ext)] = storage.MediaTypeImage
 	}
-	for _, ext := range h.cfg.Scan.Extensions.Videos {
+	for _, ext := range exts.Videos {
 		extensions[strings.ToLower(ext)] = storage.MediaTypeVideo
 	}
-	for _, ext := range h.cfg.Scan.Extensions.Raw {
+	for _, ext := range exts.Raw {
 		extensions[strings.ToLower(ext)] = storage.MediaTypeRaw
 	}
 
@@ -1984,17 +3419,28 @@ func (h *Handlers) UploadMedia(w http.ResponseWriter, r *http.Request) {
 			Filename:   uniqueFilename,
 			Ext:        ext,
 			Type:       mediaType,
-			MimeType:   h.getMimeType(ext),
+			MimeType:   h.cfg.MimeType(ext),
 			Size:       fileInfo.Size(),
 			ModifiedAt: fileInfo.ModTime(),
 			CreatedAt:  now,
+			UploadedBy: session.UserID,
 		}
 
 		// Извлекаем метаданные для изображений
+		var keywords []string
 		if mediaType == storage.MediaTypeImage || mediaType == storage.MediaTypeRaw {
-			if err := scanner.ExtractMetadata(targetPath, mediaItem); err != nil {
+			if err := scanner.ExtractMetadata(targetPath, mediaItem, h.cfg.CaptureLocation()); err != nil {
 				logger.InfoLog.Printf("Warning: failed to extract metadata from %s: %v", uniqueFilename, err)
 			}
+			if keywords, err = scanner.ExtractXMP(targetPath, mediaItem); err != nil {
+				logger.InfoLog.Printf("Warning: failed to extract XMP from %s: %v", uniqueFilename, err)
+			}
+		}
+		h.scanner.Geocode(mediaItem)
+		if mediaType == storage.MediaTypeVideo {
+			if err := h.scanner.ExtractVideoMetadata(targetPath, mediaItem); err != nil {
+				logger.InfoLog.Printf("Warning: failed to extract video metadata from %s: %v", uniqueFilename, err)
+			}
 		}
 
 		// Вычисляем хеши
@@ -2009,11 +3455,10 @@ func (h *Handlers) UploadMedia(w http.ResponseWriter, r *http.Request) {
 
 		// Проверяем на дубликаты
 		dupResult, err := h.store.CheckDuplicate(
-			mediaItem.Size,
-			mediaItem.Checksum,
-			mediaItem.ImageHash,
+			mediaItem,
 			isImage,
 			10, // Similarity threshold
+			scanner.DuplicateScope(h.cfg),
 		)
 		if err == nil && dupResult != nil && dupResult.IsDuplicate {
 			// Дубликат - помечаем и переносим в корзину
@@ -2033,6 +3478,12 @@ func (h *Handlers) UploadMedia(w http.ResponseWriter, r *http.Request) {
 		mediaIDs = append(mediaIDs, mediaItem.ID)
 		uploaded++
 
+		if h.cfg.Scan.ImportKeywords && len(keywords) > 0 {
+			if err := h.store.AddTagsToMedia(mediaItem.ID, keywords); err != nil {
+				logger.InfoLog.Printf("Warning: failed to add keyword tags to %s: %v", uniqueFilename, err)
+			}
+		}
+
 		// Добавляем в очередь генерации превью
 		if mediaItem.DeletedAt == nil {
 			h.thumbService.QueueAllThumbnails(mediaItem.ID)
@@ -2065,7 +3516,9 @@ func (h *Handlers) GenerateAPIToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		DeviceName string `json:"device_name"`
+		DeviceName string   `json:"device_name"`
+		TTLDays    int      `json:"ttl_days"` // 0 — срок по умолчанию
+		Scopes     []string `json:"scopes"`   // read, upload, admin; пусто — все права роли
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -2076,8 +3529,19 @@ func (h *Handlers) GenerateAPIToken(w http.ResponseWriter, r *http.Request) {
 	if req.DeviceName == "" {
 		req.DeviceName = "Unnamed Device"
 	}
+	if req.TTLDays < 0 {
+		h.jsonError(w, "ttl_days must not be negative", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !storage.IsValidScope(scope) {
+			h.jsonError(w, "Unknown scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
 
-	token, err := h.auth.GenerateAPIToken(session.UserID, session.Username, session.Role, req.DeviceName)
+	ttl := time.Duration(req.TTLDays) * 24 * time.Hour
+	token, err := h.auth.GenerateAPIToken(session.UserID, session.Username, session.Role, req.DeviceName, ttl, req.Scopes)
 	if err != nil {
 		h.jsonError(w, "Failed to generate token: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -2124,7 +3588,7 @@ func (h *Handlers) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
 			h.jsonError(w, "Failed to get token: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if apiToken == nil {
+		if apiToken == nil || apiToken.Expired() {
 			h.jsonError(w, "Token not found", http.StatusNotFound)
 			return
 		}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/photocore/photocore/internal/auth"
+	"github.com/photocore/photocore/internal/cache"
+	"github.com/photocore/photocore/internal/config"
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/media"
+	"github.com/photocore/photocore/internal/scanner"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// newTestHandlers создает обработчики над временными БД, кэшем превью и медиа-корнем.
+// extraYAML дописывается в конфигурацию (разделы кроме storage).
+func newTestHandlers(tb testing.TB, extraYAML string) (*Handlers, string) {
+	tb.Helper()
+	dir := tb.TempDir()
+	root := filepath.Join(dir, "media")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		tb.Fatal(err)
+	}
+	if err := logger.Init(filepath.Join(dir, "logs")); err != nil {
+		tb.Fatal(err)
+	}
+
+	yaml := fmt.Sprintf(`storage:
+  media_paths: [%q]
+  cache_path: %q
+  db_path: %q
+  logs_path: %q
+scan:
+  extensions:
+    images: [".jpg", ".png"]
+%s`, root, filepath.Join(dir, "cache"), filepath.Join(dir, "data", "test.db"), filepath.Join(dir, "logs"), extraYAML)
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	store, err := storage.NewStore(cfg.Storage.DBPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { store.Close() })
+
+	thumbGen := media.NewThumbnailGenerator(cfg)
+	if err := thumbGen.EnsureCacheDir(); err != nil {
+		tb.Fatal(err)
+	}
+	h := NewHandlers(cfg, store, scanner.NewScanner(cfg, store), thumbGen, auth.NewAuth(cfg, store),
+		nil, cache.NewMediaCache(), nil, nil, "")
+	return h, root
+}
+
+// withRole добавляет в запрос сессию пользователя с ролью role
+func withRole(r *http.Request, role string) *http.Request {
+	session := &storage.Session{ID: "test-session", UserID: "user-" + role, Username: role, Role: role}
+	return r.WithContext(context.WithValue(r.Context(), auth.SessionKey, session))
+}
+
+// addTestMedia сохраняет запись медиа для файла path (файл не создается)
+func addTestMedia(tb testing.TB, h *Handlers, path string, edit func(m *storage.Media)) *storage.Media {
+	tb.Helper()
+	m := &storage.Media{
+		ID:       storage.GenerateID(path),
+		Path:     path,
+		Dir:      filepath.Dir(path),
+		Filename: filepath.Base(path),
+		Ext:      filepath.Ext(path),
+		Type:     storage.MediaTypeImage,
+	}
+	if edit != nil {
+		edit(m)
+	}
+	if err := h.store.SaveMedia(m); err != nil {
+		tb.Fatal(err)
+	}
+	return m
+}
+
+// writeSolidJPEG пишет однотонный JPEG size x size
+func writeSolidJPEG(tb testing.TB, path string, c color.Color, size int) {
+	tb.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	if err := jpeg.Encode(f, img, nil); err != nil {
+		tb.Fatal(err)
+	}
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// Healthz проверка живости для оркестратора: отвечает 200, пока HTTP-сервер работает
+func (h *Handlers) Healthz(w http.ResponseWriter, r *http.Request) {
+	h.jsonResponse(w, map[string]string{"status": "ok"})
+}
+
+// Readyz проверка готовности: база читается и пул воркеров запущен, иначе 503 с причиной
+func (h *Handlers) Readyz(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.Ping(); err != nil {
+		h.jsonError(w, "store unavailable: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if h.workerPool == nil || !h.workerPool.Running() {
+		h.jsonError(w, "worker pool not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{"status": "ready"})
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyzRequiresWorkerPool(t *testing.T) {
+	h, _ := newTestHandlers(t, "") // Без пула воркеров
+
+	rec := httptest.NewRecorder()
+	h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz without worker pool = %d, want 503", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200", rec.Code)
+	}
+}
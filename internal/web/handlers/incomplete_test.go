@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func TestIncompleteMediaByMissingField(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	taken := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	addTestMedia(t, h, filepath.Join(root, "complete.jpg"), func(m *storage.Media) {
+		m.TakenAt = taken
+		m.Metadata.Camera = "Canon EOS R"
+		m.Metadata.GPSLat, m.Metadata.GPSLon = 55.75, 37.62
+	})
+	addTestMedia(t, h, filepath.Join(root, "nocamera.jpg"), func(m *storage.Media) {
+		m.TakenAt = taken
+		m.Metadata.GPSLat, m.Metadata.GPSLon = 55.75, 37.62
+	})
+	addTestMedia(t, h, filepath.Join(root, "nogps.jpg"), func(m *storage.Media) {
+		m.TakenAt = taken
+		m.Metadata.Camera = "Canon EOS R"
+	})
+	addTestMedia(t, h, filepath.Join(root, "nodate.jpg"), func(m *storage.Media) {
+		m.Metadata.Camera = "Canon EOS R"
+		m.Metadata.GPSLat, m.Metadata.GPSLon = 55.75, 37.62
+	})
+	addTestMedia(t, h, filepath.Join(root, "bare.jpg"), nil)
+
+	get := func(query string) (int, []string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.IncompleteMedia(rec, withRole(httptest.NewRequest(http.MethodGet, "/api/media/incomplete"+query, nil), storage.RoleViewer))
+		if rec.Code != http.StatusOK {
+			return rec.Code, nil
+		}
+		var result storage.SearchResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, m := range result.Media {
+			names = append(names, m.Filename)
+		}
+		sort.Strings(names)
+		return rec.Code, names
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?missing=gps", []string{"bare.jpg", "nogps.jpg"}},
+		{"?missing=Camera", []string{"bare.jpg", "nocamera.jpg"}},
+		{"?missing=date", []string{"bare.jpg", "nodate.jpg"}},
+		{"?missing=gps,date", []string{"bare.jpg"}}, // Нет ни одного из полей
+		{"", []string{"bare.jpg"}},                  // По умолчанию — все три поля
+	}
+	for _, tt := range tests {
+		if code, got := get(tt.query); code != http.StatusOK || !slices.Equal(got, tt.want) {
+			t.Errorf("%q = %d %v, want %v", tt.query, code, got, tt.want)
+		}
+	}
+
+	if code, _ := get("?missing=lens"); code != http.StatusBadRequest {
+		t.Errorf("unknown field = %d, want 400", code)
+	}
+}
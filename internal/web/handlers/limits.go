@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/photocore/photocore/internal/logger"
+)
+
+// heavyLimiter ограничивает число одновременных тяжелых запросов с одного IP
+// (ZIP-архив, контактный лист; отдельным экземпляром — синхронная генерация превью),
+// чтобы один клиент не занял весь CPU и диск
+type heavyLimiter struct {
+	limit int // <= 0 — без ограничения
+
+	mu     sync.Mutex
+	active map[string]int // IP -> запросов в работе
+}
+
+func newHeavyLimiter(limit int) *heavyLimiter {
+	return &heavyLimiter{limit: limit, active: make(map[string]int)}
+}
+
+// acquire занимает слот для ip; false — лимит исчерпан
+func (l *heavyLimiter) acquire(ip string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[ip] >= l.limit {
+		return false
+	}
+	l.active[ip]++
+	return true
+}
+
+// release освобождает слот, занятый acquire
+func (l *heavyLimiter) release(ip string) {
+	if l.limit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[ip] <= 1 {
+		delete(l.active, ip)
+		return
+	}
+	l.active[ip]--
+}
+
+// Heavy оборачивает тяжелый обработчик: сверх лимита одновременных запросов с IP — 429
+func (h *Handlers) Heavy(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := h.clientIP(r)
+		if !h.heavy.acquire(ip) {
+			h.tooManyHeavy(w)
+			return
+		}
+		defer h.heavy.release(ip)
+		next(w, r)
+	}
+}
+
+// tooManyHeavy ответ, когда у IP уже выполняется максимум тяжелых запросов
+func (h *Handlers) tooManyHeavy(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "5")
+	h.jsonError(w, "Too many concurrent heavy requests, retry later", http.StatusTooManyRequests)
+}
+
+// parseTrustedProxies разбирает server.trusted_proxies: IP или CIDR
+func parseTrustedProxies(values []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			logger.InfoLog.Printf("Ignoring invalid trusted proxy %q: %v", value, err)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// clientIP возвращает IP клиента. За доверенным прокси (server.trusted_proxies)
+// берется самый правый адрес X-Forwarded-For, не принадлежащий прокси, или X-Real-IP;
+// иначе заголовки игнорируются — их может подделать любой клиент.
+func (h *Handlers) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !h.trustedProxy(ip) {
+		return ip
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			if !h.trustedProxy(hop) {
+				return hop
+			}
+			ip = hop
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return ip
+}
+
+// trustedProxy входит ли ip в server.trusted_proxies
+func (h *Handlers) trustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range h.trustedProxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP возвращает IP из RemoteAddr (без порта)
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blockingHandler держит запрос, пока не закрыт release; started сообщает о входе
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func TestHeavyRejectsSecondConcurrentRequest(t *testing.T) {
+	h, _ := newTestHandlers(t, "")
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	handler := h.Heavy(blockingHandler(started, release))
+
+	first := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/contact-sheet", nil))
+		first <- rec.Code
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first heavy request did not start")
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/contact-sheet", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second concurrent request = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+
+	// Запрос с другого IP не ждет чужого слота
+	other := httptest.NewRequest(http.MethodPost, "/api/contact-sheet", nil)
+	other.RemoteAddr = "198.51.100.7:4000"
+	go handler(httptest.NewRecorder(), other)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request from another IP was blocked")
+	}
+
+	close(release)
+	if code := <-first; code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", code)
+	}
+
+	// Слот освобожден
+	started = make(chan struct{}, 1)
+	release = make(chan struct{})
+	close(release)
+	rec = httptest.NewRecorder()
+	h.Heavy(blockingHandler(started, release))(rec, httptest.NewRequest(http.MethodPost, "/api/contact-sheet", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("request after release = %d, want 200", rec.Code)
+	}
+}
+
+func TestThumbnailWaitsUseSeparateLimit(t *testing.T) {
+	h, _ := newTestHandlers(t, "thumbnails:\n  wait_per_ip: 2\n")
+	ip := "192.0.2.1"
+
+	// Ожидание превью не занимает слот тяжелых запросов
+	for i := 0; i < 2; i++ {
+		if !h.thumbWaits.acquire(ip) {
+			t.Fatalf("thumbnail wait %d rejected under its own limit", i+1)
+		}
+	}
+	if !h.heavy.acquire(ip) {
+		t.Fatal("heavy request rejected while only thumbnail waits are active")
+	}
+	h.heavy.release(ip)
+
+	if h.thumbWaits.acquire(ip) {
+		t.Error("third thumbnail wait accepted with wait_per_ip 2")
+	}
+	h.thumbWaits.release(ip)
+	if !h.thumbWaits.acquire(ip) {
+		t.Error("thumbnail wait slot was not released")
+	}
+}
+
+func TestClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	h, _ := newTestHandlers(t, "server:\n  trusted_proxies: [\"10.0.0.0/8\"]\n")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.5:1234"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	if ip := h.clientIP(r); ip != "203.0.113.5" {
+		t.Errorf("untrusted peer: clientIP = %s, want the connection address", ip)
+	}
+
+	r.RemoteAddr = "10.1.2.3:1234"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 198.51.100.9, 10.0.0.2")
+	if ip := h.clientIP(r); ip != "198.51.100.9" {
+		t.Errorf("behind proxy: clientIP = %s, want the rightmost untrusted hop", ip)
+	}
+}
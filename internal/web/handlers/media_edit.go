@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/photocore/photocore/internal/auth"
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/media"
+	"github.com/photocore/photocore/internal/scanner"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// Ориентации EXIF без отражения и с отражением по горизонтали, по повороту 0/90/180/270° по часовой
+var (
+	rotatedOrientations  = [4]int{1, 6, 3, 8}
+	mirroredOrientations = [4]int{2, 7, 4, 5}
+)
+
+// rotateOrientation поворачивает EXIF ориентацию на degrees (кратно 90, по часовой)
+func rotateOrientation(orientation, degrees int) int {
+	table, step := rotatedOrientations, 0
+	for i, o := range rotatedOrientations {
+		if o == orientation {
+			step = i
+		}
+	}
+	for i, o := range mirroredOrientations {
+		if o == orientation {
+			table, step = mirroredOrientations, i
+		}
+	}
+	step = ((step+degrees/90)%4 + 4) % 4
+	return table[step]
+}
+
+// editableMedia проверяет права и возвращает медиа для записи EXIF; при ошибке ответ уже отправлен
+func (h *Handlers) editableMedia(w http.ResponseWriter, r *http.Request) *storage.Media {
+	if !auth.CanEdit(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+
+	m, err := h.store.GetMedia(h.mediaID(r))
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if m == nil || m.DeletedAt != nil {
+		h.jsonError(w, "Media not found", http.StatusNotFound)
+		return nil
+	}
+	return m
+}
+
+// exifWriteError отвечает на ошибку записи EXIF; неподдерживаемый формат — отдельное сообщение
+func (h *Handlers) exifWriteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, media.ErrExifUnsupported) {
+		h.jsonError(w, "This file format cannot store EXIF, only JPEG can be edited", http.StatusUnsupportedMediaType)
+		return
+	}
+	h.jsonError(w, "Failed to write EXIF: "+err.Error(), http.StatusInternalServerError)
+}
+
+// refreshEditedMedia перечитывает файл после записи EXIF: размер и время изменения
+// (иначе сканер посчитает файл измененным), метаданные и контрольную сумму.
+// При rotated превью удаляются и ставятся в очередь заново.
+func (h *Handlers) refreshEditedMedia(m *storage.Media, rotated bool) error {
+	info, err := os.Stat(m.Path)
+	if err != nil {
+		return err
+	}
+	m.Size = info.Size()
+	m.ModifiedAt = info.ModTime()
+
+	if err := scanner.ExtractMetadata(m.Path, m, h.cfg.CaptureLocation()); err != nil {
+		logger.InfoLog.Printf("Warning: failed to extract metadata from %s: %v", m.Filename, err)
+	}
+	if hashes, err := scanner.CalculateHashes(m.Path, true); err != nil {
+		logger.InfoLog.Printf("Warning: failed to calculate hashes for %s: %v", m.Filename, err)
+	} else {
+		m.Checksum = hashes.Checksum
+		m.ImageHash = hashes.ImageHash
+	}
+
+	if rotated {
+		m.ThumbSmall = ""
+		m.ThumbLarge = ""
+		m.BlurHash = "" // Пересчитается по новому превью
+	}
+	if err := h.store.SaveMedia(m); err != nil {
+		return err
+	}
+
+	if rotated {
+		h.thumbGen.DeleteThumbnails(m.ID)
+		h.thumbService.QueueAllThumbnails(m.ID)
+	}
+	h.cache.Clear()
+	return nil
+}
+
+// RotateMedia сохраняет поворот в EXIF Orientation файла (editor и admin).
+// Тело: {"degrees": 90} — поворот относительно текущего (кратно 90, по часовой)
+// или {"orientation": 6} — значение EXIF 1-8.
+func (h *Handlers) RotateMedia(w http.ResponseWriter, r *http.Request) {
+	m := h.editableMedia(w, r)
+	if m == nil {
+		return
+	}
+
+	var req struct {
+		Degrees     int `json:"degrees"`
+		Orientation int `json:"orientation"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	orientation := req.Orientation
+	if orientation == 0 {
+		if req.Degrees%90 != 0 {
+			h.jsonError(w, "degrees must be a multiple of 90", http.StatusBadRequest)
+			return
+		}
+		orientation = rotateOrientation(m.Metadata.Orientation, req.Degrees)
+	}
+	if orientation < 1 || orientation > 8 {
+		h.jsonError(w, "orientation must be between 1 and 8", http.StatusBadRequest)
+		return
+	}
+
+	if err := media.WriteOrientation(m.Path, orientation); err != nil {
+		h.exifWriteError(w, err)
+		return
+	}
+	if err := h.refreshEditedMedia(m, true); err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"status":      "rotated",
+		"orientation": m.Metadata.Orientation,
+	})
+}
+
+// SetMediaDate сохраняет дату съемки в EXIF файла (editor и admin).
+// Тело: {"taken_at": "2023-05-01T14:30"} — локальное время съемки, как в EXIF, без часового пояса.
+func (h *Handlers) SetMediaDate(w http.ResponseWriter, r *http.Request) {
+	m := h.editableMedia(w, r)
+	if m == nil {
+		return
+	}
+
+	var req struct {
+		TakenAt string `json:"taken_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	takenAt, ok := parseTakenAt(req.TakenAt, h.cfg.CaptureLocation())
+	if !ok {
+		h.jsonError(w, "Invalid taken_at, expected YYYY-MM-DDTHH:MM[:SS]", http.StatusBadRequest)
+		return
+	}
+
+	if err := media.WriteDateTaken(m.Path, takenAt); err != nil {
+		h.exifWriteError(w, err)
+		return
+	}
+	if err := h.refreshEditedMedia(m, false); err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"status":   "updated",
+		"taken_at": m.TakenAt,
+	})
+}
+
+// parseTakenAt разбирает дату из <input type="datetime-local"> или RFC 3339.
+// Время без часового пояса считается местным временем съемки в loc.
+func parseTakenAt(value string, loc *time.Location) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// BulkUpdateMetadata перезаписывает дату съемки, камеру и описание у нескольких медиа (editor и admin).
+// Тело: {"media_ids": [...], "taken_at": "2023-05-01T14:30", "camera": "...", "caption": "..."};
+// отсутствующее поле не меняется, пустая строка в camera/caption очищает его.
+// Меняется только запись в базе: общая для пачки правка не пишется в файлы.
+func (h *Handlers) BulkUpdateMetadata(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanEdit(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden: недостаточно прав", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		MediaIDs []string `json:"media_ids"`
+		TakenAt  *string  `json:"taken_at"`
+		Camera   *string  `json:"camera"`
+		Caption  *string  `json:"caption"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.MediaIDs) == 0 {
+		h.jsonError(w, "media_ids is required", http.StatusBadRequest)
+		return
+	}
+
+	var edit storage.MetadataEdit
+	if req.TakenAt != nil {
+		takenAt, ok := parseTakenAt(*req.TakenAt, h.cfg.CaptureLocation())
+		if !ok {
+			h.jsonError(w, "Invalid taken_at, expected YYYY-MM-DDTHH:MM[:SS]", http.StatusBadRequest)
+			return
+		}
+		edit.TakenAt = &takenAt
+	}
+	if req.Camera != nil {
+		camera := strings.TrimSpace(*req.Camera)
+		edit.Camera = &camera
+	}
+	if req.Caption != nil {
+		caption := strings.TrimSpace(*req.Caption)
+		edit.Caption = &caption
+	}
+	if edit.TakenAt == nil && edit.Camera == nil && edit.Caption == nil {
+		h.jsonError(w, "Nothing to update: set taken_at, camera or caption", http.StatusBadRequest)
+		return
+	}
+
+	results := h.store.BulkUpdateMetadata(req.MediaIDs, edit)
+
+	// Дата и камера меняют группы хронологии и статистику
+	h.cache.Clear()
+
+	h.bulkResponse(w, "updated", results)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// postBulkMetadata отправляет body в BulkUpdateMetadata от имени роли role
+func postBulkMetadata(h *Handlers, role, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := withRole(httptest.NewRequest(http.MethodPost, "/api/bulk/metadata", strings.NewReader(body)), role)
+	h.BulkUpdateMetadata(rec, req)
+	return rec
+}
+
+// timelineCounts число медиа в каждой группе хронологии
+func timelineCounts(tb testing.TB, h *Handlers) map[string]int {
+	tb.Helper()
+	groups, err := h.store.GetTimeline()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	counts := make(map[string]int, len(groups))
+	for _, g := range groups {
+		counts[g.Date] = g.MediaCount
+	}
+	return counts
+}
+
+func TestBulkMetadataDateMovesTimelineGroup(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	may := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	var ids []string
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		m := addTestMedia(t, h, filepath.Join(root, name), func(m *storage.Media) {
+			m.TakenAt = may
+			m.ModifiedAt = may
+		})
+		ids = append(ids, m.ID)
+	}
+	if counts := timelineCounts(t, h); counts["2023-05"] != 3 {
+		t.Fatalf("timeline before edit = %v", counts)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"media_ids": []string{ids[0], ids[1], "missing-id"},
+		"taken_at":  "2021-08-03T09:15",
+	})
+	rec := postBulkMetadata(h, storage.RoleEditor, string(body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Count  int `json:"count"`
+		Failed int `json:"failed"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Count != 2 || resp.Failed != 1 {
+		t.Errorf("response = %s, want 2 updated and 1 failed", rec.Body)
+	}
+
+	counts := timelineCounts(t, h)
+	if counts["2021-08"] != 2 || counts["2023-05"] != 1 {
+		t.Errorf("timeline after edit = %v, want 2021-08:2 2023-05:1", counts)
+	}
+	moved, err := h.store.ListMediaByMonth("2021-08")
+	if err != nil || len(moved) != 2 {
+		t.Fatalf("media in 2021-08 = %v (%v)", moved, err)
+	}
+	if got := moved[0].TakenAt.Format("2006-01-02 15:04"); got != "2021-08-03 09:15" {
+		t.Errorf("taken at = %s", got)
+	}
+}
+
+func TestBulkMetadataValidation(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	m := addTestMedia(t, h, filepath.Join(root, "a.jpg"), nil)
+
+	for _, tc := range []struct {
+		name, role, body string
+		want             int
+	}{
+		{"viewer", storage.RoleViewer, `{"media_ids":["` + m.ID + `"],"caption":"x"}`, http.StatusForbidden},
+		{"no ids", storage.RoleEditor, `{"caption":"x"}`, http.StatusBadRequest},
+		{"nothing to change", storage.RoleEditor, `{"media_ids":["` + m.ID + `"]}`, http.StatusBadRequest},
+		{"bad date", storage.RoleEditor, `{"media_ids":["` + m.ID + `"],"taken_at":"03.08.2021"}`, http.StatusBadRequest},
+	} {
+		if rec := postBulkMetadata(h, tc.role, tc.body); rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// memoryYear снимки одного года в «В этот день»
+type memoryYear struct {
+	Year     int              `json:"year"`
+	YearsAgo int              `json:"years_ago"`
+	Media    []*storage.Media `json:"media"`
+}
+
+// Memories возвращает снимки, сделанные в этот день в прошлые годы, по годам от новых к старым.
+// ?date=MM-DD — другой день вместо сегодняшнего.
+func (h *Handlers) Memories(w http.ResponseWriter, r *http.Request) {
+	today := time.Now()
+	month, day := int(today.Month()), today.Day()
+	if value := r.URL.Query().Get("date"); value != "" {
+		// Високосный год, чтобы 02-29 тоже разбиралось
+		date, err := time.Parse("2006-01-02", "2000-"+value)
+		if err != nil {
+			h.jsonError(w, "Invalid date, expected MM-DD", http.StatusBadRequest)
+			return
+		}
+		month, day = int(date.Month()), date.Day()
+	}
+
+	media, err := h.store.GetOnThisDay(month, day)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	years := []*memoryYear{}
+	for _, m := range h.stripGPS(r, media) {
+		year := m.TakenAt.Year()
+		if year >= today.Year() {
+			continue // Только прошлые годы
+		}
+		if len(years) == 0 || years[len(years)-1].Year != year {
+			years = append(years, &memoryYear{Year: year, YearsAgo: today.Year() - year})
+		}
+		last := years[len(years)-1]
+		last.Media = append(last.Media, m)
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"date":  time.Date(2000, time.Month(month), day, 0, 0, 0, 0, time.UTC).Format("01-02"),
+		"years": years,
+	})
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func TestMemoriesGroupsByYear(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	thisYear := time.Now().Year()
+	add := func(name string, taken time.Time, edit func(m *storage.Media)) *storage.Media {
+		return addTestMedia(t, h, filepath.Join(root, name), func(m *storage.Media) {
+			m.TakenAt = taken
+			m.ModifiedAt = taken
+			if edit != nil {
+				edit(m)
+			}
+		})
+	}
+	at := func(year int, month time.Month, d, hour int) time.Time {
+		return time.Date(year, month, d, hour, 0, 0, 0, time.UTC)
+	}
+
+	evening := add("2021-evening.jpg", at(2021, time.May, 1, 19), nil)
+	morning := add("2021-morning.jpg", at(2021, time.May, 1, 8), nil)
+	old := add("2019.jpg", at(2019, time.May, 1, 12), nil)
+	add("2021-next-day.jpg", at(2021, time.May, 2, 12), nil)
+	add("this-year.jpg", at(thisYear, time.May, 1, 12), nil)
+	add("duplicate.jpg", at(2020, time.May, 1, 12), func(m *storage.Media) { m.DuplicateOf = old.ID })
+	trashed := add("trashed.jpg", at(2018, time.May, 1, 12), nil)
+	if err := h.store.SoftDeleteMedia(trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+	// Без EXIF-даты: время изменения файла не считается днем съемки
+	add("no-exif.jpg", time.Time{}, func(m *storage.Media) { m.ModifiedAt = at(2017, time.May, 1, 12) })
+
+	rec := httptest.NewRecorder()
+	h.Memories(rec, withRole(httptest.NewRequest(http.MethodGet, "/api/memories?date=05-01", nil), storage.RoleViewer))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Date  string `json:"date"`
+		Years []struct {
+			Year     int              `json:"year"`
+			YearsAgo int              `json:"years_ago"`
+			Media    []*storage.Media `json:"media"`
+		} `json:"years"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Date != "05-01" {
+		t.Errorf("date = %q", resp.Date)
+	}
+
+	var got []string
+	for _, y := range resp.Years {
+		if y.YearsAgo != thisYear-y.Year {
+			t.Errorf("year %d: years_ago = %d", y.Year, y.YearsAgo)
+		}
+		ids := ""
+		for _, m := range y.Media {
+			ids += " " + m.ID
+		}
+		got = append(got, fmt.Sprintf("%d:%s", y.Year, ids))
+	}
+	want := []string{
+		fmt.Sprintf("2021: %s %s", morning.ID, evening.ID), // Внутри дня — по времени
+		fmt.Sprintf("2019: %s", old.ID),
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("years = %v, want %v", got, want)
+	}
+}
+
+func TestMemoriesRejectsBadDate(t *testing.T) {
+	h, _ := newTestHandlers(t, "")
+	for _, date := range []string{"13-01", "02-30", "5-1x"} {
+		rec := httptest.NewRecorder()
+		h.Memories(rec, withRole(httptest.NewRequest(http.MethodGet, "/api/memories?date="+date, nil), storage.RoleViewer))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("date %q: status = %d, want 400", date, rec.Code)
+		}
+	}
+
+	// 29 февраля разбирается
+	rec := httptest.NewRecorder()
+	h.Memories(rec, withRole(httptest.NewRequest(http.MethodGet, "/api/memories?date=02-29", nil), storage.RoleViewer))
+	if rec.Code != http.StatusOK {
+		t.Errorf("02-29: status = %d", rec.Code)
+	}
+}
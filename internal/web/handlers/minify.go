@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// rawTextTags элементы, содержимое которых минификация не трогает:
+// в скриптах перевод строки значим (// комментарии, ASI), в pre/textarea — пробелы
+var rawTextTags = []string{"script", "style", "pre", "textarea"}
+
+var (
+	htmlCommentRe = regexp.MustCompile(`(?s)<!--.*?-->`)
+	whitespaceRe  = regexp.MustCompile(`\s+`)
+)
+
+// minifyHTML удаляет HTML-комментарии и схлопывает пробелы вне script/style/pre/textarea
+func minifyHTML(src []byte) []byte {
+	out := make([]byte, 0, len(src))
+	lower := asciiLower(src)
+
+	for pos := 0; pos < len(src); {
+		start, end := nextRawText(lower, pos)
+		if start < 0 {
+			out = append(out, minifySegment(src[pos:])...)
+			break
+		}
+		out = append(out, minifySegment(src[pos:start])...)
+		out = append(out, src[start:end]...)
+		pos = end
+	}
+	return out
+}
+
+// asciiLower переводит в нижний регистр только A-Z. В отличие от bytes.ToLower длина
+// не меняется (İ и т.п. не превращаются в другое число байт), и смещения совпадают с src.
+func asciiLower(src []byte) []byte {
+	out := make([]byte, len(src))
+	for i, c := range src {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// nextRawText находит ближайший элемент из rawTextTags начиная с pos
+// и возвращает его границы вместе с закрывающим тегом (-1, если таких нет)
+func nextRawText(lower []byte, pos int) (int, int) {
+	start, end := -1, -1
+	for _, tag := range rawTextTags {
+		i := indexTag(lower, pos, tag)
+		if i < 0 || (start >= 0 && i >= start) {
+			continue
+		}
+		closeTag := []byte("</" + tag)
+		j := bytes.Index(lower[i:], closeTag)
+		if j < 0 {
+			start, end = i, len(lower) // Незакрытый элемент — оставляем хвост как есть
+			continue
+		}
+		k := bytes.IndexByte(lower[i+j:], '>')
+		if k < 0 {
+			start, end = i, len(lower)
+			continue
+		}
+		start, end = i, i+j+k+1
+	}
+	return start, end
+}
+
+// indexTag ищет открывающий тег <tag (не <tagname-длиннее>)
+func indexTag(lower []byte, pos int, tag string) int {
+	open := []byte("<" + tag)
+	for pos < len(lower) {
+		i := bytes.Index(lower[pos:], open)
+		if i < 0 {
+			return -1
+		}
+		i += pos
+		next := i + len(open)
+		if next >= len(lower) || lower[next] == '>' || lower[next] == ' ' || lower[next] == '\t' || lower[next] == '\n' || lower[next] == '\r' || lower[next] == '/' {
+			return i
+		}
+		pos = next
+	}
+	return -1
+}
+
+// minifySegment обрабатывает обычную разметку: комментарии (кроме условных <!--[if) и лишние пробелы
+func minifySegment(b []byte) []byte {
+	b = htmlCommentRe.ReplaceAllFunc(b, func(c []byte) []byte {
+		if bytes.HasPrefix(c, []byte("<!--[if")) {
+			return c
+		}
+		return nil
+	})
+	return whitespaceRe.ReplaceAll(b, []byte(" "))
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMinifyHTML(t *testing.T) {
+	src := `<!DOCTYPE html>
+<html>
+  <!-- комментарий шаблона -->
+  <head>
+    <title>Галерея</title>
+    <SCRIPT>
+      // перевод строки значим
+      var a = 1
+    </SCRIPT>
+  </head>
+  <body>
+    <h1>   Фото   </h1>
+    <pre>  a
+  b</pre>
+  </body>
+</html>
+`
+	out := string(minifyHTML([]byte(src)))
+
+	if len(out) >= len(src) {
+		t.Errorf("minified %d bytes, source %d", len(out), len(src))
+	}
+	if strings.Contains(out, "комментарий") {
+		t.Error("HTML comment was not removed")
+	}
+	for _, want := range []string{"<title>Галерея</title>", "<h1> Фото </h1>", "<pre>  a\n  b</pre>", "// перевод строки значим\n      var a = 1", "</html>"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("minified output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestMinifyHTMLNonASCIIBeforeRawText(t *testing.T) {
+	// İ в нижнем регистре по Unicode занимает больше байт: смещения не должны съезжать
+	src := "<p>İİİİ   текст</p>\n<pre>  keep   spaces  </pre>\n<p>после</p>"
+	out := string(minifyHTML([]byte(src)))
+
+	want := "<p>İİİİ текст</p> <pre>  keep   spaces  </pre> <p>после</p>"
+	if out != want {
+		t.Errorf("minified = %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// NavIndex возвращает навигационный индекс: альбомы, теги, камеры и хронологию по месяцам.
+// Индекс кэшируется, пока не изменятся медиа, альбомы или теги (Store.NavVersion).
+func (h *Handlers) NavIndex(w http.ResponseWriter, r *http.Request) {
+	version := h.store.NavVersion()
+	if index, ok := h.cache.GetNavIndex(version); ok {
+		h.jsonResponse(w, index)
+		return
+	}
+
+	index, err := h.buildNavIndex()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Пока индекс строился, данные могли измениться: такой результат не кэшируем
+	if h.store.NavVersion() == version {
+		h.cache.SetNavIndex(version, index)
+	}
+	h.jsonResponse(w, index)
+}
+
+// buildNavIndex собирает навигационный индекс из базы
+func (h *Handlers) buildNavIndex() (*storage.NavIndex, error) {
+	albums, err := h.store.ListAlbums()
+	if err != nil {
+		return nil, err
+	}
+	tags, err := h.store.ListAllTags()
+	if err != nil {
+		return nil, err
+	}
+	cameras, err := h.store.ListCameras()
+	if err != nil {
+		return nil, err
+	}
+	timeline, err := h.store.GetTimeline()
+	if err != nil {
+		return nil, err
+	}
+
+	index := &storage.NavIndex{
+		Albums:   make([]*storage.NavAlbum, 0, len(albums)),
+		Tags:     tags,
+		Cameras:  cameras,
+		Timeline: timeline,
+	}
+	h.fillSmartAlbumCounts(albums)
+	h.fillAlbumCovers(albums)
+	for _, a := range albums {
+		index.Albums = append(index.Albums, &storage.NavAlbum{
+			ID:         a.ID,
+			Name:       a.Name,
+			ParentID:   a.ParentID,
+			MediaCount: a.MediaCount,
+			CoverID:    a.CoverID,
+		})
+	}
+	if index.Tags == nil {
+		index.Tags = []*storage.Tag{}
+	}
+	if index.Cameras == nil {
+		index.Cameras = []*storage.CameraCount{}
+	}
+	if index.Timeline == nil {
+		index.Timeline = []*storage.TimelineGroup{}
+	}
+	return index, nil
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// navAlbums запрашивает навигационный индекс и возвращает имена альбомов
+func navAlbums(tb testing.TB, h *Handlers) []string {
+	tb.Helper()
+	rec := httptest.NewRecorder()
+	req := withRole(httptest.NewRequest(http.MethodGet, "/api/nav", nil), storage.RoleViewer)
+	h.NavIndex(rec, req)
+	if rec.Code != http.StatusOK {
+		tb.Fatalf("nav status = %d: %s", rec.Code, rec.Body)
+	}
+	var index storage.NavIndex
+	if err := json.Unmarshal(rec.Body.Bytes(), &index); err != nil {
+		tb.Fatal(err)
+	}
+	var names []string
+	for _, a := range index.Albums {
+		names = append(names, a.Name)
+	}
+	return names
+}
+
+func TestNavIndexCacheInvalidation(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	m := addTestMedia(t, h, filepath.Join(root, "a.jpg"), nil)
+	if err := h.store.SaveAlbum(&storage.Album{ID: "trip", Name: "Trip"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := navAlbums(t, h); len(got) != 1 {
+		t.Fatalf("albums = %v, want [Trip]", got)
+	}
+
+	// Запись, не касающаяся навигации, не сбрасывает построенный индекс
+	version := h.store.NavVersion()
+	if err := h.store.SaveSession(&storage.Session{ID: "s1", UserID: "u1", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if h.store.NavVersion() != version {
+		t.Fatal("session write changed NavVersion")
+	}
+	if _, ok := h.cache.GetNavIndex(version); !ok {
+		t.Fatal("nav index was not cached across an unrelated write")
+	}
+
+	if err := h.store.SaveAlbum(&storage.Album{ID: "home", Name: "Home"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := navAlbums(t, h); len(got) != 2 {
+		t.Fatalf("albums after new album = %v, want two", got)
+	}
+
+	version = h.store.NavVersion()
+	if err := h.store.AddTagsToMedia(m.ID, []string{"sea"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.cache.GetNavIndex(h.store.NavVersion()); ok || h.store.NavVersion() == version {
+		t.Error("tag change did not invalidate the nav index")
+	}
+}
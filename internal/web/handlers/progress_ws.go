@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/photocore/photocore/internal/scanner"
+)
+
+const (
+	progressTick      = time.Second      // Как часто проверять изменения прогресса
+	progressKeepalive = 30 * time.Second // Повтор без изменений, чтобы прокси не закрыли соединение
+)
+
+// progressUpdate сообщение /ws/progress: прогресс сканирования и состояние очереди
+type progressUpdate struct {
+	Scan  scanner.ScanProgress   `json:"scan"`
+	Queue map[string]interface{} `json:"queue"`
+}
+
+// queueStats состояние очереди воркеров (как в /api/queue)
+func (h *Handlers) queueStats() map[string]interface{} {
+	stats := h.workerPool.Stats()
+	return map[string]interface{}{
+		"total_tasks":     stats.TotalTasks,
+		"completed_tasks": stats.CompletedTasks,
+		"failed_tasks":    stats.FailedTasks,
+		"queued_tasks":    stats.QueuedTasks,
+		"active_workers":  stats.ActiveWorkers,
+		"retried_tasks":   stats.RetriedTasks,
+		"pending_retries": stats.PendingRetries,
+		"queue_length":    h.workerPool.QueueLength(),
+		"processing":      h.thumbService.ProcessingCount(),
+	}
+}
+
+// ProgressSocket отправляет по WebSocket прогресс сканирования и очереди при изменении
+// (проверка раз в секунду) вместо опроса /api/scan/progress и /api/queue
+func (h *Handlers) ProgressSocket(w http.ResponseWriter, r *http.Request) {
+	server := websocket.Server{
+		Handshake: checkSameOrigin,
+		Handler:   h.streamProgress,
+	}
+	server.ServeHTTP(w, r)
+}
+
+// checkSameOrigin отклоняет WebSocket с чужих сайтов: сессия передается в cookie,
+// и без проверки Origin любая страница могла бы читать прогресс от имени пользователя
+func checkSameOrigin(cfg *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil // Не браузер
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return fmt.Errorf("cross-origin websocket rejected: %s", origin)
+	}
+	return nil
+}
+
+// streamProgress шлет progressUpdate, пока клиент не отключится
+func (h *Handlers) streamProgress(ws *websocket.Conn) {
+	defer ws.Close()
+
+	// Входящие сообщения не нужны, чтение только замечает отключение клиента
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	ticker := time.NewTicker(progressTick)
+	defer ticker.Stop()
+
+	var last []byte
+	var lastSent time.Time
+	for {
+		msg, err := json.Marshal(progressUpdate{
+			Scan:  h.scanner.Progress(),
+			Queue: h.queueStats(),
+		})
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(msg, last) || time.Since(lastSent) >= progressKeepalive {
+			if err := websocket.Message.Send(ws, string(msg)); err != nil {
+				return
+			}
+			last, lastSent = msg, time.Now()
+		}
+
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
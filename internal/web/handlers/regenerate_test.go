@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/photocore/photocore/internal/storage"
+	"github.com/photocore/photocore/internal/worker"
+)
+
+func postRegenerate(tb testing.TB, h *Handlers, role, body string) *httptest.ResponseRecorder {
+	tb.Helper()
+	rec := httptest.NewRecorder()
+	req := withRole(httptest.NewRequest(http.MethodPost, "/api/thumbnails/regenerate-bulk", strings.NewReader(body)), role)
+	h.RegenerateThumbnails(rec, req)
+	return rec
+}
+
+func TestRegenerateThumbnailsForAlbum(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	// Пул не запущен: задачи только ставятся в очередь
+	h.thumbService = worker.NewThumbnailService(worker.NewPool(1, 10, nil), h.store, h.thumbGen)
+
+	var all []*storage.Media
+	for _, name := range []string{"a.jpg", "b.jpg", "outside.jpg"} {
+		m := addTestMedia(t, h, filepath.Join(root, name), nil)
+		if err := os.WriteFile(h.thumbGen.GetThumbnailPath(m.ID, "small"), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, m)
+	}
+	members, outside := all[:2], all[2]
+	if err := h.store.SaveAlbum(&storage.Album{ID: "trip", Name: "Trip"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.store.AddMediaToAlbum("trip", []string{members[0].ID, members[1].ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := postRegenerate(t, h, storage.RoleViewer, `{"filter": "album", "value": "trip"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("viewer status = %d, want 403", rec.Code)
+	}
+	if rec := postRegenerate(t, h, storage.RoleEditor, `{"filter": "album", "value": "missing"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown album status = %d, want 404", rec.Code)
+	}
+
+	rec := postRegenerate(t, h, storage.RoleEditor, `{"filter": "album", "value": "trip"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var body map[string]int
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["matched"] != 2 || body["queued"] != 2 || body["pending"] != 0 {
+		t.Errorf("response = %v, want matched 2, queued 2, pending 0", body)
+	}
+
+	for _, m := range members {
+		if h.thumbGen.ThumbnailExists(m.ID, "small") {
+			t.Errorf("thumbnail of album member %s was not deleted", m.Filename)
+		}
+		if !h.thumbService.IsProcessing(m.ID, "small") {
+			t.Errorf("thumbnail of album member %s was not re-queued", m.Filename)
+		}
+	}
+	if !h.thumbGen.ThumbnailExists(outside.ID, "small") || h.thumbService.IsProcessing(outside.ID, "small") {
+		t.Error("media outside the album was regenerated")
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/photocore/photocore/internal/auth"
+	"github.com/photocore/photocore/internal/scanner"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// burstSuggestion найденная серия, которую можно собрать в стопку
+type burstSuggestion struct {
+	Camera   string    `json:"camera,omitempty"`
+	TakenAt  time.Time `json:"taken_at"`
+	Count    int       `json:"count"`
+	MediaIDs []string  `json:"media_ids"`
+}
+
+// Bursts предлагает серии кадров (scan.burst_gap, scan.burst_min_size), еще не собранные в стопки
+func (h *Handlers) Bursts(w http.ResponseWriter, r *http.Request) {
+	bursts, err := h.store.DetectBursts(scanner.BurstOptions(h.cfg))
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	suggestions := make([]*burstSuggestion, 0, len(bursts))
+	for _, burst := range bursts {
+		suggestion := &burstSuggestion{
+			Camera:  burst[0].Metadata.Camera,
+			TakenAt: burst[0].TakenAt,
+			Count:   len(burst),
+		}
+		for _, m := range burst {
+			suggestion.MediaIDs = append(suggestion.MediaIDs, m.ID)
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"bursts": suggestions,
+		"count":  len(suggestions),
+	})
+}
+
+// StackBursts собирает медиа в стопку. С media_ids — указанные (первое становится верхним),
+// без — все найденные серии.
+func (h *Handlers) StackBursts(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanEdit(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		MediaIDs []string `json:"media_ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(req.MediaIDs) == 0 {
+		stacks, err := h.store.StackBursts(scanner.BurstOptions(h.cfg))
+		if err != nil {
+			h.jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.cache.Clear()
+		h.jsonResponse(w, map[string]int{"stacks": stacks})
+		return
+	}
+
+	stackID, err := h.store.StackMedia(req.MediaIDs)
+	if err != nil {
+		if errors.Is(err, storage.ErrStackMedia) {
+			h.jsonErrorCode(w, err.Error(), http.StatusBadRequest, ErrCodeNotFound)
+			return
+		}
+		if errors.Is(err, storage.ErrStackSize) {
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.cache.Clear()
+
+	h.jsonResponse(w, map[string]string{"stack_id": stackID})
+}
+
+// GetStack возвращает медиа стопки по времени съемки
+func (h *Handlers) GetStack(w http.ResponseWriter, r *http.Request) {
+	media, err := h.store.GetStackMedia(chi.URLParam(r, "id"))
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(media) == 0 {
+		h.jsonError(w, "Stack not found", http.StatusNotFound)
+		return
+	}
+
+	h.jsonResponse(w, h.stripGPS(r, media))
+}
+
+// Unstack разбирает стопку, медиа снова показываются по отдельности
+func (h *Handlers) Unstack(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanEdit(auth.GetUserRole(r)) {
+		h.jsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if err := h.store.UnstackMedia(chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, storage.ErrStackNotFound) {
+			h.jsonError(w, "Stack not found", http.StatusNotFound)
+			return
+		}
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.cache.Clear()
+
+	h.jsonResponse(w, map[string]string{"status": "unstacked"})
+}
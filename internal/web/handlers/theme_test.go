@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func TestSetThemePerUser(t *testing.T) {
+	h, _ := newTestHandlers(t, "")
+	// withRole выдает сессию пользователя с именем, равным роли
+	for _, name := range []string{storage.RoleViewer, storage.RoleEditor} {
+		if err := h.store.SaveUser(&storage.User{ID: "user-" + name, Username: name, Role: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setTheme := func(role, body string) int {
+		rec := httptest.NewRecorder()
+		h.SetTheme(rec, withRole(httptest.NewRequest(http.MethodPut, "/api/me/theme", strings.NewReader(body)), role))
+		return rec.Code
+	}
+	theme := func(role string) interface{} {
+		return h.baseData(withRole(httptest.NewRequest(http.MethodGet, "/", nil), role))["Theme"]
+	}
+
+	// По умолчанию — темная тема
+	if got := theme(storage.RoleViewer); got != storage.ThemeDark {
+		t.Errorf("default theme = %v, want dark", got)
+	}
+	for _, body := range []string{`{"theme": "sepia"}`, `{}`, `not json`} {
+		if code := setTheme(storage.RoleViewer, body); code != http.StatusBadRequest {
+			t.Errorf("body %s = %d, want 400", body, code)
+		}
+	}
+	if code := setTheme(storage.RoleAdmin, `{"theme": "light"}`); code != http.StatusNotFound {
+		t.Errorf("unknown user = %d, want 404", code)
+	}
+
+	if code := setTheme(storage.RoleViewer, `{"theme": "light"}`); code != http.StatusOK {
+		t.Fatalf("set light = %d, want 200", code)
+	}
+	if got := theme(storage.RoleViewer); got != storage.ThemeLight {
+		t.Errorf("theme after update = %v, want light", got)
+	}
+	// Тема хранится у каждого пользователя своя
+	if got := theme(storage.RoleEditor); got != storage.ThemeDark {
+		t.Errorf("other user's theme = %v, want dark", got)
+	}
+}
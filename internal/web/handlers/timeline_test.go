@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// timelineLinks запрашивает страницу галереи и возвращает значения заголовка Link
+func timelineLinks(tb testing.TB, h *Handlers) []string {
+	tb.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	h.Timeline(rec, withRole(r, storage.RoleViewer))
+	link := rec.Header().Get("Link")
+	if link == "" {
+		return nil
+	}
+	return strings.Split(link, ", ")
+}
+
+func TestTimelinePreloadsFirstScreenThumbnails(t *testing.T) {
+	h, root := newTestHandlers(t, "server:\n  preload_thumbnails: 3\n")
+	at := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 12, 0, 0, 0, time.UTC) }
+
+	jan5 := addTestMedia(t, h, filepath.Join(root, "jan5.jpg"), func(m *storage.Media) { m.TakenAt = at(2024, time.January, 5) })
+	jan20 := addTestMedia(t, h, filepath.Join(root, "jan20.jpg"), func(m *storage.Media) { m.TakenAt = at(2024, time.January, 20) })
+	// Без даты съемки порядок берется по дате модификации
+	noExif := addTestMedia(t, h, filepath.Join(root, "noexif.jpg"), func(m *storage.Media) { m.ModifiedAt = at(2024, time.January, 10) })
+	feb := addTestMedia(t, h, filepath.Join(root, "feb.jpg"), func(m *storage.Media) { m.TakenAt = at(2024, time.February, 3) })
+	addTestMedia(t, h, filepath.Join(root, "old.jpg"), func(m *storage.Media) { m.TakenAt = at(2023, time.March, 1) })
+
+	want := []string{feb.ID, jan20.ID, noExif.ID}
+	got := timelineLinks(t, h)
+	if len(got) != len(want) {
+		t.Fatalf("Link = %q, want %d entries", got, len(want))
+	}
+	for i, id := range want {
+		// Тот же URL, что в src карточки, иначе браузер скачает превью дважды
+		if exp := "</media/" + id + "/thumb/small>; rel=preload; as=image"; got[i] != exp {
+			t.Errorf("Link[%d] = %q, want %q", i, got[i], exp)
+		}
+	}
+
+	// Удаленные в корзину медиа не предзагружаются
+	if err := h.store.SoftDeleteMedia(feb.ID); err != nil {
+		t.Fatal(err)
+	}
+	got = timelineLinks(t, h)
+	if len(got) != 3 || !strings.Contains(got[0], jan20.ID) || !strings.Contains(got[2], jan5.ID) {
+		t.Errorf("Link after trashing feb = %q, want jan20, noexif, jan5", got)
+	}
+}
+
+func TestTimelinePreloadDisabled(t *testing.T) {
+	h, root := newTestHandlers(t, "server:\n  preload_thumbnails: -1\n")
+	addTestMedia(t, h, filepath.Join(root, "a.jpg"), func(m *storage.Media) { m.TakenAt = time.Now() })
+
+	if got := timelineLinks(t, h); got != nil {
+		t.Errorf("Link = %q, want none when preload is disabled", got)
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// trashedMedia сохраняет запись медиа для path и переносит ее в корзину
+func trashedMedia(tb testing.TB, h *Handlers, path string) *storage.Media {
+	tb.Helper()
+	m := addTestMedia(tb, h, path, nil)
+	if err := h.store.SoftDeleteMedia(m.ID); err != nil {
+		tb.Fatal(err)
+	}
+	return m
+}
+
+func TestEmptyTrashKeepsFailedFiles(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	removable := filepath.Join(root, "removable.jpg")
+	if err := os.WriteFile(removable, []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Непустой каталог на месте файла: os.Remove не сможет его удалить
+	stuck := filepath.Join(root, "stuck.jpg")
+	if err := os.MkdirAll(filepath.Join(stuck, "inner"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ok, failing := trashedMedia(t, h, removable), trashedMedia(t, h, stuck)
+
+	empty := func(query string) map[string]interface{} {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.EmptyTrash(rec, withRole(httptest.NewRequest(http.MethodDelete, "/api/trash"+query, nil), storage.RoleAdmin))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("EmptyTrash%s = %d: %s", query, rec.Code, rec.Body)
+		}
+		var resp map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := empty("")
+	failed, _ := resp["failed"].([]interface{})
+	if resp["status"] != "partial" || resp["deleted"] != float64(1) || len(failed) != 1 {
+		t.Fatalf("response = %v, want partial with 1 deleted and 1 failed", resp)
+	}
+	if item := failed[0].(map[string]interface{}); item["id"] != failing.ID || item["path"] != stuck || item["error"] == "" {
+		t.Errorf("failed item = %v, want %s with an error", item, failing.ID)
+	}
+	if m, _ := h.store.GetMedia(ok.ID); m != nil {
+		t.Error("record of the deleted file is still stored")
+	}
+	// Запись неудаленного файла остается в корзине для повторной попытки
+	trash, err := h.store.ListTrashMedia()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != failing.ID {
+		t.Errorf("trash after partial empty = %d items, want only %s", len(trash), failing.ID)
+	}
+
+	// force удаляет запись, даже если файл стереть не удалось
+	resp = empty("?force=true")
+	if resp["status"] != "partial" || resp["deleted"] != float64(1) {
+		t.Errorf("forced response = %v, want partial with 1 deleted", resp)
+	}
+	if trash, _ := h.store.ListTrashMedia(); len(trash) != 0 {
+		t.Errorf("trash after forced empty = %d items, want none", len(trash))
+	}
+}
+
+func TestUndoTrashRestoresPriorState(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	a := addTestMedia(t, h, filepath.Join(root, "a.jpg"), nil)
+	b := addTestMedia(t, h, filepath.Join(root, "b.jpg"), nil)
+	// c уже лежал в корзине до операции и после отмены должен остаться там
+	c := trashedMedia(t, h, filepath.Join(root, "c.jpg"))
+
+	call := func(handler http.HandlerFunc, role, path, body string) (int, map[string]interface{}) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler(rec, withRole(httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)), role))
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := call(h.BulkMoveToTrash, storage.RoleAdmin, "/api/bulk/trash", `{"media_ids": ["`+a.ID+`", "`+b.ID+`"]}`)
+	token, _ := resp["undo_token"].(string)
+	if code != http.StatusOK || token == "" {
+		t.Fatalf("bulk trash = %d %v, want 200 with undo_token", code, resp)
+	}
+	undo := `{"undo_token": "` + token + `"}`
+
+	// Токен привязан к пользователю, выполнившему удаление
+	if code, _ := call(h.UndoTrash, storage.RoleEditor, "/api/trash/undo", undo); code != http.StatusNotFound {
+		t.Errorf("undo by another user = %d, want 404", code)
+	}
+	if code, resp := call(h.UndoTrash, storage.RoleAdmin, "/api/trash/undo", undo); code != http.StatusOK || resp["count"] != float64(2) {
+		t.Fatalf("undo = %d %v, want 2 restored", code, resp)
+	}
+	for _, m := range []*storage.Media{a, b} {
+		if got := mustGetTestMedia(t, h, m.ID); got.DeletedAt != nil {
+			t.Errorf("%s is still in trash after undo", m.Filename)
+		}
+	}
+	if got := mustGetTestMedia(t, h, c.ID); got.DeletedAt == nil {
+		t.Error("media trashed before the operation was restored by undo")
+	}
+
+	// Токен одноразовый
+	if code, _ := call(h.UndoTrash, storage.RoleAdmin, "/api/trash/undo", undo); code != http.StatusNotFound {
+		t.Errorf("second undo = %d, want 404", code)
+	}
+
+	// Просроченный токен не действует
+	code, resp = call(h.BulkMoveToTrash, storage.RoleAdmin, "/api/bulk/trash", `{"media_ids": ["`+a.ID+`"]}`)
+	if token, _ = resp["undo_token"].(string); code != http.StatusOK || token == "" {
+		t.Fatalf("second bulk trash = %d %v, want 200 with undo_token", code, resp)
+	}
+	h.trashUndo.mu.Lock()
+	h.trashUndo.ops[token].createdAt = time.Now().Add(-trashUndoTTL - time.Second)
+	h.trashUndo.mu.Unlock()
+	if code, _ := call(h.UndoTrash, storage.RoleAdmin, "/api/trash/undo", `{"undo_token": "`+token+`"}`); code != http.StatusNotFound {
+		t.Errorf("expired undo = %d, want 404", code)
+	}
+	if got := mustGetTestMedia(t, h, a.ID); got.DeletedAt == nil {
+		t.Error("expired undo restored media")
+	}
+}
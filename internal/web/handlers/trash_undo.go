@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/photocore/photocore/internal/auth"
+	"github.com/photocore/photocore/internal/logger"
+)
+
+// trashUndoTTL сколько действует токен отмены перемещения в корзину
+const trashUndoTTL = 5 * time.Minute
+
+// trashOperation одно перемещение в корзину, которое можно отменить
+type trashOperation struct {
+	userID    string
+	mediaIDs  []string
+	createdAt time.Time
+}
+
+// trashUndoLog недавние перемещения в корзину (в памяти, до перезапуска)
+type trashUndoLog struct {
+	mu  sync.Mutex
+	ops map[string]*trashOperation // undo token -> операция
+}
+
+func newTrashUndoLog() *trashUndoLog {
+	return &trashUndoLog{ops: make(map[string]*trashOperation)}
+}
+
+// remember сохраняет операцию и возвращает токен отмены ("" если нечего отменять)
+func (l *trashUndoLog) remember(userID string, mediaIDs []string) string {
+	if len(mediaIDs) == 0 {
+		return ""
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	token := hex.EncodeToString(b)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire()
+	l.ops[token] = &trashOperation{
+		userID:    userID,
+		mediaIDs:  mediaIDs,
+		createdAt: time.Now(),
+	}
+	return token
+}
+
+// take возвращает и забывает операцию пользователя по токену
+func (l *trashUndoLog) take(token, userID string) *trashOperation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire()
+	op, ok := l.ops[token]
+	if !ok || op.userID != userID {
+		return nil
+	}
+	delete(l.ops, token)
+	return op
+}
+
+// expire забывает операции старше trashUndoTTL. Вызывается под l.mu.
+func (l *trashUndoLog) expire() {
+	cutoff := time.Now().Add(-trashUndoTTL)
+	for token, op := range l.ops {
+		if op.createdAt.Before(cutoff) {
+			delete(l.ops, token)
+		}
+	}
+}
+
+// UndoTrash восстанавливает медиа, перемещенные в корзину одной операцией (по undo_token)
+func (h *Handlers) UndoTrash(w http.ResponseWriter, r *http.Request) {
+	// Проверка прав: только admin и editor
+	role := auth.GetUserRole(r)
+	if !auth.CanEdit(role) {
+		h.jsonError(w, "Forbidden: недостаточно прав", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		UndoToken string `json:"undo_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	op := h.trashUndo.take(req.UndoToken, auth.GetUserID(r))
+	if op == nil {
+		h.jsonError(w, "Undo token not found or expired", http.StatusNotFound)
+		return
+	}
+
+	var restored int
+	for _, id := range op.mediaIDs {
+		if err := h.store.RestoreMedia(id); err != nil {
+			logger.InfoLog.Printf("Error restoring media %s: %v", id, err)
+			continue
+		}
+		h.cache.DeleteMedia(id)
+		restored++
+	}
+
+	h.cache.Clear()
+
+	h.jsonResponse(w, map[string]interface{}{
+		"status": "restored",
+		"count":  restored,
+	})
+}
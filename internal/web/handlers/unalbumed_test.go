@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// unalbumedNames запрашивает /api/media/unalbumed и возвращает имена файлов
+func unalbumedNames(tb testing.TB, h *Handlers) []string {
+	tb.Helper()
+	rec := httptest.NewRecorder()
+	h.UnalbumedMedia(rec, withRole(httptest.NewRequest(http.MethodGet, "/api/media/unalbumed", nil), storage.RoleViewer))
+	if rec.Code != http.StatusOK {
+		tb.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var result storage.SearchResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		tb.Fatal(err)
+	}
+	var names []string
+	for _, m := range result.Media {
+		names = append(names, m.Filename)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestUnalbumedMediaShrinksWhenAddedToAlbum(t *testing.T) {
+	h, root := newTestHandlers(t, "")
+	a := addTestMedia(t, h, filepath.Join(root, "a.jpg"), nil)
+	addTestMedia(t, h, filepath.Join(root, "b.jpg"), nil)
+	c := addTestMedia(t, h, filepath.Join(root, "c.jpg"), func(m *storage.Media) { m.Tags = []string{"trip"} })
+
+	if got := unalbumedNames(t, h); len(got) != 3 {
+		t.Fatalf("unalbumed = %v, want all three", got)
+	}
+
+	if err := h.store.SaveAlbum(&storage.Album{ID: "trip", Name: "Trip"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.store.AddMediaToAlbum("trip", []string{a.ID}); err != nil {
+		t.Fatal(err)
+	}
+	// Умный альбом медиа не раскладывает: c остается в списке
+	smart := &storage.Album{ID: "smart", Name: "Tagged", Smart: true, Query: &storage.SearchQuery{Tags: []string{"trip"}}}
+	if err := h.store.SaveAlbum(smart); err != nil {
+		t.Fatal(err)
+	}
+
+	got := unalbumedNames(t, h)
+	if len(got) != 2 || got[0] != "b.jpg" || got[1] != c.Filename {
+		t.Errorf("unalbumed after adding a.jpg = %v, want [b.jpg c.jpg]", got)
+	}
+
+	if err := h.store.RemoveMediaFromAlbum("trip", []string{a.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got := unalbumedNames(t, h); len(got) != 3 {
+		t.Errorf("unalbumed after removing a.jpg = %v, want all three", got)
+	}
+}
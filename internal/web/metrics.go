@@ -0,0 +1,199 @@
+package web
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// metricsDurationBuckets границы гистограммы длительности запросов (секунды)
+var metricsDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// knownMethods методы, которые попадают в метку method как есть
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// requestKey метки счетчика запросов
+type requestKey struct {
+	method string
+	code   int
+}
+
+// httpMetrics счетчики HTTP-запросов для /metrics
+type httpMetrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]int64
+	buckets  []int64 // Не накопительно: buckets[i] — запросы в (bounds[i-1], bounds[i]]
+	count    int64
+	sum      float64
+}
+
+func newHTTPMetrics() *httpMetrics {
+	return &httpMetrics{
+		requests: make(map[requestKey]int64),
+		buckets:  make([]int64, len(metricsDurationBuckets)+1), // Последний — больше 10s
+	}
+}
+
+// middleware считает запросы по методу и коду ответа и время их обработки
+func (m *httpMetrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		m.observe(r.Method, ww.Status(), time.Since(start))
+	})
+}
+
+func (m *httpMetrics) observe(method string, code int, duration time.Duration) {
+	if code == 0 {
+		code = http.StatusOK // Обработчик ничего не записал
+	}
+	if !knownMethods[method] {
+		method = "OTHER" // Метод задает клиент: не плодим метки
+	}
+	seconds := duration.Seconds()
+	bucket := sort.SearchFloat64s(metricsDurationBuckets, seconds)
+
+	m.mu.Lock()
+	m.requests[requestKey{method: method, code: code}]++
+	m.buckets[bucket]++
+	m.count++
+	m.sum += seconds
+	m.mu.Unlock()
+}
+
+// handleMetrics отдает метрики в текстовом формате Prometheus
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	s.metrics.write(out)
+
+	if s.workerPool != nil {
+		stats := s.workerPool.Stats()
+		writeMetric(out, "photocore_thumbnail_queue_length", "gauge", "Tasks waiting in the worker queue",
+			sample{value: float64(s.workerPool.QueueLength())})
+		writeMetric(out, "photocore_worker_active", "gauge", "Workers currently running a task",
+			sample{value: float64(stats.ActiveWorkers)})
+		writeMetric(out, "photocore_worker_tasks_total", "counter", "Finished worker tasks by result",
+			sample{labels: `result="completed"`, value: float64(stats.CompletedTasks)},
+			sample{labels: `result="failed"`, value: float64(stats.FailedTasks)})
+	}
+
+	if s.cache != nil {
+		cacheStats := s.cache.Stats()
+		names := make([]string, 0, len(cacheStats))
+		for name := range cacheStats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var hits, misses, items []sample
+		for _, name := range names {
+			label := "cache=" + strconv.Quote(name)
+			hits = append(hits, sample{labels: label, value: float64(cacheStats[name].Hits)})
+			misses = append(misses, sample{labels: label, value: float64(cacheStats[name].Misses)})
+			items = append(items, sample{labels: label, value: float64(cacheStats[name].Items)})
+		}
+		writeMetric(out, "photocore_cache_hits_total", "counter", "Cache lookups that found a value", hits...)
+		writeMetric(out, "photocore_cache_misses_total", "counter", "Cache lookups without a value", misses...)
+		writeMetric(out, "photocore_cache_items", "gauge", "Items currently in the cache", items...)
+	}
+
+	if stats, err := s.store.GetStats(); err == nil {
+		writeMetric(out, "photocore_media_total", "gauge", "Media in the library",
+			sample{value: float64(stats.TotalMedia)})
+		writeMetric(out, "photocore_media_type_total", "gauge", "Media in the library by type",
+			sample{labels: `type="image"`, value: float64(stats.TotalImages)},
+			sample{labels: `type="video"`, value: float64(stats.TotalVideos)},
+			sample{labels: `type="raw"`, value: float64(stats.TotalRaw)})
+		writeMetric(out, "photocore_media_size_bytes", "gauge", "Total size of media files",
+			sample{value: float64(stats.TotalSize)})
+	}
+
+	if s.scanner != nil {
+		progress := s.scanner.Progress()
+		running := 0.0
+		if progress.Running {
+			running = 1
+		}
+		writeMetric(out, "photocore_scan_running", "gauge", "Whether a library scan is in progress",
+			sample{value: running})
+		writeMetric(out, "photocore_scan_files", "gauge", "Files of the current or last scan by state",
+			sample{labels: `state="total"`, value: float64(progress.TotalFiles)},
+			sample{labels: `state="scanned"`, value: float64(progress.Scanned)},
+			sample{labels: `state="new"`, value: float64(progress.NewFiles)},
+			sample{labels: `state="updated"`, value: float64(progress.UpdatedFiles)},
+			sample{labels: `state="error"`, value: float64(progress.Errors)})
+	}
+}
+
+// write выводит счетчик запросов и гистограмму длительности
+func (m *httpMetrics) write(out *bufio.Writer) {
+	m.mu.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	requests := make([]sample, 0, len(keys))
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, key := range keys {
+		requests = append(requests, sample{
+			labels: fmt.Sprintf("method=%q,code=\"%d\"", key.method, key.code),
+			value:  float64(m.requests[key]),
+		})
+	}
+
+	durations := make([]sample, 0, len(m.buckets)+2)
+	var cumulative int64
+	for i, bound := range metricsDurationBuckets {
+		cumulative += m.buckets[i]
+		durations = append(durations, sample{
+			suffix: "_bucket",
+			labels: "le=" + strconv.Quote(strconv.FormatFloat(bound, 'g', -1, 64)),
+			value:  float64(cumulative),
+		})
+	}
+	durations = append(durations,
+		sample{suffix: "_bucket", labels: `le="+Inf"`, value: float64(m.count)},
+		sample{suffix: "_sum", value: m.sum},
+		sample{suffix: "_count", value: float64(m.count)})
+	m.mu.Unlock()
+
+	writeMetric(out, "photocore_http_requests_total", "counter", "HTTP requests by method and status code", requests...)
+	writeMetric(out, "photocore_http_request_duration_seconds", "histogram", "HTTP request handling time", durations...)
+}
+
+// sample значение метрики; labels уже в формате Prometheus (name="value",...)
+type sample struct {
+	suffix string // _bucket, _sum, _count у гистограммы
+	labels string
+	value  float64
+}
+
+// writeMetric пишет HELP, TYPE и значения одной метрики
+func writeMetric(out *bufio.Writer, name, kind, help string, samples ...sample) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, s := range samples {
+		value := strconv.FormatFloat(s.value, 'g', -1, 64)
+		if s.labels != "" {
+			fmt.Fprintf(out, "%s%s{%s} %s\n", name, s.suffix, s.labels, value)
+		} else {
+			fmt.Fprintf(out, "%s%s %s\n", name, s.suffix, value)
+		}
+	}
+}
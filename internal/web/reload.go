@@ -0,0 +1,47 @@
+package web
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/photocore/photocore/internal/logger"
+)
+
+// WatchConfigReload перечитывает конфигурацию из path по SIGHUP.
+// Применяются только поля, которые можно менять на лету (config.IsReloadable),
+// об остальных изменениях пишется в лог с просьбой перезапустить сервер.
+// Start подписывается сам, если конфигурация загружена из файла (config.Load).
+func (s *Server) WatchConfigReload(path string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			s.reloadConfig(path)
+		}
+	}()
+}
+
+// reloadConfig применяет новую конфигурацию; при ошибке текущая остается без изменений
+func (s *Server) reloadConfig(path string) {
+	logger.InfoLog.Printf("SIGHUP received, reloading config from %s", path)
+
+	applied, restart, err := s.cfg.Reload(path)
+	if err != nil {
+		logger.ErrorLog.Printf("Config reload rejected, keeping current config: %v", err)
+		return
+	}
+	s.trashCleaner.SetRetention(s.cfg.TrashRetentionDays())
+
+	if len(applied) == 0 && len(restart) == 0 {
+		logger.InfoLog.Printf("Config reload: no changes")
+		return
+	}
+	if len(applied) > 0 {
+		logger.InfoLog.Printf("Config reload: applied %s", strings.Join(applied, ", "))
+	}
+	if len(restart) > 0 {
+		logger.InfoLog.Printf("Config reload: restart required to apply %s", strings.Join(restart, ", "))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"io/fs"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"time"
@@ -40,7 +41,9 @@ type Server struct {
 	cache         *cache.MediaCache
 	workerPool    *worker.Pool
 	thumbService  *worker.ThumbnailService
+	trashCleaner  *worker.TrashCleaner
 	buildVersion  string // Версия сборки для cache busting статических файлов
+	metrics       *httpMetrics
 }
 
 // NewServer создает новый веб-сервер
@@ -58,8 +61,10 @@ func NewServer(
 ) (*Server, error) {
 	// Template functions
 	funcMap := template.FuncMap{
-		"sub":     func(a, b int) int { return a - b },
-		"RFC3339": func() string { return time.RFC3339 }, // Функция возвращающая константу форматирования
+		"sub":       func(a, b int) int { return a - b },
+		"staticURL": func(path string) string { return staticURL(path, buildVersion) },
+		"RFC3339":   func() string { return time.RFC3339 }, // Функция возвращающая константу форматирования
+		"srcset":    thumbGen.Srcset,                       // srcset превью всех размеров для <img>
 		"dict": func(values ...interface{}) (map[string]interface{}, error) {
 			if len(values)%2 != 0 {
 				return nil, fmt.Errorf("dict requires even number of arguments")
@@ -100,6 +105,9 @@ func NewServer(
 		"trash.html",
 		"upload.html",
 		"pwa_settings.html",
+		"share.html",
+		"camera.html",
+		"duplicates.html",
 	}
 
 	// Partials (фрагменты для HTMX)
@@ -137,6 +145,19 @@ func NewServer(
 		pageTemplates[partial] = tmpl
 	}
 
+	if cfg.Trash.MoveFiles {
+		store.SetTrashDir(cfg.Trash.Dir)
+	}
+
+	if workerPool != nil {
+		workerPool.SetRetryPolicy(cfg.Tasks.MaxAttempts, time.Duration(cfg.Tasks.RetryDelay)*time.Second)
+	}
+
+	// Файлы при сканировании обрабатываются воркерами пула параллельно
+	if workerPool != nil && scanner != nil {
+		worker.NewScanService(workerPool, scanner)
+	}
+
 	s := &Server{
 		cfg:           cfg,
 		store:         store,
@@ -148,13 +169,28 @@ func NewServer(
 		cache:         mediaCache,
 		workerPool:    workerPool,
 		thumbService:  thumbService,
+		trashCleaner:  worker.NewTrashCleaner(store, thumbGen, cfg.Trash.RetentionDays),
 		buildVersion:  buildVersion,
+		metrics:       newHTTPMetrics(),
 	}
 
 	s.setupRoutes()
 	return s, nil
 }
 
+// staticURL добавляет версию сборки к URL статического файла.
+// JS/CSS отдаются с immutable-кэшем на год, поэтому новая сборка должна менять URL.
+func staticURL(path, version string) string {
+	if version == "" {
+		return path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "v=" + url.QueryEscape(version)
+}
+
 // staticCacheMiddleware добавляет Cache-Control заголовки для статических файлов
 func staticCacheMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -197,13 +233,31 @@ func (s *Server) setupRoutes() {
 
 	// Middleware
 	r.Use(middleware.Logger)
+	if s.cfg.Server.Metrics != "off" {
+		r.Use(s.metrics.middleware)
+	}
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Compress(5))
-	r.Use(middleware.Timeout(60 * time.Second))
 
 	// Создаем handlers
 	h := handlers.NewHandlers(s.cfg, s.store, s.scanner, s.thumbGen, s.auth, s.pageTemplates, s.cache, s.workerPool, s.thumbService, s.buildVersion)
 
+	// WebSocket живет дольше таймаута запроса, поэтому регистрируется вне группы с Timeout
+	r.Group(func(r chi.Router) {
+		r.Use(s.auth.Middleware)
+		r.Get("/ws/progress", h.ProgressSocket) // Прогресс сканирования и очереди без опроса
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(60 * time.Second))
+		s.setupTimedRoutes(r, h)
+	})
+
+	s.router = r
+}
+
+// setupTimedRoutes регистрирует обычные маршруты (ответ ограничен таймаутом запроса)
+func (s *Server) setupTimedRoutes(r chi.Router, h *handlers.Handlers) {
 	// Статические файлы
 	staticHandler := http.FileServer(http.FS(s.staticFS))
 
@@ -218,14 +272,31 @@ func (s *Server) setupRoutes() {
 	// Все остальные статические файлы с кэшированием
 	r.Handle("/static/*", staticCacheMiddleware(http.StripPrefix("/static/", staticHandler)))
 
+	// Проверки для оркестратора (Docker, Kubernetes), без авторизации
+	r.Get("/healthz", h.Healthz)
+	r.Get("/readyz", h.Readyz)
+	if s.cfg.Server.Metrics == "public" {
+		r.Get("/metrics", s.handleMetrics)
+	}
+
 	// Публичные маршруты
 	r.Get("/login", h.LoginPage)
 	r.Post("/login", h.Login)
 
+	// Публичные ссылки на альбомы (без сессии, проверка токена в handlers)
+	r.Get("/share/{token}", h.SharedAlbumPage)
+	r.Post("/share/{token}", h.SharedAlbumPage)
+	r.Get("/share/{token}/media/{id}", h.SharedMedia)
+	r.Get("/share/{token}/media/{id}/thumb/{size}", h.SharedThumbnail)
+
 	// Защищенные маршруты
 	r.Group(func(r chi.Router) {
 		r.Use(s.auth.Middleware)
 
+		if s.cfg.Server.Metrics == "auth" {
+			r.Get("/metrics", s.handleMetrics)
+		}
+
 		// Основные страницы
 		r.Get("/", h.Index)
 		r.Get("/gallery", h.Timeline) // Главная галерея - timeline view
@@ -243,6 +314,7 @@ func (s *Server) setupRoutes() {
 		r.Get("/timeline/{period}", h.TimelineMedia)
 		r.Get("/map", h.MapPage)
 		r.Get("/tags/{tag}", h.MediaByTag)
+		r.Get("/cameras/{camera}", h.MediaByCamera)
 
 		// Медиа-файлы
 		r.Get("/media/{id}", h.ServeMedia)
@@ -251,17 +323,23 @@ func (s *Server) setupRoutes() {
 
 		// API
 		r.Post("/logout", h.Logout)
-		r.Get("/api/scan", h.StartScan)
+		r.Post("/api/scan", h.StartScan) // POST: запуск меняет данные, токену read недоступен
 		r.Get("/api/scan/progress", h.ScanProgress)
 		r.Get("/api/stats", h.Stats)
+		r.Post("/api/stats/rebuild", h.RebuildStats)
+		r.Get("/api/export", h.Heavy(h.ExportCatalog))
+		r.Post("/api/import", h.ImportCatalog)
 
 		// API для мониторинга
 		r.Get("/api/queue", h.QueueStats)
 		r.Get("/api/cache", h.CacheStats)
 		r.Post("/api/thumbnails/generate", h.GenerateThumbnails)
+		r.Post("/api/thumbnails/regenerate-bulk", h.RegenerateThumbnails)
 
 		// API поиска
 		r.Get("/api/search", h.Search)
+		r.Get("/api/export/csv", h.Heavy(h.ExportCSV)) // Метаданные найденного в CSV
+		r.Get("/api/by-camera", h.ListCameras)
 
 		// API альбомов
 		r.Get("/api/albums", h.ListAlbums)
@@ -269,8 +347,14 @@ func (s *Server) setupRoutes() {
 		r.Get("/api/albums/{id}", h.GetAlbum)
 		r.Put("/api/albums/{id}", h.UpdateAlbum)
 		r.Delete("/api/albums/{id}", h.DeleteAlbum)
+		r.Put("/api/albums/{id}/cover", h.SetAlbumCover)
+		r.Put("/api/albums/{id}/order", h.ReorderAlbum)
+		r.Put("/api/albums/{id}/slideshow", h.SetAlbumSlideshow)
 		r.Post("/api/albums/{id}/media", h.AddToAlbum)
 		r.Delete("/api/albums/{id}/media", h.RemoveFromAlbum)
+		r.Post("/api/albums/{id}/share", h.CreateShareLink)
+		r.Get("/api/albums/{id}/share", h.ListShareLinks)
+		r.Delete("/api/albums/{id}/share/{token}", h.RevokeShareLink)
 
 		// API избранного и тегов
 		r.Post("/api/media/{id}/favorite", h.ToggleFavorite)
@@ -281,31 +365,58 @@ func (s *Server) setupRoutes() {
 
 		// API timeline и карты
 		r.Get("/api/timeline", h.Timeline)
+		r.Get("/api/memories", h.Memories) // В этот день в прошлые годы
+		r.Get("/api/index", h.NavIndex)    // Альбомы, теги, камеры и хронология для навигации
 		r.Get("/api/geo", h.GeoPoints)
+		r.Get("/api/geo/places", h.GeoPlaces)
+
+		// API статистики съемки
+		r.Get("/api/insights/gear", h.GearInsights)
 
 		// API bulk операций
 		r.Post("/api/bulk/favorite", h.BulkFavorite)
 		r.Post("/api/bulk/tags", h.BulkAddTags)
+		r.Post("/api/bulk/metadata", h.BulkUpdateMetadata)
 		r.Post("/api/bulk/album", h.BulkAddToAlbum)
 		r.Post("/api/bulk/delete", h.BulkMoveToTrash) // Теперь перемещает в корзину
-		r.Post("/api/bulk/download", h.BulkDownload)
+		r.Post("/api/bulk/download", h.Heavy(h.BulkDownload))
 		r.Post("/api/bulk/restore", h.BulkRestore)
+		r.Post("/api/contact-sheet", h.Heavy(h.ContactSheet))
 
 		// Корзина
 		r.Get("/trash", h.TrashPage)
 		r.Get("/api/trash/stats", h.TrashStats)
 		r.Post("/api/media/{id}/trash", h.MoveToTrash)
+		r.Post("/api/trash/undo", h.UndoTrash)
 		r.Post("/api/trash/{id}/restore", h.RestoreFromTrash)
 		r.Delete("/api/trash/{id}", h.PermanentDelete)
 		r.Delete("/api/trash", h.EmptyTrash)
 
 		// API медиа (для модального окна сравнения)
+		r.Get("/api/media/incomplete", h.IncompleteMedia)
+		r.Get("/api/media/unalbumed", h.UnalbumedMedia) // Еще не разложенные по альбомам
 		r.Get("/api/media/{id}", h.GetMediaInfo)
+		r.Get("/api/media/{id}/original", h.GetMediaOriginal)
+		r.Get("/api/media/{id}/colors", h.MediaColors)
+		r.Post("/api/media/{id}/colors", h.ComputeMediaColors)
+		r.Post("/api/media/{id}/rotate", h.RotateMedia) // Поворот и дата пишутся в EXIF файла
+		r.Post("/api/media/{id}/date", h.SetMediaDate)
+		r.Post("/api/media/{id}/flag", h.FlagMedia)
+		r.Delete("/api/media/{id}/flag", h.UnflagMedia)
+		r.Get("/duplicates", h.DuplicatesPage)
+		r.Get("/api/duplicates", h.ListDuplicates)
 		r.Post("/api/duplicates/replace", h.ReplaceDuplicate)
 		r.Post("/api/duplicates/unmark", h.UnmarkDuplicate)
 
+		// Серии кадров и стопки
+		r.Get("/api/bursts", h.Bursts)
+		r.Post("/api/bursts/stack", h.StackBursts)
+		r.Get("/api/stacks/{id}", h.GetStack)
+		r.Delete("/api/stacks/{id}", h.Unstack)
+
 		// Admin страница и API (проверка прав в handlers)
 		r.Get("/admin", h.AdminPage)
+		r.Get("/api/flagged", h.ListFlagged)
 		r.Get("/api/users", h.ListUsers)
 		r.Post("/api/users", h.CreateUser)
 		r.Put("/api/users/{username}", h.UpdateUser)
@@ -314,18 +425,45 @@ func (s *Server) setupRoutes() {
 		// Upload API
 		r.Post("/api/upload", h.UploadMedia)
 
+		// Настройки текущего пользователя
+		r.Put("/api/me/theme", h.SetTheme)
+
 		// API Token Management
 		r.Post("/api/tokens", h.GenerateAPIToken)
 		r.Get("/api/tokens", h.ListAPITokens)
 		r.Delete("/api/tokens/{token}", h.RevokeAPIToken)
 	})
-
-	s.router = r
 }
 
 // Start запускает веб-сервер
 func (s *Server) Start() error {
+	if s.cfg.Scan.Watch {
+		s.startWatcher()
+	}
+	// Запускается и при retention_days: 0 — срок можно включить перезагрузкой конфигурации
+	s.trashCleaner.Start()
+	if path := s.cfg.Path(); path != "" {
+		s.WatchConfigReload(path)
+	}
+
 	addr := fmt.Sprintf("%s:%d", s.cfg.Server.Host, s.cfg.Server.Port)
 	logger.InfoLog.Printf("Starting server on http://%s", addr)
 	return http.ListenAndServe(addr, s.router)
 }
+
+// startWatcher запускает наблюдение за медиа-директориями с синхронизацией БД
+func (s *Server) startWatcher() {
+	watcher, err := scanner.NewWatcher(s.cfg, s.store)
+	if err != nil {
+		logger.ErrorLog.Printf("File watcher disabled: %v", err)
+		return
+	}
+	ws := scanner.NewWatchSync(s.scanner, s.store)
+	if s.thumbGen != nil {
+		ws.OnMove(s.thumbGen.MoveThumbnails)
+	}
+	watcher.AddHandler(ws.Handle)
+	if err := watcher.Start(); err != nil {
+		logger.ErrorLog.Printf("File watcher disabled: %v", err)
+	}
+}
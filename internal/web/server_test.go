@@ -0,0 +1,396 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/net/websocket"
+
+	"github.com/photocore/photocore/internal/auth"
+	"github.com/photocore/photocore/internal/cache"
+	"github.com/photocore/photocore/internal/config"
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/media"
+	"github.com/photocore/photocore/internal/scanner"
+	"github.com/photocore/photocore/internal/storage"
+	"github.com/photocore/photocore/internal/worker"
+)
+
+// testServer сервер над временными БД и медиа-корнем
+type testServer struct {
+	*Server
+	http  *httptest.Server
+	token string // Bearer токен администратора
+}
+
+func newTestServer(tb testing.TB) *testServer {
+	tb.Helper()
+	dir := tb.TempDir()
+	root := filepath.Join(dir, "media")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		tb.Fatal(err)
+	}
+	yaml := fmt.Sprintf(`storage:
+  media_paths: [%q]
+  cache_path: %q
+  db_path: %q
+  logs_path: %q
+scan:
+  extensions:
+    images: [".jpg"]
+`, root, filepath.Join(dir, "cache"), filepath.Join(dir, "data", "test.db"), filepath.Join(dir, "logs"))
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	// Логгер настраивается так же, как при запуске сервера
+	if err := logger.InitWithOptions(cfg.Storage.LogsPath, cfg.LoggerOptions()); err != nil {
+		tb.Fatal(err)
+	}
+
+	store, err := storage.NewStore(cfg.Storage.DBPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { store.Close() })
+
+	thumbGen := media.NewThumbnailGenerator(cfg)
+	if err := thumbGen.EnsureCacheDir(); err != nil {
+		tb.Fatal(err)
+	}
+	pool := worker.NewPool(1, 10, nil)
+	thumbService := worker.NewThumbnailService(pool, store, thumbGen)
+	pool.Start()
+	tb.Cleanup(pool.Stop)
+
+	authService := auth.NewAuth(cfg, store)
+	static := fstest.MapFS{"app.js": {Data: []byte("// app")}}
+	s, err := NewServer(cfg, store, scanner.NewScanner(cfg, store), thumbGen, authService, static,
+		cache.NewMediaCache(), pool, thumbService, "test")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	token, err := authService.GenerateAPIToken("admin-id", "admin", storage.RoleAdmin, "test", time.Hour, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	ts := httptest.NewServer(s.router)
+	tb.Cleanup(ts.Close)
+	return &testServer{Server: s, http: ts, token: token.Token}
+}
+
+func TestProgressSocketSendsUpdate(t *testing.T) {
+	ts := newTestServer(t)
+
+	wsURL := "ws" + strings.TrimPrefix(ts.http.URL, "http") + "/ws/progress"
+	wsCfg, err := websocket.NewConfig(wsURL, ts.http.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsCfg.Header = http.Header{"Authorization": {"Bearer " + ts.token}}
+	conn, err := websocket.DialConfig(wsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg string
+	if err := websocket.Message.Receive(conn, &msg); err != nil {
+		t.Fatal(err)
+	}
+	var update struct {
+		Scan  *scanner.ScanProgress  `json:"scan"`
+		Queue map[string]interface{} `json:"queue"`
+	}
+	if err := json.Unmarshal([]byte(msg), &update); err != nil {
+		t.Fatalf("update %q: %v", msg, err)
+	}
+	if update.Scan == nil || update.Queue == nil {
+		t.Errorf("update = %s, want scan progress and queue stats", msg)
+	}
+	if _, ok := update.Queue["queue_length"]; !ok {
+		t.Errorf("queue stats lack queue_length: %v", update.Queue)
+	}
+}
+
+func TestProgressSocketOutsideTimeout(t *testing.T) {
+	ts := newTestServer(t)
+
+	timed := map[string]bool{}
+	err := chi.Walk(ts.router, func(method, route string, _ http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		for _, mw := range middlewares {
+			name := runtime.FuncForPC(reflect.ValueOf(mw).Pointer()).Name()
+			if strings.Contains(name, "middleware.Timeout") {
+				timed[method+" "+route] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if timed["GET /ws/progress"] {
+		t.Error("/ws/progress is behind the request timeout")
+	}
+	if !timed["GET /api/queue"] {
+		t.Error("/api/queue lost the request timeout")
+	}
+}
+
+// get выполняет GET с токеном администратора
+func (ts *testServer) get(tb testing.TB, path string) *http.Response {
+	tb.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.http.URL+path, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+ts.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestSearchPageListsCamerasFromIndex(t *testing.T) {
+	ts := newTestServer(t)
+	for i, camera := range []string{"Canon EOS R", "Fujifilm X-T4"} {
+		path := fmt.Sprintf("/library/%d.jpg", i)
+		m := &storage.Media{ID: storage.GenerateID(path), Path: path, Dir: "/library", Filename: filepath.Base(path), Type: storage.MediaTypeImage}
+		m.Metadata.Camera = camera
+		if err := ts.store.SaveMedia(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := ts.get(t, "/search")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	for _, camera := range []string{"Canon EOS R", "Fujifilm X-T4"} {
+		if !strings.Contains(string(body), camera) {
+			t.Errorf("search page lacks camera %q", camera)
+		}
+	}
+}
+
+func TestUnauthenticatedResponses(t *testing.T) {
+	ts := newTestServer(t)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// API получает 401 JSON, а не HTML страницы входа
+	resp, err := client.Get(ts.http.URL + "/api/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("/api/stats status = %d, want 401", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("/api/stats content type = %q, want JSON", ct)
+	}
+	var body struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Code != "unauthorized" {
+		t.Errorf("/api/stats body = %+v (%v), want code unauthorized", body, err)
+	}
+
+	// HTMX-запрос страницы тоже получает 401 и заголовок перехода
+	req, _ := http.NewRequest(http.MethodGet, ts.http.URL+"/gallery", nil)
+	req.Header.Set("HX-Request", "true")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("HX-Redirect") != "/login" {
+		t.Errorf("HTMX /gallery = %d, HX-Redirect %q; want 401 to /login", resp.StatusCode, resp.Header.Get("HX-Redirect"))
+	}
+
+	// Браузер перенаправляется на страницу входа
+	resp, err = client.Get(ts.http.URL + "/gallery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/login" {
+		t.Errorf("/gallery = %d to %q, want 302 to /login", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+// probe выполняет GET без авторизации и возвращает код ответа и поле status
+func (ts *testServer) probe(tb testing.TB, path string) (int, string) {
+	tb.Helper()
+	resp, err := http.Get(ts.http.URL + path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Status string `json:"status"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body.Status
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	ts := newTestServer(t)
+
+	if code, status := ts.probe(t, "/healthz"); code != http.StatusOK || status != "ok" {
+		t.Errorf("/healthz = %d %q, want 200 ok", code, status)
+	}
+	if code, status := ts.probe(t, "/readyz"); code != http.StatusOK || status != "ready" {
+		t.Errorf("/readyz = %d %q, want 200 ready", code, status)
+	}
+
+	// Закрытая база: сервер жив, но не готов
+	if err := ts.store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := ts.probe(t, "/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz with closed store = %d, want 200", code)
+	}
+	if code, _ := ts.probe(t, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz with closed store = %d, want 503", code)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	ts := newTestServer(t)
+	path := "/library/a.jpg"
+	m := &storage.Media{ID: storage.GenerateID(path), Path: path, Dir: "/library", Filename: "a.jpg", Type: storage.MediaTypeImage, Size: 1000}
+	if err := ts.store.SaveMedia(m); err != nil {
+		t.Fatal(err)
+	}
+	ts.get(t, "/api/stats") // Запрос попадает в счетчик
+
+	// В режиме auth метрики без входа не отдаются
+	resp, err := http.Get(ts.http.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous /metrics = %d, want 401", resp.StatusCode)
+	}
+
+	resp = ts.get(t, "/metrics")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/metrics status = %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("content type = %q, want Prometheus text", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		"# TYPE photocore_http_requests_total counter",
+		`photocore_http_requests_total{method="GET",code="200"}`,
+		"# TYPE photocore_http_request_duration_seconds histogram",
+		"photocore_thumbnail_queue_length 0",
+		"# TYPE photocore_cache_hits_total counter",
+		"photocore_media_total 1",
+		`photocore_media_type_total{type="image"} 1`,
+		"photocore_scan_running 0",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+}
+
+func TestDemotedUserLosesAdminAccess(t *testing.T) {
+	ts := newTestServer(t)
+	hash, err := ts.auth.HashPassword("Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.store.SaveUser(&storage.User{ID: "bob-id", Username: "bob", PasswordHash: hash, Role: storage.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	session, err := ts.auth.Login("bob", "Secret-pass-1", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listUsers := func() int {
+		req, _ := http.NewRequest(http.MethodGet, ts.http.URL+"/api/users", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: session.ID})
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := listUsers(); code != http.StatusOK {
+		t.Fatalf("admin session status = %d, want 200", code)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, ts.http.URL+"/api/users/bob", strings.NewReader(`{"role": "viewer"}`))
+	req.Header.Set("Authorization", "Bearer "+ts.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("demote status = %d, want 200", resp.StatusCode)
+	}
+
+	// Сессия не перевыпускалась: права должны пропасть в ней же
+	if code := listUsers(); code != http.StatusForbidden {
+		t.Errorf("demoted session status = %d, want 403", code)
+	}
+	if u, _ := ts.store.GetUser("bob"); u.Role != storage.RoleViewer {
+		t.Errorf("stored role = %q, want viewer", u.Role)
+	}
+}
+
+func TestStaticURLAddsBuildVersion(t *testing.T) {
+	tests := []struct{ path, version, want string }{
+		{"/static/js/app.js", "", "/static/js/app.js"},
+		{"/static/js/app.js", "1.2.0", "/static/js/app.js?v=1.2.0"},
+		{"/static/css/app.css?theme=dark", "1.2.0", "/static/css/app.css?theme=dark&v=1.2.0"},
+		{"/static/js/app.js", "dev build", "/static/js/app.js?v=dev+build"},
+	}
+	for _, tt := range tests {
+		if got := staticURL(tt.path, tt.version); got != tt.want {
+			t.Errorf("staticURL(%q, %q) = %q, want %q", tt.path, tt.version, got, tt.want)
+		}
+	}
+
+	// Страницы ссылаются на скрипты с версией сборки сервера
+	ts := newTestServer(t)
+	resp := ts.get(t, "/search")
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `src="/static/js/htmx.min.js?v=test"`) {
+		t.Error("search page script URL lacks the build version")
+	}
+}
@@ -0,0 +1,163 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// shareFixture альбом с одним медиа, медиа вне альбома (файлы обоих существуют)
+// и функция создания ссылки на альбом
+func shareFixture(t *testing.T, ts *testServer) (inAlbum, outside *storage.Media, share func(link *storage.ShareLink) string) {
+	t.Helper()
+	root := ts.cfg.Storage.MediaPaths[0]
+	save := func(name string) *storage.Media {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte("jpeg"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		m := &storage.Media{ID: storage.GenerateID(path), Path: path, Dir: root, Filename: name, Type: storage.MediaTypeImage, MimeType: "image/jpeg"}
+		if err := ts.store.SaveMedia(m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	inAlbum, outside = save("shared.jpg"), save("private.jpg")
+
+	album := &storage.Album{ID: "trip", Name: "Trip"}
+	if err := ts.store.SaveAlbum(album); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.store.AddMediaToAlbum(album.ID, []string{inAlbum.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	share = func(link *storage.ShareLink) string {
+		n++
+		link.Token = strings.Repeat(string(rune('a'+n)), 64)
+		link.AlbumID = album.ID
+		link.CreatedAt = time.Now()
+		if err := ts.store.SaveShareLink(link); err != nil {
+			t.Fatal(err)
+		}
+		return "/share/" + link.Token
+	}
+	return inAlbum, outside, share
+}
+
+// noRedirect клиент, возвращающий ответы с перенаправлением как есть
+var noRedirect = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}}
+
+// shareGet выполняет анонимный GET (с cookie, если задана) и возвращает код ответа
+func shareGet(t *testing.T, ts *testServer, path string, cookie *http.Cookie) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, ts.http.URL+path, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestShareLinkServesOnlyAlbumMedia(t *testing.T) {
+	ts := newTestServer(t)
+	inAlbum, outside, share := shareFixture(t, ts)
+	base := share(&storage.ShareLink{})
+
+	if code := shareGet(t, ts, base, nil); code != http.StatusOK {
+		t.Errorf("album page = %d, want 200", code)
+	}
+	if code := shareGet(t, ts, base+"/media/"+inAlbum.ID, nil); code != http.StatusOK {
+		t.Errorf("album media = %d, want 200", code)
+	}
+	// Токен альбома не открывает остальную библиотеку
+	if code := shareGet(t, ts, base+"/media/"+outside.ID, nil); code != http.StatusNotFound {
+		t.Errorf("media outside album = %d, want 404", code)
+	}
+	if code := shareGet(t, ts, base+"/media/"+outside.ID+"/thumb/small", nil); code != http.StatusNotFound {
+		t.Errorf("thumbnail outside album = %d, want 404", code)
+	}
+
+	// Медиа в корзине по ссылке тоже не отдается
+	if err := ts.store.SoftDeleteMedia(inAlbum.ID); err != nil {
+		t.Fatal(err)
+	}
+	ts.cache.DeleteMedia(inAlbum.ID)
+	if code := shareGet(t, ts, base+"/media/"+inAlbum.ID, nil); code != http.StatusNotFound {
+		t.Errorf("trashed album media = %d, want 404", code)
+	}
+}
+
+func TestExpiredShareLinkNotFound(t *testing.T) {
+	ts := newTestServer(t)
+	inAlbum, _, share := shareFixture(t, ts)
+	past := time.Now().Add(-time.Minute)
+	base := share(&storage.ShareLink{ExpiresAt: &past})
+
+	for _, path := range []string{base, base + "/media/" + inAlbum.ID, base + "/media/" + inAlbum.ID + "/thumb/small"} {
+		if code := shareGet(t, ts, path, nil); code != http.StatusNotFound {
+			t.Errorf("%s = %d, want 404", path, code)
+		}
+	}
+	if code := shareGet(t, ts, "/share/"+strings.Repeat("f", 64), nil); code != http.StatusNotFound {
+		t.Errorf("unknown token = %d, want 404", code)
+	}
+}
+
+func TestPasswordShareLinkRequiresPassword(t *testing.T) {
+	ts := newTestServer(t)
+	inAlbum, _, share := shareFixture(t, ts)
+	hash, err := ts.auth.HashPassword("sea-view-2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := share(&storage.ShareLink{PasswordHash: hash, HasPassword: true})
+	mediaPath := base + "/media/" + inAlbum.ID
+
+	// Без пароля — только форма ввода, медиа закрыты
+	if code := shareGet(t, ts, mediaPath, nil); code != http.StatusUnauthorized {
+		t.Errorf("media without password = %d, want 401", code)
+	}
+
+	unlock := func(password string) *http.Response {
+		t.Helper()
+		resp, err := noRedirect.PostForm(ts.http.URL+base, url.Values{"password": {password}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	for _, password := range []string{"", "wrong-password"} {
+		resp := unlock(password)
+		if resp.StatusCode != http.StatusUnauthorized || len(resp.Cookies()) != 0 {
+			t.Errorf("password %q = %d with cookies %v, want 401 without cookie", password, resp.StatusCode, resp.Cookies())
+		}
+	}
+	// Подобранная вручную cookie не подходит
+	forged := &http.Cookie{Name: "share_" + strings.TrimPrefix(base, "/share/")[:16], Value: "forged"}
+	if code := shareGet(t, ts, mediaPath, forged); code != http.StatusUnauthorized {
+		t.Errorf("media with forged cookie = %d, want 401", code)
+	}
+
+	resp := unlock("sea-view-2024")
+	if resp.StatusCode != http.StatusSeeOther || len(resp.Cookies()) != 1 {
+		t.Fatalf("correct password = %d with cookies %v, want 303 and a cookie", resp.StatusCode, resp.Cookies())
+	}
+	if code := shareGet(t, ts, mediaPath, resp.Cookies()[0]); code != http.StatusOK {
+		t.Errorf("media after unlock = %d, want 200", code)
+	}
+}
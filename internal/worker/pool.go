@@ -2,6 +2,8 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -18,6 +20,14 @@ const (
 	TaskExtractMetadata   TaskType = "extract_metadata"
 	TaskProcessRAW        TaskType = "process_raw"
 	TaskProcessVideo      TaskType = "process_video"
+	TaskScanFile          TaskType = "scan_file" // Обработка файла при сканировании (хеши, метаданные, дубликаты)
+)
+
+// Параметры повторов по умолчанию: 3 попытки с паузами 1s, 4s (каждая следующая в 4 раза дольше)
+const (
+	DefaultMaxAttempts = 3
+	DefaultRetryDelay  = time.Second
+	retryBackoffFactor = 4
 )
 
 // TaskPriority определяет приоритет задачи
@@ -38,31 +48,88 @@ type Task struct {
 	MediaPath string
 	Size      string // для thumbnail: small, medium, large
 	CreatedAt time.Time
-	Attempts  int
+	Attempts  int  // Сколько раз задача уже выполнялась
+	Transient bool // Не сохранять в персистентной очереди (задачи текущего сканирования)
+}
+
+// Key ключ дедупликации задачи в персистентной очереди (тип:mediaID:size)
+func (t *Task) Key() string {
+	if t.MediaID == "" {
+		return string(t.Type) + ":" + t.ID
+	}
+	return string(t.Type) + ":" + t.MediaID + ":" + t.Size
+}
+
+// TaskStore хранилище персистентной очереди (реализуется storage.Store)
+type TaskStore interface {
+	SaveQueuedTask(key string, data []byte) error
+	DeleteQueuedTask(key string) error
+	ListQueuedTasks() (map[string][]byte, error)
 }
 
 // TaskResult содержит результат выполнения задачи
 type TaskResult struct {
-	TaskID    string
-	Success   bool
-	Error     error
-	Duration  time.Duration
+	TaskID     string
+	Success    bool
+	Error      error
+	Duration   time.Duration
 	OutputPath string
 }
 
-// Handler обрабатывает задачи определенного типа
+// Handler обрабатывает задачи определенного типа.
+// Ошибки, обернутые в Permanent, не повторяются.
 type Handler func(ctx context.Context, task *Task) (*TaskResult, error)
 
+// permanentError ошибка, при которой повтор задачи бессмысленен
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent помечает ошибку как постоянную: пул не будет повторять задачу
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent проверяет, помечена ли ошибка как постоянная
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
 // Pool управляет пулом воркеров
 type Pool struct {
-	numWorkers   int
-	taskQueue    chan *Task
-	resultQueue  chan *TaskResult
-	handlers     map[TaskType]Handler
-	wg           sync.WaitGroup
-	ctx          context.Context
-	cancel       context.CancelFunc
-	mu           sync.RWMutex
+	numWorkers  int
+	taskQueue   chan *Task
+	resultQueue chan *TaskResult
+	handlers    map[TaskType]Handler
+	wg          sync.WaitGroup
+	ctx         context.Context
+	cancel      context.CancelFunc
+	mu          sync.RWMutex
+
+	// Повторы временных ошибок
+	maxAttempts int
+	retryDelay  time.Duration
+	retryWg     sync.WaitGroup // Отложенные повторы, Stop ждет их до закрытия очереди
+	feedWg      sync.WaitGroup // Фоновые постановщики задач (Feed), Stop ждет их так же
+
+	// Персистентная очередь (nil — только в памяти)
+	taskStore TaskStore
+	pendingMu sync.Mutex
+	pending   map[string]bool // Ключи задач, сохраненных и еще не завершенных
+
+	running atomic.Bool // Между Start и Stop
+
+	// Задачи PriorityHigh (файлы сканирования) берутся воркерами раньше остальных
+	priorityQueue chan *Task
+	// Вызываются для задач, так и не выполненных из-за остановки пула
+	discardHandlers map[TaskType]func(task *Task)
 
 	// Статистика
 	stats Stats
@@ -75,10 +142,13 @@ type Stats struct {
 	FailedTasks    int64
 	QueuedTasks    int64
 	ActiveWorkers  int64
+	RetriedTasks   int64 // Сколько раз задачи повторно ставились в очередь
+	PendingRetries int64 // Повторы, ожидающие своей паузы
 }
 
-// NewPool создает новый пул воркеров
-func NewPool(numWorkers int, queueSize int) *Pool {
+// NewPool создает новый пул воркеров.
+// Если taskStore не nil, очередь сохраняется в БД и незавершенные задачи возобновляются при Start.
+func NewPool(numWorkers int, queueSize int, taskStore TaskStore) *Pool {
 	if numWorkers <= 0 {
 		numWorkers = runtime.NumCPU()
 	}
@@ -95,7 +165,36 @@ func NewPool(numWorkers int, queueSize int) *Pool {
 		handlers:    make(map[TaskType]Handler),
 		ctx:         ctx,
 		cancel:      cancel,
+		maxAttempts: DefaultMaxAttempts,
+		retryDelay:  DefaultRetryDelay,
+		taskStore:   taskStore,
+		pending:     make(map[string]bool),
+
+		priorityQueue:   make(chan *Task, queueSize),
+		discardHandlers: make(map[TaskType]func(task *Task)),
+	}
+}
+
+// SetRetryPolicy задает число попыток и паузу перед первым повтором
+// (каждая следующая пауза в 4 раза дольше). maxAttempts <= 1 отключает повторы.
+func (p *Pool) SetRetryPolicy(maxAttempts int, baseDelay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if maxAttempts < 1 {
+		maxAttempts = 1
 	}
+	p.maxAttempts = maxAttempts
+	p.retryDelay = baseDelay
+}
+
+// WillRetry сообщает, будет ли задача повторена после ошибки err
+func (p *Pool) WillRetry(task *Task, err error) bool {
+	if err == nil || IsPermanent(err) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return task.Attempts+1 < p.maxAttempts
 }
 
 // RegisterHandler регистрирует обработчик для типа задачи
@@ -105,6 +204,32 @@ func (p *Pool) RegisterHandler(taskType TaskType, handler Handler) {
 	p.handlers[taskType] = handler
 }
 
+// RegisterDiscardHandler регистрирует fn для задач типа taskType, отброшенных при Stop
+// (остались в очереди или ждали повтора) — например, чтобы снять ожидание их завершения
+func (p *Pool) RegisterDiscardHandler(taskType TaskType, fn func(task *Task)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.discardHandlers[taskType] = fn
+}
+
+// discard сообщает обработчику типа, что задача не будет выполнена
+func (p *Pool) discard(task *Task) {
+	p.mu.RLock()
+	fn := p.discardHandlers[task.Type]
+	p.mu.RUnlock()
+	if fn != nil {
+		fn(task)
+	}
+}
+
+// queueFor возвращает очередь задачи по ее приоритету
+func (p *Pool) queueFor(task *Task) chan *Task {
+	if task.Priority >= PriorityHigh {
+		return p.priorityQueue
+	}
+	return p.taskQueue
+}
+
 // Start запускает воркеры
 func (p *Pool) Start() {
 	logger.InfoLog.Printf("Starting worker pool with %d workers", p.numWorkers)
@@ -116,46 +241,174 @@ func (p *Pool) Start() {
 
 	// Горутина для обработки результатов
 	go p.processResults()
+
+	if p.taskStore != nil {
+		p.restoreTasks()
+	}
+	p.running.Store(true)
+}
+
+// restoreTasks возвращает в очередь задачи, не завершенные до перезапуска
+func (p *Pool) restoreTasks() {
+	stored, err := p.taskStore.ListQueuedTasks()
+	if err != nil {
+		logger.ErrorLog.Printf("Failed to load persistent task queue: %v", err)
+		return
+	}
+	if len(stored) == 0 {
+		return
+	}
+
+	var tasks []*Task
+	p.pendingMu.Lock()
+	for key, data := range stored {
+		var task Task
+		if err := json.Unmarshal(data, &task); err != nil {
+			logger.ErrorLog.Printf("Dropping unreadable queued task %s: %v", key, err)
+			p.taskStore.DeleteQueuedTask(key)
+			continue
+		}
+		p.pending[key] = true
+		tasks = append(tasks, &task)
+	}
+	p.pendingMu.Unlock()
+
+	logger.InfoLog.Printf("Restoring %d queued tasks", len(tasks))
+
+	// Задач может быть больше, чем вмещает канал, — добавляем в фоне
+	p.retryWg.Add(1)
+	go func() {
+		defer p.retryWg.Done()
+		for _, task := range tasks {
+			select {
+			case <-p.ctx.Done():
+				return
+			case p.queueFor(task) <- task:
+				atomic.AddInt64(&p.stats.TotalTasks, 1)
+				atomic.AddInt64(&p.stats.QueuedTasks, 1)
+			}
+		}
+	}()
+}
+
+// track сохраняет задачу в персистентной очереди.
+// Возвращает false, если задача с тем же ключом уже ожидает выполнения.
+func (p *Pool) track(task *Task) bool {
+	if p.taskStore == nil || task.Transient {
+		return true
+	}
+	key := task.Key()
+
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	if p.pending[key] {
+		return false
+	}
+	p.pending[key] = true
+	p.saveTask(task)
+	return true
+}
+
+// saveTask записывает задачу в БД (ошибка не мешает выполнению — задача останется в памяти)
+func (p *Pool) saveTask(task *Task) {
+	data, err := json.Marshal(task)
+	if err == nil {
+		err = p.taskStore.SaveQueuedTask(task.Key(), data)
+	}
+	if err != nil {
+		logger.ErrorLog.Printf("Failed to persist task %s: %v", task.ID, err)
+	}
+}
+
+// untrack удаляет завершенную задачу из персистентной очереди
+func (p *Pool) untrack(task *Task) {
+	if p.taskStore == nil || task.Transient {
+		return
+	}
+	key := task.Key()
+
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	delete(p.pending, key)
+	if err := p.taskStore.DeleteQueuedTask(key); err != nil {
+		logger.ErrorLog.Printf("Failed to remove task %s from persistent queue: %v", task.ID, err)
+	}
 }
 
 // Stop останавливает пул
 func (p *Pool) Stop() {
 	logger.InfoLog.Println("Stopping worker pool...")
+	p.running.Store(false)
 	p.cancel()
+	p.retryWg.Wait()
+	p.feedWg.Wait()
 	close(p.taskQueue)
+	close(p.priorityQueue)
 	p.wg.Wait()
+
+	// Воркеры вышли по отмене контекста: оставшиеся задачи не выполнятся.
+	// Персистентные остаются в БД и возобновятся при следующем Start.
+	for _, queue := range []chan *Task{p.priorityQueue, p.taskQueue} {
+		for task := range queue {
+			atomic.AddInt64(&p.stats.QueuedTasks, -1)
+			p.discard(task)
+		}
+	}
 	close(p.resultQueue)
 	logger.InfoLog.Println("Worker pool stopped")
 }
 
-// Submit добавляет задачу в очередь
+// Submit добавляет задачу в очередь.
+// Для персистентной очереди повторная задача с тем же ключом не добавляется (возвращается true).
 func (p *Pool) Submit(task *Task) bool {
+	if !p.track(task) {
+		return true
+	}
 	select {
 	case <-p.ctx.Done():
+		p.untrack(task)
 		return false
-	case p.taskQueue <- task:
+	case p.queueFor(task) <- task:
 		atomic.AddInt64(&p.stats.TotalTasks, 1)
 		atomic.AddInt64(&p.stats.QueuedTasks, 1)
 		return true
 	default:
 		// Очередь переполнена
 		logger.InfoLog.Printf("Task queue full, dropping task %s", task.ID)
+		p.untrack(task)
 		return false
 	}
 }
 
 // SubmitBlocking добавляет задачу с блокировкой
 func (p *Pool) SubmitBlocking(task *Task) bool {
+	if !p.track(task) {
+		return true
+	}
 	select {
 	case <-p.ctx.Done():
+		p.untrack(task)
 		return false
-	case p.taskQueue <- task:
+	case p.queueFor(task) <- task:
 		atomic.AddInt64(&p.stats.TotalTasks, 1)
 		atomic.AddInt64(&p.stats.QueuedTasks, 1)
 		return true
 	}
 }
 
+// Feed запускает fn в фоне для постановки задач через SubmitBlocking по мере освобождения очереди.
+// fn должна завершиться после отмены ctx (Stop), Stop ждет ее до закрытия очереди.
+func (p *Pool) Feed(fn func(ctx context.Context)) {
+	if p.ctx.Err() != nil {
+		return
+	}
+	p.feedWg.Add(1)
+	go func() {
+		defer p.feedWg.Done()
+		fn(p.ctx)
+	}()
+}
+
 // Stats возвращает статистику пула
 func (p *Pool) Stats() Stats {
 	return Stats{
@@ -164,12 +417,24 @@ func (p *Pool) Stats() Stats {
 		FailedTasks:    atomic.LoadInt64(&p.stats.FailedTasks),
 		QueuedTasks:    atomic.LoadInt64(&p.stats.QueuedTasks),
 		ActiveWorkers:  atomic.LoadInt64(&p.stats.ActiveWorkers),
+		RetriedTasks:   atomic.LoadInt64(&p.stats.RetriedTasks),
+		PendingRetries: atomic.LoadInt64(&p.stats.PendingRetries),
 	}
 }
 
-// QueueLength возвращает текущую длину очереди
+// Running запущен ли пул (Start вызван, Stop еще нет)
+func (p *Pool) Running() bool {
+	return p.running.Load()
+}
+
+// QueueLength возвращает текущую длину очереди (вместе с приоритетной)
 func (p *Pool) QueueLength() int {
-	return len(p.taskQueue)
+	return len(p.taskQueue) + len(p.priorityQueue)
+}
+
+// QueueCapacity возвращает размер очереди (queue_size)
+func (p *Pool) QueueCapacity() int {
+	return cap(p.taskQueue)
 }
 
 func (p *Pool) worker(id int) {
@@ -177,10 +442,31 @@ func (p *Pool) worker(id int) {
 	logger.InfoLog.Printf("Worker %d started", id)
 
 	for {
+		// Приоритетные задачи не ждут за фоновыми
+		select {
+		case <-p.ctx.Done():
+			logger.InfoLog.Printf("Worker %d stopping", id)
+			return
+		case task, ok := <-p.priorityQueue:
+			if !ok {
+				logger.InfoLog.Printf("Worker %d: task queue closed", id)
+				return
+			}
+			p.processTask(id, task)
+			continue
+		default:
+		}
+
 		select {
 		case <-p.ctx.Done():
 			logger.InfoLog.Printf("Worker %d stopping", id)
 			return
+		case task, ok := <-p.priorityQueue:
+			if !ok {
+				logger.InfoLog.Printf("Worker %d: task queue closed", id)
+				return
+			}
+			p.processTask(id, task)
 		case task, ok := <-p.taskQueue:
 			if !ok {
 				logger.InfoLog.Printf("Worker %d: task queue closed", id)
@@ -231,9 +517,13 @@ func (p *Pool) processTask(workerID int, task *Task) {
 
 	if result.Success {
 		atomic.AddInt64(&p.stats.CompletedTasks, 1)
+	} else if p.WillRetry(task, result.Error) {
+		p.scheduleRetry(task, result.Error)
+		return
 	} else {
 		atomic.AddInt64(&p.stats.FailedTasks, 1)
 	}
+	p.untrack(task)
 
 	// Отправляем результат
 	select {
@@ -243,6 +533,46 @@ func (p *Pool) processTask(workerID int, task *Task) {
 	}
 }
 
+// scheduleRetry ставит задачу в очередь повторно после паузы 1s, 4s, 16s...
+func (p *Pool) scheduleRetry(task *Task, err error) {
+	p.mu.RLock()
+	delay := p.retryDelay
+	p.mu.RUnlock()
+	for i := 0; i < task.Attempts; i++ {
+		delay *= retryBackoffFactor
+	}
+	task.Attempts++
+	if p.taskStore != nil && !task.Transient {
+		p.saveTask(task) // После перезапуска повтор продолжится с учетом попыток
+	}
+
+	logger.InfoLog.Printf("Task %s failed (attempt %d): %v, retrying in %v", task.ID, task.Attempts, err, delay)
+
+	atomic.AddInt64(&p.stats.PendingRetries, 1)
+	p.retryWg.Add(1)
+	go func() {
+		defer p.retryWg.Done()
+		defer atomic.AddInt64(&p.stats.PendingRetries, -1)
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-p.ctx.Done():
+			p.discard(task)
+			return
+		case <-timer.C:
+		}
+
+		select {
+		case <-p.ctx.Done():
+			p.discard(task)
+		case p.queueFor(task) <- task:
+			atomic.AddInt64(&p.stats.RetriedTasks, 1)
+			atomic.AddInt64(&p.stats.QueuedTasks, 1)
+		}
+	}()
+}
+
 func (p *Pool) processResults() {
 	for result := range p.resultQueue {
 		if !result.Success && result.Error != nil {
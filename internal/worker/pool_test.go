@@ -0,0 +1,219 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "worker-test")
+	if err != nil {
+		panic(err)
+	}
+	if err := logger.Init(filepath.Join(dir, "logs")); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// waitFor ждет выполнения cond не дольше 5 секунд
+func waitFor(tb testing.TB, what string, cond func() bool) {
+	tb.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			tb.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolRetriesTransientFailures(t *testing.T) {
+	p := NewPool(1, 10, nil)
+	p.SetRetryPolicy(3, time.Millisecond)
+
+	var calls atomic.Int32
+	p.RegisterHandler(TaskGenerateThumbnail, func(ctx context.Context, task *Task) (*TaskResult, error) {
+		if calls.Add(1) <= 2 {
+			return nil, errors.New("disk busy")
+		}
+		return &TaskResult{TaskID: task.ID, Success: true}, nil
+	})
+	p.Start()
+	defer p.Stop()
+
+	p.Submit(&Task{ID: "flaky", Type: TaskGenerateThumbnail})
+	waitFor(t, "task success", func() bool { return p.Stats().CompletedTasks == 1 })
+
+	if got := calls.Load(); got != 3 {
+		t.Errorf("handler calls = %d, want 3", got)
+	}
+	stats := p.Stats()
+	if stats.RetriedTasks != 2 || stats.FailedTasks != 0 {
+		t.Errorf("retried = %d, failed = %d; want 2, 0", stats.RetriedTasks, stats.FailedTasks)
+	}
+}
+
+func TestPoolDoesNotRetryPermanentFailures(t *testing.T) {
+	p := NewPool(1, 10, nil)
+	p.SetRetryPolicy(3, time.Millisecond)
+
+	var calls atomic.Int32
+	p.RegisterHandler(TaskGenerateThumbnail, func(ctx context.Context, task *Task) (*TaskResult, error) {
+		calls.Add(1)
+		return nil, Permanent(errors.New("unsupported format"))
+	})
+	p.Start()
+	defer p.Stop()
+
+	p.Submit(&Task{ID: "broken", Type: TaskGenerateThumbnail})
+	waitFor(t, "task failure", func() bool { return p.Stats().FailedTasks == 1 })
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("handler calls = %d, want 1", got)
+	}
+}
+
+func TestPoolResumesPersistedTasksAfterRestart(t *testing.T) {
+	store := newMemTaskStore()
+
+	// Первый пул не запускается: задачи попадают в очередь и в store, но не выполняются
+	first := NewPool(1, 10, store)
+	for _, id := range []string{"media-a", "media-b", "media-c"} {
+		first.Submit(&Task{ID: id, Type: TaskGenerateThumbnail, MediaID: id, Size: "small"})
+	}
+	first.Submit(&Task{ID: "dup", Type: TaskGenerateThumbnail, MediaID: "media-a", Size: "small"})
+	if got := store.len(); got != 3 {
+		t.Fatalf("persisted tasks = %d, want 3 (duplicate key skipped)", got)
+	}
+	first.Stop()
+
+	second := NewPool(2, 10, store)
+	var mu sync.Mutex
+	done := map[string]int{}
+	second.RegisterHandler(TaskGenerateThumbnail, func(ctx context.Context, task *Task) (*TaskResult, error) {
+		mu.Lock()
+		done[task.MediaID]++
+		mu.Unlock()
+		return &TaskResult{TaskID: task.ID, Success: true}, nil
+	})
+	second.Start()
+	defer second.Stop()
+
+	waitFor(t, "restored tasks", func() bool { return second.Stats().CompletedTasks == 3 })
+	waitFor(t, "persistent queue drained", func() bool { return store.len() == 0 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range []string{"media-a", "media-b", "media-c"} {
+		if done[id] != 1 {
+			t.Errorf("task %s ran %d times, want 1", id, done[id])
+		}
+	}
+}
+
+// memTaskStore персистентная очередь в памяти, переживает пересоздание пула
+type memTaskStore struct {
+	mu    sync.Mutex
+	tasks map[string][]byte
+}
+
+func newMemTaskStore() *memTaskStore {
+	return &memTaskStore{tasks: make(map[string][]byte)}
+}
+
+func (s *memTaskStore) SaveQueuedTask(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *memTaskStore) DeleteQueuedTask(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tasks, key)
+	return nil
+}
+
+func (s *memTaskStore) ListQueuedTasks() (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string][]byte, len(s.tasks))
+	for k, v := range s.tasks {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (s *memTaskStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tasks)
+}
+
+func TestPoolStopDiscardsQueuedTasks(t *testing.T) {
+	p := NewPool(1, 10, nil)
+	started := make(chan struct{})
+	p.RegisterHandler(TaskGenerateThumbnail, func(ctx context.Context, task *Task) (*TaskResult, error) {
+		close(started)
+		<-ctx.Done() // Первая задача занимает единственного воркера до остановки
+		return nil, ctx.Err()
+	})
+	var discarded atomic.Int32
+	p.RegisterDiscardHandler(TaskGenerateThumbnail, func(task *Task) { discarded.Add(1) })
+	p.Start()
+
+	p.Submit(&Task{ID: "busy", Type: TaskGenerateThumbnail})
+	<-started
+	for i := 0; i < 4; i++ {
+		p.Submit(&Task{ID: "queued", Type: TaskGenerateThumbnail})
+	}
+	p.Stop()
+
+	if got := discarded.Load(); got != 4 {
+		t.Errorf("discarded = %d, want 4 queued tasks", got)
+	}
+	if got := p.Stats().QueuedTasks; got != 0 {
+		t.Errorf("queued after stop = %d, want 0", got)
+	}
+}
+
+func TestPoolRunsHighPriorityFirst(t *testing.T) {
+	p := NewPool(1, 10, nil)
+	var mu sync.Mutex
+	var order []string
+	handler := func(ctx context.Context, task *Task) (*TaskResult, error) {
+		mu.Lock()
+		order = append(order, task.ID)
+		mu.Unlock()
+		return &TaskResult{TaskID: task.ID, Success: true}, nil
+	}
+	p.RegisterHandler(TaskGenerateThumbnail, handler)
+	p.RegisterHandler(TaskScanFile, handler)
+
+	// Пока пул не запущен, задачи копятся в очередях
+	for _, id := range []string{"thumb-1", "thumb-2", "thumb-3"} {
+		p.Submit(&Task{ID: id, Type: TaskGenerateThumbnail, Priority: PriorityNormal})
+	}
+	p.Submit(&Task{ID: "scan", Type: TaskScanFile, Priority: PriorityHigh})
+	p.Start()
+	defer p.Stop()
+
+	waitFor(t, "all tasks", func() bool { return p.Stats().CompletedTasks == 4 })
+	mu.Lock()
+	defer mu.Unlock()
+	if order[0] != "scan" {
+		t.Errorf("order = %v, want the high priority task first", order)
+	}
+}
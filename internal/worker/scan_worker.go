@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/photocore/photocore/internal/scanner"
+)
+
+// ScanService распределяет файлы сканирования по воркерам пула:
+// хеширование, метаданные и проверка дубликатов идут параллельно
+type ScanService struct {
+	pool    *Pool
+	scanner *scanner.Scanner
+}
+
+// NewScanService создает сервис и подключает его к сканеру как очередь файлов
+func NewScanService(pool *Pool, sc *scanner.Scanner) *ScanService {
+	svc := &ScanService{
+		pool:    pool,
+		scanner: sc,
+	}
+
+	pool.RegisterHandler(TaskScanFile, svc.handleScanFile)
+	pool.RegisterDiscardHandler(TaskScanFile, func(task *Task) {
+		sc.DiscardQueuedFile(task.MediaPath)
+	})
+	sc.SetFileQueue(svc)
+
+	return svc
+}
+
+// SubmitScanFile ставит файл в приоритетную очередь, чтобы сканирование не ждало
+// фоновую генерацию превью (блокируется, пока очередь заполнена, чтобы обход не опережал обработку)
+func (s *ScanService) SubmitScanFile(path string) bool {
+	return s.pool.SubmitBlocking(&Task{
+		ID:        generateTaskID(),
+		Type:      TaskScanFile,
+		Priority:  PriorityHigh,
+		MediaPath: path,
+		CreatedAt: time.Now(),
+		Transient: true,
+	})
+}
+
+// handleScanFile обрабатывает задачу сканирования файла.
+// Ошибки учитываются в прогрессе сканирования, задача не повторяется.
+func (s *ScanService) handleScanFile(ctx context.Context, task *Task) (*TaskResult, error) {
+	s.scanner.ProcessQueuedFile(ctx, task.MediaPath)
+	return nil, nil
+}
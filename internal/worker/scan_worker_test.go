@@ -0,0 +1,140 @@
+package worker
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/config"
+	"github.com/photocore/photocore/internal/scanner"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// newTestScanner создает сканер над пустым медиа-корнем во временной директории
+func newTestScanner(tb testing.TB) (*scanner.Scanner, *storage.Store, string) {
+	tb.Helper()
+	dir := tb.TempDir()
+	root := filepath.Join(dir, "media")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		tb.Fatal(err)
+	}
+
+	yaml := fmt.Sprintf(`storage:
+  media_paths: [%q]
+  cache_path: %q
+  db_path: %q
+  logs_path: %q
+scan:
+  extensions:
+    images: [".jpg"]
+`, root, filepath.Join(dir, "cache"), filepath.Join(dir, "data", "test.db"), filepath.Join(dir, "logs"))
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	store, err := storage.NewStore(cfg.Storage.DBPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { store.Close() })
+	return scanner.NewScanner(cfg, store), store, root
+}
+
+// writeFixtureJPEGs пишет n различных JPEG size x size в root
+func writeFixtureJPEGs(tb testing.TB, root string, n, size int) {
+	tb.Helper()
+	for i := 0; i < n; i++ {
+		// Случайные блоки 8x8: перцептивные хеши разные, файлы не считаются дубликатами
+		rnd := rand.New(rand.NewSource(int64(i)))
+		img := image.NewGray(image.Rect(0, 0, size, size))
+		for by := 0; by < size; by += 8 {
+			for bx := 0; bx < size; bx += 8 {
+				c := color.Gray{Y: uint8(rnd.Intn(256))}
+				for y := by; y < by+8 && y < size; y++ {
+					for x := bx; x < bx+8 && x < size; x++ {
+						img.SetGray(x, y, c)
+					}
+				}
+			}
+		}
+		f, err := os.Create(filepath.Join(root, fmt.Sprintf("img%03d.jpg", i)))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := jpeg.Encode(f, img, nil); err != nil {
+			tb.Fatal(err)
+		}
+		f.Close()
+	}
+}
+
+// waitScan ждет завершения сканирования
+func waitScan(tb testing.TB, sc *scanner.Scanner) {
+	tb.Helper()
+	waitFor(tb, "scan to finish", func() bool { return !sc.IsScanning() })
+}
+
+func TestScanFinishesWhenPoolStops(t *testing.T) {
+	sc, _, root := newTestScanner(t)
+	writeFixtureJPEGs(t, root, 5, 16)
+
+	// Пул не запущен: файлы остаются в очереди, сканирование ждет их обработки
+	pool := NewPool(1, 10, nil)
+	NewScanService(pool, sc)
+	if err := sc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "files to be queued", func() bool { return pool.QueueLength() == 5 })
+
+	pool.Stop()
+	waitScan(t, sc)
+	if p := sc.Progress(); p.Errors != 5 {
+		t.Errorf("errors = %d, want 5 discarded files", p.Errors)
+	}
+}
+
+// benchmarkScan сканирует свежую библиотеку из 64 файлов; workers = 0 — без пула
+func benchmarkScan(b *testing.B, workers int) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		sc, _, root := newTestScanner(b)
+		writeFixtureJPEGs(b, root, 64, 256)
+		var pool *Pool
+		if workers > 0 {
+			pool = NewPool(workers, 100, nil)
+			NewScanService(pool, sc)
+			pool.Start()
+		}
+		b.StartTimer()
+
+		if err := sc.Start(); err != nil {
+			b.Fatal(err)
+		}
+		for sc.IsScanning() {
+			time.Sleep(time.Millisecond)
+		}
+
+		b.StopTimer()
+		if p := sc.Progress(); p.NewFiles != 64 {
+			b.Fatalf("new files = %d, want 64", p.NewFiles)
+		}
+		if pool != nil {
+			pool.Stop()
+		}
+	}
+}
+
+// Параллельная обработка через пул должна быть быстрее последовательной
+func BenchmarkScanSequential(b *testing.B) { benchmarkScan(b, 0) }
+func BenchmarkScanPool(b *testing.B)       { benchmarkScan(b, 4) }
@@ -5,10 +5,14 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"github.com/photocore/photocore/internal/logger"
 	"github.com/photocore/photocore/internal/media"
 	"github.com/photocore/photocore/internal/storage"
@@ -24,6 +28,9 @@ type ThumbnailService struct {
 	mu         sync.RWMutex
 	processing map[string]bool   // mediaID+size -> in progress
 	failed     map[string]string // mediaID+size -> error message (постоянные ошибки)
+
+	// Объединяет одновременные генерации одного превью (очередь и синхронные запросы)
+	inflight singleflight.Group
 }
 
 // NewThumbnailService создает новый сервис генерации превью
@@ -38,12 +45,22 @@ func NewThumbnailService(pool *Pool, store *storage.Store, thumbGen *media.Thumb
 
 	// Регистрируем обработчик
 	pool.RegisterHandler(TaskGenerateThumbnail, svc.handleThumbnail)
+	pool.RegisterDiscardHandler(TaskGenerateThumbnail, func(task *Task) {
+		svc.mu.Lock()
+		delete(svc.processing, task.MediaID+":"+task.Size)
+		svc.mu.Unlock()
+	})
 
 	return svc
 }
 
 // QueueThumbnail добавляет задачу на генерацию превью
 func (s *ThumbnailService) QueueThumbnail(mediaID, size string) bool {
+	return s.queueThumbnail(mediaID, size, s.pool.Submit)
+}
+
+// queueThumbnail ставит задачу через submit (Pool.Submit или Pool.SubmitBlocking)
+func (s *ThumbnailService) queueThumbnail(mediaID, size string, submit func(task *Task) bool) bool {
 	key := mediaID + ":" + size
 
 	s.mu.Lock()
@@ -68,7 +85,7 @@ func (s *ThumbnailService) QueueThumbnail(mediaID, size string) bool {
 		CreatedAt: time.Now(),
 	}
 
-	if !s.pool.Submit(task) {
+	if !submit(task) {
 		s.mu.Lock()
 		delete(s.processing, key)
 		s.mu.Unlock()
@@ -96,32 +113,151 @@ func (s *ThumbnailService) QueueBatch(mediaIDs []string, size string) int {
 	return queued
 }
 
-// PregeneateThumbnails запускает генерацию превью для всех медиа без превью
-func (s *ThumbnailService) PregenerateThumbnails() error {
+// PregenerateThumbnails запускает генерацию превью для всех медиа без превью.
+// order (thumbnails.pregenerate_order) задает, что ставится в очередь первым:
+// очередь FIFO, и при переполнении отбрасываются наименее нужные превью.
+func (s *ThumbnailService) PregenerateThumbnails(order string) error {
 	allMedia, err := s.store.ListAllMedia()
 	if err != nil {
 		return fmt.Errorf("failed to list media: %w", err)
 	}
 
-	queued := 0
+	var candidates []*storage.Media
 	for _, m := range allMedia {
 		// Проверяем, существует ли превью
 		if !s.thumbGen.ThumbnailExists(m.ID, "small") {
-			if s.QueueThumbnail(m.ID, "small") {
-				queued++
+			candidates = append(candidates, m)
+		}
+	}
+	if err := s.sortForPregeneration(candidates, order); err != nil {
+		return err
+	}
+
+	queued := 0
+	for _, m := range candidates {
+		if s.QueueThumbnail(m.ID, "small") {
+			queued++
+		}
+	}
+
+	logger.InfoLog.Printf("Queued %d thumbnail generation tasks (%s)", queued, order)
+	return nil
+}
+
+// RegenerateThumbnails удаляет превью медиа и заново ставит в очередь small
+// (medium и large создадутся при первом запросе). Сколько помещается в очередь пула,
+// ставится сразу (queued), остальные (pending) досылаются в фоне по мере ее освобождения,
+// поэтому повторять вызов не нужно. Превью удаляются непосредственно перед постановкой задачи.
+func (s *ThumbnailService) RegenerateThumbnails(mediaList []*storage.Media) (queued, pending int) {
+	i := 0
+	for ; i < len(mediaList) && s.pool.QueueLength() < s.pool.QueueCapacity(); i++ {
+		if s.regenerate(mediaList[i], s.pool.Submit) {
+			queued++
+		}
+	}
+
+	rest := mediaList[i:]
+	if len(rest) > 0 {
+		s.pool.Feed(func(ctx context.Context) {
+			fed := 0
+			for _, m := range rest {
+				if ctx.Err() != nil {
+					break // Пул остановлен: превью оставшихся не трогаем
+				}
+				if s.regenerate(m, s.pool.SubmitBlocking) {
+					fed++
+				}
+			}
+			logger.InfoLog.Printf("Regenerating thumbnails: queued %d of %d pending in background", fed, len(rest))
+		})
+	}
+
+	logger.InfoLog.Printf("Regenerating thumbnails: queued %d, pending %d", queued, len(rest))
+	return queued, len(rest)
+}
+
+// regenerate удаляет превью медиа и ставит small через submit
+func (s *ThumbnailService) regenerate(m *storage.Media, submit func(task *Task) bool) bool {
+	s.thumbGen.DeleteThumbnails(m.ID)
+	s.mu.Lock()
+	for _, size := range []string{"small", "medium", "large"} {
+		delete(s.failed, m.ID+":"+size) // После смены режима формат мог стать поддерживаемым
+	}
+	s.mu.Unlock()
+
+	return s.queueThumbnail(m.ID, "small", submit)
+}
+
+// sortForPregeneration упорядочивает медиа для генерации: сначала приоритетная группа
+// (избранное или медиа из альбомов), внутри групп и для остальных — от новых к старым
+func (s *ThumbnailService) sortForPregeneration(candidates []*storage.Media, order string) error {
+	rank := func(m *storage.Media) int { return 0 }
+
+	switch order {
+	case "favorites_first":
+		favorites, err := s.store.FavoriteMediaIDs()
+		if err != nil {
+			return fmt.Errorf("failed to list favorites: %w", err)
+		}
+		rank = func(m *storage.Media) int {
+			if m.IsFavorite || favorites[m.ID] {
+				return 0
+			}
+			return 1
+		}
+	case "by_album":
+		albumRank, err := s.albumRanks()
+		if err != nil {
+			return err
+		}
+		rank = func(m *storage.Media) int {
+			if r, ok := albumRank[m.ID]; ok {
+				return r
 			}
+			return math.MaxInt // Вне альбомов — после всех альбомов
 		}
 	}
 
-	logger.InfoLog.Printf("Queued %d thumbnail generation tasks", queued)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ri, rj := rank(candidates[i]), rank(candidates[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return candidates[i].Date().After(candidates[j].Date())
+	})
 	return nil
 }
 
-func (s *ThumbnailService) handleThumbnail(ctx context.Context, task *Task) (*TaskResult, error) {
+// albumRanks номер альбома для каждого медиа: альбомы по убыванию UpdatedAt,
+// медиа из нескольких альбомов получает номер самого свежего
+func (s *ThumbnailService) albumRanks() (map[string]int, error) {
+	albums, err := s.store.ListAlbums()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list albums: %w", err)
+	}
+	sort.SliceStable(albums, func(i, j int) bool {
+		return albums[i].UpdatedAt.After(albums[j].UpdatedAt)
+	})
+
+	ranks := make(map[string]int)
+	for i, album := range albums {
+		for _, id := range album.MediaIDs {
+			if _, ok := ranks[id]; !ok {
+				ranks[id] = i
+			}
+		}
+	}
+	return ranks, nil
+}
+
+func (s *ThumbnailService) handleThumbnail(ctx context.Context, task *Task) (result *TaskResult, err error) {
 	key := task.MediaID + ":" + task.Size
 	defer func() {
 		// Очищаем processing только если не было постоянной ошибки
-		// (markAsFailed сам очищает processing)
+		// (markAsFailed сам очищает processing) и задача не будет повторена
+		if s.pool.WillRetry(task, err) {
+			return
+		}
 		s.mu.Lock()
 		if _, failed := s.failed[key]; !failed {
 			delete(s.processing, key)
@@ -129,15 +265,6 @@ func (s *ThumbnailService) handleThumbnail(ctx context.Context, task *Task) (*Ta
 		s.mu.Unlock()
 	}()
 
-	// Получаем медиа из БД
-	m, err := s.store.GetMedia(task.MediaID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get media: %w", err)
-	}
-	if m == nil {
-		return nil, fmt.Errorf("media not found: %s", task.MediaID)
-	}
-
 	// Проверяем контекст
 	select {
 	case <-ctx.Done():
@@ -145,20 +272,15 @@ func (s *ThumbnailService) handleThumbnail(ctx context.Context, task *Task) (*Ta
 	default:
 	}
 
-	// Генерируем превью
 	start := time.Now()
-	logger.InfoLog.Printf("Generating thumbnail for %s/%s (file: %s)", task.MediaID[:16], task.Size, m.Filename)
-	thumbPath, err := s.thumbGen.GenerateThumbnail(m, task.Size)
+	thumbPath, err := s.generate(task.MediaID, task.Size)
 	duration := time.Since(start)
 
 	if err != nil {
-		logger.InfoLog.Printf("ERROR: Failed to generate thumbnail for %s/%s: %v", task.MediaID[:16], task.Size, err)
-
-		// Проверяем, является ли ошибка постоянной
+		// Постоянные ошибки (формат, повреждение) не повторяем, временные — пул повторит с паузой
 		if isPermanentError(err) {
-			s.markAsFailed(task.MediaID, task.Size, err.Error())
+			err = Permanent(err)
 		}
-
 		return &TaskResult{
 			TaskID:   task.ID,
 			Success:  false,
@@ -167,10 +289,79 @@ func (s *ThumbnailService) handleThumbnail(ctx context.Context, task *Task) (*Ta
 		}, err
 	}
 
-	logger.InfoLog.Printf("SUCCESS: Generated thumbnail for %s/%s in %v -> %s", task.MediaID[:16], task.Size, duration, thumbPath)
+	return &TaskResult{
+		TaskID:     task.ID,
+		Success:    true,
+		Duration:   duration,
+		OutputPath: thumbPath,
+	}, nil
+}
+
+// GenerateNow синхронно генерирует превью, ожидая не дольше ctx.
+// Одновременные вызовы (и задача из очереди) для одного mediaID+size выполняют генерацию один раз.
+func (s *ThumbnailService) GenerateNow(ctx context.Context, mediaID, size string) (string, error) {
+	if hasFailed, errMsg := s.HasFailed(mediaID, size); hasFailed {
+		return "", fmt.Errorf("thumbnail generation failed: %s", errMsg)
+	}
+
+	ch := s.inflight.DoChan(mediaID+":"+size, func() (interface{}, error) {
+		return s.generateOnce(mediaID, size)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	case <-ctx.Done():
+		// Генерация продолжится в фоне, результат получит следующий запрос
+		return "", ctx.Err()
+	}
+}
+
+// generate генерирует превью через singleflight
+func (s *ThumbnailService) generate(mediaID, size string) (string, error) {
+	path, err, _ := s.inflight.Do(mediaID+":"+size, func() (interface{}, error) {
+		return s.generateOnce(mediaID, size)
+	})
+	if err != nil {
+		return "", err
+	}
+	return path.(string), nil
+}
+
+// generateOnce генерирует превью и сохраняет путь к нему в БД
+func (s *ThumbnailService) generateOnce(mediaID, size string) (interface{}, error) {
+	// Получаем медиа из БД
+	m, err := s.store.GetMedia(mediaID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media: %w", err)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("media not found: %s", mediaID)
+	}
+
+	// Генерируем превью
+	start := time.Now()
+	logger.InfoLog.Printf("Generating thumbnail for %s/%s (file: %s)", mediaID[:16], size, m.Filename)
+	thumbPath, err := s.thumbGen.GenerateThumbnail(m, size)
+	duration := time.Since(start)
+
+	if err != nil {
+		logger.InfoLog.Printf("ERROR: Failed to generate thumbnail for %s/%s: %v", mediaID[:16], size, err)
+
+		// Проверяем, является ли ошибка постоянной
+		if isPermanentError(err) {
+			s.markAsFailed(mediaID, size, err.Error())
+		}
+		return nil, err
+	}
+
+	logger.InfoLog.Printf("SUCCESS: Generated thumbnail for %s/%s in %v -> %s", mediaID[:16], size, duration, thumbPath)
 
 	// Обновляем путь к превью в БД
-	switch task.Size {
+	switch size {
 	case "small":
 		m.ThumbSmall = thumbPath
 	case "large":
@@ -181,12 +372,7 @@ func (s *ThumbnailService) handleThumbnail(ctx context.Context, task *Task) (*Ta
 		logger.InfoLog.Printf("Failed to update media thumbnail path: %v", err)
 	}
 
-	return &TaskResult{
-		TaskID:     task.ID,
-		Success:    true,
-		Duration:   duration,
-		OutputPath: thumbPath,
-	}, nil
+	return thumbPath, nil
 }
 
 // IsProcessing проверяет, обрабатывается ли медиа
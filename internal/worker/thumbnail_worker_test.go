@@ -0,0 +1,308 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/config"
+	"github.com/photocore/photocore/internal/media"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// pregenerationFixture сохраняет медиа с датами съемки по дням 2020-01-01+i
+// в порядке names и возвращает их ID по имени
+func pregenerationFixture(tb testing.TB, store *storage.Store, names ...string) map[string]string {
+	tb.Helper()
+	ids := make(map[string]string, len(names))
+	for i, name := range names {
+		path := "/library/" + name + ".jpg"
+		m := &storage.Media{
+			ID:       storage.GenerateID(path),
+			Path:     path,
+			Dir:      "/library",
+			Filename: name + ".jpg",
+			Type:     storage.MediaTypeImage,
+			TakenAt:  time.Date(2020, 1, 1+i, 12, 0, 0, 0, time.UTC),
+		}
+		if err := store.SaveMedia(m); err != nil {
+			tb.Fatal(err)
+		}
+		ids[name] = m.ID
+	}
+	return ids
+}
+
+// queuedOrder запускает PregenerateThumbnails на непущенном пуле с одним воркером
+// и возвращает имена медиа в порядке обработки задач
+func queuedOrder(tb testing.TB, store *storage.Store, ids map[string]string, order string) []string {
+	tb.Helper()
+	dir := tb.TempDir()
+	cfg := &config.Config{}
+	cfg.Storage.CachePath = filepath.Join(dir, "cache")
+	thumbGen := media.NewThumbnailGenerator(cfg)
+
+	p := NewPool(1, 100, nil)
+	svc := NewThumbnailService(p, store, thumbGen)
+	if err := svc.PregenerateThumbnails(order); err != nil {
+		tb.Fatal(err)
+	}
+
+	names := make(map[string]string, len(ids))
+	for name, id := range ids {
+		names[id] = name
+	}
+	var mu sync.Mutex
+	var got []string
+	p.RegisterHandler(TaskGenerateThumbnail, func(ctx context.Context, task *Task) (*TaskResult, error) {
+		mu.Lock()
+		got = append(got, names[task.MediaID])
+		mu.Unlock()
+		return &TaskResult{TaskID: task.ID, Success: true}, nil
+	})
+	p.Start()
+	defer p.Stop()
+
+	waitFor(tb, "pregeneration tasks", func() bool { return p.Stats().CompletedTasks == int64(len(ids)) })
+	mu.Lock()
+	defer mu.Unlock()
+	return got
+}
+
+func assertOrder(tb testing.TB, got []string, want ...string) {
+	tb.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		tb.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestPregenerateNewestFirst(t *testing.T) {
+	_, store, _ := newTestScanner(t)
+	ids := pregenerationFixture(t, store, "oldest", "middle", "newest")
+
+	assertOrder(t, queuedOrder(t, store, ids, "newest_first"), "newest", "middle", "oldest")
+}
+
+func TestPregenerateFavoritesFirst(t *testing.T) {
+	_, store, _ := newTestScanner(t)
+	ids := pregenerationFixture(t, store, "oldest", "middle", "newest", "latest")
+	if err := store.SetFavorite(ids["oldest"], true); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetUserFavorite("user-1", ids["middle"], true); err != nil {
+		t.Fatal(err)
+	}
+
+	assertOrder(t, queuedOrder(t, store, ids, "favorites_first"), "middle", "oldest", "latest", "newest")
+}
+
+func TestPregenerateByAlbum(t *testing.T) {
+	_, store, _ := newTestScanner(t)
+	ids := pregenerationFixture(t, store, "a", "b", "c", "loose")
+	now := time.Now()
+	albums := []*storage.Album{
+		{ID: "album-old", Name: "Old", MediaIDs: []string{ids["a"], ids["b"]}, UpdatedAt: now.Add(-time.Hour)},
+		{ID: "album-new", Name: "New", MediaIDs: []string{ids["c"], ids["a"]}, UpdatedAt: now},
+	}
+	for _, album := range albums {
+		if err := store.SaveAlbum(album); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Свежий альбом первым (a попадает в него), затем старый, затем медиа вне альбомов
+	assertOrder(t, queuedOrder(t, store, ids, "by_album"), "c", "a", "b", "loose")
+}
+
+// regenerationFixture создает сервис превью над непущенным пулом с очередью queueSize
+// и файлы small для медиа ids
+func regenerationFixture(tb testing.TB, store *storage.Store, queueSize int, ids map[string]string) (*ThumbnailService, *Pool) {
+	tb.Helper()
+	cfg := &config.Config{}
+	cfg.Storage.CachePath = filepath.Join(tb.TempDir(), "cache")
+	thumbGen := media.NewThumbnailGenerator(cfg)
+	if err := thumbGen.EnsureCacheDir(); err != nil {
+		tb.Fatal(err)
+	}
+	for _, id := range ids {
+		if err := os.WriteFile(thumbGen.GetThumbnailPath(id, "small"), []byte("old"), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	p := NewPool(1, queueSize, nil)
+	return NewThumbnailService(p, store, thumbGen), p
+}
+
+func mediaByName(tb testing.TB, store *storage.Store, ids map[string]string, names ...string) []*storage.Media {
+	tb.Helper()
+	list := make([]*storage.Media, 0, len(names))
+	for _, name := range names {
+		m, err := store.GetMedia(ids[name])
+		if err != nil || m == nil {
+			tb.Fatalf("media %s: %v, %v", name, m, err)
+		}
+		list = append(list, m)
+	}
+	return list
+}
+
+func TestRegenerateThumbnailsFeedsRemainderInBackground(t *testing.T) {
+	_, store, _ := newTestScanner(t)
+	names := []string{"a", "b", "c", "d", "e"}
+	ids := pregenerationFixture(t, store, names...)
+	svc, p := regenerationFixture(t, store, 2, ids)
+
+	queued, pending := svc.RegenerateThumbnails(mediaByName(t, store, ids, names...))
+	if queued != 2 || pending != 3 {
+		t.Fatalf("queued/pending = %d/%d, want 2/3", queued, pending)
+	}
+
+	var mu sync.Mutex
+	handled := make(map[string]int)
+	p.RegisterHandler(TaskGenerateThumbnail, func(ctx context.Context, task *Task) (*TaskResult, error) {
+		mu.Lock()
+		handled[task.MediaID]++
+		mu.Unlock()
+		return &TaskResult{TaskID: task.ID, Success: true}, nil
+	})
+	p.Start()
+	defer p.Stop()
+
+	// Остаток досылается сам, без повторного вызова
+	waitFor(t, "regeneration tasks", func() bool { return p.Stats().CompletedTasks == int64(len(names)) })
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range names {
+		if handled[ids[name]] != 1 {
+			t.Errorf("%s handled %d times, want 1", name, handled[ids[name]])
+		}
+		if svc.thumbGen.ThumbnailExists(ids[name], "small") {
+			t.Errorf("old thumbnail of %s was not deleted", name)
+		}
+	}
+}
+
+func TestRegenerateThumbnailsStopsWithPool(t *testing.T) {
+	_, store, _ := newTestScanner(t)
+	names := []string{"a", "b", "c", "d", "e"}
+	ids := pregenerationFixture(t, store, names...)
+	svc, p := regenerationFixture(t, store, 2, ids)
+
+	// Пул не запущен: a и b в очереди, c ждет места в фоне
+	svc.RegenerateThumbnails(mediaByName(t, store, ids, names...))
+	waitFor(t, "background feeder", func() bool { return svc.IsProcessing(ids["c"], "small") })
+	p.Stop()
+
+	for _, name := range []string{"d", "e"} {
+		if !svc.thumbGen.ThumbnailExists(ids[name], "small") {
+			t.Errorf("thumbnail of %s was deleted after the pool stopped", name)
+		}
+	}
+	if svc.IsProcessing(ids["c"], "small") {
+		t.Error("task that never reached the queue is still marked as processing")
+	}
+}
+
+// slowVideoFixture видео, кадр которого заглушка ffmpeg отдает через delay секунд,
+// записывая каждый вызов в calls.log. Возвращает сервис над пущенным пулом, ID медиа и журнал
+func slowVideoFixture(tb testing.TB, delay string) (*ThumbnailService, string, string) {
+	tb.Helper()
+	dir := tb.TempDir()
+	frame := filepath.Join(dir, "frame.jpg")
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.WriteFile(frame, buf.Bytes(), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	calls := filepath.Join(dir, "calls.log")
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	script := fmt.Sprintf("#!/bin/sh\necho call >> %q\nsleep %s\ncat %q\n", calls, delay, frame)
+	if err := os.WriteFile(ffmpeg, []byte(script), 0755); err != nil {
+		tb.Fatal(err)
+	}
+
+	// Заголовок MP4 (ftyp), чтобы проверка формата пропустила файл
+	video := filepath.Join(dir, "clip.mp4")
+	if err := os.WriteFile(video, []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), 0644); err != nil {
+		tb.Fatal(err)
+	}
+
+	_, store, _ := newTestScanner(tb)
+	m := &storage.Media{ID: storage.GenerateID(video), Path: video, Dir: dir, Filename: "clip.mp4", Type: storage.MediaTypeVideo}
+	if err := store.SaveMedia(m); err != nil {
+		tb.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Storage.CachePath = filepath.Join(dir, "cache")
+	cfg.Thumbnails.Small, cfg.Thumbnails.Quality = 8, 80
+	cfg.Tools.Ffmpeg = ffmpeg
+	p := NewPool(2, 10, nil)
+	svc := NewThumbnailService(p, store, media.NewThumbnailGenerator(cfg))
+	p.Start()
+	tb.Cleanup(p.Stop)
+	return svc, m.ID, calls
+}
+
+// ffmpegCalls число запусков заглушки ffmpeg
+func ffmpegCalls(tb testing.TB, calls string) int {
+	tb.Helper()
+	data, err := os.ReadFile(calls)
+	if err != nil && !os.IsNotExist(err) {
+		tb.Fatal(err)
+	}
+	return strings.Count(string(data), "call")
+}
+
+func TestGenerateNowCoalescesConcurrentRequests(t *testing.T) {
+	svc, id, calls := slowVideoFixture(t, "0.3")
+
+	const waiters = 5
+	paths := make([]string, waiters)
+	errs := make([]error, waiters)
+	var wg sync.WaitGroup
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			paths[i], errs[i] = svc.GenerateNow(context.Background(), id, "small")
+		}(i)
+	}
+	svc.QueueThumbnail(id, "small") // Задача из очереди присоединяется к той же генерации
+	wg.Wait()
+
+	for i := 0; i < waiters; i++ {
+		if errs[i] != nil || paths[i] == "" || paths[i] != paths[0] {
+			t.Errorf("waiter %d = %q, %v; want the shared path %q", i, paths[i], errs[i], paths[0])
+		}
+	}
+	waitFor(t, "queued task", func() bool { return !svc.IsProcessing(id, "small") })
+	if n := ffmpegCalls(t, calls); n != 1 {
+		t.Errorf("ffmpeg ran %d times, want 1", n)
+	}
+}
+
+func TestGenerateNowTimeoutKeepsGenerating(t *testing.T) {
+	svc, id, _ := slowVideoFixture(t, "0.3")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := svc.GenerateNow(ctx, id, "small"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GenerateNow error = %v, want deadline exceeded", err)
+	}
+
+	// Ожидание прервано, но превью дописывается в фоне
+	waitFor(t, "background thumbnail", func() bool { return svc.thumbGen.ThumbnailExists(id, "small") })
+}
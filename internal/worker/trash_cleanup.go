@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/photocore/photocore/internal/logger"
+	"github.com/photocore/photocore/internal/media"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+// trashCleanupInterval как часто проверять корзину
+const trashCleanupInterval = 24 * time.Hour
+
+// TrashCleaner окончательно удаляет медиа, пролежавшие в корзине дольше срока хранения:
+// файл с диска, превью и запись в БД (как при ручной очистке корзины)
+type TrashCleaner struct {
+	store    *storage.Store
+	thumbGen *media.ThumbnailGenerator
+
+	mu        sync.Mutex
+	retention time.Duration // 0 — автоматическая очистка выключена
+
+	stopOnce sync.Once
+	stopChan chan struct{}
+}
+
+// NewTrashCleaner создает задачу очистки корзины со сроком хранения retentionDays дней
+func NewTrashCleaner(store *storage.Store, thumbGen *media.ThumbnailGenerator, retentionDays int) *TrashCleaner {
+	c := &TrashCleaner{
+		store:    store,
+		thumbGen: thumbGen,
+		stopChan: make(chan struct{}),
+	}
+	c.SetRetention(retentionDays)
+	return c
+}
+
+// SetRetention меняет срок хранения (при перезагрузке конфигурации); 0 — не очищать
+func (c *TrashCleaner) SetRetention(retentionDays int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retention = time.Duration(max(retentionDays, 0)) * 24 * time.Hour
+}
+
+// Start запускает очистку сразу и далее раз в сутки
+func (c *TrashCleaner) Start() {
+	go func() {
+		ticker := time.NewTicker(trashCleanupInterval)
+		defer ticker.Stop()
+		for {
+			c.RunOnce()
+			select {
+			case <-c.stopChan:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop останавливает периодическую очистку
+func (c *TrashCleaner) Stop() {
+	c.stopOnce.Do(func() { close(c.stopChan) })
+}
+
+// RunOnce удаляет просроченные медиа из корзины и возвращает их количество
+func (c *TrashCleaner) RunOnce() (int, error) {
+	c.mu.Lock()
+	retention := c.retention
+	c.mu.Unlock()
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	deleted, err := c.store.CleanupTrash(retention, c.thumbGen.PurgeFiles)
+	if err != nil {
+		logger.ErrorLog.Printf("Trash cleanup failed: %v", err)
+		return deleted, err
+	}
+	logger.InfoLog.Printf("Trash cleanup: %d expired items purged", deleted)
+	return deleted, nil
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/photocore/photocore/internal/config"
+	"github.com/photocore/photocore/internal/media"
+	"github.com/photocore/photocore/internal/storage"
+)
+
+func TestTrashCleanerPurgesExpiredMedia(t *testing.T) {
+	_, store, root := newTestScanner(t)
+	cfg := &config.Config{}
+	cfg.Storage.CachePath = filepath.Join(t.TempDir(), "cache")
+	cleaner := NewTrashCleaner(store, media.NewThumbnailGenerator(cfg), 30)
+
+	// trashedAgo сохраняет медиа с файлом, удаленное в корзину days дней назад (-1 — не в корзине)
+	trashedAgo := func(name string, days int) *storage.Media {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte("jpeg"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		m := &storage.Media{ID: storage.GenerateID(path), Path: path, Dir: root, Filename: name, Type: storage.MediaTypeImage}
+		if days >= 0 {
+			deleted := time.Now().AddDate(0, 0, -days)
+			m.DeletedAt = &deleted
+		}
+		if err := store.SaveMedia(m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	expired := trashedAgo("expired.jpg", 31)
+	recent := trashedAgo("recent.jpg", 29)
+	live := trashedAgo("live.jpg", -1)
+
+	// Срок хранения 0 — очистка выключена
+	cleaner.SetRetention(0)
+	if deleted, err := cleaner.RunOnce(); err != nil || deleted != 0 {
+		t.Fatalf("disabled cleanup = %d, %v; want nothing deleted", deleted, err)
+	}
+
+	cleaner.SetRetention(30)
+	if deleted, err := cleaner.RunOnce(); err != nil || deleted != 1 {
+		t.Fatalf("cleanup = %d, %v; want 1 expired item", deleted, err)
+	}
+	if m, _ := store.GetMedia(expired.ID); m != nil {
+		t.Error("expired record is still stored")
+	}
+	if _, err := os.Stat(expired.Path); !os.IsNotExist(err) {
+		t.Errorf("expired file was not deleted: %v", err)
+	}
+	for _, m := range []*storage.Media{recent, live} {
+		if got, _ := store.GetMedia(m.ID); got == nil {
+			t.Errorf("%s was deleted before its retention ended", m.Filename)
+		}
+		if _, err := os.Stat(m.Path); err != nil {
+			t.Errorf("%s file was removed: %v", m.Filename, err)
+		}
+	}
+}